@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   {
+     "ietf-netconf-acm:nacm" : {
+       "enable-nacm" : true,
+       "read-default" : "permit",
+       "write-default" : "deny",
+       "exec-default" : "permit",
+       "groups" : {
+         "group" : [ { "name" : "admin", "user-name" : [ "alice" ] } ]
+       },
+       "rule-list" : [
+         {
+           "name" : "admin-acl",
+           "group" : [ "admin" ],
+           "rule" : [
+             { "name" : "permit-all", "module-name" : "*",
+               "access-operations" : "*", "action" : "permit" }
+           ]
+         }
+       ]
+     }
+   }
+*/
+
+var (
+	ACCESS_CREATE = "create"
+	ACCESS_READ   = "read"
+	ACCESS_UPDATE = "update"
+	ACCESS_DELETE = "delete"
+	ACCESS_EXEC   = "exec"
+
+	ACTION_PERMIT = "permit"
+	ACTION_DENY   = "deny"
+)
+
+// NACM holds access control rules in the form of the nacm container of
+// ietf-netconf-acm (RFC 8341). Rule paths are instance-identifiers in the
+// JSON encoding, i.e. qualified by module names rather than prefixes.
+type NACM struct {
+	EnableNACM   *bool  `json:"enable-nacm"`
+	ReadDefault  string `json:"read-default"`
+	WriteDefault string `json:"write-default"`
+	ExecDefault  string `json:"exec-default"`
+
+	Groups struct {
+		Group []NACMGroup `json:"group"`
+	} `json:"groups"`
+
+	RuleList []NACMRuleList `json:"rule-list"`
+}
+
+type NACMGroup struct {
+	Name     string   `json:"name"`
+	UserName []string `json:"user-name"`
+}
+
+type NACMRuleList struct {
+	Name  string     `json:"name"`
+	Group []string   `json:"group"`
+	Rule  []NACMRule `json:"rule"`
+}
+
+type NACMRule struct {
+	Name             string `json:"name"`
+	ModuleName       string `json:"module-name"`
+	RpcName          string `json:"rpc-name"`
+	NotificationName string `json:"notification-name"`
+	Path             string `json:"path"`
+	AccessOperations string `json:"access-operations"`
+	Action           string `json:"action"`
+}
+
+type NACMJson struct {
+	NACM NACM `json:"ietf-netconf-acm:nacm"`
+}
+
+// LoadNACM reads the access control rules from a JSON encoded
+// ietf-netconf-acm:nacm document.
+func LoadNACM(file string) (*NACM, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc NACMJson
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+
+	nacm := &doc.NACM
+	for _, list := range nacm.RuleList {
+		for _, rule := range list.Rule {
+			if rule.Action != ACTION_PERMIT && rule.Action != ACTION_DENY {
+				return nil, fmt.Errorf("%s: rule %s has invalid action %q", file, rule.Name, rule.Action)
+			}
+		}
+	}
+	return nacm, nil
+}
+
+// An accessRequest is a single access to check: op on the node of module
+// mod at the qualified schema path path. Top-level rpcs are named by rpc.
+type accessRequest struct {
+	op     string
+	module string
+	path   []string
+	rpc    string
+}
+
+// groups returns the groups user is a member of.
+func (nacm *NACM) groups(user string) map[string]bool {
+	groups := make(map[string]bool)
+	for _, group := range nacm.Groups.Group {
+		for _, name := range group.UserName {
+			if name == user {
+				groups[group.Name] = true
+			}
+		}
+	}
+	return groups
+}
+
+// permit reports whether user is allowed the access ar, following the
+// procedure of RFC 8341 sections 3.4.4 to 3.4.6: the first matching rule of
+// the rule-lists for the user's groups decides, otherwise the default for the
+// kind of access does.
+func (nacm *NACM) permit(user string, ar accessRequest) bool {
+	if nacm == nil || (nacm.EnableNACM != nil && !*nacm.EnableNACM) {
+		return true
+	}
+
+	groups := nacm.groups(user)
+	for _, list := range nacm.RuleList {
+		member := false
+		for _, group := range list.Group {
+			if group == "*" || groups[group] {
+				member = true
+				break
+			}
+		}
+		if !member {
+			continue
+		}
+		for _, rule := range list.Rule {
+			if rule.matches(ar) {
+				return rule.Action == ACTION_PERMIT
+			}
+		}
+	}
+
+	var def string
+	switch ar.op {
+	case ACCESS_READ:
+		def = nacm.ReadDefault
+		if def == "" {
+			def = ACTION_PERMIT
+		}
+	case ACCESS_EXEC:
+		def = nacm.ExecDefault
+		if def == "" {
+			def = ACTION_PERMIT
+		}
+	default:
+		def = nacm.WriteDefault
+		if def == "" {
+			def = ACTION_DENY
+		}
+	}
+	return def == ACTION_PERMIT
+}
+
+func (rule *NACMRule) matches(ar accessRequest) bool {
+	if rule.ModuleName != "" && rule.ModuleName != "*" && rule.ModuleName != ar.module {
+		return false
+	}
+
+	ops := rule.AccessOperations
+	if ops != "" && ops != "*" {
+		found := false
+		for _, op := range strings.Fields(ops) {
+			if op == ar.op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case rule.RpcName != "":
+		return ar.rpc != "" && (rule.RpcName == "*" || rule.RpcName == ar.rpc)
+	case rule.NotificationName != "":
+		return false
+	case rule.Path != "":
+		if ar.rpc != "" {
+			return false
+		}
+		path := rulePath(rule.Path)
+		if len(path) > len(ar.path) {
+			return false
+		}
+		for i := range path {
+			if path[i] != ar.path[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// rulePath splits a rule path into module qualified node names, dropping
+// predicates. Unqualified names take the module of the node above.
+func rulePath(p string) []string {
+	var path []string
+	var mod string
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		if i := strings.Index(part, "["); i >= 0 {
+			part = part[:i]
+		}
+		if part == "" {
+			continue
+		}
+		m, name := splitName(part)
+		if m != "" {
+			mod = m
+		}
+		path = append(path, mod+":"+name)
+	}
+	return path
+}
+
+// qualifiedPath returns the module qualified names of the data nodes from
+// the top of the schema down to e.
+func (schema *Schema) qualifiedPath(e *yang.Entry) []string {
+	var path []string
+	for ; e != nil && e.Parent != nil; e = e.Parent {
+		if e.IsChoice() || e.IsCase() {
+			continue
+		}
+		path = append([]string{schema.ModuleOf(e) + ":" + e.Name}, path...)
+	}
+	return path
+}
+
+// permit reports whether the user of req may perform op on the node e.
+func (restconf *RestConf) permit(req *http.Request, op string, e *yang.Entry) bool {
+	if restconf.nacm == nil {
+		return true
+	}
+
+	ar := accessRequest{op: op, module: restconf.schemaOf(req).ModuleOf(e)}
+	if isOperation(e) && !isAction(e) {
+		ar.rpc = e.Name
+	} else {
+		ar.path = restconf.schemaOf(req).qualifiedPath(e)
+	}
+	return restconf.nacm.permit(requestUser(req), ar)
+}
+
+// permitTree reports whether the user of req may perform op on the node e
+// and every node of the data tree v written to it.
+func (restconf *RestConf) permitTree(req *http.Request, op string, e *yang.Entry, v interface{}) bool {
+	if !restconf.permit(req, op, e) {
+		return false
+	}
+	if !e.IsDir() {
+		return true
+	}
+
+	var entries []interface{}
+	if values, ok := v.([]interface{}); ok {
+		entries = values
+	} else {
+		entries = []interface{}{v}
+	}
+	for _, entry := range entries {
+		dir, _ := entry.(map[string]interface{})
+		for name, cv := range dir {
+			if child := findDataChild(e, name); child != nil && !restconf.permitTree(req, op, child, cv) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// filterRead removes the nodes the user of req may not read from the data
+// tree v of the node e.
+func (restconf *RestConf) filterRead(req *http.Request, e *yang.Entry, v interface{}) interface{} {
+	if restconf.nacm == nil || !e.IsDir() {
+		return v
+	}
+
+	if values, ok := v.([]interface{}); ok {
+		for i, value := range values {
+			values[i] = restconf.filterRead(req, e, value)
+		}
+		return values
+	}
+
+	dir, _ := v.(map[string]interface{})
+	for name, cv := range dir {
+		child := findDataChild(e, name)
+		if child == nil || !restconf.permit(req, ACCESS_READ, child) {
+			delete(dir, name)
+			continue
+		}
+		dir[name] = restconf.filterRead(req, child, cv)
+	}
+	return dir
+}
+
+func accessDenied(op string, e *yang.Entry) *RestConfError {
+	return NewError(http.StatusForbidden, ERROR_TYPE_PROTOCOL,
+		ERROR_TAG_ACCESS_DENIED, "%s access to %s is denied", op, e.Name)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testNACM() *NACM {
+	nacm := &NACM{WriteDefault: ACTION_DENY}
+	nacm.Groups.Group = []NACMGroup{
+		{Name: "admin", UserName: []string{"alice"}},
+		{Name: "oper", UserName: []string{"bob"}},
+	}
+	nacm.RuleList = []NACMRuleList{
+		{
+			Name:  "admin-acl",
+			Group: []string{"admin"},
+			Rule: []NACMRule{
+				{Name: "permit-all", ModuleName: "*", AccessOperations: "*", Action: ACTION_PERMIT},
+			},
+		},
+		{
+			Name:  "oper-acl",
+			Group: []string{"oper"},
+			Rule: []NACMRule{
+				{Name: "hide-interfaces", Path: "/test:system/interface", AccessOperations: "read", Action: ACTION_DENY},
+				{Name: "deny-reboot", ModuleName: "test", RpcName: "reboot", Action: ACTION_DENY},
+			},
+		},
+	}
+	return nacm
+}
+
+func TestNACMPermit(t *testing.T) {
+	nacm := testNACM()
+
+	interfaces := []string{"test:system", "test:interface"}
+	tests := []struct {
+		user string
+		ar   accessRequest
+		want bool
+	}{
+		{"alice", accessRequest{op: ACCESS_UPDATE, module: "test", path: interfaces}, true},
+		{"bob", accessRequest{op: ACCESS_READ, module: "test", path: interfaces}, false},
+		{"bob", accessRequest{op: ACCESS_READ, module: "test", path: append(interfaces, "test:mtu")}, false},
+		{"bob", accessRequest{op: ACCESS_READ, module: "test", path: []string{"test:system", "test:hostname"}}, true},
+		{"bob", accessRequest{op: ACCESS_UPDATE, module: "test", path: []string{"test:system"}}, false},
+		{"bob", accessRequest{op: ACCESS_EXEC, module: "test", rpc: "reboot"}, false},
+		{"bob", accessRequest{op: ACCESS_EXEC, module: "test", rpc: "ping"}, true},
+		{"eve", accessRequest{op: ACCESS_READ, module: "test", path: interfaces}, true},
+		{"eve", accessRequest{op: ACCESS_DELETE, module: "test", path: interfaces}, false},
+	}
+
+	for _, test := range tests {
+		if got := nacm.permit(test.user, test.ar); got != test.want {
+			t.Errorf("permit(%s, %+v) = %v, want %v", test.user, test.ar, got, test.want)
+		}
+	}
+
+	disabled := false
+	nacm.EnableNACM = &disabled
+	if !nacm.permit("eve", accessRequest{op: ACCESS_DELETE, module: "test"}) {
+		t.Errorf("disabled nacm denied access")
+	}
+}
+
+func TestNACMData(t *testing.T) {
+	server := testServer(t)
+	server.nacm = testNACM()
+	server.users = testUsers(t, "alice", "bob")
+
+	steps := []struct {
+		user   string
+		method string
+		url    string
+		body   string
+		status int
+		want   string
+	}{
+		{"", "GET", "/restconf/data/test:system", "", http.StatusUnauthorized, ""},
+		{"alice", "PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0}]}}`, http.StatusCreated, ""},
+		{"alice", "GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0}]}}`},
+		{"bob", "GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"a"}}`},
+		{"bob", "GET", "/restconf/data/test:system/interface=eth0,0", "", http.StatusNotFound, ""},
+		{"bob", "PATCH", "/restconf/data/test:system", `{"test:system":{"hostname":"b"}}`, http.StatusForbidden, ""},
+		{"bob", "POST", "/restconf/operations/test:reboot", `{"test:input":{"delay":1}}`, http.StatusForbidden, ""},
+		{"bob", "POST", "/restconf/operations/test:ping", "", http.StatusNotImplemented, ""},
+	}
+
+	for i, step := range steps {
+		req := httptest.NewRequest(step.method, step.url, strings.NewReader(step.body))
+		req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+		if step.user != "" {
+			req.SetBasicAuth(step.user, step.user+"-secret")
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != step.status {
+			t.Fatalf("step %d: %s %s as %q: got status %d, want %d: %s",
+				i, step.method, step.url, step.user, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Fatalf("step %d: got body %s, want %s", i, rsp.Body, step.want)
+		}
+	}
+}
+
+func TestNACMOperationsListing(t *testing.T) {
+	server := testServer(t)
+	server.nacm = testNACM()
+	server.nacm.RuleList = append(server.nacm.RuleList, NACMRuleList{
+		Name:  "anonymous-acl",
+		Group: []string{"*"},
+		Rule: []NACMRule{
+			{Name: "deny-ping", ModuleName: "test", RpcName: "ping", AccessOperations: "exec", Action: ACTION_DENY},
+		},
+	})
+
+	for _, test := range []struct {
+		user string
+		want string
+	}{
+		{"alice", `{"ietf-restconf:operations":{"test:ping":[null],"test:reboot":[null]}}`},
+		{"bob", `{"ietf-restconf:operations":{}}`},
+		{"", `{"ietf-restconf:operations":{"test:reboot":[null]}}`},
+	} {
+		req := httptest.NewRequest("GET", "/restconf/operations", nil)
+		rsp := httptest.NewRecorder()
+		server.listOperations(rsp, withUser(req, test.user))
+		if rsp.Body.String() != test.want {
+			t.Errorf("operations of %q: got %s, want %s", test.user, rsp.Body, test.want)
+		}
+	}
+}
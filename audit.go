@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+   {"time":"2024-01-01T00:00:00Z","request-id":"...","client":"192.0.2.10","user":"alice","method":"PUT",
+    "path":"/restconf/data/test:system","before":{"test:system":{...}},"after":{"test:system":{...}}}
+
+   The records of the audit file are written as the edits commit, and synced
+   to disk by a goroutine of the file, so that the edits waiting for the
+   datastore do not wait for the disk as well. The syncs of the records
+   written meanwhile are coalesced. With -audit-strict an edit waits for the
+   sync covering its records, which the edits committing meanwhile share,
+   and fails if it fails. Once a sync fails the following records sync the
+   file themselves before they are written, and fail with its error while it
+   fails.
+*/
+
+// An AuditRecord describes a single successful edit of the datastore. Before
+// and After are the JSON encoded data at Path, absent where there is none.
+type AuditRecord struct {
+	Time      string          `json:"time"`
+	RequestID string          `json:"request-id,omitempty"`
+	Client    string          `json:"client,omitempty"` // IP address of the client
+	User      string          `json:"user,omitempty"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// An AuditSink stores audit records. It must be safe for concurrent use.
+// Audit stores the records of a single transaction, none of them if it
+// fails.
+type AuditSink interface {
+	Audit(recs ...*AuditRecord) error
+}
+
+// A FileAudit appends audit records to a file as JSON lines.
+type FileAudit struct {
+	mu      sync.Mutex
+	synced  *sync.Cond // broadcast once a sync completed
+	f       *os.File
+	strict  bool          // Audit waits for its records to be synced
+	written uint64        // the writes of records made
+	covered uint64        // the writes the last sync covered
+	err     error         // the error of the last sync, nil if it succeeded
+	closed  bool          // set by Close
+	sync    chan struct{} // signals the syncer that records were written
+	done    chan struct{} // closed once the syncer returned
+}
+
+// OpenAudit opens the audit log file, created if it does not exist. When
+// strict is set Audit returns once its records are synced to disk.
+func OpenAudit(file string, strict bool) (*FileAudit, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	audit := &FileAudit{f: f, strict: strict, sync: make(chan struct{}, 1), done: make(chan struct{})}
+	audit.synced = sync.NewCond(&audit.mu)
+	go audit.syncer()
+	return audit, nil
+}
+
+func (audit *FileAudit) Audit(recs ...*AuditRecord) error {
+	// The records are written at once, so that no other record comes
+	// between them.
+	var lines []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.closed {
+		return os.ErrClosed
+	}
+	// After a failed sync the records wait for the disk until it recovers.
+	if audit.err != nil {
+		if audit.err = audit.f.Sync(); audit.err != nil {
+			return audit.err
+		}
+		audit.covered = audit.written
+	}
+	if _, err := audit.f.Write(lines); err != nil {
+		return err
+	}
+	audit.written++
+	write := audit.written
+	select {
+	case audit.sync <- struct{}{}:
+	default:
+		// A sync is pending already, it covers the records.
+	}
+
+	if !audit.strict {
+		return nil
+	}
+	for audit.covered < write {
+		audit.synced.Wait()
+	}
+	return audit.err
+}
+
+// syncer syncs the file whenever records were written since the last sync,
+// until the file is closed.
+func (audit *FileAudit) syncer() {
+	defer close(audit.done)
+	for range audit.sync {
+		audit.mu.Lock()
+		write := audit.written
+		audit.mu.Unlock()
+
+		err := audit.f.Sync()
+		if err != nil {
+			log.Println("sync audit log failed!", err.Error())
+		}
+		audit.mu.Lock()
+		audit.err = err
+		if write > audit.covered {
+			audit.covered = write
+		}
+		audit.synced.Broadcast()
+		audit.mu.Unlock()
+	}
+}
+
+// Close syncs the records written and closes the file.
+func (audit *FileAudit) Close() error {
+	audit.mu.Lock()
+	if audit.closed {
+		audit.mu.Unlock()
+		return os.ErrClosed
+	}
+	audit.closed = true
+	close(audit.sync)
+	audit.mu.Unlock()
+
+	<-audit.done
+	err := audit.f.Sync()
+	if cerr := audit.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// auditChanges records the changes of a single transaction of req in the
+// audit log, if there is one. Records that cannot be written are logged, and
+// fail the transaction in strict mode.
+func (restconf *RestConf) auditChanges(req *http.Request, changes []*Change) error {
+	if restconf.audit == nil || len(changes) == 0 {
+		return nil
+	}
+
+	now := restconf.now().UTC().Format(time.RFC3339Nano)
+	recs := make([]*AuditRecord, len(changes))
+	for i, c := range changes {
+		recs[i] = &AuditRecord{
+			Time:      now,
+			RequestID: requestIDOf(req),
+			Client:    clientAddr(req),
+			User:      requestUser(req),
+			Method:    req.Method,
+			Path:      c.Resource.URL(),
+			Before:    restconf.auditData(req, c.Resource, c.Before),
+			After:     restconf.auditData(req, c.Resource, c.After),
+		}
+	}
+
+	if err := restconf.audit.Audit(recs...); err != nil {
+		logRequest(req, "write audit record failed!", err.Error())
+		if restconf.auditStrict {
+			return NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+				ERROR_TAG_OPERATION_FAILED, "edit cannot be audited")
+		}
+	}
+	return nil
+}
+
+// auditData returns the JSON encoding of the data v at r, in the schema req
+// is served with, nil if v is nil.
+func (restconf *RestConf) auditData(req *http.Request, r *Resource, v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if r.Segment().Keys != nil {
+		v = []interface{}{v}
+	}
+	return restconf.schemaOf(req).encode(APPLICATION_DATA_JSON, r.Entry(), v)
+}
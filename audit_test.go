@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memoryAudit struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+	err     error
+	max     int // the records held before failing with errAuditFull, 0 for any
+}
+
+var errAuditFull = errors.New("audit full")
+
+func (audit *memoryAudit) Audit(recs ...*AuditRecord) error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.err != nil {
+		return audit.err
+	}
+	if audit.max > 0 && len(audit.records)+len(recs) > audit.max {
+		return errAuditFull
+	}
+	audit.records = append(audit.records, recs...)
+	return nil
+}
+
+func TestAuditEdits(t *testing.T) {
+	server := testServer(t)
+	audit := &memoryAudit{}
+	server.audit = audit
+
+	steps := []struct {
+		method, url, body string
+		status            int
+	}{
+		{"PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"a"}}`, http.StatusCreated},
+		{"PATCH", "/restconf/data/test:system", `{"test:system":{"hostname":"b"}}`, http.StatusNoContent},
+		{"PATCH", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"mtu":1500}]}`, http.StatusNotFound},
+		{"POST", "/restconf/data/test:system", `{"test:interface":[{"name":"eth0","unit":0}]}`, http.StatusCreated},
+		{"DELETE", "/restconf/data/test:system/interface=eth0,0", "", http.StatusNoContent},
+	}
+	for _, step := range steps {
+		if rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body); rsp.Code != step.status {
+			t.Fatalf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+	}
+
+	want := []struct {
+		method, path, before, after string
+	}{
+		{"PUT", "/restconf/data/test:system", "", `{"test:system":{"hostname":"a"}}`},
+		{"PATCH", "/restconf/data/test:system", `{"test:system":{"hostname":"a"}}`, `{"test:system":{"hostname":"b"}}`},
+		{"POST", "/restconf/data/test:system/interface=eth0,0", "", `{"test:interface":[{"name":"eth0","unit":0}]}`},
+		{"DELETE", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"name":"eth0","unit":0}]}`, ""},
+	}
+	if len(audit.records) != len(want) {
+		t.Fatalf("got %d audit records, want %d", len(audit.records), len(want))
+	}
+	for i, w := range want {
+		rec := audit.records[i]
+		if rec.Method != w.method || rec.Path != w.path || string(rec.Before) != w.before || string(rec.After) != w.after {
+			t.Errorf("record %d: got %s %s %s -> %s, want %s %s %s -> %s", i,
+				rec.Method, rec.Path, rec.Before, rec.After, w.method, w.path, w.before, w.after)
+		}
+		if rec.RequestID == "" || rec.Time == "" {
+			t.Errorf("record %d: missing request ID or time", i)
+		}
+	}
+}
+
+func TestAuditStrict(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		server := testServer(t)
+		server.audit = &memoryAudit{err: errors.New("disk full")}
+		server.auditStrict = strict
+
+		status := http.StatusCreated
+		if strict {
+			status = http.StatusInternalServerError
+		}
+		rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`)
+		if rsp.Code != status {
+			t.Fatalf("strict %v: got status %d, want %d: %s", strict, rsp.Code, status, rsp.Body)
+		}
+		if strict {
+			if rsp := doRequest(server, "GET", "/restconf/data/test:system", "", ""); rsp.Code != http.StatusNotFound {
+				t.Errorf("got status %d after a failed edit, want %d", rsp.Code, http.StatusNotFound)
+			}
+		}
+	}
+}
+
+func TestAuditStrictTransactions(t *testing.T) {
+	server := testServer(t)
+	audit := &memoryAudit{max: 1}
+	server.audit = audit
+	server.auditStrict = true
+	var events []*ChangeEvent
+	server.bus.Subscribe(nil, func(ev *ChangeEvent) { events = append(events, ev) })
+
+	// The changes of a transaction are audited together, none of them
+	// when they do not all fit.
+	rsp := doRequest(server, "PATCH", "/restconf/data", APPLICATION_YANG_PATCH_JSON, yangPatch("p",
+		`{"edit-id":"1","operation":"create","target":"/test:system/hostname","value":{"test:hostname":"a"}}`,
+		`{"edit-id":"2","operation":"create","target":"/test:system/ratio","value":{"test:ratio":"1.0"}}`))
+	if rsp.Code != http.StatusInternalServerError {
+		t.Fatalf("PATCH: got status %d, want %d: %s", rsp.Code, http.StatusInternalServerError, rsp.Body)
+	}
+	if len(audit.records) != 0 || len(events) != 0 {
+		t.Errorf("PATCH: got %d audit records and %d events of an abandoned patch", len(audit.records), len(events))
+	}
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system", "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("got status %d after a failed patch, want %d", rsp.Code, http.StatusNotFound)
+	}
+
+	// A move removes the source and creates the destination.
+	audit.max = 0
+	rsp = doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"interface":[{"name":"eth0","unit":0}]}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	audit.max = len(audit.records) + 1
+	events = nil
+	rsp = doRequest(server, "POST", "/restconf/data", APPLICATION_COPY_JSON,
+		`{"go-restconf:move":{"source":"/test:system/interface=eth0,0","destination":"/test:system/interface=eth1,0"}}`)
+	if rsp.Code != http.StatusInternalServerError {
+		t.Fatalf("move: got status %d, want %d: %s", rsp.Code, http.StatusInternalServerError, rsp.Body)
+	}
+	if len(audit.records) != audit.max-1 || len(events) != 0 {
+		t.Errorf("move: got %d audit records and %d events of an abandoned move", len(audit.records)-audit.max+1, len(events))
+	}
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system/interface=eth0,0", "", ""); rsp.Code != http.StatusOK {
+		t.Errorf("got status %d for the source of a failed move, want %d", rsp.Code, http.StatusOK)
+	}
+}
+
+func TestFileAudit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAudit(file, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := testServer(t)
+	server.audit = audit
+
+	for _, body := range []string{`{"test:system":{"hostname":"a"}}`, `{"test:system":{"hostname":"b"}}`} {
+		if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, body); rsp.Code >= 300 {
+			t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+		}
+	}
+	// In strict mode the records written at once wait for the same sync.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := audit.Audit(&AuditRecord{Method: "POST"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(text), "\n"), "\n")
+	if len(lines) != 10 || !strings.Contains(lines[1], `"after":{"test:system":{"hostname":"b"}}`) {
+		t.Errorf("got audit log %s", text)
+	}
+	if err := audit.Audit(&AuditRecord{Method: "PUT"}); err == nil {
+		t.Error("a record is written after the file is closed")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type contextKey string
+
+var userContextKey = contextKey("user")
+
+// PASSWORD_ITERATIONS is the PBKDF2 iteration count of the password hashes
+// HashPassword returns, the one OWASP recommends for PBKDF2-HMAC-SHA256.
+var PASSWORD_ITERATIONS = 600000
+
+// MAX_PASSWORD_CHECKS is the number of passwords checked against their hash
+// at once, the other logins waiting for one of the checks to complete.
+var MAX_PASSWORD_CHECKS = 4
+
+const (
+	PASSWORD_SCHEME   = "pbkdf2-sha256"
+	PASSWORD_SALT_LEN = 16
+)
+
+// HashPassword returns the hash of password for a users file, of the form
+//
+//	pbkdf2-sha256$iterations$salt$key
+//
+// with a random salt, the salt and the derived key hex encoded. It is what
+// restconf -hash-password prints.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, PASSWORD_SALT_LEN)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, PASSWORD_ITERATIONS, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", PASSWORD_SCHEME, PASSWORD_ITERATIONS,
+		hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+// A passwordHash is a parsed password hash of a users file.
+type passwordHash struct {
+	iterations int
+	salt, key  []byte
+}
+
+// parsePasswordHash parses a password hash HashPassword returned.
+func parsePasswordHash(s string) (*passwordHash, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 4 || parts[0] != PASSWORD_SCHEME {
+		return nil, fmt.Errorf("expected a %s$iterations$salt$key hash, see -hash-password", PASSWORD_SCHEME)
+	}
+	h := &passwordHash{}
+	var err error
+	if h.iterations, err = strconv.Atoi(parts[1]); err != nil || h.iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count %q", parts[1])
+	}
+	if h.salt, err = hex.DecodeString(parts[2]); err != nil || len(h.salt) == 0 {
+		return nil, fmt.Errorf("invalid salt %q", parts[2])
+	}
+	if h.key, err = hex.DecodeString(parts[3]); err != nil || len(h.key) != sha256.Size {
+		return nil, fmt.Errorf("invalid key %q", parts[3])
+	}
+	return h, nil
+}
+
+// check reports whether password is the one h is the hash of.
+func (h *passwordHash) check(password string) bool {
+	key, err := pbkdf2.Key(sha256.New, password, h.salt, h.iterations, len(h.key))
+	return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// LoadUsers reads a users file holding one "name:password-hash" line per
+// user, the hash being one HashPassword returns. Empty lines and lines
+// starting with # are ignored.
+func LoadUsers(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected name:password-hash", file, n)
+		}
+		hash := strings.ToLower(line[i+1:])
+		if _, err := parsePasswordHash(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", file, n, err.Error())
+		}
+		users[line[:i]] = hash
+	}
+	return users, scanner.Err()
+}
+
+// logins caches the passwords checked against the hashes of the users file,
+// so that a client sending its credentials with every request derives the
+// slow key once. The cached digests are keyed by user and hash, changing the
+// hash of a user falls back to the slow check.
+type logins struct {
+	mu      sync.Mutex
+	checked map[string][sha256.Size]byte
+	checks  chan struct{} // holds a token for every slow check running
+	dummy   sync.Once
+	unknown string // the hash the passwords of unknown users are checked against
+}
+
+// check reports whether password matches the hash of the user name, hash
+// being "" for an unknown user. Only a password matching the cached digest
+// skips the slow check, so that guessing the password of a user who logged
+// in is as slow as guessing any other, and the password of an unknown user
+// is checked against a hash of its own, so that it takes as long as for a
+// known one.
+func (l *logins) check(name, hash, password string) bool {
+	known := hash != ""
+	if !known {
+		l.dummy.Do(func() { l.unknown, _ = HashPassword("") })
+		hash = l.unknown
+	}
+	id := name + ":" + hash
+	sum := sha256.Sum256([]byte(hash + "$" + password))
+
+	l.mu.Lock()
+	cached, ok := l.checked[id]
+	if l.checks == nil {
+		l.checks = make(chan struct{}, max(MAX_PASSWORD_CHECKS, 1))
+	}
+	checks := l.checks
+	l.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(cached[:], sum[:]) == 1 {
+		return true
+	}
+
+	checks <- struct{}{}
+	h, err := parsePasswordHash(hash)
+	valid := err == nil && h.check(password)
+	<-checks
+	if !valid || !known {
+		return false
+	}
+	l.mu.Lock()
+	if l.checked == nil {
+		l.checked = make(map[string][sha256.Size]byte)
+	}
+	l.checked[id] = sum
+	l.mu.Unlock()
+	return true
+}
+
+// authenticate returns the user of req, checked with HTTP basic
+// authentication against the users file. Without a users file every request
+// is anonymous, with user "".
+func (restconf *RestConf) authenticate(req *http.Request) (string, bool) {
+	if restconf.users == nil {
+		return "", true
+	}
+
+	name, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	if !restconf.logins.check(name, restconf.users[name], password) {
+		return "", false
+	}
+	return name, true
+}
+
+// withUser returns req carrying the authenticated user.
+func withUser(req *http.Request, user string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+}
+
+// requestUser returns the authenticated user of req, "" when anonymous.
+func requestUser(req *http.Request) string {
+	user, _ := req.Context().Value(userContextKey).(string)
+	return user
+}
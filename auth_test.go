@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testUsers returns the users file of the users, the password of each being
+// its name followed by "-secret". The hashes take few iterations.
+func testUsers(t testing.TB, names ...string) map[string]string {
+	defer func(n int) { PASSWORD_ITERATIONS = n }(PASSWORD_ITERATIONS)
+	PASSWORD_ITERATIONS = 10
+
+	users := make(map[string]string)
+	for _, name := range names {
+		hash, err := HashPassword(name + "-secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[name] = hash
+	}
+	return users
+}
+
+func TestPasswordHash(t *testing.T) {
+	users := testUsers(t, "alice", "bob")
+	if users["alice"] == users["bob"] || !strings.HasPrefix(users["alice"], PASSWORD_SCHEME+"$10$") {
+		t.Fatalf("got hashes %v", users)
+	}
+	// The same password hashes with another salt each time.
+	if again := testUsers(t, "alice"); again["alice"] == users["alice"] {
+		t.Errorf("hashes of the same password are the same: %s", users["alice"])
+	}
+
+	file := filepath.Join(t.TempDir(), "users")
+	text := "# users\nalice:" + users["alice"] + "\n\nbob:" + strings.ToUpper(users["bob"]) + "\n"
+	if err := os.WriteFile(file, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadUsers(file)
+	if err != nil || len(loaded) != 2 {
+		t.Fatalf("LoadUsers: got %v, %v", loaded, err)
+	}
+
+	server := testServer(t)
+	server.users = loaded
+	for _, test := range []struct {
+		user, password string
+		status         int
+	}{
+		{"alice", "alice-secret", http.StatusOK},
+		{"alice", "alice-secret", http.StatusOK}, // checked once
+		{"bob", "bob-secret", http.StatusOK},
+		{"alice", "bob-secret", http.StatusUnauthorized},
+		{"alice", "", http.StatusUnauthorized},
+		{"eve", "eve-secret", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/restconf/yang-library-version", nil)
+		req.SetBasicAuth(test.user, test.password)
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != test.status {
+			t.Errorf("%s:%s: got status %d, want %d", test.user, test.password, rsp.Code, test.status)
+		}
+	}
+	// The password of an unknown user is checked against a hash as well.
+	if _, err := parsePasswordHash(server.logins.unknown); err != nil {
+		t.Errorf("unknown users are checked against %q: %v", server.logins.unknown, err)
+	}
+
+	// Unsalted SHA-256 hashes are refused.
+	for _, hash := range []string{
+		"4c2a8fe7eaf24721cc7a9f0175115bd4a28bac0e4d1ba7fba8cc12962ada3754",
+		PASSWORD_SCHEME + "$0$00$" + strings.Repeat("00", 32),
+		PASSWORD_SCHEME + "$10$$" + strings.Repeat("00", 32),
+		PASSWORD_SCHEME + "$10$00$00",
+	} {
+		if err := os.WriteFile(file, []byte("carol:"+hash+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadUsers(file); err == nil {
+			t.Errorf("LoadUsers of %s: got no error", hash)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+/*
+   Batch retrieval is a vendor extension: a POST to the datastore resource
+   with the batch media type reads several resources at once.
+
+   {
+     "go-restconf:batch" : {
+       "path" : [ "/example:system", "/example:system/interface=eth0" ]
+     }
+   }
+
+   The response holds, for each path, the document a GET of the path would
+   return, or the errors document it would fail with.
+
+   {
+     "go-restconf:batch" : {
+       "/example:system" : { "example:system" : { ... } },
+       "/example:system/interface=eth0" : {
+         "ietf-restconf:errors" : { ... }
+       }
+     }
+   }
+*/
+
+var APPLICATION_BATCH_JSON = "application/vnd.go-restconf.batch+json"
+
+type BatchRequest struct {
+	Path []string `json:"path"`
+}
+
+type BatchRequestJson struct {
+	Batch BatchRequest `json:"go-restconf:batch"`
+}
+
+// batchData handles a batch retrieval of the resources listed in the body.
+func (restconf *RestConf) batchData(rsp http.ResponseWriter, req *http.Request) {
+	if !acceptsBatch(req) {
+		writeError(rsp, req, NewError(http.StatusNotAcceptable, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "batch responses are only sent as %s", APPLICATION_BATCH_JSON))
+		return
+	}
+
+	var batch BatchRequestJson
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		writeError(rsp, req, malformed("invalid batch request: %s", err.Error()))
+		return
+	}
+	if len(batch.Batch.Path) == 0 {
+		writeError(rsp, req, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_MISSING_ELEMENT, "batch request lists no path"))
+		return
+	}
+
+	rsp.Header().Set("Content-Type", APPLICATION_BATCH_JSON)
+	rsp.WriteHeader(http.StatusOK)
+
+	buf := bufio.NewWriter(rsp)
+	buf.WriteString(`{"go-restconf:batch":{`)
+	for i, path := range batch.Batch.Path {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		appendJSONString(buf, path)
+		buf.WriteByte(':')
+		restconf.batchEntry(buf, req, path)
+	}
+	buf.WriteString(`}}`)
+
+	if err := buf.Flush(); err != nil {
+		logRequest(req, "write batch response failed!", err.Error())
+	}
+}
+
+// batchEntry writes the document of a GET of path, or its errors document.
+func (restconf *RestConf) batchEntry(buf *bufio.Writer, req *http.Request, path string) {
+	schema := restconf.schemaOf(req)
+
+	var r *Resource
+	var value interface{}
+
+	segs, err := ParsePath(path)
+	if err == nil && len(segs) == 0 {
+		err = invalidValue("batch path %q addresses no data node", path)
+	}
+	if err == nil {
+		r, err = schema.Resolve(segs)
+	}
+	if err == nil && isOperation(r.Entry()) {
+		err = invalidValue("batch path %q addresses an operation", path)
+	}
+	if err == nil {
+		value, err = restconf.readData(req, r)
+	}
+
+	if err != nil {
+		var errs ErrorList
+		errs.add(err)
+		body, _ := json.Marshal(RestConfErrorsJson{Errors: RestConfErrors{Error: errs}})
+		buf.Write(body)
+		return
+	}
+
+	schema.encodeTo(buf, APPLICATION_DATA_JSON, r.Entry(), value)
+}
+
+// acceptsBatch reports whether the Accept header of req allows a batch
+// response.
+func acceptsBatch(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	for _, elem := range strings.Split(accept, ",") {
+		switch mediaType(elem) {
+		case APPLICATION_BATCH_JSON, "*/*", "application/*":
+			return true
+		}
+	}
+	return false
+}
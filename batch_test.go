@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBatchData(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0,"mtu":1500}]}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	rsp = doRequest(server, "POST", "/restconf/data", APPLICATION_BATCH_JSON,
+		`{"go-restconf:batch":{"path":["/test:system/hostname","/test:system/interface=eth0,0/mtu","/test:system/interface=eth1,0"]}}`)
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != APPLICATION_BATCH_JSON {
+		t.Fatalf("batch: got status %d, Content-Type %q: %s", rsp.Code, rsp.Header().Get("Content-Type"), rsp.Body)
+	}
+
+	want := `{"go-restconf:batch":{` +
+		`"/test:system/hostname":{"test:hostname":"a"},` +
+		`"/test:system/interface=eth0,0/mtu":{"test:mtu":1500},` +
+		`"/test:system/interface=eth1,0":{"ietf-restconf:errors":{"error":[{"error-type":"protocol","error-tag":"data-missing","error-message":"resource interface does not exist"}]}}}}`
+	if rsp.Body.String() != want {
+		t.Errorf("batch: got %s, want %s", rsp.Body, want)
+	}
+
+	for _, body := range []string{`{"go-restconf:batch":{"path":[]}}`, `{"go-restconf:batch":`} {
+		rsp = doRequest(server, "POST", "/restconf/data", APPLICATION_BATCH_JSON, body)
+		if rsp.Code != http.StatusBadRequest {
+			t.Errorf("batch %s: got status %d, want %d", body, rsp.Code, http.StatusBadRequest)
+		}
+	}
+}
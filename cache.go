@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A cachedResponse is the precomputed body of a response that only changes
+// with the schema, plain and gzip compressed, along with their entity tags
+// and the time it was built, zero when it is not sent.
+type cachedResponse struct {
+	body     []byte
+	etag     string
+	gzipped  []byte
+	gzipEtag string
+	modified time.Time
+}
+
+func newCachedResponse(body []byte) *cachedResponse {
+	cached := &cachedResponse{body: body, etag: entityTag(body)}
+
+	// The encodings are distinct representations, with distinct tags.
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(body)
+	if zw.Close() == nil {
+		cached.gzipped = buf.Bytes()
+		cached.gzipEtag = strings.TrimSuffix(cached.etag, `"`) + `-gzip"`
+	}
+	return cached
+}
+
+// entityTag returns the strong entity tag of the response body.
+func entityTag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// discoveryCache holds the responses of the discovery resources, keyed by
+// resource and media type.
+type discoveryCache map[string]*cachedResponse
+
+func discoveryKey(url, format string) string {
+	return url + " " + format
+}
+
+// newDiscoveryCache marshals the host-meta, root and yang-library-version
+// responses of schema in every format they are served in, schema being nil
+// until the server is ready. They were last modified at modified.
+func newDiscoveryCache(schema *Schema, modified time.Time) (discoveryCache, error) {
+	cache := make(discoveryCache)
+
+	cache[discoveryKey("/.well-known/host-meta", APPLICATION_XRD_XML)] = newCachedResponse([]byte(
+		`<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+		<Link rel='restconf' href='` + RESTCONF_PREFIX + `'/>
+	</XRD>`))
+
+	version := YANG_LIBRARY_VERSION
+	if schema != nil {
+		version = schema.YangLibraryVersion()
+	}
+	root := RestConfRoot{
+		XmlLns: PUBLIC_XMLNS,
+		Yang:   version}
+	yanglibver := YangLibVer{Version: version, XmlLns: PUBLIC_XMLNS}
+
+	for _, v := range []struct {
+		url  string
+		json interface{}
+		xml  interface{}
+	}{
+		{RESTCONF_PREFIX, RestConfJson{Root: root}, root},
+		{RESTCONF_PREFIX + "/yang-library-version", yanglibver, yanglibver},
+	} {
+		body, err := json.Marshal(v.json)
+		if err != nil {
+			return nil, err
+		}
+		cache[discoveryKey(v.url, APPLICATION_DATA_JSON)] = newCachedResponse(body)
+
+		body, err = xml.Marshal(v.xml)
+		if err != nil {
+			return nil, err
+		}
+		cache[discoveryKey(v.url, APPLICATION_DATA_XML)] = newCachedResponse(body)
+	}
+
+	for _, cached := range cache {
+		cached.modified = modified
+	}
+	return cache, nil
+}
+
+// serveCached sends the cached response of url in format, or 304 Not
+// Modified when the client already holds it.
+func (restconf *RestConf) serveCached(rsp http.ResponseWriter, req *http.Request, url, format string) {
+	restconf.schemaMu.RLock()
+	cached := restconf.discovery[discoveryKey(url, format)]
+	restconf.schemaMu.RUnlock()
+
+	if cached == nil {
+		writeError(rsp, req, NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+			ERROR_TAG_OPERATION_FAILED, "no %s response for %s", format, url))
+		return
+	}
+
+	writeCached(rsp, req, format, cached)
+}
+
+// writeCached sends the cached response in format, compressed if the client
+// accepts gzip, or 304 Not Modified when the client already holds it.
+func writeCached(rsp http.ResponseWriter, req *http.Request, format string, cached *cachedResponse) {
+	body, etag := cached.body, cached.etag
+	rsp.Header().Set("Content-Type", format)
+	addVary(rsp, "Accept-Encoding")
+	if cached.gzipped != nil && acceptsGzip(req) {
+		body, etag = cached.gzipped, cached.gzipEtag
+		rsp.Header().Set("Content-Encoding", "gzip")
+	}
+	rsp.Header().Set("ETag", etag)
+	if !cached.modified.IsZero() {
+		rsp.Header().Set("Last-Modified", cached.modified.UTC().Format(http.TimeFormat))
+	}
+
+	if etagMatch(req.Header.Get("If-None-Match"), etag) {
+		rsp.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rsp.WriteHeader(http.StatusOK)
+	rsp.Write(body)
+}
+
+// etagMatch reports whether the If-None-Match header value matches etag.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
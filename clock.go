@@ -0,0 +1,35 @@
+package main
+
+import (
+	"time"
+)
+
+// A Clock tells the time the server stamps its responses, audit records and
+// notifications with: the Date and Last-Modified headers, the time of the
+// audit records and the eventTime of the notifications and push updates.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock replaces the clock of the server, the system time by default,
+// e.g. with a fixed one in tests. It must be set before the server serves
+// requests, the server is started at the time of the clock.
+func (restconf *RestConf) SetClock(clock Clock) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	restconf.clock = clock
+	restconf.stats.started = clock.Now()
+}
+
+// now returns the time of the clock of the server.
+func (restconf *RestConf) now() time.Time {
+	return restconf.clock.Now()
+}
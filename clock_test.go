@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock stopped at a time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestClock(t *testing.T) {
+	at := time.Date(2021, time.March, 4, 5, 6, 7, 8000, time.FixedZone("CET", 3600))
+	schema := testSchema(t, map[string]string{"test": testModuleText, "alarm": alarmModuleText})
+	server := NewRestConf(schema)
+	server.SetClock(fixedClock(at))
+	// The discovery responses are built along with the schema.
+	server.SetSchema(schema)
+	audit := &memoryAudit{}
+	server.audit = audit
+
+	rsp := doRequest(server, "GET", RESTCONF_PREFIX, "", "")
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("GET %s: got status %d: %s", RESTCONF_PREFIX, rsp.Code, rsp.Body)
+	}
+	want := "Thu, 04 Mar 2021 04:06:07 GMT"
+	if date := rsp.Header().Get("Date"); date != want {
+		t.Errorf("got Date %q, want %q", date, want)
+	}
+	if modified := rsp.Header().Get("Last-Modified"); modified != want {
+		t.Errorf("got Last-Modified %q, want %q", modified, want)
+	}
+
+	rsp = doRequest(server, "PUT", "/restconf/data/test:system/hostname", APPLICATION_DATA_JSON, `{"test:hostname":"a"}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	if len(audit.records) != 1 || audit.records[0].Time != "2021-03-04T04:06:07.000008Z" {
+		t.Errorf("got audit records %v, want one at 2021-03-04T04:06:07.000008Z", audit.records)
+	}
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	stream, done := openStream(t, ts, STREAMS_PREFIX+"/NETCONF/json")
+	defer done()
+	if err := server.Notify(NETCONF_STREAM, schema.Lookup("/alarm/alarm"), map[string]interface{}{"severity": "minor"}); err != nil {
+		t.Fatal(err)
+	}
+	want = `{"ietf-restconf:notification":{"eventTime":"2021-03-04T04:06:07.000008Z","alarm:alarm":{"severity":"minor"}}}`
+	if event := nextEvent(t, stream); event != want {
+		t.Errorf("got event %s, want %s", event, want)
+	}
+}
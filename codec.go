@@ -0,0 +1,1098 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+// Data trees are held in a form independent of their encoding: a container
+// or list entry is a map[string]interface{} keyed by node name, a list or
+// leaf-list is a []interface{} and a leaf value is the canonical string
+// representation of the value. anydata and anyxml content is kept as decoded.
+
+// splitName splits a JSON member or path identifier into its module name and
+// local name.
+func splitName(s string) (string, string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// The errors of a request body tell how it failed: a body that cannot be
+// parsed as the request's format is a malformed-message of type protocol,
+// one that parses but does not match the schema carries an application
+// error-tag naming the violation, unknown-element for a node the schema does
+// not define, missing-element for a node it requires and invalid-value for
+// a value or an instance the node does not allow.
+
+func malformed(format string, args ...interface{}) *RestConfError {
+	return NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL, ERROR_TAG_MALFORMED_MESSAGE, format, args...)
+}
+
+func invalidValue(format string, args ...interface{}) *RestConfError {
+	return NewError(http.StatusBadRequest, ERROR_TYPE_APPLICATION, ERROR_TAG_INVALID_VALUE, format, args...)
+}
+
+func unknownElement(format string, args ...interface{}) *RestConfError {
+	return NewError(http.StatusBadRequest, ERROR_TYPE_APPLICATION, ERROR_TAG_UNKNOWN_ELEMENT, format, args...)
+}
+
+func missingElement(format string, args ...interface{}) *RestConfError {
+	return NewError(http.StatusBadRequest, ERROR_TYPE_APPLICATION, ERROR_TAG_MISSING_ELEMENT, format, args...)
+}
+
+// unknownMember adds the error err of a member or element the schema does not
+// define to errs. Without STRICT_VALIDATION the member is ignored instead,
+// with a warning in the log of req, nil outside of a request.
+func unknownMember(req *http.Request, errs *ErrorList, err *RestConfError) {
+	if STRICT_VALIDATION {
+		errs.add(err)
+		return
+	}
+	logRequest(req, "warning: ignored", err.Error())
+}
+
+// A nodeFinder looks up the schema node of the top-level member or element of
+// a document from its module and local name.
+type nodeFinder func(mod, name string) *yang.Entry
+
+// decode reads a request body holding the node e in the request's format.
+// Errors in the body carry their error-path below the data node at, nil for
+// the top level. An empty body is malformed, it would replace the data of e
+// with nothing.
+func (schema *Schema) decode(req *http.Request, at *ErrorPath, e *yang.Entry) (interface{}, error) {
+	if emptyBody(req) {
+		return nil, errorAt(malformed("the request body is empty, it must hold the data of %s", e.Name), at)
+	}
+	// The body holds the node itself, e.g. {"example:hostname":"a"} for a
+	// leaf, not its bare value.
+	var got string
+	_, value, err := schema.decodeBody(req, at, func(mod, name string) *yang.Entry {
+		if name == e.Name && mod == schema.ModuleOf(e) {
+			return e
+		}
+		got = name
+		if mod != "" {
+			got = mod + ":" + name
+		}
+		return nil
+	})
+	if err != nil && got != "" {
+		return nil, unknownElement("unexpected node %q, the request body must hold the node %s:%s",
+			got, schema.ModuleOf(e), e.Name)
+	}
+	return value, err
+}
+
+// decodeChild reads a request body holding a child node of parent, or a
+// top-level node of any module when parent is nil. It returns the schema node
+// of the child along with its value. at is the error-path of the parent.
+func (schema *Schema) decodeChild(req *http.Request, at *ErrorPath, parent *yang.Entry) (*yang.Entry, interface{}, error) {
+	if emptyBody(req) {
+		return nil, nil, errorAt(malformed("the request body is empty, it must hold the data node to create"), at)
+	}
+	return schema.decodeBody(req, at, func(mod, name string) *yang.Entry {
+		if parent == nil {
+			if schema.exposed(mod) {
+				return findDataChild(schema.Modules[mod], name)
+			}
+			return nil
+		}
+		if child := findDataChild(parent, name); child != nil && schema.ModuleOf(child) == mod {
+			return child
+		}
+		return nil
+	})
+}
+
+// emptyBody reports whether the body of req holds nothing but white space.
+// A body that is not empty is left to be read whole.
+func emptyBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	br := bufio.NewReader(req.Body)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil || !strings.ContainsRune(" \t\r\n", rune(b)) {
+			br.UnreadByte()
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{br, req.Body}
+			return false
+		}
+	}
+}
+
+// emptyValue returns the value an empty request body holds for the input e
+// of an operation, the empty input, or an error if one of the children of e
+// is mandatory.
+func (schema *Schema) emptyValue(at *ErrorPath, e *yang.Entry) (interface{}, error) {
+	if child := mandatoryChild(e); child != nil {
+		return nil, errorAt(missingElement("the request body is empty, %s requires %s", e.Name, child.Name), at)
+	}
+	return map[string]interface{}{}, nil
+}
+
+// mandatoryChild returns a descendant of the container e that an instance of
+// e must hold, a mandatory leaf, anydata, anyxml or choice, or a list or
+// leaf-list with min-elements, nil if there is none. The children of
+// non-presence containers are descendants of e, those of cases are not.
+func mandatoryChild(e *yang.Entry) *yang.Entry {
+	for _, name := range sortedNames(e.Dir) {
+		child := e.Dir[name]
+		var mandatory *yang.Value
+		switch n := child.Node.(type) {
+		case *yang.Leaf:
+			mandatory = n.Mandatory
+		case *yang.Choice:
+			mandatory = n.Mandatory
+		case *yang.AnyData:
+			mandatory = n.Mandatory
+		case *yang.AnyXML:
+			mandatory = n.Mandatory
+		case *yang.Container:
+			if n.Presence == nil {
+				if m := mandatoryChild(child); m != nil {
+					return m
+				}
+			}
+		}
+		if mandatory != nil && mandatory.Name == "true" {
+			return child
+		}
+		if (child.IsList() || child.IsLeafList()) && child.ListAttr != nil && child.ListAttr.MinElements != nil {
+			if n, err := strconv.Atoi(child.ListAttr.MinElements.Name); err == nil && n > 0 {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+func (schema *Schema) decodeBody(req *http.Request, at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error) {
+	format, err := requestFormat(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == APPLICATION_DATA_XML {
+		return schema.decodeXML(req, req.Body, at, find)
+	}
+	e, value, err := schema.decodeJSON(req, req.Body, at, find)
+	if err == nil && req.Method != "PATCH" && hasRemoval(e, value) {
+		return nil, nil, invalidValue("null members remove data and are only allowed with PATCH")
+	}
+	return e, value, err
+}
+
+// hasRemoval reports whether the decoded value v of e holds a member removed
+// with a JSON null.
+func hasRemoval(e *yang.Entry, v interface{}) bool {
+	if e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry {
+		return false
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		for _, value := range v {
+			if hasRemoval(e, value) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for name, value := range v {
+			if value == nil {
+				return true
+			}
+			if child := findDataChild(e, name); child != nil && hasRemoval(child, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeJSON reads a JSON document holding a single member, which must be
+// module qualified, and returns its schema node and value. Lists and
+// leaf-lists decode to a []interface{}. at is the error-path of the parent
+// of the member. req is the request the document is read for, nil outside
+// of a request.
+func (schema *Schema) decodeJSON(req *http.Request, r io.Reader, at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error) {
+	v, err := readJSON(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil, malformed("invalid JSON: the body must be an object holding a module qualified member, not a bare value")
+	}
+	if len(doc) != 1 {
+		return nil, nil, malformed("expected a single top-level member, got %d", len(doc))
+	}
+
+	for name, v := range doc {
+		mod, local := splitName(name)
+		e := find(mod, local)
+		if e == nil {
+			return nil, nil, unknownElement("unexpected member %q", name)
+		}
+		value, err := schema.fromJSON(req, e, at, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		return e, value, nil
+	}
+	return nil, nil, nil
+}
+
+// readJSON reads a JSON value from r, numbers as json.Number. An object
+// holding a member twice is refused, decoding it would silently keep the last
+// one.
+func readJSON(r io.Reader) (interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	v, err := readJSONValue(dec)
+	if err, ok := err.(*RestConfError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, malformed("invalid JSON: %s", err.Error())
+	}
+	return v, nil
+}
+
+// readJSONValue reads the next JSON value of dec.
+func readJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := make(map[string]interface{})
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name, _ := tok.(string)
+			if _, ok := obj[name]; ok {
+				return nil, invalidValue("duplicate member %q", name)
+			}
+			if obj[name], err = readJSONValue(dec); err != nil {
+				return nil, err
+			}
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := readJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// duplicateInstance returns an error at p, the error-path of the list or
+// leaf-list e, when two of its entries have the same keys, or two values of a
+// configuration leaf-list are the same. Either could then no longer be
+// addressed on its own.
+func duplicateInstance(e *yang.Entry, p *ErrorPath, values []interface{}) error {
+	if e.IsLeafList() && e.ReadOnly() {
+		return nil
+	}
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		keys := instanceKeys(e, v)
+		if keys == nil {
+			continue
+		}
+		id := fmt.Sprintf("%q", keys)
+		if !seen[id] {
+			seen[id] = true
+			continue
+		}
+		if e.IsLeafList() {
+			return errorAt(invalidValue("duplicate value %q in leaf-list %s", keys[0], e.Name), p)
+		}
+		return errorAt(invalidValue("duplicate entry %s in list %s", strings.Join(keys, ","), e.Name), p)
+	}
+	return nil
+}
+
+// fromJSON returns the value of the JSON member v holding e, which is a
+// child of the data node at. Errors carry the error-path of the node they
+// are found at.
+func (schema *Schema) fromJSON(req *http.Request, e *yang.Entry, at *ErrorPath, v interface{}) (interface{}, error) {
+	switch {
+	case e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry:
+		return v, nil
+	case e.IsLeaf():
+		value, err := leafFromJSON(e, v)
+		if err == nil {
+			value, err = schema.instanceLeaf(e, value)
+		}
+		return value, errorAt(err, schema.errorPath(at, e, nil))
+	case e.IsLeafList():
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, errorAt(invalidValue("leaf-list %s must be an array", e.Name), schema.errorPath(at, e, nil))
+		}
+		var errs ErrorList
+		values := make([]interface{}, 0, len(arr))
+		for _, elem := range arr {
+			value, err := leafFromJSON(e, elem)
+			if err == nil {
+				value, err = schema.instanceLeaf(e, value)
+			}
+			errs.add(err)
+			values = append(values, value)
+		}
+		if len(errs) == 0 {
+			errs.add(duplicateInstance(e, nil, values))
+		}
+		return values, errorAt(errs.err(), schema.errorPath(at, e, nil))
+	case e.IsList():
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, errorAt(invalidValue("list %s must be an array", e.Name), schema.errorPath(at, e, nil))
+		}
+		var errs ErrorList
+		entries := make([]interface{}, 0, len(arr))
+		for _, elem := range arr {
+			entry, err := schema.fromJSONDir(req, e, schema.errorPath(at, e, jsonKeys(e, elem)), elem)
+			errs.add(err)
+			entries = append(entries, entry)
+		}
+		if len(errs) == 0 {
+			errs.add(duplicateInstance(e, schema.errorPath(at, e, nil), entries))
+		}
+		return entries, errs.err()
+	default:
+		return schema.fromJSONDir(req, e, schema.errorPath(at, e, nil), v)
+	}
+}
+
+// fromJSONDir returns the value of the JSON object v holding the container
+// or list entry e, whose error-path is p.
+func (schema *Schema) fromJSONDir(req *http.Request, e *yang.Entry, p *ErrorPath, v interface{}) (map[string]interface{}, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errorAt(invalidValue("%s must be an object", e.Name), p)
+	}
+
+	// Errors of the members are collected, so that all of them are
+	// reported at once.
+	var errs ErrorList
+	dir := make(map[string]interface{}, len(obj))
+	for _, name := range sortedKeys(obj) {
+		mod, local := splitName(name)
+
+		child := findDataChild(e, local)
+		if child == nil {
+			unknownMember(req, &errs, unknownElement("unknown element %q in %s", name, e.Name))
+			continue
+		}
+		switch cmod := schema.ModuleOf(child); {
+		case mod != "" && mod != cmod:
+			unknownMember(req, &errs, unknownElement("element %q is not defined in module %s", local, mod))
+			continue
+		case mod == "" && cmod != schema.ModuleOf(e):
+			errs.add(unknownElement("element %q must be qualified with module %s", local, cmod))
+			continue
+		}
+
+		// A null member removes the node on PATCH (RFC 7396), it is
+		// kept as a nil value.
+		if obj[name] == nil {
+			if isKey(e, local) {
+				errs.add(invalidValue("key leaf %s of %s cannot be removed", local, e.Name))
+				continue
+			}
+			dir[local] = nil
+			continue
+		}
+
+		value, err := schema.fromJSON(req, child, p, obj[name])
+		errs.add(err)
+		if err == nil && noInstances(child, value) {
+			continue
+		}
+		dir[local] = value
+	}
+	if len(errs) > 0 {
+		return nil, errorAt(errs, p)
+	}
+	return dir, nil
+}
+
+// jsonKeys returns the key values of the JSON list entry v of e, or nil if
+// a key leaf is missing.
+func jsonKeys(e *yang.Entry, v interface{}) []string {
+	obj, _ := v.(map[string]interface{})
+	var keys []string
+	for _, name := range keyNames(e) {
+		switch key := obj[name].(type) {
+		case string:
+			keys = append(keys, key)
+		case json.Number:
+			keys = append(keys, key.String())
+		case bool:
+			keys = append(keys, strconv.FormatBool(key))
+		default:
+			return nil
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the member names of obj in sorted order.
+func sortedKeys(obj map[string]interface{}) []string {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func leafFromJSON(e *yang.Entry, v interface{}) (string, error) {
+	empty := leafKind(e) == yang.Yempty
+
+	var s string
+	var js jsonType
+	switch v := v.(type) {
+	case string:
+		s, js = v, jsonString
+	case json.Number:
+		s, js = v.String(), jsonNumber
+	case bool:
+		s, js = strconv.FormatBool(v), jsonBool
+	case []interface{}:
+		// The empty type is encoded as [null] (RFC 7951 section 6.9).
+		if len(v) == 1 && v[0] == nil && empty {
+			return "", nil
+		}
+		return "", invalidValue("invalid value for leaf %s", e.Name)
+	default:
+		return "", invalidValue("invalid value for leaf %s", e.Name)
+	}
+
+	if empty {
+		return "", invalidValue("leaf %s of type empty must be encoded as [null]", e.Name)
+	}
+	// Other leaves take numbers and strings alike, the members of a union
+	// only the JSON type they are encoded as.
+	if leafKind(e) != yang.Yunion {
+		js = anyJSON
+	}
+	return leafJSONValue(e, s, js)
+}
+
+// An xmlNode is a generic XML element, decoded before it is matched against
+// the schema.
+type xmlNode struct {
+	Name     xml.Name
+	Attr     []xml.Attr
+	Parent   *xmlNode
+	Children []*xmlNode
+	Text     string
+}
+
+// parseXML reads the XML document of r into a tree, refusing documents with
+// a document type declaration or nested deeper than MAX_XML_DEPTH.
+func parseXML(r io.Reader) (*xmlNode, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = true
+	dec.Entity = nil
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err == errXMLTooBig {
+			return nil, xmlTooBig()
+		}
+		if err != nil {
+			return nil, malformed("invalid XML: %s", err.Error())
+		}
+
+		switch t := tok.(type) {
+		case xml.Directive:
+			return nil, malformed("invalid XML: document type declarations are not allowed")
+		case xml.StartElement:
+			if len(stack) >= MAX_XML_DEPTH {
+				return nil, malformed("invalid XML: elements are nested deeper than %d levels", MAX_XML_DEPTH)
+			}
+			n := &xmlNode{Name: t.Name, Attr: t.Attr}
+			switch {
+			case len(stack) > 0:
+				n.Parent = stack[len(stack)-1]
+				n.Parent.Children = append(n.Parent.Children, n)
+			case root != nil:
+				return nil, malformed("invalid XML: multiple root elements")
+			default:
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, malformed("invalid XML: no root element")
+	}
+	return root, nil
+}
+
+// decodeXML reads an XML document and returns the schema node and value of
+// its root element. Lists and leaf-lists decode to a []interface{} holding the
+// single entry. at is the error-path of the parent of the root element, req
+// the request the document is read for.
+func (schema *Schema) decodeXML(req *http.Request, r io.Reader, at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error) {
+	root, err := parseXML(limitXMLBody(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema.decodeXMLNode(req, root, at, find)
+}
+
+// decodeXMLNode returns the schema node and value of the element root, as
+// decodeXML does for the root element of a document.
+func (schema *Schema) decodeXMLNode(req *http.Request, root *xmlNode, at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error) {
+	e := find(schema.ModuleByNamespace(root.Name.Space), root.Name.Local)
+	if e == nil {
+		return nil, nil, unknownElement("unexpected element %q in namespace %q", root.Name.Local, root.Name.Space)
+	}
+
+	value, err := schema.fromXML(req, e, schema.errorPath(at, e, xmlKeys(e, root)), root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.IsList() || e.IsLeafList() {
+		return e, []interface{}{value}, nil
+	}
+	return e, value, nil
+}
+
+// fromXML returns the value of the element n holding a single instance of e,
+// whose error-path is p.
+func (schema *Schema) fromXML(req *http.Request, e *yang.Entry, p *ErrorPath, n *xmlNode) (interface{}, error) {
+	if e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry {
+		return n.Text, nil
+	}
+	if !e.IsDir() {
+		if len(n.Children) > 0 {
+			return nil, errorAt(invalidValue("leaf %s cannot hold elements", e.Name), p)
+		}
+		// An empty leaf is a bare element, white space around the
+		// missing value is insignificant.
+		if leafKind(e) == yang.Yempty && strings.TrimSpace(n.Text) == "" {
+			return "", nil
+		}
+		text := n.Text
+		switch leafKind(e) {
+		case yang.Yidentityref, yang.Yunion:
+			text = schema.xmlQualified(n, text)
+		case yang.YinstanceIdentifier:
+			text = schema.xmlInstanceID(n, text)
+		}
+		value, err := leafValue(e, text)
+		if err == nil {
+			value, err = schema.instanceLeaf(e, value)
+		}
+		return value, errorAt(err, p)
+	}
+
+	var errs ErrorList
+	dir := make(map[string]interface{}, len(n.Children))
+	for _, cn := range n.Children {
+		child := findDataChild(e, cn.Name.Local)
+		if child == nil {
+			unknownMember(req, &errs, unknownElement("unknown element %q in %s", cn.Name.Local, e.Name))
+			continue
+		}
+		if cn.Name.Space != child.Namespace().Name {
+			unknownMember(req, &errs, unknownElement("element %q is not defined in namespace %s", cn.Name.Local, cn.Name.Space))
+			continue
+		}
+
+		value, err := schema.fromXML(req, child, schema.errorPath(p, child, xmlKeys(child, cn)), cn)
+		if err != nil {
+			errs.add(err)
+			continue
+		}
+
+		switch {
+		case child.IsList() || child.IsLeafList():
+			values, _ := dir[child.Name].([]interface{})
+			dir[child.Name] = append(values, value)
+		case dir[child.Name] != nil:
+			errs.add(invalidValue("duplicate element %q in %s", child.Name, e.Name))
+		default:
+			dir[child.Name] = value
+		}
+	}
+	if len(errs) == 0 {
+		for _, name := range sortedKeys(dir) {
+			if child := findDataChild(e, name); child.IsList() || child.IsLeafList() {
+				values, _ := dir[name].([]interface{})
+				errs.add(duplicateInstance(child, schema.errorPath(p, child, nil), values))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errorAt(errs, p)
+	}
+	return dir, nil
+}
+
+// xmlKeys returns the key values of the element n holding a list entry of e,
+// or nil if e is no list or a key leaf is missing.
+func xmlKeys(e *yang.Entry, n *xmlNode) []string {
+	if !e.IsList() {
+		return nil
+	}
+	var keys []string
+	for _, name := range keyNames(e) {
+		var found bool
+		for _, cn := range n.Children {
+			if cn.Name.Local == name {
+				keys = append(keys, strings.TrimSpace(cn.Text))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return keys
+}
+
+// xmlQualified replaces the XML namespace prefix of the value s of the
+// element n, as used by identityrefs, with the name of the module it stands
+// for. The prefix may be declared on n or any of its ancestors.
+func (schema *Schema) xmlQualified(n *xmlNode, s string) string {
+	prefix, name := splitName(strings.TrimSpace(s))
+	if prefix == "" {
+		return s
+	}
+	if mod := schema.xmlPrefixModule(n, prefix); mod != prefix {
+		return mod + ":" + name
+	}
+	return s
+}
+
+// xmlPrefixModule returns the name of the module the XML namespace prefix
+// in scope at the element n stands for, or prefix itself if it is not bound
+// to a namespace of the schema. The nearest declaration of prefix, on n or
+// its ancestors, is the one in scope.
+func (schema *Schema) xmlPrefixModule(n *xmlNode, prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	for ; n != nil; n = n.Parent {
+		for _, attr := range n.Attr {
+			if attr.Name.Space == "xmlns" && attr.Name.Local == prefix {
+				if mod := schema.ModuleByNamespace(attr.Value); mod != "" {
+					return mod
+				}
+				return prefix
+			}
+		}
+	}
+	return prefix
+}
+
+// encode returns the document for the node e holding v in format.
+func (schema *Schema) encode(format string, e *yang.Entry, v interface{}) []byte {
+	var buf bytes.Buffer
+	schema.encodeTo(&buf, format, e, v)
+	return buf.Bytes()
+}
+
+// encodeTo writes the document for the node e holding v in format to w as it
+// is encoded, so that large data trees are never held in memory as a whole.
+// It returns the first error writing to w, or writes nothing if v is nested
+// too deep to be encoded.
+func (schema *Schema) encodeTo(w io.Writer, format string, e *yang.Entry, v interface{}) error {
+	return schema.encodeTagged(w, format, e, v, false)
+}
+
+// encodeTagged is encodeTo tagging the leafs holding their default value if
+// tagged, as with-defaults report-all-tagged does.
+func (schema *Schema) encodeTagged(w io.Writer, format string, e *yang.Entry, v interface{}, tagged bool) error {
+	if err := schema.checkDepth(e, v, entryDepth(e)); err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(w)
+	if format == APPLICATION_DATA_XML {
+		schema.appendXML(buf, e, "", v, tagged)
+	} else {
+		buf.WriteByte('{')
+		schema.appendJSONMember(buf, e, "", v, tagged)
+		buf.WriteByte('}')
+	}
+	return buf.Flush()
+}
+
+// A dataNode is a top-level data node of the datastore along with its data.
+type dataNode struct {
+	entry *yang.Entry
+	value interface{}
+}
+
+// encodeDatastore writes the document of the datastore resource holding the
+// top-level nodes to w in format: the data container of ietf-restconf, each
+// node qualified by its module. The nodes must not be nested deeper than
+// checkDepth allows. The leafs holding their default value are tagged if
+// tagged is.
+func (schema *Schema) encodeDatastore(w io.Writer, format string, nodes []dataNode, tagged bool) error {
+	buf := bufio.NewWriter(w)
+	if format == APPLICATION_DATA_XML && len(nodes) == 0 {
+		// An empty datastore is still a document, of the data element
+		// alone.
+		buf.WriteString(`<data xmlns="` + PUBLIC_XMLNS + `"/>`)
+		return buf.Flush()
+	}
+	if format == APPLICATION_DATA_XML {
+		buf.WriteString(`<data xmlns="` + PUBLIC_XMLNS + `">`)
+	} else {
+		buf.WriteString(`{"ietf-restconf:data":{`)
+	}
+
+	first := true
+	for _, n := range nodes {
+		if format == APPLICATION_DATA_XML {
+			schema.appendXML(buf, n.entry, PUBLIC_XMLNS, n.value, tagged)
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		schema.appendJSONMember(buf, n.entry, "", n.value, tagged)
+	}
+
+	if format == APPLICATION_DATA_XML {
+		buf.WriteString(`</data>`)
+	} else {
+		buf.WriteString(`}}`)
+	}
+	return buf.Flush()
+}
+
+// checkDepth returns an error if the data tree v of the node e, at level
+// depth, holds nodes below MAX_SCHEMA_DEPTH.
+func (schema *Schema) checkDepth(e *yang.Entry, v interface{}, depth int) error {
+	if depth > MAX_SCHEMA_DEPTH {
+		return NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION, ERROR_TAG_OPERATION_FAILED,
+			"data at %s is nested deeper than %d levels", e.Name, MAX_SCHEMA_DEPTH)
+	}
+	if !e.IsDir() {
+		return nil
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, value := range v {
+			if err := schema.checkDepth(e, value, depth); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for name, cv := range v {
+			if child := findDataChild(e, name); child != nil {
+				if err := schema.checkDepth(child, cv, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// appendJSONMember writes the member for e, qualifying its name when the
+// module of e differs from that of its parent (RFC 7951 section 4). A leaf
+// holding its default value is followed by the metadata member tagging it
+// as a default if tagged (RFC 8040 section 4.8.9, RFC 7952 section 5.2.1).
+func (schema *Schema) appendJSONMember(buf *bufio.Writer, e *yang.Entry, parentModule string, v interface{}, tagged bool) {
+	name := e.Name
+	if mod := schema.ModuleOf(e); mod != parentModule {
+		name = mod + ":" + e.Name
+	}
+	appendJSONString(buf, name)
+	buf.WriteByte(':')
+	schema.appendJSONValue(buf, e, v, tagged)
+
+	if s, _ := v.(string); tagged && e.IsLeaf() && isDefaultLeaf(e, s) {
+		buf.WriteByte(',')
+		appendJSONString(buf, "@"+name)
+		buf.WriteString(`:{"` + WITH_DEFAULTS_MODULE + `:default":true}`)
+	}
+}
+
+func (schema *Schema) appendJSONValue(buf *bufio.Writer, e *yang.Entry, v interface{}, tagged bool) {
+	switch {
+	case e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry:
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte("null")
+		}
+		buf.Write(b)
+	case e.IsLeaf():
+		s, _ := v.(string)
+		appendJSONLeaf(buf, e, s)
+	case e.IsLeafList() || e.IsList():
+		buf.WriteByte('[')
+		values, _ := v.([]interface{})
+		for i, value := range values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if e.IsList() {
+				schema.appendJSONValue(buf, containerOf(e), value, tagged)
+			} else {
+				s, _ := value.(string)
+				appendJSONLeaf(buf, e, s)
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		dir, _ := v.(map[string]interface{})
+		mod := schema.ModuleOf(e)
+		buf.WriteByte('{')
+		first := true
+		for _, child := range dataChildren(e) {
+			cv, ok := dir[child.Name]
+			if !ok || noInstances(child, cv) {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			schema.appendJSONMember(buf, child, mod, cv, tagged)
+		}
+		buf.WriteByte('}')
+	}
+}
+
+// noInstances reports whether v is the value of the list or leaf-list e
+// without any instance. A list or leaf-list is always encoded as an array,
+// even with a single instance, and one without instances is not encoded at
+// all (RFC 7951 section 5.3 and 5.4): an empty array decodes as no data.
+func noInstances(e *yang.Entry, v interface{}) bool {
+	if !e.IsList() && !e.IsLeafList() {
+		return false
+	}
+	values, _ := v.([]interface{})
+	return len(values) == 0
+}
+
+// containerOf returns a copy of the list e that encodes as a single entry.
+func containerOf(e *yang.Entry) *yang.Entry {
+	entry := *e
+	entry.ListAttr = nil
+	return &entry
+}
+
+// appendJSONLeaf writes the leaf value s per the encoding rules of RFC 7951
+// section 6. 64-bit integers and decimal64 values are written as strings,
+// as JSON numbers cannot hold them without losing precision.
+func appendJSONLeaf(buf *bufio.Writer, e *yang.Entry, s string) {
+	// A union value is encoded as the member type it matches.
+	kind := yang.Ystring
+	if e.Type != nil {
+		if t, v, err := matchType(e, e.Type, s, anyJSON, 0); err == nil {
+			kind, s = t.Kind, v
+		} else if t := leafType(e); t != nil {
+			kind = t.Kind
+		}
+	}
+
+	switch kind {
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yuint8, yang.Yuint16, yang.Yuint32:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			buf.WriteString(s)
+			return
+		}
+	case yang.Ybool:
+		if s == "true" || s == "false" {
+			buf.WriteString(s)
+			return
+		}
+	case yang.Yempty:
+		buf.WriteString("[null]")
+		return
+	}
+	appendJSONString(buf, s)
+}
+
+func appendJSONString(buf *bufio.Writer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// leafKind returns the base type kind of the leaf e, following leafrefs to
+// the leaf they refer to.
+func leafKind(e *yang.Entry) yang.TypeKind {
+	if t := leafType(e); t != nil {
+		return t.Kind
+	}
+	return yang.Ystring
+}
+
+// leafType returns the type of the leaf e, following leafrefs to the leaf
+// they refer to.
+func leafType(e *yang.Entry) *yang.YangType {
+	for seen := 0; e != nil && e.Type != nil && seen < MAX_TYPE_DEPTH; seen++ {
+		if e.Type.Kind != yang.Yleafref {
+			return e.Type
+		}
+		e = leafrefTarget(e, e.Type.Path)
+	}
+	return nil
+}
+
+// leafrefTarget returns the leaf the leafref path of the leaf e points at,
+// or nil if the path cannot be resolved.
+func leafrefTarget(e *yang.Entry, path string) *yang.Entry {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		// Drop predicates, they select instances rather than schema nodes.
+		if i := strings.Index(part, "["); i >= 0 {
+			part = part[:i]
+		}
+		parts = append(parts, strings.TrimSpace(part))
+	}
+	path = strings.Join(parts, "/")
+
+	// Relative paths start at the leaf itself, while Find starts at the
+	// entry it is called on, so climb through choice and case nodes which
+	// are not part of the data tree.
+	if strings.HasPrefix(path, "/") {
+		return e.Find(path)
+	}
+	from := e
+	for strings.HasPrefix(path, "../") {
+		from = from.Parent
+		for from != nil && (from.IsChoice() || from.IsCase()) {
+			from = from.Parent
+		}
+		path = strings.TrimPrefix(path, "../")
+	}
+	if from == nil {
+		return nil
+	}
+	return from.Find(path)
+}
+
+// appendXML writes the element(s) for e, declaring its namespace when it
+// differs from the namespace of the parent element. A leaf holding its
+// default value carries the default attribute of ietf-netconf-with-defaults
+// if tagged (RFC 6243 section 6).
+func (schema *Schema) appendXML(buf *bufio.Writer, e *yang.Entry, parentNS string, v interface{}, tagged bool) {
+	if e.IsList() || e.IsLeafList() {
+		values, _ := v.([]interface{})
+		entry := containerOf(e)
+		for _, value := range values {
+			schema.appendXML(buf, entry, parentNS, value, tagged)
+		}
+		return
+	}
+
+	ns := e.Namespace().Name
+	buf.WriteString("<" + e.Name)
+	if ns != parentNS {
+		buf.WriteString(` xmlns="`)
+		xml.EscapeText(buf, []byte(ns))
+		buf.WriteString(`"`)
+	}
+	if s, _ := v.(string); tagged && e.IsLeaf() && isDefaultLeaf(e, s) {
+		buf.WriteString(` xmlns:wd="` + WITH_DEFAULTS_XMLNS + `" wd:default="true"`)
+	}
+
+	switch {
+	case e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry || !e.IsDir():
+		s, _ := v.(string)
+		if !e.IsDir() {
+			s = canonicalLeaf(e, s)
+		}
+		if !e.IsDir() && leafKind(e) == yang.YinstanceIdentifier {
+			// Every node is qualified by a prefix declared on the
+			// element, the name of its module.
+			var namespaces map[string]string
+			s, namespaces = schema.xmlQualifiedID(s)
+			mods := make([]string, 0, len(namespaces))
+			for mod := range namespaces {
+				mods = append(mods, mod)
+			}
+			sort.Strings(mods)
+			for _, mod := range mods {
+				buf.WriteString(` xmlns:` + mod + `="`)
+				xml.EscapeText(buf, []byte(namespaces[mod]))
+				buf.WriteString(`"`)
+			}
+		}
+		if !e.IsDir() && e.Type != nil {
+			// An identity is qualified by a prefix declared on the
+			// element, the name of its module.
+			if t, _, err := matchType(e, e.Type, s, anyJSON, 0); err == nil && t.Kind == yang.Yidentityref {
+				if mod, _ := splitName(s); schema.Modules[mod] != nil {
+					buf.WriteString(` xmlns:` + mod + `="`)
+					xml.EscapeText(buf, []byte(schema.Modules[mod].Namespace().Name))
+					buf.WriteString(`"`)
+				}
+			}
+		}
+		if s == "" {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteString(">")
+		xml.EscapeText(buf, []byte(s))
+	default:
+		buf.WriteString(">")
+		dir, _ := v.(map[string]interface{})
+		for _, child := range dataChildren(e) {
+			if cv, ok := dir[child.Name]; ok {
+				schema.appendXML(buf, child, ns, cv, tagged)
+			}
+		}
+	}
+	buf.WriteString("</" + e.Name + ">")
+}
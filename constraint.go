@@ -0,0 +1,263 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+var ERROR_APP_TAG_MUST_VIOLATION = "must-violation"
+
+// An xpathConstraint is a compiled must or when expression.
+type xpathConstraint struct {
+	text string
+	expr xpathExpr
+	must *yang.Must // the must statement, nil for a when
+
+	// parent is set for the when of a choice, case or augment, which is
+	// evaluated at the parent data node rather than at the node itself.
+	parent bool
+}
+
+// nodeConstraints are the expressions constraining the instances of a data
+// node (RFC 7950 sections 7.5.3 and 7.21.5).
+type nodeConstraints struct {
+	when []xpathConstraint
+	must []xpathConstraint
+}
+
+// nodeMust returns the must statements of the data node n.
+func nodeMust(n yang.Node) []*yang.Must {
+	switch n := n.(type) {
+	case *yang.Container:
+		return n.Must
+	case *yang.List:
+		return n.Must
+	case *yang.Leaf:
+		return n.Must
+	case *yang.LeafList:
+		return n.Must
+	case *yang.AnyData:
+		return n.Must
+	case *yang.AnyXML:
+		return n.Must
+	}
+	return nil
+}
+
+// nodeWhen returns the when statement of n, nil if it has none.
+func nodeWhen(n yang.Node) *yang.Value {
+	switch n := n.(type) {
+	case *yang.Container:
+		return n.When
+	case *yang.List:
+		return n.When
+	case *yang.Leaf:
+		return n.When
+	case *yang.LeafList:
+		return n.When
+	case *yang.AnyData:
+		return n.When
+	case *yang.AnyXML:
+		return n.When
+	case *yang.Choice:
+		return n.When
+	case *yang.Case:
+		return n.When
+	}
+	return nil
+}
+
+// xpathNamespaces returns the namespace of a prefix of the expressions of
+// the statement n, the prefix of its module or of a module it imports, e
+// being the data node it constrains.
+func xpathNamespaces(n yang.Node, e *yang.Entry) func(prefix string) (string, bool) {
+	return func(prefix string) (string, bool) {
+		mod := yang.FindModuleByPrefix(n, prefix)
+		switch {
+		case mod == nil:
+			return "", false
+		case mod.Namespace != nil:
+			return mod.Namespace.Name, true
+		}
+		// The prefix of a submodule, whose nodes have the namespace of the
+		// module it belongs to.
+		return e.Namespace().Name, true
+	}
+}
+
+// compileConstraints compiles the must and when expressions of the data
+// node e, whose schema key is key, along with the when expressions of the
+// choices, cases and augments e is within. Expressions the evaluator does
+// not support are logged and left out rather than failing every edit. It
+// returns nil if e is not constrained.
+func compileConstraints(key string, e *yang.Entry) *nodeConstraints {
+	var c nodeConstraints
+	compile := func(text string, must *yang.Must, parent bool, n yang.Node) {
+		expr, err := parseXPath(text, xpathNamespaces(n, e))
+		if err != nil {
+			log.Println("schema", key, "constraint", text, "is not supported, it is not checked!")
+			return
+		}
+		if must != nil {
+			c.must = append(c.must, xpathConstraint{text: text, expr: expr, must: must})
+		} else {
+			c.when = append(c.when, xpathConstraint{text: text, expr: expr, parent: parent})
+		}
+	}
+
+	if e.Node == nil {
+		return nil
+	}
+	for _, must := range nodeMust(e.Node) {
+		compile(must.Name, must, false, e.Node)
+	}
+	if when := nodeWhen(e.Node); when != nil {
+		compile(when.Name, nil, false, e.Node)
+	}
+	for x := e; x != nil && x.Node != nil; x = x.Parent {
+		if x != e && !x.IsChoice() && !x.IsCase() {
+			break
+		}
+		if x != e {
+			switch x.Node.(type) {
+			case *yang.Choice, *yang.Case:
+				if when := nodeWhen(x.Node); when != nil {
+					compile(when.Name, nil, true, x.Node)
+				}
+			}
+		}
+		if aug, ok := x.Node.ParentNode().(*yang.Augment); ok && aug.When != nil {
+			compile(aug.When.Name, nil, true, aug)
+		}
+	}
+
+	if c.when == nil && c.must == nil {
+		return nil
+	}
+	return &c
+}
+
+// constraintCheck returns the check of the must and when expressions of the
+// nodes of the module of r for DataStore.Edit, along with the instances of
+// the module its instance-identifiers require, or nil if the module has
+// none. The expressions are evaluated on the whole datastore, the nodes of
+// other modules are checked when their module is edited.
+//
+// A node whose when expression is false is removed, with its descendants
+// (RFC 7950 section 8.1), before the must expressions are checked.
+func (schema *Schema) constraintCheck(r *Resource) editCheck {
+	mod := r.Segments[0].Module
+	if !schema.constrained[mod] {
+		return nil
+	}
+	return func(view moduleView) error {
+		root := schema.newXPathRoot(view)
+		var nodes []*xpathNode
+		for _, top := range root.children() {
+			if moduleEntry(top.entry) == schema.Modules[mod] {
+				nodes = append(nodes, top)
+			}
+		}
+		// Removing a node may make the when expressions of others false.
+		for {
+			var removed []*xpathNode
+			for _, n := range nodes {
+				schema.inapplicable(n, &removed)
+			}
+			if len(removed) == 0 {
+				break
+			}
+			removeXPathNodes(removed)
+			gone := make(map[*xpathNode]bool, len(removed))
+			for _, n := range removed {
+				gone[n] = true
+			}
+			kept := nodes[:0]
+			for _, n := range nodes {
+				if !gone[n] {
+					kept = append(kept, n)
+				}
+			}
+			nodes = kept
+		}
+
+		var errs ErrorList
+		for _, n := range nodes {
+			schema.checkConstraints(n, &errs)
+		}
+		schema.checkInstances(mod, view(mod), &errs)
+		return errs.err()
+	}
+}
+
+// moduleEntry returns the module of the schema tree holding e.
+func moduleEntry(e *yang.Entry) *yang.Entry {
+	for e.Parent != nil {
+		e = e.Parent
+	}
+	return e
+}
+
+// inapplicable adds to removed the node n if one of its when expressions is
+// false, or else its descendants for which one is.
+func (schema *Schema) inapplicable(n *xpathNode, removed *[]*xpathNode) {
+	if c := schema.constraints[n.entry]; c != nil {
+		for _, when := range c.when {
+			at := n
+			if when.parent {
+				at = n.parent
+			}
+			if !xpathBool(when.expr(&xpathContext{node: at, current: at})) {
+				*removed = append(*removed, n)
+				return
+			}
+		}
+	}
+	for _, child := range n.children() {
+		schema.inapplicable(child, removed)
+	}
+}
+
+// checkConstraints adds an error to errs for the node n and every
+// descendant of it violating one of its must expressions.
+func (schema *Schema) checkConstraints(n *xpathNode, errs *ErrorList) {
+	if c := schema.constraints[n.entry]; c != nil {
+		for _, must := range c.must {
+			if !xpathBool(must.expr(&xpathContext{node: n, current: n})) {
+				errs.add(errorAt(mustViolation(n.entry, must), schema.nodePath(n)))
+			}
+		}
+	}
+	for _, child := range n.children() {
+		schema.checkConstraints(child, errs)
+	}
+}
+
+// nodePath returns the error-path of the data node n, nil for the root.
+func (schema *Schema) nodePath(n *xpathNode) *ErrorPath {
+	if n.parent == nil {
+		return nil
+	}
+	var values []string
+	if n.entry.IsList() || n.entry.IsLeafList() {
+		values = instanceKeys(n.entry, n.value)
+	}
+	return schema.errorPath(schema.nodePath(n.parent), n.entry, values)
+}
+
+// mustViolation returns the error of the node e violating must, carrying the
+// error-message and error-app-tag of the must statement if it has them.
+func mustViolation(e *yang.Entry, must xpathConstraint) *RestConfError {
+	err := NewError(http.StatusBadRequest, ERROR_TYPE_APPLICATION, ERROR_TAG_OPERATION_FAILED,
+		"%s violates the must condition %q", e.Name, must.text)
+	err.AppTag = ERROR_APP_TAG_MUST_VIOLATION
+	if must.must.ErrorMessage != nil {
+		err.Message = must.must.ErrorMessage.Name
+	}
+	if must.must.ErrorAppTag != nil {
+		err.AppTag = must.must.ErrorAppTag.Name
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   Copy and move are vendor extensions: a POST to the datastore resource with
+   the copy media type copies the data at the source resource to the
+   destination resource, replacing the data there, in a single transaction.
+
+   {
+     "go-restconf:copy" : {
+       "source" : "/example:system/interface=eth0",
+       "destination" : "/example:system/interface=eth1"
+     }
+   }
+
+   A go-restconf:move member moves the data instead, removing it from the
+   source. The source data must be valid data of the destination, the key
+   leafs of a copied list entry take the keys of the destination, and the
+   copy must leave both modules valid. The response is 201, or 204 if the
+   destination was replaced, with the destination as Location.
+*/
+
+var APPLICATION_COPY_JSON = "application/vnd.go-restconf.copy+json"
+
+type CopyRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+type CopyRequestJson struct {
+	Copy *CopyRequest `json:"go-restconf:copy,omitempty"`
+	Move *CopyRequest `json:"go-restconf:move,omitempty"`
+}
+
+// copyData handles a copy, or move, of the data at the source resource of
+// the body to its destination resource.
+func (restconf *RestConf) copyData(rsp http.ResponseWriter, req *http.Request) {
+	var doc CopyRequestJson
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		writeError(rsp, req, malformed("invalid copy request: %s", err.Error()))
+		return
+	}
+	cp, move := doc.Copy, doc.Move != nil
+	if move {
+		cp = doc.Move
+	}
+	if cp == nil || doc.Copy != nil && move {
+		writeError(rsp, req, malformed("expected a single go-restconf:copy or go-restconf:move member"))
+		return
+	}
+
+	schema := restconf.schemaOf(req)
+	source, err := copyResource(schema, "source", cp.Source)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	target, err := copyResource(schema, "destination", cp.Destination)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	switch e := target.Entry(); {
+	case e.ReadOnly():
+		err = invalidValue("destination %s is state data (config false)", e.Name)
+	case sameInstance(source, target):
+		err = invalidValue("source and destination are the same resource")
+	case move && within(target, source):
+		err = invalidValue("%s cannot be moved into itself", source.Entry().Name)
+	}
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	op := ACCESS_UPDATE
+	if !restconf.store.Exists(target) {
+		op = ACCESS_CREATE
+	}
+	convert := func(v interface{}) (interface{}, error) {
+		if !restconf.permit(req, ACCESS_READ, source.Entry()) {
+			return nil, dataMissing(source)
+		}
+		if !restconf.permitTree(req, ACCESS_READ, source.Entry(), v) {
+			return nil, accessDenied(ACCESS_READ, source.Entry())
+		}
+		if move && !restconf.permitTree(req, ACCESS_DELETE, source.Entry(), v) {
+			return nil, accessDenied(ACCESS_DELETE, source.Entry())
+		}
+		value, err := schema.copyValue(req, source, target, v)
+		if err != nil {
+			return nil, err
+		}
+		if !restconf.permitTree(req, op, target.Entry(), value) {
+			return nil, accessDenied(op, target.Entry())
+		}
+		return value, nil
+	}
+
+	// The instances required in other modules are checked before the copy
+	// locks the modules of the source and destination.
+	if v, ok := restconf.store.Get(source); ok {
+		value, err := convert(v)
+		if err == nil {
+			err = restconf.foreignInstances(schema, target, value)
+		}
+		if err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+	}
+
+	status, err := restconf.store.Copy(source, target, move, convert, schema.constraintCheck, func(changes []*Change) error {
+		return restconf.commitChanges(req, changes)
+	})
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	rsp.Header().Set("Location", target.URL())
+	rsp.WriteHeader(status)
+}
+
+// within reports whether the resource r is a descendant of the resource of.
+func within(r, of *Resource) bool {
+	n := len(of.Segments)
+	return len(r.Segments) > n && sameInstance(of, &Resource{Segments: r.Segments[:n], Entries: r.Entries[:n]})
+}
+
+// copyResource resolves the source or destination path of a copy, a data
+// resource identifier like the point parameter.
+func copyResource(schema *Schema, what, path string) (*Resource, error) {
+	segs, err := ParsePath(strings.TrimPrefix(path, RESTCONF_PREFIX+"/data"))
+	if err != nil {
+		return nil, invalidValue("invalid %s %q: %s", what, path, err.Error())
+	}
+	if len(segs) == 0 {
+		return nil, invalidValue("%s %q addresses no data node", what, path)
+	}
+	r, err := schema.Resolve(segs)
+	if err != nil {
+		return nil, err
+	}
+	switch e := r.Entry(); {
+	case isOperation(e):
+		return nil, invalidValue("%s %q addresses an operation", what, path)
+	case (e.IsList() || e.IsLeafList()) && r.Segment().Keys == nil:
+		return nil, invalidValue("%s %q: %s can only be copied by entry", what, path, e.Name)
+	}
+	return r, nil
+}
+
+// copyValue returns the data v at source as data of target. v is encoded as
+// JSON and decoded as the data of target, checking it against the schema of
+// target, and the key leafs of a list entry take the keys of target.
+func (schema *Schema) copyValue(req *http.Request, source, target *Resource, v interface{}) (interface{}, error) {
+	if source.Segment().Keys != nil {
+		v = []interface{}{v}
+	}
+	doc := schema.encode(APPLICATION_DATA_JSON, source.Entry(), v)
+
+	e := target.Entry()
+	_, value, err := schema.decodeJSON(req, bytes.NewReader(doc), schema.resourcePath(target.Parent()),
+		func(mod, name string) *yang.Entry { return e })
+	if err != nil {
+		return nil, err
+	}
+
+	keys := target.Segment().Keys
+	if keys == nil {
+		return value, nil
+	}
+	values, _ := value.([]interface{})
+	if len(values) != 1 {
+		return nil, invalidValue("%s is not an entry of %s", source.Entry().Name, e.Name)
+	}
+	if e.IsLeafList() {
+		return values[0], matchKeys(e, values[0], keys)
+	}
+	entry, _ := values[0].(map[string]interface{})
+	for i, name := range keyNames(e) {
+		entry[name] = keys[i]
+	}
+	return entry, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCopyData(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0,"mtu":1500,"ipv4":{"address":"192.0.2.1"}}]}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for _, test := range []struct {
+		op, source, destination string
+		status                  int
+		location                string
+	}{
+		{"copy", "/test:system/interface=eth0,0", "/test:system/interface=eth1,0", http.StatusCreated, "/restconf/data/test:system/interface=eth1,0"},
+		{"copy", "/restconf/data/test:system/interface=eth0,0", "/test:system/interface=eth1,0", http.StatusNoContent, "/restconf/data/test:system/interface=eth1,0"},
+		{"move", "/test:system/interface=eth1,0", "/test:system/interface=eth%202,1", http.StatusCreated, "/restconf/data/test:system/interface=eth%202,1"},
+		{"copy", "/test:system/interface=eth1,0", "/test:system/interface=eth3,0", http.StatusNotFound, ""},
+		{"move", "/test:system/interface=eth0,0/ipv4", "/test:system/interface=eth0,0/ipv4/dhcp", http.StatusBadRequest, ""},
+		{"move", "/test:system/hostname", "/test:system/counter", http.StatusBadRequest, ""},
+		{"copy", "/test:system/hostname", "/test:system/uptime", http.StatusBadRequest, ""},
+		{"copy", "/test:system/hostname", "/test:system/hostname", http.StatusBadRequest, ""},
+		{"copy", "/test:system/interface", "/test:system/interface=eth3,0", http.StatusBadRequest, ""},
+		{"copy", "/test:system/interface=eth0,0/reset", "/test:system", http.StatusBadRequest, ""},
+		{"copy", "/test:system/nothing", "/test:system/hostname", http.StatusBadRequest, ""},
+	} {
+		body := `{"go-restconf:` + test.op + `":{"source":"` + test.source + `","destination":"` + test.destination + `"}}`
+		rsp := doRequest(server, "POST", "/restconf/data", APPLICATION_COPY_JSON, body)
+		if rsp.Code != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", body, rsp.Code, test.status, rsp.Body)
+			continue
+		}
+		if location := rsp.Header().Get("Location"); location != test.location {
+			t.Errorf("%s: got Location %q, want %q", body, location, test.location)
+		}
+	}
+
+	for url, want := range map[string]string{
+		"/restconf/data/test:system/interface=eth0,0":      `{"test:interface":[{"ipv4":{"address":"192.0.2.1"},"mtu":1500,"name":"eth0","unit":0}]}`,
+		"/restconf/data/test:system/interface=eth%202,1":   `{"test:interface":[{"ipv4":{"address":"192.0.2.1"},"mtu":1500,"name":"eth 2","unit":1}]}`,
+		"/restconf/data/test:system/interface=eth1,0":      "",
+		"/restconf/data/test:system/hostname":              `{"test:hostname":"a"}`,
+		"/restconf/data/test:system/interface=eth0,0/ipv4": `{"test:ipv4":{"address":"192.0.2.1"}}`,
+	} {
+		rsp := doRequest(server, "GET", url, "", "")
+		switch {
+		case want == "" && rsp.Code != http.StatusNotFound:
+			t.Errorf("GET %s: got status %d, want %d", url, rsp.Code, http.StatusNotFound)
+		case want != "" && rsp.Body.String() != want:
+			t.Errorf("GET %s: got %s, want %s", url, rsp.Body, want)
+		}
+	}
+
+	for _, body := range []string{
+		`{"go-restconf:copy":{"source":"/test:system/hostname","destination":"/test:system/hostname"},"go-restconf:move":{}}`,
+		`{"go-restconf:copy":{"source":"/test:system/hostname","target":"/test:system/hostname"}}`,
+		`{}`,
+		`{"go-restconf:copy":`,
+	} {
+		rsp := doRequest(server, "POST", "/restconf/data", APPLICATION_COPY_JSON, body)
+		if rsp.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", body, rsp.Code, http.StatusBadRequest)
+		}
+	}
+}
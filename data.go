@@ -0,0 +1,542 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+func (restconf *RestConf) Data(rsp http.ResponseWriter, req *http.Request) {
+
+	r, err := restconf.resource(req, RESTCONF_PREFIX+"/data")
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	if req.Method == "OPTIONS" {
+		restconf.dataOptions(rsp, r)
+		return
+	}
+
+	params, err := queryParams(req)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	if r != nil && isAction(r.Entry()) {
+		if !allowMethods(rsp, req, restconf.operationMethods(r.Entry())...) {
+			return
+		}
+		restconf.invoke(rsp, req, r)
+		return
+	}
+
+	// State data is only read, a write of it fails before its body is
+	// looked at.
+	if r != nil && req.Method != "GET" && req.Method != "HEAD" && r.Entry().ReadOnly() {
+		rsp.Header().Set("Allow", strings.Join(restconf.dataMethods(r), ", "))
+		writeError(rsp, req, stateWrite(req, r.Entry()))
+		return
+	}
+	if methods := restconf.dataMethods(r); readOnlyData() && !hasMethod(methods, req.Method) && !readingPost(req, r) {
+		rsp.Header().Set("Allow", strings.Join(methods, ", "))
+		MethodNotAllowed(rsp, req)
+		return
+	}
+
+	if isWrite(req, r) {
+		if err := readBody(rsp, req); err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+		done, err := restconf.lock.write(req)
+		if err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+		defer done()
+	}
+
+	switch req.Method {
+	case "GET", "HEAD":
+		{
+			if r == nil {
+				restconf.getDatastore(rsp, req, params)
+				return
+			}
+			restconf.getData(rsp, req, r, params)
+		}
+	case "POST":
+		{
+			if r == nil {
+				switch mediaType(req.Header.Get("Content-Type")) {
+				case APPLICATION_BATCH_JSON:
+					restconf.batchData(rsp, req)
+					return
+				case APPLICATION_COPY_JSON:
+					restconf.copyData(rsp, req)
+					return
+				case APPLICATION_DIFF_JSON:
+					restconf.diffData(rsp, req)
+					return
+				case APPLICATION_LOCK_JSON:
+					restconf.lockData(rsp, req)
+					return
+				}
+			}
+			restconf.createData(rsp, req, r)
+		}
+	case "PUT", "PATCH", "DELETE":
+		{
+			if req.Method == "PATCH" && isYangPatch(req) {
+				restconf.yangPatch(rsp, req, r)
+				return
+			}
+			if r == nil && req.Method == "PATCH" {
+				rsp.Header().Set("Accept-Patch", strings.Join(patchFormats(r), ", "))
+				writeError(rsp, req, NewError(http.StatusUnsupportedMediaType, ERROR_TYPE_PROTOCOL, ERROR_TAG_INVALID_VALUE,
+					"the datastore resource is only patched with %s", strings.Join(patchFormats(r), " or ")))
+				return
+			}
+			if r == nil {
+				rsp.Header().Set("Allow", strings.Join(restconf.dataMethods(r), ", "))
+				MethodNotAllowed(rsp, req)
+				return
+			}
+			restconf.editData(rsp, req, r)
+		}
+	default:
+		{
+			rsp.Header().Set("Allow", strings.Join(restconf.dataMethods(r), ", "))
+			MethodNotAllowed(rsp, req)
+		}
+	}
+}
+
+// readingPost reports whether req is a POST of the datastore resource that
+// only reads the data, a batch retrieval or a diff.
+func readingPost(req *http.Request, r *Resource) bool {
+	switch mediaType(req.Header.Get("Content-Type")) {
+	case APPLICATION_BATCH_JSON, APPLICATION_DIFF_JSON:
+		return r == nil && req.Method == "POST"
+	}
+	return false
+}
+
+// PATCH_FORMATS lists the media types of the plain PATCH bodies the server
+// accepts (RFC 8040 section 4.6.1), YANG_PATCH_FORMATS those of the YANG
+// patches.
+var PATCH_FORMATS = []string{APPLICATION_DATA_JSON, APPLICATION_DATA_XML}
+
+// dataMethods returns the methods the data resource r supports, r being nil
+// for the datastore itself.
+func (restconf *RestConf) dataMethods(r *Resource) []string {
+	switch {
+	case r == nil:
+		return readOnly([]string{"GET", "HEAD", "POST", "PATCH", "OPTIONS"})
+	case isAction(r.Entry()):
+		return append(restconf.operationMethods(r.Entry()), "OPTIONS")
+	case r.Entry().ReadOnly() || r.Entry().IsList() && r.Segment().Keys == nil:
+		return []string{"GET", "HEAD", "OPTIONS"}
+	case !r.Entry().IsDir():
+		return readOnly([]string{"GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	}
+	return readOnly([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+}
+
+// stateWrite returns the error of a write by req of the state data node e.
+func stateWrite(req *http.Request, e *yang.Entry) *RestConfError {
+	return NewError(http.StatusMethodNotAllowed, ERROR_TYPE_APPLICATION, ERROR_TAG_OPERATION_NOT_SUPPORTED,
+		"%s is state data (config false), it cannot be written with %s", e.Name, req.Method)
+}
+
+// dataOptions answers an OPTIONS request of the data resource r with the
+// methods it supports, and the media types of its PATCH bodies if it
+// supports PATCH.
+func (restconf *RestConf) dataOptions(rsp http.ResponseWriter, r *Resource) {
+	methods := restconf.dataMethods(r)
+	rsp.Header().Set("Allow", strings.Join(methods, ", "))
+	for _, method := range methods {
+		if method == "PATCH" {
+			rsp.Header().Set("Accept-Patch", strings.Join(patchFormats(r), ", "))
+		}
+	}
+	rsp.WriteHeader(http.StatusOK)
+}
+
+func (restconf *RestConf) getData(rsp http.ResponseWriter, req *http.Request, r *Resource, params *readParams) {
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	offset, limit, cursor, paged, err := pageParams(req)
+	if err == nil && params.keysOnly {
+		err = keysOnlyTarget(r)
+	}
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	var value interface{}
+	if paged {
+		value, err = restconf.readPage(rsp, req, r, offset, limit, cursor)
+	} else {
+		value, err = restconf.readData(req, r)
+	}
+	schema := restconf.schemaOf(req)
+	var truncated bool
+	if err == nil {
+		value, truncated, err = params.apply(schema, r.Entry(), value)
+		if value == nil && err == nil {
+			err = dataMissing(r)
+		}
+	}
+	if params.keysOnly && restconf.emptyList(req, r, err) {
+		value, err = []interface{}{}, nil
+	}
+	if err == nil && !paged {
+		err = checkEntries(r.Entry(), value, params.entriesCap())
+	}
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	// Data that cannot be encoded fails before the status is sent.
+	if err := schema.checkDepth(r.Entry(), value, entryDepth(r.Entry())); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	if err := validResponse(req, schema, r.Entry(), value); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	// Link the module defining the node (RFC 8040 section 3.7).
+	describedby := schema.moduleURL(schema.ModuleOf(r.Entry()))
+	rsp.Header().Add("Link", "<"+absoluteURL(req, describedby, nil)+`>; rel="describedby"`)
+	if truncated {
+		rsp.Header().Add("Warning", fmt.Sprintf(DEPTH_WARNING, params.depth))
+	}
+
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return
+	}
+
+	// The status is already sent, a failing write can only cut the body
+	// short.
+	if err := schema.encodeTagged(rsp, format, r.Entry(), value, params.tagged()); err != nil {
+		logRequest(req, "write data response failed!", err.Error())
+	}
+}
+
+// getDatastore sends the datastore resource, the data of the top-level
+// nodes of every module the user of req may read, as params select it.
+func (restconf *RestConf) getDatastore(rsp http.ResponseWriter, req *http.Request, params *readParams) {
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	if params.fields != "" || params.keysOnly {
+		name := FIELDS_PARAM
+		if params.keysOnly {
+			name = KEYS_ONLY_PARAM
+		}
+		writeError(rsp, req, invalidValue("the %s parameter is not supported on the datastore resource", name))
+		return
+	}
+
+	schema := restconf.schemaOf(req)
+	var nodes []dataNode
+	var truncated bool
+	for _, mod := range schema.ModuleNames() {
+		for _, e := range dataChildren(schema.Modules[mod]) {
+			r := &Resource{Segments: []PathSegment{{Module: mod, Name: e.Name}}, Entries: []*yang.Entry{e}}
+			value, err := restconf.readData(req, r)
+			if rerr, ok := err.(*RestConfError); ok && rerr.Tag == ERROR_TAG_DATA_MISSING {
+				continue // no data, or none the user may read
+			}
+			if err != nil {
+				writeError(rsp, req, err)
+				return
+			}
+			// The top-level nodes are the children of the datastore, at
+			// level 2 of the depth parameter.
+			value, cut, _ := params.applyAt(schema, e, value, 2)
+			truncated = truncated || cut
+			if value == nil {
+				continue
+			}
+			if err := checkEntries(e, value, params.entriesCap()); err != nil {
+				writeError(rsp, req, err)
+				return
+			}
+			// Data that cannot be encoded fails before the status is sent.
+			if err := schema.checkDepth(e, value, entryDepth(e)); err != nil {
+				writeError(rsp, req, err)
+				return
+			}
+			if err := validResponse(req, schema, e, value); err != nil {
+				writeError(rsp, req, err)
+				return
+			}
+			nodes = append(nodes, dataNode{e, value})
+		}
+	}
+	if params.depth == 1 && len(nodes) > 0 {
+		nodes, truncated = nil, true
+	}
+
+	if truncated {
+		rsp.Header().Add("Warning", fmt.Sprintf(DEPTH_WARNING, params.depth))
+	}
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return
+	}
+	if err := schema.encodeDatastore(rsp, format, nodes, params.tagged()); err != nil {
+		logRequest(req, "write data response failed!", err.Error())
+	}
+}
+
+// validResponse checks the data v of the node e a response to req sends
+// when CHECK_RESPONSES is set. Data that does not match the schema is a
+// fault of the server, it fails the request without the details.
+func validResponse(req *http.Request, schema *Schema, e *yang.Entry, v interface{}) error {
+	if !CHECK_RESPONSES {
+		return nil
+	}
+	if err := schema.checkResponse(req, e, v); err != nil {
+		logRequest(req, "invalid response data!", err.Error())
+		return NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+			ERROR_TAG_OPERATION_FAILED, "the data of %s does not match the schema", e.Name)
+	}
+	return nil
+}
+
+// readData returns the data at r the user of req may read, in the form it is
+// encoded in: a list entry or leaf-list value is wrapped in a slice.
+func (restconf *RestConf) readData(req *http.Request, r *Resource) (interface{}, error) {
+	// Nodes the user may not read are hidden, as if they did not exist.
+	var value interface{}
+	var ok bool
+	switch module := r.Segments[0].Module; {
+	case module == SCHEMA_MOUNT_MODULE:
+		value, ok = restconf.schemaOf(req).readMounts(r)
+	case module == MONITORING_MODULE:
+		value, ok = restconf.readMonitoring(req, r)
+	case restconf.hasState(r):
+		// The providers are not asked for data the user may not read.
+		if !restconf.permit(req, ACCESS_READ, r.Entry()) {
+			return nil, dataMissing(r)
+		}
+		var err error
+		if value, ok, err = restconf.readState(req, r); err != nil {
+			return nil, err
+		}
+	default:
+		value, ok = restconf.store.Get(r)
+	}
+	if !ok || !restconf.permit(req, ACCESS_READ, r.Entry()) {
+		return nil, dataMissing(r)
+	}
+	value = restconf.filterRead(req, r.Entry(), value)
+	if r.Segment().Keys != nil {
+		value = []interface{}{value}
+	}
+	return value, nil
+}
+
+// createData handles a POST creating the child resource held in the body
+// within r, or a top-level node when r is nil.
+func (restconf *RestConf) createData(rsp http.ResponseWriter, req *http.Request, r *Resource) {
+	var parent *yang.Entry
+	if r != nil {
+		parent = r.Entry()
+		if (parent.IsList() && r.Segment().Keys == nil) || !parent.IsDir() {
+			writeError(rsp, req, invalidValue("cannot create data within %s", parent.Name))
+			return
+		}
+	}
+
+	schema := restconf.schemaOf(req)
+	e, value, err := schema.decodeChild(req, schema.resourcePath(r), parent)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	if e.ReadOnly() {
+		rsp.Header().Set("Allow", strings.Join(restconf.dataMethods(r), ", "))
+		writeError(rsp, req, stateWrite(req, e))
+		return
+	}
+
+	seg := PathSegment{Name: e.Name}
+	if r == nil || schema.ModuleOf(e) != schema.ModuleOf(parent) {
+		seg.Module = schema.ModuleOf(e)
+	}
+	if e.IsList() || e.IsLeafList() {
+		values, _ := value.([]interface{})
+		if len(values) != 1 {
+			writeError(rsp, req, invalidValue("expected a single %s entry, got %d", e.Name, len(values)))
+			return
+		}
+		value = values[0]
+		seg.Keys = instanceKeys(e, value)
+		if seg.Keys == nil {
+			writeError(rsp, req, errorAt(missingElement("%s entry is missing key leafs %s", e.Name, e.Key),
+				schema.errorPath(schema.resourcePath(r), e, nil)))
+			return
+		}
+	}
+
+	if !restconf.permitTree(req, ACCESS_CREATE, e, value) {
+		writeError(rsp, req, accessDenied(ACCESS_CREATE, e))
+		return
+	}
+
+	child := &Resource{Segments: []PathSegment{seg}, Entries: []*yang.Entry{e}}
+	if r != nil {
+		child.Segments = append(append([]PathSegment{}, r.Segments...), seg)
+		child.Entries = append(append([]*yang.Entry{}, r.Entries...), e)
+	}
+
+	ins, err := schema.insertion(req, child)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	if err := restconf.foreignInstances(schema, child, value); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	status, err := restconf.store.Edit(req.Method, child, value, ins, schema.constraintCheck(child), restconf.commitEdit(req, child))
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	// The Location is built from the resolved path rather than the
+	// request URL, whose decoded path has lost the encoding of the keys.
+	rsp.Header().Set("Location", child.URL())
+	rsp.WriteHeader(status)
+}
+
+// editData handles a PUT, PATCH or DELETE of the resource r.
+func (restconf *RestConf) editData(rsp http.ResponseWriter, req *http.Request, r *Resource) {
+	e := r.Entry()
+	if e.IsList() && r.Segment().Keys == nil {
+		writeError(rsp, req, invalidValue("list %s can only be edited by entry", e.Name))
+		return
+	}
+
+	schema := restconf.schemaOf(req)
+	var value interface{}
+	if req.Method != "DELETE" {
+		var err error
+		value, err = schema.decode(req, schema.resourcePath(r.Parent()), e)
+		if err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+
+		if keys := r.Segment().Keys; keys != nil {
+			values, _ := value.([]interface{})
+			if len(values) != 1 {
+				writeError(rsp, req, invalidValue("expected a single %s entry, got %d", e.Name, len(values)))
+				return
+			}
+			value = values[0]
+			if err := matchKeys(e, value, keys); err != nil {
+				writeError(rsp, req, err)
+				return
+			}
+		}
+	}
+
+	op := ACCESS_UPDATE
+	switch {
+	case req.Method == "DELETE":
+		op = ACCESS_DELETE
+	case req.Method == "PUT" && !restconf.store.Exists(r):
+		op = ACCESS_CREATE
+	}
+	if !restconf.permitTree(req, op, e, value) {
+		writeError(rsp, req, accessDenied(op, e))
+		return
+	}
+
+	ins, err := schema.insertion(req, r)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	if err := restconf.foreignInstances(schema, r, value); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	status, err := restconf.store.Edit(req.Method, r, value, ins, schema.constraintCheck(r), restconf.commitEdit(req, r))
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	rsp.WriteHeader(status)
+}
+
+// instanceKeys returns the key values of the list entry or leaf-list value
+// v, or nil if a key leaf is missing.
+func instanceKeys(e *yang.Entry, v interface{}) []string {
+	if e.IsLeafList() {
+		s, _ := v.(string)
+		return []string{s}
+	}
+	entry, _ := v.(map[string]interface{})
+	var keys []string
+	for _, name := range keyNames(e) {
+		key, ok := entry[name].(string)
+		if !ok {
+			return nil
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// matchKeys checks that the list entry or leaf-list value v has the key
+// values given in the resource path. Missing key leafs are filled in.
+func matchKeys(e *yang.Entry, v interface{}, keys []string) error {
+	if e.IsLeafList() {
+		if v != keys[0] {
+			return invalidValue("value %v does not match the resource value %s", v, keys[0])
+		}
+		return nil
+	}
+
+	entry, _ := v.(map[string]interface{})
+	for i, name := range keyNames(e) {
+		key, ok := entry[name]
+		if !ok {
+			entry[name] = keys[i]
+			continue
+		}
+		if key != keys[i] {
+			return invalidValue("key %s %v does not match the resource key %s", name, key, keys[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDataEdits(t *testing.T) {
+	server := testServer(t)
+
+	steps := []struct {
+		method string
+		url    string
+		body   string
+		status int
+		want   string
+	}{
+		{"GET", "/restconf/data/test:system", "", http.StatusNotFound, ""},
+		{"PATCH", "/restconf/data/test:system", `{"test:system":{"hostname":"a"}}`, http.StatusNotFound, ""},
+		{"DELETE", "/restconf/data/test:system", "", http.StatusNotFound, ""},
+		{"PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"a"}}`, http.StatusCreated, ""},
+		{"PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"b"}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"b"}}`},
+		{"POST", "/restconf/data/test:system", `{"test:interface":[{"name":"eth0","unit":0}]}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data/test:system", `{"test:interface":[{"name":"eth0","unit":0}]}`, http.StatusConflict, ""},
+		{"PATCH", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"mtu":1500}]}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/test:system/interface=eth0,0", "", http.StatusOK, `{"test:interface":[{"mtu":1500,"name":"eth0","unit":0}]}`},
+		{"PUT", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"name":"eth1","unit":0}]}`, http.StatusBadRequest, ""},
+		{"DELETE", "/restconf/data/test:system/interface=eth0,0", "", http.StatusNoContent, ""},
+		{"DELETE", "/restconf/data/test:system/interface=eth0,0", "", http.StatusNotFound, ""},
+		{"GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"b"}}`},
+		{"DELETE", "/restconf/data/test:system", "", http.StatusNoContent, ""},
+		{"POST", "/restconf/data", `{"test:system":{"hostname":"c"}}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data", `{"test:system":{"hostname":"c"}}`, http.StatusConflict, ""},
+	}
+
+	for i, step := range steps {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("step %d: %s %s: got status %d, want %d: %s", i, step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("step %d: %s %s: got body %s, want %s", i, step.method, step.url, rsp.Body, step.want)
+		}
+	}
+}
+
+func TestDataKeyValues(t *testing.T) {
+	server := testServer(t)
+
+	for _, step := range []struct {
+		method, url, body string
+		status            int
+	}{
+		// A key value that is not valid for its key leaf is refused, also
+		// where the body leaves the key out.
+		{"PUT", "/restconf/data/test:system/interface=eth0,abc", `{"test:interface":[{"name":"eth0"}]}`, http.StatusBadRequest},
+		{"GET", "/restconf/data/test:system", "", http.StatusNotFound},
+		// A key value addresses the entry of its canonical form.
+		{"PUT", "/restconf/data/test:system/interface=eth2,1", `{"test:interface":[{"name":"eth2","unit":1}]}`, http.StatusCreated},
+		{"GET", "/restconf/data/test:system/interface=eth2,01", "", http.StatusOK},
+		{"PUT", "/restconf/data/test:system/interface=eth1,01", `{"test:interface":[{"name":"eth1","unit":1}]}`, http.StatusCreated},
+		{"DELETE", "/restconf/data/test:system/interface=eth1,1", "", http.StatusNoContent},
+		{"PUT", "/restconf/data/test:system/interface=eth1,01", `{"test:interface":[{"name":"eth1","unit":2}]}`, http.StatusBadRequest},
+	} {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Errorf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+	}
+	want := `{"test:system":{"interface":[{"name":"eth2","unit":1}]}}`
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system", "", ""); rsp.Body.String() != want {
+		t.Errorf("GET: got %s, want %s", rsp.Body, want)
+	}
+}
+
+func TestDuplicateInstances(t *testing.T) {
+	server := testServer(t)
+	ord := NewRestConf(testSchema(t, map[string]string{"ord": orderedModuleText}))
+
+	for _, test := range []struct {
+		server      *RestConf
+		method, url string
+		ctype, body string
+		path        string
+	}{
+		{server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			`{"test:system":{"interface":[{"name":"a","unit":1},{"name":"a","unit":1,"mtu":1500}]}}`, "/test:system/interface"},
+		{server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML,
+			`<system xmlns="urn:test"><interface><name>a</name><unit>1</unit></interface><interface><name>a</name><unit>01</unit></interface></system>`,
+			"/test:system/test:interface"},
+		{server, "POST", "/restconf/data", APPLICATION_DATA_JSON,
+			`{"test:system":{"hostname":"a","hostname":"b"}}`, ""},
+		{ord, "PUT", "/restconf/data/ord:system", APPLICATION_DATA_JSON,
+			`{"ord:system":{"tag":["x","y","x"]}}`, "/ord:system/tag"},
+		{ord, "PUT", "/restconf/data/ord:system", APPLICATION_DATA_XML,
+			`<system xmlns="urn:ord"><tag>x</tag><tag>x</tag></system>`, "/ord:system/ord:tag"},
+	} {
+		rsp := doRequest(test.server, test.method, test.url, test.ctype, test.body)
+		if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), "invalid-value") {
+			t.Errorf("%s %s: got status %d, want an invalid-value error: %s", test.method, test.body, rsp.Code, rsp.Body)
+			continue
+		}
+		if test.path != "" && !strings.Contains(rsp.Body.String(), test.path) {
+			t.Errorf("%s %s: got %s, want the error-path %s", test.method, test.body, rsp.Body, test.path)
+		}
+	}
+}
+
+func TestDataCreateLocation(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		url, body string
+		location  string
+	}{
+		{"/restconf/data/test:system", `{"test:interface":[{"name":"eth/1","unit":2}]}`,
+			"/restconf/data/test:system/interface=eth%2F1,2"},
+		{"/restconf/data/test:system", `{"test:interface":[{"name":"eth 0","unit":0}]}`,
+			"/restconf/data/test:system/interface=eth%200,0"},
+		{"/restconf/data/test:system/", `{"test:interface":[{"name":"a,b","unit":1}]}`,
+			"/restconf/data/test:system/interface=a%2Cb,1"},
+		{"/restconf/data/test:system", `{"test:interface":[{"name":"50%;x?","unit":3}]}`,
+			"/restconf/data/test:system/interface=50%25%3Bx%3F,3"},
+		{"/restconf/data/test:system/interface=eth%2F1,2", `{"test:ipv4":{"address":"192.0.2.1"}}`,
+			"/restconf/data/test:system/interface=eth%2F1,2/ipv4"},
+		{"/restconf/data/test:system/interface=a%2Cb,1/ipv4", `{"test:dhcp":{"enabled":true}}`,
+			"/restconf/data/test:system/interface=a%2Cb,1/ipv4/dhcp"},
+	} {
+		rsp := doRequest(server, "POST", test.url, APPLICATION_DATA_JSON, test.body)
+		if rsp.Code != http.StatusCreated {
+			t.Errorf("POST %s %s: got status %d, want %d: %s", test.url, test.body, rsp.Code, http.StatusCreated, rsp.Body)
+			continue
+		}
+		location := rsp.Header().Get("Location")
+		if location != test.location {
+			t.Errorf("POST %s %s: got Location %s, want %s", test.url, test.body, location, test.location)
+			continue
+		}
+		// The Location addresses the created resource.
+		if rsp := doRequest(server, "GET", location, "", ""); rsp.Code != http.StatusOK {
+			t.Errorf("GET %s: got status %d, want %d: %s", location, rsp.Code, http.StatusOK, rsp.Body)
+		}
+	}
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n < len(p) {
+		n := w.n
+		w.n = 0
+		return n, errors.New("connection reset")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestEncodeStream(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+	e := schema.Modules["test"].Dir["system"]
+
+	var interfaces []interface{}
+	for i := 0; i < 1000; i++ {
+		interfaces = append(interfaces, map[string]interface{}{
+			"name": fmt.Sprintf("eth%d", i), "unit": "0", "mtu": "1500",
+		})
+	}
+	system := map[string]interface{}{"hostname": "a", "interface": interfaces}
+
+	for _, format := range []string{APPLICATION_DATA_JSON, APPLICATION_DATA_XML} {
+		var buf bytes.Buffer
+		if err := schema.encodeTo(&buf, format, e, system); err != nil {
+			t.Fatalf("%s: encodeTo: %v", format, err)
+		}
+		if want := schema.encode(format, e, system); !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: streamed document differs from the encoded one", format)
+		}
+
+		if err := schema.encodeTo(&failingWriter{n: 10000}, format, e, system); err == nil {
+			t.Errorf("%s: encodeTo did not report the write error", format)
+		}
+	}
+}
+
+func TestDataOptions(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		url, allow, acceptPatch string
+	}{
+		{"/restconf/data", "GET, HEAD, POST, PATCH, OPTIONS", "application/yang-patch+json, application/yang-patch+xml"},
+		{"/restconf/data/test:system", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+			"application/yang-data+json, application/yang-data+xml, application/yang-patch+json, application/yang-patch+xml"},
+		{"/restconf/data/test:system/hostname", "GET, HEAD, PUT, PATCH, DELETE, OPTIONS",
+			"application/yang-data+json, application/yang-data+xml, application/yang-patch+json, application/yang-patch+xml"},
+		{"/restconf/data/test:system/interface", "GET, HEAD, OPTIONS", ""},
+		{"/restconf/data/test:system/interface=eth0,0/reset", "POST, OPTIONS", ""},
+	} {
+		rsp := doRequest(server, "OPTIONS", test.url, "", "")
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("OPTIONS %s: got status %d, want %d: %s", test.url, rsp.Code, http.StatusOK, rsp.Body)
+		}
+		if got := rsp.Header().Get("Allow"); got != test.allow {
+			t.Errorf("OPTIONS %s: got Allow %q, want %q", test.url, got, test.allow)
+		}
+		if got, ok := rsp.Header()["Accept-Patch"]; ok != (test.acceptPatch != "") || ok && got[0] != test.acceptPatch {
+			t.Errorf("OPTIONS %s: got Accept-Patch %q, want %q", test.url, got, test.acceptPatch)
+		}
+	}
+}
+
+func TestStateWrite(t *testing.T) {
+	server := testServer(t)
+
+	for _, step := range []struct {
+		method, url, body string
+	}{
+		{"PUT", "/restconf/data/test:system/uptime", `{"test:uptime":10}`},
+		{"PATCH", "/restconf/data/test:system/uptime", `{"test:uptime":10}`},
+		{"DELETE", "/restconf/data/test:system/uptime", ""},
+		{"POST", "/restconf/data/test:system", `{"test:uptime":10}`},
+	} {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, http.StatusMethodNotAllowed, rsp.Body)
+		}
+		if !bytes.Contains(rsp.Body.Bytes(), []byte(`"error-type":"application","error-tag":"operation-not-supported"`)) {
+			t.Errorf("%s %s: got %s, want an application operation-not-supported error", step.method, step.url, rsp.Body)
+		}
+		if step.method != "POST" && rsp.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("%s %s: got Allow %q, want the read methods", step.method, step.url, rsp.Header().Get("Allow"))
+		}
+	}
+
+	rsp := doRequest(server, "OPTIONS", "/restconf/data/test:system/uptime", "", "")
+	if rsp.Header().Get("Allow") != "GET, HEAD, OPTIONS" || rsp.Header().Get("Accept-Patch") != "" {
+		t.Errorf("OPTIONS of a state leaf: got Allow %q, Accept-Patch %q", rsp.Header().Get("Allow"), rsp.Header().Get("Accept-Patch"))
+	}
+}
+
+func TestDatastoreGet(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test":            testModuleText,
+		"query":           queryModuleText,
+		MONITORING_MODULE: monitoringModuleText,
+	}))
+
+	rsp := doRequest(server, "GET", "/restconf/data?content=config", "", "")
+	if want := `{"ietf-restconf:data":{}}`; rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Errorf("GET empty datastore: got status %d, %s, want %s", rsp.Code, rsp.Body, want)
+	}
+
+	for _, body := range []string{`{"test:system":{"hostname":"a"}}`, `{"query:system":{"ntp":{}}}`} {
+		if rsp := doRequest(server, "POST", "/restconf/data", APPLICATION_DATA_JSON, body); rsp.Code != http.StatusCreated {
+			t.Fatalf("POST %s: got status %d: %s", body, rsp.Code, rsp.Body)
+		}
+	}
+
+	capabilities := `"capabilities":{"capability":["urn:ietf:params:restconf:capability:defaults:1.0?basic-mode=explicit",` +
+		`"urn:ietf:params:restconf:capability:depth:1.0","urn:ietf:params:restconf:capability:fields:1.0",` +
+		`"urn:ietf:params:restconf:capability:with-defaults:1.0",` +
+		`"urn:go-restconf:capability:max-list-entries:1.0?max=100000","urn:ietf:params:restconf:capability:yang-patch:1.0"]}`
+	for _, tt := range []struct {
+		query  string
+		accept string
+		status int
+		want   string
+	}{
+		{"", "", http.StatusOK, `{"ietf-restconf:data":{"ietf-restconf-monitoring:restconf-state":{` + capabilities +
+			`,"streams":{"stream":[{"access":[{"encoding":"json","location":"http://example.com/restconf/streams/NETCONF/json"},` +
+			`{"encoding":"xml","location":"http://example.com/restconf/streams/NETCONF/xml"}],` +
+			`"description":"default NETCONF event stream","name":"NETCONF","replay-support":false}]}},` +
+			`"query:system":{"ntp":{}},"test:system":{"hostname":"a"}}}`},
+		{"content=config", "", http.StatusOK, `{"ietf-restconf:data":{"query:system":{"ntp":{}},"test:system":{"hostname":"a"}}}`},
+		{"content=nonconfig&depth=3", "", http.StatusOK,
+			`{"ietf-restconf:data":{"ietf-restconf-monitoring:restconf-state":{"capabilities":{},"streams":{}}}}`},
+		{"content=config&with-defaults=report-all", "", http.StatusOK,
+			`{"ietf-restconf:data":{"query:system":{"mtu":1500,"ntp":{"enabled":true},"udp-port":514},"test:system":{"hostname":"a"}}}`},
+		{"content=config&depth=2", "", http.StatusOK, `{"ietf-restconf:data":{"query:system":{},"test:system":{}}}`},
+		{"content=config", APPLICATION_DATA_XML, http.StatusOK, `<data xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">` +
+			`<system xmlns="urn:query"><ntp></ntp></system><system xmlns="urn:test"><hostname>a</hostname></system></data>`},
+		{"content=some", "", http.StatusBadRequest, ""},
+		{"fields=test:system", "", http.StatusBadRequest, ""},
+	} {
+		req := httptest.NewRequest("GET", "/restconf/data?"+tt.query, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != tt.status {
+			t.Fatalf("GET %s: got status %d, want %d: %s", tt.query, rsp.Code, tt.status, rsp.Body)
+		}
+		if tt.want != "" && rsp.Body.String() != tt.want {
+			t.Errorf("GET %s: got %s, want %s", tt.query, rsp.Body, tt.want)
+		}
+	}
+
+	rsp = doRequest(server, "GET", "/restconf/data/test:system?content=nonconfig", "", "")
+	if rsp.Code != http.StatusNotFound {
+		t.Errorf("GET test:system without state data: got status %d, want %d", rsp.Code, http.StatusNotFound)
+	}
+}
+
+func TestEmptyDatastoreGolden(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		url    string
+		accept string
+		golden string
+	}{
+		{"/restconf/data", APPLICATION_DATA_XML, "testdata/datastore-empty.xml"},
+		{"/restconf/data", "", "testdata/datastore-empty.json"},
+		{"/restconf/data?depth=1", APPLICATION_DATA_XML, "testdata/datastore-empty.xml"},
+		{"/restconf", APPLICATION_DATA_XML, "testdata/restconf.xml"},
+		{"/restconf", APPLICATION_DATA_JSON, "testdata/restconf.json"},
+	} {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		golden, err := os.ReadFile(test.golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp.Code != http.StatusOK || rsp.Body.String() != string(golden) {
+			t.Errorf("GET %s, Accept %q: got status %d, %s, want %s", test.url, test.accept, rsp.Code, rsp.Body, golden)
+			continue
+		}
+
+		// The XML documents are well-formed and namespaced.
+		if test.accept == APPLICATION_DATA_XML {
+			var doc struct{ XMLName xml.Name }
+			if err := xml.Unmarshal(rsp.Body.Bytes(), &doc); err != nil || doc.XMLName.Space != PUBLIC_XMLNS {
+				t.Errorf("GET %s: got element {%s}%s, %v", test.url, doc.XMLName.Space, doc.XMLName.Local, err)
+			}
+		}
+	}
+}
+
+func TestListArrays(t *testing.T) {
+	entries := []string{`{"name":"a","unit":0}`, `{"name":"b","unit":0}`, `{"name":"c","unit":0}`}
+	for n := 0; n <= len(entries); n++ {
+		server := testServer(t)
+		list := "[" + strings.Join(entries[:n], ",") + "]"
+
+		rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			`{"test:system":{"hostname":"h","interface":`+list+`}}`)
+		if rsp.Code != http.StatusCreated {
+			t.Fatalf("%d entries: PUT got status %d: %s", n, rsp.Code, rsp.Body)
+		}
+
+		// A list without entries is no data, it is not encoded.
+		want := `{"test:system":{"hostname":"h","interface":` + list + `}}`
+		if n == 0 {
+			want = `{"test:system":{"hostname":"h"}}`
+		}
+		if rsp := doRequest(server, "GET", "/restconf/data/test:system", "", ""); rsp.Body.String() != want {
+			t.Errorf("%d entries: GET got %s, want %s", n, rsp.Body, want)
+		}
+
+		rsp = doRequest(server, "GET", "/restconf/data/test:system/interface", "", "")
+		if n == 0 {
+			if rsp.Code != http.StatusNotFound {
+				t.Errorf("%d entries: GET list got status %d, want %d", n, rsp.Code, http.StatusNotFound)
+			}
+			continue
+		}
+		if want := `{"test:interface":` + list + `}`; rsp.Body.String() != want {
+			t.Errorf("%d entries: GET list got %s, want %s", n, rsp.Body, want)
+		}
+
+		// A single entry is an array of one.
+		rsp = doRequest(server, "GET", "/restconf/data/test:system/interface=a,0", "", "")
+		if want := `{"test:interface":[` + entries[0] + `]}`; rsp.Body.String() != want {
+			t.Errorf("%d entries: GET entry got %s, want %s", n, rsp.Body, want)
+		}
+	}
+
+	// A list member that is not an array is rejected, whatever it holds.
+	server := testServer(t)
+	for _, body := range []string{
+		`{"test:system":{"interface":{"name":"a","unit":0}}}`,
+		`{"test:system":{"interface":"a"}}`,
+		`{"test:system":{"interface":[[]]}}`,
+	} {
+		rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, body)
+		if rsp.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: got status %d, want %d", body, rsp.Code, http.StatusBadRequest)
+		}
+	}
+	rsp := doRequest(server, "POST", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:interface":{"name":"a","unit":0}}`)
+	if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), "must be an array") {
+		t.Errorf("POST of an entry object: got status %d, %s", rsp.Code, rsp.Body)
+	}
+}
+
+func TestMissingOrUnknown(t *testing.T) {
+	server := testServer(t)
+	if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`); rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for _, test := range []struct {
+		method, url string
+		status      int
+		tag         string
+	}{
+		// Nodes of the schema without an instance.
+		{"GET", "/restconf/data/test:system/counter", http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		{"GET", "/restconf/data/test:system/interface=eth0,0", http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		{"GET", "/restconf/data/test:system/interface=eth0,0/mtu", http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		{"DELETE", "/restconf/data/test:system/interface=eth0,0", http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		{"PATCH", "/restconf/data/test:system/interface=eth0,0", http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		// Nodes the schema does not have.
+		{"GET", "/restconf/data/test:bogus", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"GET", "/restconf/data/test:system/bogus", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"GET", "/restconf/data/test:system/hostname/bogus", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"GET", "/restconf/data/test:system/interface=eth0,0/bogus", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"DELETE", "/restconf/data/test:system/bogus", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"PUT", "/restconf/data/test:system/bogus", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+	} {
+		rsp := doRequest(server, test.method, test.url, APPLICATION_DATA_JSON, `{"test:interface":[{"name":"eth0","unit":0}]}`)
+		if rsp.Code != test.status || !strings.Contains(rsp.Body.String(), `"error-tag":"`+test.tag+`"`) {
+			t.Errorf("%s %s: got status %d, want %d %s: %s", test.method, test.url, rsp.Code, test.status, test.tag, rsp.Body)
+		}
+	}
+}
+
+func TestLeafResource(t *testing.T) {
+	server := testServer(t)
+	const url = "/restconf/data/test:system/hostname"
+
+	for _, test := range []struct {
+		format, body string
+	}{
+		{APPLICATION_DATA_JSON, `{"test:hostname":"a"}`},
+		{APPLICATION_DATA_XML, `<hostname xmlns="urn:test">b</hostname>`},
+	} {
+		rsp := doRequest(server, "PUT", url, test.format, test.body)
+		if rsp.Code != http.StatusCreated && rsp.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s: got status %d: %s", test.body, rsp.Code, rsp.Body)
+		}
+
+		// The leaf is returned as it was sent, a member or element named
+		// after the leaf rather than its bare value.
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", test.format)
+		rsp = httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != http.StatusOK || rsp.Body.String() != test.body {
+			t.Errorf("GET %s: got status %d body %s, want %s", test.format, rsp.Code, rsp.Body, test.body)
+		}
+	}
+
+	for _, test := range []struct {
+		format, body, want string
+	}{
+		{APPLICATION_DATA_JSON, `"c"`, "not a bare value"},
+		{APPLICATION_DATA_JSON, `{"hostname":"c"}`, "must hold the node test:hostname"},
+		{APPLICATION_DATA_JSON, `{"test:system":{"hostname":"c"}}`, "must hold the node test:hostname"},
+		{APPLICATION_DATA_XML, `<system xmlns="urn:test"><hostname>c</hostname></system>`, "must hold the node test:hostname"},
+		{APPLICATION_DATA_XML, `c`, ERROR_TAG_MALFORMED_MESSAGE},
+	} {
+		rsp := doRequest(server, "PUT", url, test.format, test.body)
+		if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), test.want) {
+			t.Errorf("PUT %s: got status %d: %s, want %q", test.body, rsp.Code, rsp.Body, test.want)
+		}
+	}
+}
+
+func TestEmptyBody(t *testing.T) {
+	server := testServer(t)
+	if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`); rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT system: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	// An empty body would replace the data with nothing, it is malformed.
+	for _, test := range []struct{ method, url string }{
+		{"PUT", "/restconf/data/test:system"},
+		{"PUT", "/restconf/data/test:system/hostname"},
+		{"POST", "/restconf/data/test:system"},
+		{"PATCH", "/restconf/data/test:system"},
+	} {
+		rsp := doRequest(server, test.method, test.url, APPLICATION_DATA_JSON, " \n")
+		if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), ERROR_TAG_MALFORMED_MESSAGE) ||
+			!strings.Contains(rsp.Body.String(), "request body is empty") {
+			t.Errorf("%s %s: got status %d: %s, want an empty body malformed-message error", test.method, test.url, rsp.Code, rsp.Body)
+		}
+	}
+
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system/hostname", "", ""); rsp.Body.String() != `{"test:hostname":"a"}` {
+		t.Errorf("GET hostname: got %s, want the data left intact", rsp.Body)
+	}
+}
@@ -0,0 +1,757 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+// A DataStore is the in-memory configuration datastore. It holds the data
+// tree of each module's top-level nodes separately, each guarded by its own
+// lock: reads of a module share it, an edit holds it alone, so an edit only
+// blocks the requests on the same module.
+type DataStore struct {
+	mu      sync.Mutex // guards modules, not the trees within
+	modules map[string]*moduleData
+}
+
+// moduleData is the data tree of the top-level nodes of a module.
+type moduleData struct {
+	mu  sync.RWMutex
+	dir map[string]interface{}
+}
+
+func NewDataStore() *DataStore {
+	return &DataStore{modules: make(map[string]*moduleData)}
+}
+
+// module returns the data of the module of the resource r, created when
+// missing.
+func (ds *DataStore) module(r *Resource) *moduleData {
+	mod := r.Segments[0].Module
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	data, ok := ds.modules[mod]
+	if !ok {
+		data = &moduleData{dir: make(map[string]interface{})}
+		ds.modules[mod] = data
+	}
+	return data
+}
+
+// A moduleView returns the data tree of the top-level nodes of the module
+// mod to the check of an edit, nil if it has no data.
+type moduleView func(mod string) map[string]interface{}
+
+// An editCheck checks the data of a module after an edit, read with view,
+// and fails the edit if it is not valid. It may change the data of the
+// module.
+type editCheck func(view moduleView) error
+
+// view returns the view of an edit holding the modules of edited, for which
+// it returns their new data tree. The other modules are read locked when
+// first read, until release is called: the edits being serialized, see
+// lock.go, none of them holds a module waiting for those of this one.
+func (ds *DataStore) view(edited map[string]*moduleData) (moduleView, func()) {
+	var locked []*moduleData
+	view := func(mod string) map[string]interface{} {
+		if data, ok := edited[mod]; ok {
+			return data.dir
+		}
+		ds.mu.Lock()
+		data, ok := ds.modules[mod]
+		ds.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		for _, l := range locked {
+			if l == data {
+				return data.dir
+			}
+		}
+		data.mu.RLock()
+		locked = append(locked, data)
+		return data.dir
+	}
+	release := func() {
+		for _, data := range locked {
+			data.mu.RUnlock()
+		}
+	}
+	return view, release
+}
+
+// checkEdit calls check with the view of an edit holding the modules of
+// edited.
+func (ds *DataStore) checkEdit(check editCheck, edited map[string]*moduleData) error {
+	view, release := ds.view(edited)
+	defer release()
+	return check(view)
+}
+
+// A location is the place of a resource in the data tree: the directory
+// holding it and, for a list entry or leaf-list value, its index in the
+// directory member.
+type location struct {
+	dir      map[string]interface{}
+	name     string
+	instance bool // addresses a single list entry or leaf-list value
+	index    int  // index of the instance, -1 if it does not exist
+}
+
+// matchInstance returns the index of the list entry of e with the given key
+// values, or of the leaf-list value keys[0], or -1 if there is none. The keys
+// are in canonical form, as Resolve leaves them.
+func matchInstance(values []interface{}, e *yang.Entry, keys []string) int {
+	for i, value := range values {
+		if e.IsLeafList() {
+			if value == keys[0] {
+				return i
+			}
+			continue
+		}
+		entry, _ := value.(map[string]interface{})
+		match := true
+		for j, name := range keyNames(e) {
+			if entry[name] != keys[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// newInstance returns an empty list entry holding the key values keys.
+func newInstance(e *yang.Entry, keys []string) map[string]interface{} {
+	entry := make(map[string]interface{})
+	for i, name := range keyNames(e) {
+		entry[name] = keys[i]
+	}
+	return entry
+}
+
+// locate walks the data tree of the module of r down to the resource r.
+// When create is true missing containers and list entries above r are
+// created, otherwise nil is returned if one of them does not exist. The
+// caller holds the lock of the module.
+func (data *moduleData) locate(r *Resource, create bool) *location {
+	dir := data.dir
+	for i, e := range r.Entries {
+		seg := r.Segments[i]
+		last := i == len(r.Entries)-1
+
+		if seg.Keys == nil {
+			if last {
+				return &location{dir: dir, name: e.Name, index: -1}
+			}
+			next, _ := dir[e.Name].(map[string]interface{})
+			if next == nil {
+				if !create {
+					return nil
+				}
+				next = make(map[string]interface{})
+				dir[e.Name] = next
+			}
+			dir = next
+			continue
+		}
+
+		values, _ := dir[e.Name].([]interface{})
+		index := matchInstance(values, e, seg.Keys)
+		if last {
+			return &location{dir: dir, name: e.Name, instance: true, index: index}
+		}
+		if index < 0 {
+			if !create {
+				return nil
+			}
+			values = append(values, newInstance(e, seg.Keys))
+			dir[e.Name] = values
+			index = len(values) - 1
+		}
+		dir, _ = values[index].(map[string]interface{})
+	}
+	return nil
+}
+
+// exists reports whether the location holds data.
+func (loc *location) exists() bool {
+	if loc == nil {
+		return false
+	}
+	if loc.instance {
+		return loc.index >= 0
+	}
+	_, ok := loc.dir[loc.name]
+	return ok
+}
+
+// get returns the value at the location. A list entry or leaf-list value is
+// returned on its own, not wrapped in a slice.
+func (loc *location) get() interface{} {
+	if loc.instance {
+		return loc.dir[loc.name].([]interface{})[loc.index]
+	}
+	return loc.dir[loc.name]
+}
+
+// set stores value at the location, value being a single instance when the
+// location addresses a list entry or leaf-list value.
+func (loc *location) set(value interface{}) {
+	if !loc.instance {
+		loc.dir[loc.name] = value
+		return
+	}
+	values, _ := loc.dir[loc.name].([]interface{})
+	if loc.index < 0 {
+		loc.dir[loc.name] = append(values, value)
+		loc.index = len(values)
+		return
+	}
+	values[loc.index] = value
+}
+
+// place stores the list entry or leaf-list value at the location at the
+// position ins gives, moving the instance there if it exists. A nil ins
+// stores value as set does. The point of ins must exist.
+func (loc *location) place(e *yang.Entry, value interface{}, ins *insertion) {
+	if ins == nil {
+		loc.set(value)
+		return
+	}
+	values, _ := loc.dir[loc.name].([]interface{})
+	if loc.index >= 0 {
+		values = append(values[:loc.index:loc.index], values[loc.index+1:]...)
+	}
+
+	at := len(values)
+	switch ins.where {
+	case INSERT_FIRST:
+		at = 0
+	case INSERT_BEFORE:
+		at = matchInstance(values, e, ins.point)
+	case INSERT_AFTER:
+		at = matchInstance(values, e, ins.point) + 1
+	}
+	loc.dir[loc.name] = append(values[:at:at], append([]interface{}{value}, values[at:]...)...)
+	loc.index = at
+}
+
+// hasPoint reports whether the point of ins, if it has one, is an entry of
+// the list or leaf-list e at the location other than the one at it.
+func (loc *location) hasPoint(e *yang.Entry, ins *insertion) bool {
+	if ins == nil || ins.point == nil {
+		return true
+	}
+	if loc == nil {
+		return false
+	}
+	values, _ := loc.dir[loc.name].([]interface{})
+	index := matchInstance(values, e, ins.point)
+	return index >= 0 && index != loc.index
+}
+
+// noPoint returns the error of an insertion of target before or after an
+// entry that does not exist.
+func noPoint(target *Resource) *RestConfError {
+	return invalidValue("the insertion point of %s does not exist", target.Entry().Name)
+}
+
+func (loc *location) remove() {
+	if !loc.instance {
+		delete(loc.dir, loc.name)
+		return
+	}
+	values := loc.dir[loc.name].([]interface{})
+	values = append(values[:loc.index:loc.index], values[loc.index+1:]...)
+	if len(values) == 0 {
+		delete(loc.dir, loc.name)
+	} else {
+		loc.dir[loc.name] = values
+	}
+	loc.index = -1
+}
+
+func dataMissing(r *Resource) *RestConfError {
+	return NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+		ERROR_TAG_DATA_MISSING, "resource %s does not exist", r.Entry().Name)
+}
+
+// Get returns a copy of the data at r. A list entry or leaf-list value is
+// returned on its own.
+func (ds *DataStore) Get(r *Resource) (interface{}, bool) {
+	data := ds.module(r)
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	return readTree(data.dir, r)
+}
+
+// readTree returns a copy of the data at r within dir, the data tree of the
+// top-level nodes of the module of r.
+func readTree(dir map[string]interface{}, r *Resource) (interface{}, bool) {
+	loc := (&moduleData{dir: dir}).locate(r, false)
+	if !loc.exists() {
+		return nil, false
+	}
+	return copyTree(loc.get()), true
+}
+
+// Exists reports whether there is data at r.
+func (ds *DataStore) Exists(r *Resource) bool {
+	data := ds.module(r)
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	return data.locate(r, false).exists()
+}
+
+// Edit applies method to the resource target with the decoded value and
+// returns the HTTP status of the response. For POST, target is the new child
+// resource. A list entry or leaf-list value is passed on its own, ins places
+// it within a list ordered-by user, nil placing a new entry last.
+//
+// When check is not nil the edit is made on a copy of the data tree of the
+// module, which check is called on; the edit is abandoned if it fails.
+//
+// When commit is not nil it is called with copies of the data at target
+// before and after the edit, and the check, nil where there is none, before
+// the edit is applied; the edit is abandoned if it fails.
+func (ds *DataStore) Edit(method string, target *Resource, value interface{}, ins *insertion,
+	check editCheck, commit func(before, after interface{}) error) (int, error) {
+
+	data := ds.module(target)
+	data.mu.Lock()
+	defer data.mu.Unlock()
+
+	loc := data.locate(target, false)
+	exists := loc.exists()
+	status, err := editStatus(method, exists)
+	if err != nil {
+		if err.Tag == ERROR_TAG_DATA_MISSING {
+			err = dataMissing(target)
+		}
+		return status, err
+	}
+	if !loc.hasPoint(target.Entry(), ins) {
+		return http.StatusBadRequest, noPoint(target)
+	}
+
+	var before, after interface{}
+	if exists {
+		before = copyTree(loc.get())
+	}
+	switch method {
+	case "POST", "PUT":
+		after = value
+	case "PATCH":
+		after = merge(target.Entry(), copyTree(before), value)
+	}
+
+	var next *moduleData
+	if check != nil {
+		next = &moduleData{dir: copyTree(data.dir).(map[string]interface{})}
+		next.apply(method, target, after, ins)
+		if err := ds.checkEdit(check, map[string]*moduleData{target.Segments[0].Module: next}); err != nil {
+			return http.StatusBadRequest, err
+		}
+		after, _ = readTree(next.dir, target)
+	}
+
+	if commit != nil {
+		if err := commit(before, copyTree(after)); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if next != nil {
+		data.dir = next.dir
+	} else {
+		data.apply(method, target, after, ins)
+	}
+	return status, nil
+}
+
+// Copy replaces the data at target with the data at source, which convert
+// turns into data of target, and removes the data at source if move is set.
+// The modules of both resources are locked, in the order of their names, for
+// the whole copy, so that it is a single transaction. It returns the HTTP
+// status of the response, 201 if target did not exist and 204 if its data
+// was replaced.
+//
+// check returns, for the module of a resource, the check Edit takes. commit
+// is called once with the changes of the copy, the removal of the source
+// first for a move, so that they commit together; the copy is abandoned if
+// any of them fails.
+func (ds *DataStore) Copy(source, target *Resource, move bool, convert func(v interface{}) (interface{}, error),
+	check func(r *Resource) editCheck, commit func(changes []*Change) error) (int, error) {
+
+	src, dst := ds.module(source), ds.module(target)
+	locked := []*moduleData{src}
+	if dst != src {
+		locked = append(locked, dst)
+		if target.Segments[0].Module < source.Segments[0].Module {
+			locked[0], locked[1] = dst, src
+		}
+	}
+	for _, data := range locked {
+		data.mu.Lock()
+		defer data.mu.Unlock()
+	}
+
+	loc := src.locate(source, false)
+	if !loc.exists() {
+		return http.StatusNotFound, dataMissing(source)
+	}
+	removed := copyTree(loc.get())
+	after, err := convert(copyTree(removed))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	status := http.StatusCreated
+	var before interface{}
+	if loc := dst.locate(target, false); loc.exists() {
+		status = http.StatusNoContent
+		before = copyTree(loc.get())
+	}
+
+	// The copy is made on copies of the data trees, which replace them
+	// once every check and commit succeeded.
+	next := make(map[*moduleData]*moduleData, len(locked))
+	edited := make(map[string]*moduleData, len(locked))
+	for _, r := range []*Resource{source, target} {
+		data := ds.module(r)
+		if next[data] == nil {
+			next[data] = &moduleData{dir: copyTree(data.dir).(map[string]interface{})}
+		}
+		edited[r.Segments[0].Module] = next[data]
+	}
+	if move {
+		next[src].apply("DELETE", source, nil, nil)
+	}
+	next[dst].apply("PUT", target, copyTree(after), nil)
+
+	checked := []*Resource{target}
+	if dst != src {
+		checked = append(checked, source)
+	}
+	for _, r := range checked {
+		if c := check(r); c != nil {
+			if err := ds.checkEdit(c, edited); err != nil {
+				return http.StatusBadRequest, err
+			}
+		}
+	}
+	after, _ = readTree(next[dst].dir, target)
+
+	var changes []*Change
+	if move {
+		changes = append(changes, newChange(source, removed, nil))
+	}
+	changes = append(changes, newChange(target, before, after))
+	if err := commit(changes); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	for _, data := range locked {
+		data.dir = next[data].dir
+	}
+	return status, nil
+}
+
+// A patchEdit is an edit of a YANG patch (RFC 8072), its operation applied
+// to target with the decoded value. A list entry or leaf-list value is passed
+// on its own, ins places it for the insert and move operations.
+type patchEdit struct {
+	operation string
+	target    *Resource
+	value     interface{}
+	ins       *insertion
+}
+
+// patchMethods maps the operations of YANG patch edits to the method of Edit
+// they are applied as.
+var patchMethods = map[string]string{
+	PATCH_CREATE:  "POST",
+	PATCH_INSERT:  "POST",
+	PATCH_DELETE:  "DELETE",
+	PATCH_REMOVE:  "DELETE",
+	PATCH_MERGE:   "PATCH",
+	PATCH_REPLACE: "PUT",
+	PATCH_MOVE:    "PUT",
+}
+
+// Patch applies the edits of a YANG patch in order, each to the data the
+// edits before it left, so that the point of an insert or move may be an
+// entry an earlier edit created. The modules of the targets are locked, in
+// the order of their names, for the whole patch, so that it is a single
+// transaction.
+//
+// check and commit are those of Copy, commit being called with the changes
+// of all the edits; the patch is abandoned if any of them, or any edit,
+// fails. It returns the index of the failing edit with its error, -1 for an
+// error of the whole patch.
+func (ds *DataStore) Patch(edits []*patchEdit, check func(r *Resource) editCheck,
+	commit func(changes []*Change) error) (int, error) {
+
+	// Each module is represented by the first target within it.
+	var mods []string
+	targets := make(map[string]*Resource)
+	for _, edit := range edits {
+		if mod := edit.target.Segments[0].Module; targets[mod] == nil {
+			mods = append(mods, mod)
+			targets[mod] = edit.target
+		}
+	}
+	sort.Strings(mods)
+
+	locked := make(map[string]*moduleData, len(mods))
+	next := make(map[string]*moduleData, len(mods))
+	for _, mod := range mods {
+		data := ds.module(targets[mod])
+		data.mu.Lock()
+		defer data.mu.Unlock()
+		locked[mod] = data
+		next[mod] = &moduleData{dir: copyTree(data.dir).(map[string]interface{})}
+	}
+
+	type change struct {
+		target        *Resource
+		before, after interface{}
+	}
+	var changes []change
+	for i, edit := range edits {
+		before, after, changed, err := next[edit.target.Segments[0].Module].patch(edit)
+		if err != nil {
+			return i, err
+		}
+		if changed {
+			changes = append(changes, change{edit.target, before, after})
+		}
+	}
+
+	for _, mod := range mods {
+		if c := check(targets[mod]); c != nil {
+			if err := ds.checkEdit(c, next); err != nil {
+				return -1, err
+			}
+		}
+	}
+	// The last change of a target leaves the data the checks left.
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := &changes[i]
+		last := true
+		for _, later := range changes[i+1:] {
+			if sameInstance(later.target, c.target) {
+				last = false
+				break
+			}
+		}
+		if last && c.after != nil {
+			c.after, _ = readTree(next[c.target.Segments[0].Module].dir, c.target)
+		}
+	}
+	committed := make([]*Change, len(changes))
+	for i, c := range changes {
+		committed[i] = newChange(c.target, c.before, c.after)
+	}
+	if err := commit(committed); err != nil {
+		return -1, err
+	}
+
+	for _, mod := range mods {
+		locked[mod].dir = next[mod].dir
+	}
+	return -1, nil
+}
+
+// patch applies the edit of a YANG patch to the data and returns copies of
+// the data at its target before and after it, nil where there is none.
+// changed is false for a remove of data that does not exist. The caller
+// holds the lock of the module.
+func (data *moduleData) patch(edit *patchEdit) (before, after interface{}, changed bool, err error) {
+	target := edit.target
+	loc := data.locate(target, false)
+	exists := loc.exists()
+
+	method := patchMethods[edit.operation]
+	switch {
+	case edit.operation == PATCH_REMOVE && !exists:
+		return nil, nil, false, nil
+	case edit.operation == PATCH_MERGE && !exists:
+		// A merge creates the data it does not find.
+		method = "PUT"
+	case edit.operation == PATCH_MOVE && !exists:
+		return nil, nil, false, dataMissing(target)
+	}
+	if _, err := editStatus(method, exists); err != nil {
+		if err.Tag == ERROR_TAG_DATA_MISSING {
+			err = dataMissing(target)
+		}
+		return nil, nil, false, err
+	}
+	if !loc.hasPoint(target.Entry(), edit.ins) {
+		return nil, nil, false, noPoint(target)
+	}
+
+	if exists {
+		before = copyTree(loc.get())
+	}
+	switch {
+	case edit.operation == PATCH_MOVE:
+		after = copyTree(before)
+	case method == "PATCH":
+		after = merge(target.Entry(), copyTree(before), edit.value)
+	case method != "DELETE":
+		after = edit.value
+	}
+	data.apply(method, target, after, edit.ins)
+	return before, copyTree(after), true, nil
+}
+
+// apply sets the data at target to after, placed as ins gives, or removes
+// it for DELETE. The caller holds the lock of the module.
+func (data *moduleData) apply(method string, target *Resource, after interface{}, ins *insertion) {
+	switch method {
+	case "POST", "PUT":
+		data.locate(target, true).place(target.Entry(), after, ins)
+	case "PATCH":
+		data.locate(target, false).set(after)
+	case "DELETE":
+		data.locate(target, false).remove()
+	}
+}
+
+// merge merges value into the data cur of the node e and returns the result
+// (RFC 8040 section 4.6.1). Containers and list entries are merged member by
+// member, leaving the members value does not name intact, and a nil member
+// removes the node. List entries are matched by their keys and leaf-list
+// values by value, others are added. Leafs and anydata are replaced.
+func merge(e *yang.Entry, cur, value interface{}) interface{} {
+	if e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry {
+		return value
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		dir, ok := cur.(map[string]interface{})
+		if !ok {
+			dir = make(map[string]interface{}, len(value))
+		}
+		for name, v := range value {
+			child := findDataChild(e, name)
+			switch {
+			case v == nil:
+				delete(dir, name)
+			case child == nil:
+				dir[name] = v
+			default:
+				dir[name] = merge(child, dir[name], v)
+			}
+		}
+		return dir
+	case []interface{}:
+		values, _ := cur.([]interface{})
+		for _, v := range value {
+			index := -1
+			if keys := instanceKeys(e, v); keys != nil {
+				index = matchInstance(values, e, keys)
+			}
+			if index < 0 {
+				values = append(values, merge(e, nil, v))
+			} else {
+				values[index] = merge(e, values[index], v)
+			}
+		}
+		return values
+	}
+	return value
+}
+
+// GetPage returns a copy of at most limit entries of the list or leaf-list
+// at r, starting at entry offset, along with the total number of entries.
+// A limit of 0 returns all entries from offset on.
+func (ds *DataStore) GetPage(r *Resource, offset, limit int) ([]interface{}, int, bool) {
+	data := ds.module(r)
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	loc := data.locate(r, false)
+	if !loc.exists() {
+		return nil, 0, false
+	}
+	values, _ := loc.get().([]interface{})
+	total := len(values)
+
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	page, _ := copyTree(values[offset:end]).([]interface{})
+	return page, total, true
+}
+
+// copyTree returns a deep copy of the data tree v.
+func copyTree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		dir := make(map[string]interface{}, len(v))
+		for name, value := range v {
+			dir[name] = copyTree(value)
+		}
+		return dir
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = copyTree(value)
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+// editStatus is the single place deciding the outcome of a data resource edit
+// from its method and whether the target resource exists (RFC 8040 sections
+// 4.4 to 4.7). It returns the HTTP status of a successful edit, or the error
+// to send.
+//
+//	POST   create  201, existing resource 409 data-exists
+//	PUT    create  201, replace 204
+//	PATCH  merge   204, missing resource 404 data-missing
+//	DELETE delete  204, missing resource 404 data-missing
+func editStatus(method string, exists bool) (int, *RestConfError) {
+	switch method {
+	case "POST":
+		if exists {
+			return http.StatusConflict, NewError(http.StatusConflict, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_DATA_EXISTS, "resource already exists")
+		}
+		return http.StatusCreated, nil
+	case "PUT":
+		if exists {
+			return http.StatusNoContent, nil
+		}
+		return http.StatusCreated, nil
+	case "PATCH", "DELETE":
+		if !exists {
+			return http.StatusNotFound, NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_DATA_MISSING, "resource does not exist")
+		}
+		return http.StatusNoContent, nil
+	}
+	return http.StatusMethodNotAllowed, NewError(http.StatusMethodNotAllowed, ERROR_TYPE_PROTOCOL,
+		ERROR_TAG_OPERATION_NOT_SUPPORTED, "method %s is not supported", method)
+}
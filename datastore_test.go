@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestEditStatus(t *testing.T) {
+	tests := []struct {
+		method string
+		exists bool
+		status int
+		tag    string
+	}{
+		{"POST", false, http.StatusCreated, ""},
+		{"POST", true, http.StatusConflict, ERROR_TAG_DATA_EXISTS},
+		{"PUT", false, http.StatusCreated, ""},
+		{"PUT", true, http.StatusNoContent, ""},
+		{"PATCH", false, http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		{"PATCH", true, http.StatusNoContent, ""},
+		{"DELETE", false, http.StatusNotFound, ERROR_TAG_DATA_MISSING},
+		{"DELETE", true, http.StatusNoContent, ""},
+		{"COPY", false, http.StatusMethodNotAllowed, ERROR_TAG_OPERATION_NOT_SUPPORTED},
+		{"COPY", true, http.StatusMethodNotAllowed, ERROR_TAG_OPERATION_NOT_SUPPORTED},
+	}
+
+	for _, tt := range tests {
+		status, err := editStatus(tt.method, tt.exists)
+		if status != tt.status {
+			t.Errorf("editStatus(%s, %v): got status %d, want %d", tt.method, tt.exists, status, tt.status)
+		}
+		switch {
+		case tt.tag == "" && err != nil:
+			t.Errorf("editStatus(%s, %v): got error %v, want none", tt.method, tt.exists, err)
+		case tt.tag != "" && err == nil:
+			t.Errorf("editStatus(%s, %v): got no error, want %s", tt.method, tt.exists, tt.tag)
+		case tt.tag != "" && (err.Tag != tt.tag || err.Status != tt.status):
+			t.Errorf("editStatus(%s, %v): got error %s/%d, want %s/%d", tt.method, tt.exists, err.Tag, err.Status, tt.tag, tt.status)
+		}
+	}
+}
+
+func TestMergeNested(t *testing.T) {
+	server := testServer(t)
+
+	steps := []struct {
+		method, url, body string
+		status            int
+		want              string
+	}{
+		{"PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"a","interface":[` +
+			`{"name":"eth0","unit":0,"mtu":1500,"ipv4":{"address":"10.0.0.1","dhcp":{"enabled":true,"lease":60}}},` +
+			`{"name":"eth1","unit":0,"mtu":9000}]}}`, http.StatusCreated, ""},
+		{"PATCH", "/restconf/data/test:system", `{"test:system":{"interface":[` +
+			`{"name":"eth0","unit":0,"ipv4":{"dhcp":{"lease":120}}},{"name":"eth2","unit":0}]}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"a","interface":[` +
+			`{"ipv4":{"address":"10.0.0.1","dhcp":{"enabled":true,"lease":120}},"mtu":1500,"name":"eth0","unit":0},` +
+			`{"mtu":9000,"name":"eth1","unit":0},{"name":"eth2","unit":0}]}}`},
+		{"PATCH", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"mtu":null,"ipv4":{"dhcp":{"enabled":null}}}]}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/test:system/interface=eth0,0", "", http.StatusOK,
+			`{"test:interface":[{"ipv4":{"address":"10.0.0.1","dhcp":{"lease":120}},"name":"eth0","unit":0}]}`},
+		{"PATCH", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"unit":null}]}`, http.StatusBadRequest, ""},
+		{"PUT", "/restconf/data/test:system/interface=eth0,0", `{"test:interface":[{"mtu":null}]}`, http.StatusBadRequest, ""},
+	}
+
+	for i, step := range steps {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("step %d: %s %s: got status %d, want %d: %s", i, step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("step %d: %s %s: got body %s, want %s", i, step.method, step.url, rsp.Body, step.want)
+		}
+	}
+}
+
+// TestConcurrentEdits edits and reads the datastore from many goroutines; run
+// it with -race.
+func TestConcurrentEdits(t *testing.T) {
+	server := testServer(t)
+	if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"hostname":"a"}}`); rsp.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d: %s", rsp.Code, http.StatusCreated, rsp.Body)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("/restconf/data/test:system/interface=eth%d,0", i)
+			body := fmt.Sprintf(`{"test:interface":[{"name":"eth%d","unit":0,"mtu":1500}]}`, i)
+			for n := 0; n < 50; n++ {
+				steps := []struct {
+					method, url, body string
+					status            int
+				}{
+					{"PUT", url, body, http.StatusCreated},
+					{"GET", url, "", http.StatusOK},
+					{"GET", "/restconf/data/test:system", "", http.StatusOK},
+					{"PATCH", "/restconf/data/test:system", `{"test:system":{"hostname":"b"}}`, http.StatusNoContent},
+					{"DELETE", url, "", http.StatusNoContent},
+				}
+				for _, step := range steps {
+					if rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body); rsp.Code != step.status {
+						t.Errorf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, step.status, rsp.Body)
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
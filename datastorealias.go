@@ -0,0 +1,38 @@
+package main
+
+/*
+   The data resource /restconf/data holds both the configuration and the
+   state data, the classic RESTCONF datastore. With -data-datastore it
+   aliases one of the NMDA datastores (RFC 8342) instead, so that clients
+   written against the datastore resources of RFC 8527 see the same data
+   there:
+
+   restconf -data-datastore running      GET returns the configuration only
+   restconf -data-datastore operational  GET returns config and state, the
+                                         data is not written, as with
+                                         -readonly, the actions are invoked
+
+   The content parameter selects within the datastore aliased: with running
+   content=nonconfig selects nothing and content=all only the configuration,
+   with operational it selects as it does without an alias.
+*/
+
+var (
+	DATASTORE_RUNNING     = "running"
+	DATASTORE_OPERATIONAL = "operational"
+)
+
+// DATA_DATASTORE is the NMDA datastore /restconf/data aliases, "" for the
+// classic datastore of both the configuration and the state data.
+var DATA_DATASTORE = ""
+
+// validDataDatastore reports whether ds can be aliased by /restconf/data.
+func validDataDatastore(ds string) bool {
+	return ds == "" || ds == DATASTORE_RUNNING || ds == DATASTORE_OPERATIONAL
+}
+
+// readOnlyData reports whether the data resources are not written, the
+// server being read-only or /restconf/data aliasing operational.
+func readOnlyData() bool {
+	return READ_ONLY || DATA_DATASTORE == DATASTORE_OPERATIONAL
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDataDatastore(t *testing.T) {
+	defer func() { DATA_DATASTORE = "" }()
+
+	for _, test := range []struct {
+		datastore, method, url, body string
+		status                       int
+		want                         string
+	}{
+		// The classic datastore holds config and state.
+		{"", "GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"a","uptime":5}}`},
+		{"", "GET", "/restconf/data/test:system?content=nonconfig", "", http.StatusOK, `{"test:system":{"uptime":5}}`},
+		{"", "PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"b"}`, http.StatusNoContent, ""},
+
+		{"running", "GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"a"}}`},
+		{"running", "GET", "/restconf/data/test:system?content=all", "", http.StatusOK, `{"test:system":{"hostname":"a"}}`},
+		{"running", "GET", "/restconf/data/test:system?content=config", "", http.StatusOK, `{"test:system":{"hostname":"a"}}`},
+		{"running", "GET", "/restconf/data/test:system?content=nonconfig", "", http.StatusNotFound, ""},
+		{"running", "GET", "/restconf/data/test:system/uptime", "", http.StatusNotFound, ""},
+		{"running", "GET", "/restconf/data", "", http.StatusOK, `{"ietf-restconf:data":{"test:system":{"hostname":"a"}}}`},
+		{"running", "PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"b"}`, http.StatusNoContent, ""},
+
+		{"operational", "GET", "/restconf/data/test:system", "", http.StatusOK, `{"test:system":{"hostname":"a","uptime":5}}`},
+		{"operational", "GET", "/restconf/data/test:system?content=config", "", http.StatusOK, `{"test:system":{"hostname":"a"}}`},
+		{"operational", "GET", "/restconf/data/test:system?content=nonconfig", "", http.StatusOK, `{"test:system":{"uptime":5}}`},
+		{"operational", "PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"b"}`, http.StatusMethodNotAllowed, ""},
+		{"operational", "DELETE", "/restconf/data/test:system", "", http.StatusMethodNotAllowed, ""},
+	} {
+		DATA_DATASTORE = ""
+		server := testServer(t)
+		if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`); rsp.Code != http.StatusCreated {
+			t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+		}
+		if err := server.RegState("/test:system/uptime", func(st *StateRequest) (interface{}, error) {
+			return 5, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		DATA_DATASTORE = test.datastore
+		rsp := doRequest(server, test.method, test.url, APPLICATION_DATA_JSON, test.body)
+		if rsp.Code != test.status || test.want != "" && rsp.Body.String() != test.want {
+			t.Errorf("%s: %s %s: got status %d body %s, want %d %s", test.datastore, test.method, test.url,
+				rsp.Code, rsp.Body, test.status, test.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The diff is a vendor extension: a POST to the datastore resource with the
+   diff media type compares the configuration of the datastore with the
+   candidate configuration of the body, a datastore document like a data
+   file holds, without changing either.
+
+   {
+     "example:system" : {
+       "hostname" : "b",
+       "interface" : [ { "name" : "eth1" } ]
+     }
+   }
+
+   The response is the YANG patch (RFC 8072) turning the configuration into
+   the candidate, for the client to review or replay edit by edit. The
+   nodes the candidate leaves out are deleted, list entries are matched by
+   their keys and leaf-list entries by value, the order of the entries is not
+   compared.
+
+   {
+     "ietf-yang-patch:yang-patch" : {
+       "patch-id" : "diff",
+       "edit" : [
+         {
+           "edit-id" : "edit1",
+           "operation" : "replace",
+           "target" : "/example:system/hostname",
+           "value" : { "example:hostname" : "b" }
+         }
+       ]
+     }
+   }
+*/
+
+var (
+	APPLICATION_DIFF_JSON       = "application/vnd.go-restconf.diff+json"
+	APPLICATION_YANG_PATCH_JSON = "application/yang-patch+json"
+
+	DIFF_PATCH_ID = "diff"
+)
+
+// A diffEdit is an edit of a diff, the change of the configuration at
+// target.
+type diffEdit struct {
+	operation string
+	target    []PathSegment
+	entry     *yang.Entry
+	value     interface{} // the candidate data at target, nil for a delete
+}
+
+// diffData handles a diff of the datastore with the candidate configuration
+// of the body.
+func (restconf *RestConf) diffData(rsp http.ResponseWriter, req *http.Request) {
+	v, err := readJSON(req.Body)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		writeError(rsp, req, malformed("invalid JSON: the body must be an object"))
+		return
+	}
+	if data, ok := doc["ietf-restconf:data"]; ok && len(doc) == 1 {
+		if doc, ok = data.(map[string]interface{}); !ok {
+			writeError(rsp, req, invalidValue("ietf-restconf:data must be an object"))
+			return
+		}
+	}
+
+	schema := restconf.schemaOf(req)
+	candidate := make(map[*yang.Entry]interface{})
+	var errs ErrorList
+	for _, name := range sortedKeys(doc) {
+		mod, local := splitName(name)
+		e := schema.topNode(mod, local)
+		if e == nil || schema.hidden[mod] {
+			errs.add(unknownElement("unexpected member %q", name))
+			continue
+		}
+		if e.ReadOnly() {
+			errs.add(invalidValue("%s is state data (config false), it is not configuration", name))
+			continue
+		}
+		value, err := schema.fromJSON(req, e, nil, doc[name])
+		if err == nil && hasRemoval(e, value) {
+			err = invalidValue("null members are not allowed in %s", name)
+		}
+		errs.add(err)
+		candidate[e] = value
+	}
+	if err := errs.err(); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	var edits []*diffEdit
+	for _, mod := range schema.ModuleNames() {
+		for _, e := range dataChildren(schema.Modules[mod]) {
+			if e.ReadOnly() || !restconf.permit(req, ACCESS_READ, e) {
+				continue
+			}
+			r := &Resource{Segments: []PathSegment{{Module: mod, Name: e.Name}}, Entries: []*yang.Entry{e}}
+			running, _ := restconf.store.Get(r)
+			// Only the nodes the user may read are compared.
+			running = restconf.filterRead(req, e, running)
+			after := restconf.filterRead(req, e, candidate[e])
+			edits = diffNode(schema, edits, r.Segments, e, running, after)
+		}
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"ietf-yang-patch:yang-patch":{"patch-id":%q,"edit":[`, DIFF_PATCH_ID)
+	for i, edit := range edits {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		target := make([]string, 0, len(edit.target))
+		for _, seg := range edit.target {
+			target = append(target, seg.String())
+		}
+		fmt.Fprintf(&body, `{"edit-id":"edit%d","operation":%q,"target":%q`,
+			i+1, edit.operation, "/"+strings.Join(target, "/"))
+		if edit.value != nil {
+			value := edit.value
+			if edit.target[len(edit.target)-1].Keys != nil {
+				value = []interface{}{value}
+			}
+			body.WriteString(`,"value":`)
+			body.Write(schema.encode(APPLICATION_DATA_JSON, edit.entry, value))
+		}
+		body.WriteString(`}`)
+	}
+	body.WriteString(`]}}`)
+
+	rsp.Header().Set("Content-Type", APPLICATION_YANG_PATCH_JSON)
+	rsp.WriteHeader(http.StatusOK)
+	rsp.Write(body.Bytes())
+}
+
+// diffNode appends to edits the edits turning the data before of the node e
+// at target into the data after, and returns them.
+//
+// The edits of a list or leaf-list target single entries, by their keys or
+// values, a whole list being no resource a patch can create or delete.
+func diffNode(schema *Schema, edits []*diffEdit, target []PathSegment, e *yang.Entry, before, after interface{}) []*diffEdit {
+	last := target[len(target)-1]
+	entries := (e.IsList() || e.IsLeafList()) && last.Keys == nil
+	switch {
+	case before == nil && after == nil:
+		return edits
+	case before == nil && !entries:
+		return append(edits, &diffEdit{operation: CHANGE_CREATE, target: target, entry: e, value: after})
+	case after == nil && !entries:
+		return append(edits, &diffEdit{operation: CHANGE_DELETE, target: target, entry: e})
+	}
+
+	switch {
+	case entries:
+		olds, _ := before.([]interface{})
+		news, _ := after.([]interface{})
+		entry := func(v interface{}) []PathSegment {
+			seg := PathSegment{Module: last.Module, Name: last.Name, Keys: instanceKeys(e, v)}
+			return append(target[:len(target)-1:len(target)-1], seg)
+		}
+		// The removed entries first, a created entry may take the place
+		// of one.
+		for _, old := range olds {
+			if matchInstance(news, e, instanceKeys(e, old)) < 0 {
+				edits = append(edits, &diffEdit{operation: CHANGE_DELETE, target: entry(old), entry: e})
+			}
+		}
+		for _, cur := range news {
+			var prev interface{}
+			if i := matchInstance(olds, e, instanceKeys(e, cur)); i >= 0 {
+				prev = olds[i]
+			}
+			edits = diffNode(schema, edits, entry(cur), e, prev, cur)
+		}
+		return edits
+	case e.IsLeafList():
+		// An entry of a leaf-list that is in both is the same.
+		return edits
+	case e.IsDir():
+		olds, _ := before.(map[string]interface{})
+		news, _ := after.(map[string]interface{})
+		for _, child := range dataChildren(e) {
+			if child.ReadOnly() {
+				continue
+			}
+			seg := PathSegment{Name: child.Name}
+			if schema.ModuleOf(child) != schema.ModuleOf(e) {
+				seg.Module = schema.ModuleOf(child)
+			}
+			edits = diffNode(schema, edits, append(target[:len(target):len(target)], seg), child, olds[child.Name], news[child.Name])
+		}
+		return edits
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		edits = append(edits, &diffEdit{operation: CHANGE_REPLACE, target: target, entry: e, value: after})
+	}
+	return edits
+}
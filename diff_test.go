@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDiffData(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"hostname":"a","counter":1,"interface":[{"name":"eth0","unit":0,"mtu":1500},{"name":"eth1","unit":0}]}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for _, test := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"test:system":{"hostname":"a","counter":1,"interface":[{"name":"eth1","unit":0},{"name":"eth0","unit":0,"mtu":1500}]}}`,
+			http.StatusOK, `{"ietf-yang-patch:yang-patch":{"patch-id":"diff","edit":[]}}`},
+		{`{"test:system":{"hostname":"b","interface":[{"name":"eth0","unit":0,"mtu":9000,"ipv4":{"address":"192.0.2.1"}},{"name":"eth2","unit":0}]}}`,
+			http.StatusOK, `{"ietf-yang-patch:yang-patch":{"patch-id":"diff","edit":[` +
+				`{"edit-id":"edit1","operation":"delete","target":"/test:system/counter"},` +
+				`{"edit-id":"edit2","operation":"replace","target":"/test:system/hostname","value":{"test:hostname":"b"}},` +
+				`{"edit-id":"edit3","operation":"delete","target":"/test:system/interface=eth1,0"},` +
+				`{"edit-id":"edit4","operation":"create","target":"/test:system/interface=eth0,0/ipv4","value":{"test:ipv4":{"address":"192.0.2.1"}}},` +
+				`{"edit-id":"edit5","operation":"replace","target":"/test:system/interface=eth0,0/mtu","value":{"test:mtu":9000}},` +
+				`{"edit-id":"edit6","operation":"create","target":"/test:system/interface=eth2,0","value":{"test:interface":[{"name":"eth2","unit":0}]}}]}}`},
+		// A list left out or added as a whole is deleted or created entry by
+		// entry.
+		{`{"test:system":{"hostname":"a","counter":1}}`,
+			http.StatusOK, `{"ietf-yang-patch:yang-patch":{"patch-id":"diff","edit":[` +
+				`{"edit-id":"edit1","operation":"delete","target":"/test:system/interface=eth0,0"},` +
+				`{"edit-id":"edit2","operation":"delete","target":"/test:system/interface=eth1,0"}]}}`},
+		{`{"ietf-restconf:data":{}}`,
+			http.StatusOK, `{"ietf-yang-patch:yang-patch":{"patch-id":"diff","edit":[{"edit-id":"edit1","operation":"delete","target":"/test:system"}]}}`},
+		{`{"test:system":{"mtu":1}}`, http.StatusBadRequest, ""},
+		{`{"test:other":{}}`, http.StatusBadRequest, ""},
+		{`{`, http.StatusBadRequest, ""},
+	} {
+		rsp := doRequest(server, "POST", "/restconf/data", APPLICATION_DIFF_JSON, test.body)
+		if rsp.Code != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", test.body, rsp.Code, test.status, rsp.Body)
+			continue
+		}
+		if test.want == "" {
+			continue
+		}
+		if ctype := rsp.Header().Get("Content-Type"); ctype != APPLICATION_YANG_PATCH_JSON {
+			t.Errorf("%s: got Content-Type %q", test.body, ctype)
+		}
+		if rsp.Body.String() != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.body, rsp.Body, test.want)
+		}
+	}
+
+	// The datastore is left as it is.
+	rsp = doRequest(server, "GET", "/restconf/data/test:system/hostname", "", "")
+	if want := `{"test:hostname":"a"}`; rsp.Body.String() != want {
+		t.Errorf("GET after the diffs: got %s, want %s", rsp.Body, want)
+	}
+
+	rsp = doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`)
+	if rsp.Code != http.StatusNoContent {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	rsp = doRequest(server, "POST", "/restconf/data", APPLICATION_DIFF_JSON,
+		`{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0},{"name":"eth1","unit":0}]}}`)
+	want := `{"ietf-yang-patch:yang-patch":{"patch-id":"diff","edit":[` +
+		`{"edit-id":"edit1","operation":"create","target":"/test:system/interface=eth0,0","value":{"test:interface":[{"name":"eth0","unit":0}]}},` +
+		`{"edit-id":"edit2","operation":"create","target":"/test:system/interface=eth1,0","value":{"test:interface":[{"name":"eth1","unit":0}]}}]}}`
+	if rsp.Body.String() != want {
+		t.Errorf("diff adding a list: got\n%s\nwant\n%s", rsp.Body, want)
+	}
+}
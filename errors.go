@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+   {
+     "ietf-restconf:errors" : {
+       "error" : [
+         {
+           "error-type" : "protocol",
+           "error-tag" : "invalid-value",
+           "error-path" : "/example:system/interface[name='eth0']/mtu",
+           "error-message" : "..."
+         }
+       ]
+     }
+   }
+*/
+
+var (
+	ERROR_TYPE_TRANSPORT   = "transport"
+	ERROR_TYPE_RPC         = "rpc"
+	ERROR_TYPE_PROTOCOL    = "protocol"
+	ERROR_TYPE_APPLICATION = "application"
+
+	ERROR_TAG_IN_USE                  = "in-use"
+	ERROR_TAG_INVALID_VALUE           = "invalid-value"
+	ERROR_TAG_TOO_BIG                 = "too-big"
+	ERROR_TAG_MISSING_ATTRIBUTE       = "missing-attribute"
+	ERROR_TAG_BAD_ATTRIBUTE           = "bad-attribute"
+	ERROR_TAG_UNKNOWN_ATTRIBUTE       = "unknown-attribute"
+	ERROR_TAG_MISSING_ELEMENT         = "missing-element"
+	ERROR_TAG_BAD_ELEMENT             = "bad-element"
+	ERROR_TAG_UNKNOWN_ELEMENT         = "unknown-element"
+	ERROR_TAG_UNKNOWN_NAMESPACE       = "unknown-namespace"
+	ERROR_TAG_ACCESS_DENIED           = "access-denied"
+	ERROR_TAG_LOCK_DENIED             = "lock-denied"
+	ERROR_TAG_RESOURCE_DENIED         = "resource-denied"
+	ERROR_TAG_ROLLBACK_FAILED         = "rollback-failed"
+	ERROR_TAG_DATA_EXISTS             = "data-exists"
+	ERROR_TAG_DATA_MISSING            = "data-missing"
+	ERROR_TAG_OPERATION_NOT_SUPPORTED = "operation-not-supported"
+	ERROR_TAG_OPERATION_FAILED        = "operation-failed"
+	ERROR_TAG_PARTIAL_OPERATION       = "partial-operation"
+	ERROR_TAG_MALFORMED_MESSAGE       = "malformed-message"
+)
+
+// A RestConfError is a single error of the ietf-restconf:errors envelope
+// (RFC 8040 section 7.1). It also carries the HTTP status it is sent with.
+type RestConfError struct {
+	XMLName xml.Name `json:"-" xml:"error"`
+	Status  int      `json:"-" xml:"-"`
+
+	Type    string     `json:"error-type" xml:"error-type"`
+	Tag     string     `json:"error-tag" xml:"error-tag"`
+	AppTag  string     `json:"error-app-tag,omitempty" xml:"error-app-tag,omitempty"`
+	Path    *ErrorPath `json:"error-path,omitempty" xml:"error-path,omitempty"`
+	Message string     `json:"error-message,omitempty" xml:"error-message,omitempty"`
+}
+
+// NewError returns a RestConfError sent with the HTTP status.
+func NewError(status int, errType, tag, format string, args ...interface{}) *RestConfError {
+	return &RestConfError{
+		Status:  status,
+		Type:    errType,
+		Tag:     tag,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (err *RestConfError) Error() string {
+	return err.Tag + ": " + err.Message
+}
+
+// errorAt sets the error-path of the errors of err that have none to p. The
+// errors of a nested node are given their path first, so that they keep the
+// path of the innermost node.
+func errorAt(err error, p *ErrorPath) error {
+	switch err := err.(type) {
+	case *RestConfError:
+		if err.Path == nil {
+			err.Path = p
+		}
+	case ErrorList:
+		for _, e := range err {
+			if e.Path == nil {
+				e.Path = p
+			}
+		}
+	}
+	return err
+}
+
+// An ErrorPath is the instance-identifier of the data node an error is
+// about (RFC 8040 section 7.1). In JSON a node is qualified with its module
+// name where its module differs from that of its parent (RFC 7951 section
+// 6.11). In XML every node is qualified, the module names being declared as
+// namespace prefixes of the error-path element.
+type ErrorPath struct {
+	nodes []pathNode
+	text  string // the path as decoded from an error document
+}
+
+// A pathNode is one node of an ErrorPath. The keys of a list entry, or "."
+// for the value of a leaf-list, are given as predicates.
+type pathNode struct {
+	module, namespace, name string
+
+	keys   []string
+	values []string
+}
+
+// format returns the path, qualifying the nodes of the modules the qualify
+// function selects.
+func (p *ErrorPath) format(qualify func(module, parent string) bool) string {
+	if p.nodes == nil {
+		return p.text
+	}
+	var b strings.Builder
+	var parent string
+	for _, n := range p.nodes {
+		b.WriteByte('/')
+		if qualify(n.module, parent) {
+			b.WriteString(n.module + ":")
+		}
+		b.WriteString(n.name)
+		for i, key := range n.keys {
+			b.WriteByte('[')
+			if key != "." && qualify(n.module, n.module) {
+				b.WriteString(n.module + ":")
+			}
+			b.WriteString(key + "=" + quoteLiteral(n.values[i]) + "]")
+		}
+		parent = n.module
+	}
+	return b.String()
+}
+
+func (p *ErrorPath) String() string {
+	return p.format(func(module, parent string) bool { return module != parent })
+}
+
+func (p *ErrorPath) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *ErrorPath) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	declared := make(map[string]bool)
+	for _, n := range p.nodes {
+		if !declared[n.module] {
+			declared[n.module] = true
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:" + n.module}, Value: n.namespace})
+		}
+	}
+	return enc.EncodeElement(p.format(func(module, parent string) bool { return true }), start)
+}
+
+func (p *ErrorPath) UnmarshalJSON(b []byte) error {
+	*p = ErrorPath{}
+	return json.Unmarshal(b, &p.text)
+}
+
+func (p *ErrorPath) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	*p = ErrorPath{}
+	return dec.DecodeElement(&p.text, &start)
+}
+
+// quoteLiteral quotes s as an XPath string literal. A literal cannot escape
+// its quote, a value holding both quotes is joined with concat() from the
+// parts between its apostrophes and quoted apostrophes.
+func quoteLiteral(s string) string {
+	switch {
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'"
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`
+	}
+	var parts []string
+	for i, part := range strings.Split(s, "'") {
+		if i > 0 {
+			parts = append(parts, `"'"`)
+		}
+		if part != "" {
+			parts = append(parts, "'"+part+"'")
+		}
+	}
+	return "concat(" + strings.Join(parts, ", ") + ")"
+}
+
+type RestConfErrors struct {
+	XMLName xml.Name `json:"-" xml:"errors"`
+	XmlLns  string   `json:"-" xml:"xmlns,attr"`
+
+	Error []*RestConfError `json:"error" xml:"error"`
+}
+
+type RestConfErrorsJson struct {
+	Errors RestConfErrors `json:"ietf-restconf:errors"`
+}
+
+// An ErrorList is a set of errors reported together, e.g. every invalid leaf
+// of a request body.
+type ErrorList []*RestConfError
+
+func (errs ErrorList) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// add appends err to errs, flattening an ErrorList and mapping a PathError
+// to its RESTCONF error. Other errors are reported as an operation-failed
+// application error.
+func (errs *ErrorList) add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case ErrorList:
+		*errs = append(*errs, err...)
+	case *RestConfError:
+		*errs = append(*errs, err)
+	case *PathError:
+		*errs = append(*errs, err.restconfError())
+	default:
+		*errs = append(*errs, NewError(http.StatusInternalServerError,
+			ERROR_TYPE_APPLICATION, ERROR_TAG_OPERATION_FAILED, "%s", err.Error()))
+	}
+}
+
+// err returns errs as an error, nil if there are none.
+func (errs ErrorList) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// status returns the HTTP status of the most severe error: server errors
+// over client errors, and the highest status within a class.
+func (errs ErrorList) status() int {
+	status := http.StatusInternalServerError
+	for i, err := range errs {
+		if i == 0 || err.Status > status {
+			status = err.Status
+		}
+	}
+	return status
+}
+
+// writeError sends errs as a single RESTCONF errors document, with the
+// status of the most severe of them. The document is the yang-errors
+// structure of the schema of req if it loads ietf-restconf.
+func writeError(rsp http.ResponseWriter, req *http.Request, errs ...error) {
+	var list ErrorList
+	for _, err := range errs {
+		list.add(err)
+	}
+	status := list.status()
+
+	doc := RestConfErrors{
+		XmlLns: PUBLIC_XMLNS,
+		Error:  list,
+	}
+
+	var body []byte
+	var merr error
+
+	format := errorFormat(req)
+	schema, _ := req.Context().Value(schemaContextKey).(*Schema)
+	switch {
+	case schema != nil && schema.yangErrors != nil:
+		{
+			body = schema.encode(format, schema.yangErrors, errorsData(list))
+		}
+	case format == APPLICATION_DATA_XML:
+		{
+			body, merr = xml.Marshal(doc)
+		}
+	default:
+		{
+			body, merr = json.Marshal(RestConfErrorsJson{Errors: doc})
+		}
+	}
+
+	if merr != nil {
+		logRequest(req, "marshal error response failed!", merr.Error())
+		http.Error(rsp, list.Error(), status)
+		return
+	}
+
+	addVary(rsp, "Accept")
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(status)
+	rsp.Write(body)
+}
+
+// errorFormat picks the media type of an error response, the first yang-data
+// type of the client's Accept, then the format of the request body, then
+// JSON.
+func errorFormat(req *http.Request) string {
+	formats := strings.Split(req.Header.Get("Accept"), ",")
+	for _, format := range append(formats, req.Header.Get("Content-Type")) {
+		switch mediaType(format) {
+		case APPLICATION_DATA_XML:
+			return APPLICATION_DATA_XML
+		case APPLICATION_DATA_JSON:
+			return APPLICATION_DATA_JSON
+		}
+	}
+	return APPLICATION_DATA_JSON
+}
+
+// NotFound answers a request for a path no handler serves with a RESTCONF
+// error, in place of the plain text page of http.NotFound.
+func NotFound(rsp http.ResponseWriter, req *http.Request) {
+	writeError(rsp, req, NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+		ERROR_TAG_INVALID_VALUE, "no resource %q", req.URL.Path))
+}
+
+// MethodNotAllowed answers a request with a method its resource does not
+// support with a RESTCONF error, 501 if the server does not implement the
+// method at all.
+func MethodNotAllowed(rsp http.ResponseWriter, req *http.Request) {
+	writeError(rsp, req, methodError(req))
+}
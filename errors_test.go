@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteErrors(t *testing.T) {
+	req := httptest.NewRequest("GET", "/restconf/data", nil)
+	rsp := httptest.NewRecorder()
+	writeError(rsp, req,
+		invalidValue("first"),
+		ErrorList{unknownElement("second"), NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_DATA_EXISTS, "third")},
+		errors.New("fourth"))
+
+	if rsp.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", rsp.Code, http.StatusInternalServerError)
+	}
+
+	var doc RestConfErrorsJson
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("unmarshal %s: %v", rsp.Body, err)
+	}
+	var tags []string
+	for _, err := range doc.Errors.Error {
+		tags = append(tags, err.Tag)
+	}
+	want := []string{ERROR_TAG_INVALID_VALUE, ERROR_TAG_UNKNOWN_ELEMENT, ERROR_TAG_DATA_EXISTS, ERROR_TAG_OPERATION_FAILED}
+	if len(tags) != len(want) {
+		t.Fatalf("got error tags %v, want %v", tags, want)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("got error tags %v, want %v", tags, want)
+			break
+		}
+	}
+
+	rsp = httptest.NewRecorder()
+	writeError(rsp, req, invalidValue("first"), NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_DATA_EXISTS, "second"))
+	if rsp.Code != http.StatusConflict {
+		t.Errorf("got status %d, want %d", rsp.Code, http.StatusConflict)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		ctype string
+		body  string
+	}{
+		{APPLICATION_DATA_JSON, `{"test:system":{"hostname":{},"bogus":1,"interface":[{"name":"eth0","mtu":[]}]}}`},
+		{APPLICATION_DATA_XML, `<system xmlns="urn:test"><bogus/><interface><name>eth0</name><other/></interface><hostname>a</hostname><hostname>b</hostname></system>`},
+	} {
+		rsp := doRequest(server, "PUT", "/restconf/data/test:system", test.ctype, test.body)
+		if rsp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got status %d, want %d: %s", test.ctype, rsp.Code, http.StatusBadRequest, rsp.Body)
+		}
+
+		var doc RestConfErrors
+		var err error
+		if test.ctype == APPLICATION_DATA_XML {
+			err = xml.Unmarshal(rsp.Body.Bytes(), &doc)
+		} else {
+			var jdoc RestConfErrorsJson
+			err = json.Unmarshal(rsp.Body.Bytes(), &jdoc)
+			doc = jdoc.Errors
+		}
+		if err != nil {
+			t.Fatalf("%s: unmarshal %s: %v", test.ctype, rsp.Body, err)
+		}
+		if len(doc.Error) != 3 {
+			t.Errorf("%s: got %d errors, want 3: %s", test.ctype, len(doc.Error), rsp.Body)
+		}
+	}
+}
+
+func TestDecodeErrorTags(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		name   string
+		method string
+		url    string
+		ctype  string
+		body   string
+		etype  string
+		tag    string
+	}{
+		{"JSON syntax", "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{`, ERROR_TYPE_PROTOCOL, ERROR_TAG_MALFORMED_MESSAGE},
+		{"XML syntax", "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, `<system xmlns="urn:test"><hostname>`, ERROR_TYPE_PROTOCOL, ERROR_TAG_MALFORMED_MESSAGE},
+		{"two members", "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{},"test:other":{}}`, ERROR_TYPE_PROTOCOL, ERROR_TAG_MALFORMED_MESSAGE},
+		{"unknown member", "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"bogus":1}}`, ERROR_TYPE_APPLICATION, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"unknown element", "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, `<system xmlns="urn:test"><bogus/></system>`, ERROR_TYPE_APPLICATION, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"JSON type", "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"counter":"many"}}`, ERROR_TYPE_APPLICATION, ERROR_TAG_INVALID_VALUE},
+		{"XML type", "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, `<system xmlns="urn:test"><counter>-1</counter></system>`, ERROR_TYPE_APPLICATION, ERROR_TAG_INVALID_VALUE},
+		{"JSON shape", "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"interface":{"name":"eth0"}}}`, ERROR_TYPE_APPLICATION, ERROR_TAG_INVALID_VALUE},
+		{"duplicate element", "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, `<system xmlns="urn:test"><hostname>a</hostname><hostname>b</hostname></system>`, ERROR_TYPE_APPLICATION, ERROR_TAG_INVALID_VALUE},
+		{"missing key", "POST", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:interface":[{"name":"eth0"}]}`, ERROR_TYPE_APPLICATION, ERROR_TAG_MISSING_ELEMENT},
+	} {
+		rsp := doRequest(server, test.method, test.url, test.ctype, test.body)
+		if rsp.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, rsp.Code, http.StatusBadRequest, rsp.Body)
+			continue
+		}
+
+		var doc RestConfErrors
+		var err error
+		if test.ctype == APPLICATION_DATA_XML {
+			err = xml.Unmarshal(rsp.Body.Bytes(), &doc)
+		} else {
+			var jdoc RestConfErrorsJson
+			err = json.Unmarshal(rsp.Body.Bytes(), &jdoc)
+			doc = jdoc.Errors
+		}
+		if err != nil {
+			t.Fatalf("%s: unmarshal %s: %v", test.name, rsp.Body, err)
+		}
+		if len(doc.Error) != 1 || doc.Error[0].Type != test.etype || doc.Error[0].Tag != test.tag {
+			t.Errorf("%s: got %s, want a single %s %s error", test.name, rsp.Body, test.etype, test.tag)
+		}
+	}
+}
+
+func TestErrorPath(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		method, url, ctype, body string
+		tag, path                string
+	}{
+		{"PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			`{"test:system":{"interface":[{"name":"eth0","unit":1,"mtu":"big"}]}}`,
+			ERROR_TAG_INVALID_VALUE, "/test:system/interface[name='eth0'][unit='1']/mtu"},
+		{"PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			`{"test:system":{"interface":[{"name":"it's \"a\"","unit":1,"mtu":"big"}]}}`,
+			ERROR_TAG_INVALID_VALUE, `/test:system/interface[name=concat('it', "'", 's "a"')][unit='1']/mtu`},
+		{"PUT", "/restconf/data/test:system/interface=eth0,1", APPLICATION_DATA_JSON,
+			`{"test:interface":[{"name":"eth0","unit":1,"ipv4":{"dhcp":{"lease":-1}}}]}`,
+			ERROR_TAG_INVALID_VALUE, "/test:system/interface[name='eth0'][unit='1']/ipv4/dhcp/lease"},
+		{"PUT", "/restconf/data/test:system", APPLICATION_DATA_XML,
+			`<system xmlns="urn:test"><interface><name>eth0</name><unit>1</unit><mtu>big</mtu></interface></system>`,
+			ERROR_TAG_INVALID_VALUE, "/test:system/test:interface[test:name='eth0'][test:unit='1']/test:mtu"},
+		{"POST", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			`{"test:interface":[{"mtu":1500}]}`,
+			ERROR_TAG_MISSING_ELEMENT, "/test:system/interface"},
+	} {
+		rsp := doRequest(server, test.method, test.url, test.ctype, test.body)
+		if rsp.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: got status %d, want %d: %s", test.method, test.url, rsp.Code, http.StatusBadRequest, rsp.Body)
+		}
+
+		var doc RestConfErrors
+		var err error
+		if test.ctype == APPLICATION_DATA_XML {
+			if !strings.Contains(rsp.Body.String(), `xmlns:test="urn:test"`) {
+				t.Errorf("%s %s: error-path prefix test is not declared: %s", test.method, test.url, rsp.Body)
+			}
+			err = xml.Unmarshal(rsp.Body.Bytes(), &doc)
+		} else {
+			var jdoc RestConfErrorsJson
+			err = json.Unmarshal(rsp.Body.Bytes(), &jdoc)
+			doc = jdoc.Errors
+		}
+		if err != nil {
+			t.Fatalf("%s %s: unmarshal %s: %v", test.method, test.url, rsp.Body, err)
+		}
+		if len(doc.Error) != 1 || doc.Error[0].Tag != test.tag || doc.Error[0].Path == nil || doc.Error[0].Path.String() != test.path {
+			t.Errorf("%s %s: got %s, want a %s error at %s", test.method, test.url, rsp.Body, test.tag, test.path)
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		method string
+		url    string
+		accept string
+		status int
+		format string
+	}{
+		{"GET", "/nowhere", "", http.StatusNotFound, APPLICATION_DATA_JSON},
+		{"GET", "/nowhere", "text/html, " + APPLICATION_DATA_XML, http.StatusNotFound, APPLICATION_DATA_XML},
+		{"GET", "/restconfx", APPLICATION_DATA_JSON, http.StatusNotFound, APPLICATION_DATA_JSON},
+		{"POST", "/restconf", APPLICATION_DATA_XML, http.StatusMethodNotAllowed, APPLICATION_DATA_XML},
+		{"GET", "/.well-known/host-meta", "text/plain", http.StatusNotAcceptable, APPLICATION_DATA_JSON},
+	} {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		if rsp.Code != test.status || rsp.Header().Get("Content-Type") != test.format {
+			t.Errorf("%s %s: got status %d, Content-Type %q, want %d, %q", test.method, test.url,
+				rsp.Code, rsp.Header().Get("Content-Type"), test.status, test.format)
+			continue
+		}
+		var err error
+		if test.format == APPLICATION_DATA_XML {
+			err = xml.Unmarshal(rsp.Body.Bytes(), &RestConfErrors{})
+		} else {
+			err = json.Unmarshal(rsp.Body.Bytes(), &RestConfErrorsJson{})
+		}
+		if err != nil {
+			t.Errorf("%s %s: unmarshal %s: %v", test.method, test.url, rsp.Body, err)
+		}
+	}
+}
+
+// restconfModuleText holds the yang-errors structure of ietf-restconf.
+var restconfModuleText = `
+module ietf-restconf {
+  yang-version 1.1;
+  namespace "urn:ietf:params:xml:ns:yang:ietf-restconf";
+  prefix "rc";
+
+  extension yang-data {
+    argument name {
+      yin-element true;
+    }
+  }
+
+  rc:yang-data yang-errors {
+    uses errors;
+  }
+
+  grouping errors {
+    container errors {
+      list error {
+        leaf error-type {
+          type enumeration {
+            enum transport;
+            enum rpc;
+            enum protocol;
+            enum application;
+          }
+          mandatory true;
+        }
+        leaf error-tag { type string; mandatory true; }
+        leaf error-app-tag { type string; }
+        leaf error-path { type instance-identifier; }
+        leaf error-message { type string; }
+        anydata error-info;
+      }
+    }
+  }
+}
+`
+
+func TestYangErrors(t *testing.T) {
+	fallback := testServer(t)
+	server := NewRestConf(testSchema(t, map[string]string{"test": testModuleText, "ietf-restconf": restconfModuleText}))
+	if server.Schema().yangErrors == nil {
+		t.Fatal("no yang-errors structure in ietf-restconf")
+	}
+
+	body := `{"test:system":{"mtu":1,"interface":[{"name":"eth0","unit":300}]}}`
+	for _, format := range []string{APPLICATION_DATA_JSON, APPLICATION_DATA_XML} {
+		req := func(server *RestConf) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("PUT", "/restconf/data/test:system", strings.NewReader(body))
+			req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+			req.Header.Set("Accept", format)
+			rsp := httptest.NewRecorder()
+			server.ServeHTTP(rsp, req)
+			return rsp
+		}
+		got, want := req(server), req(fallback)
+		if got.Code != want.Code || got.Header().Get("Content-Type") != format {
+			t.Errorf("%s: got status %d, %s, want %d", format, got.Code, got.Header().Get("Content-Type"), want.Code)
+		}
+
+		// The documents hold the same errors, whatever their order of
+		// members.
+		var gotDoc, wantDoc RestConfErrorsJson
+		if format == APPLICATION_DATA_XML {
+			if err := xml.Unmarshal(got.Body.Bytes(), &gotDoc.Errors); err != nil {
+				t.Fatalf("%s: %v: %s", format, err, got.Body)
+			}
+			xml.Unmarshal(want.Body.Bytes(), &wantDoc.Errors)
+			if !strings.Contains(got.Body.String(), `<errors xmlns="`+PUBLIC_XMLNS+`">`) ||
+				!strings.Contains(got.Body.String(), `<error-path xmlns:test="urn:test">/test:system/test:interface[test:name=&#39;eth0&#39;][test:unit=&#39;300&#39;]/test:unit</error-path>`) {
+				t.Errorf("%s: got %s", format, got.Body)
+			}
+		} else {
+			if err := json.Unmarshal(got.Body.Bytes(), &gotDoc); err != nil {
+				t.Fatalf("%s: %v: %s", format, err, got.Body)
+			}
+			json.Unmarshal(want.Body.Bytes(), &wantDoc)
+		}
+		gotJSON, _ := json.Marshal(gotDoc)
+		wantJSON, _ := json.Marshal(wantDoc)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: got errors %s, want %s", format, gotJSON, wantJSON)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	server := testServer(t)
+	body := `{"test:system":{"hostname":"a","uptime":10,"interface":[{"name":"eth0","unit":0,"mtu":1500}]}}`
+	if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, body); rsp.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d: %s", rsp.Code, http.StatusCreated, rsp.Body)
+	}
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{APPLICATION_DATA_JSON, `{"ietf-restconf:data":{"test:system":{"hostname":"a",` +
+			`"interface":[{"mtu":1500,"name":"eth0","unit":0}]}}}`},
+		{APPLICATION_DATA_XML, `<data xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf"><system xmlns="urn:test">` +
+			`<hostname>a</hostname><interface><mtu>1500</mtu><name>eth0</name><unit>0</unit></interface></system></data>`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := server.Schema().Export(ts.Client(), ts.URL, "running", tt.format, &buf); err != nil {
+			t.Fatalf("Export(%s): %v", tt.format, err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("Export(%s): got %s, want %s", tt.format, got, tt.want)
+		}
+		if err := server.Schema().ValidateData(strings.NewReader(buf.String()), tt.format); err != nil {
+			t.Errorf("Export(%s): export does not validate: %v", tt.format, err)
+		}
+	}
+
+	// The operational datastore holds the state data as well.
+	var buf bytes.Buffer
+	if err := server.Schema().Export(ts.Client(), ts.URL, "operational", APPLICATION_DATA_JSON, &buf); err != nil {
+		t.Fatalf("Export(operational): %v", err)
+	}
+	if got, want := buf.String(), `{"ietf-restconf:data":{"test:system":{"hostname":"a",`+
+		`"interface":[{"mtu":1500,"name":"eth0","unit":0}],"uptime":10}}}`; got != want {
+		t.Errorf("Export(operational): got %s, want %s", got, want)
+	}
+
+	if err := server.Schema().Export(ts.Client(), ts.URL, "candidate", APPLICATION_DATA_JSON, &bytes.Buffer{}); err == nil {
+		t.Errorf("Export(candidate): got no error")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+   Modules loaded only to support others, e.g. modules of internal helper
+   nodes, are hidden from the clients: they are not listed among the modules
+   of the schema, their sources are not served, and the paths of their data
+   and operations name no resource. The nodes they augment into exposed
+   modules are part of those modules and stay exposed.
+
+   restconf -hide example-internal,example-debug
+   restconf -expose example,ietf-interfaces
+*/
+
+// Expose hides the modules of the schema not listed in expose, all of them
+// being exposed if it is empty, and the modules listed in hide. Every listed
+// module must be loaded.
+func (schema *Schema) Expose(expose, hide []string) error {
+	for _, name := range append(append([]string{}, expose...), hide...) {
+		if _, ok := schema.Modules[name]; !ok {
+			return fmt.Errorf("unknown module %q", name)
+		}
+	}
+
+	hidden := make(map[string]bool)
+	if len(expose) > 0 {
+		for name := range schema.Modules {
+			hidden[name] = true
+		}
+		for _, name := range expose {
+			delete(hidden, name)
+		}
+	}
+	for _, name := range hide {
+		hidden[name] = true
+	}
+	schema.hidden = hidden
+	return nil
+}
+
+// exposed reports whether name is a module of the schema that is not hidden.
+func (schema *Schema) exposed(name string) bool {
+	_, ok := schema.Modules[name]
+	return ok && !schema.hidden[name]
+}
+
+// moduleList splits the comma separated list of module names s.
+func moduleList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+var exposeAugmentModuleText = `
+module expose-aug {
+  namespace "urn:expose-aug";
+  prefix x;
+  import test { prefix t; }
+
+  augment "/t:system" {
+    leaf extra { type string; }
+  }
+}
+`
+
+var exposeRpcModuleText = `
+module expose-rpc {
+  namespace "urn:expose-rpc";
+  prefix r;
+
+  rpc debug {
+    input {
+      leaf level { type uint8; }
+    }
+  }
+}
+`
+
+func TestExpose(t *testing.T) {
+	schema := testSchema(t, map[string]string{
+		"test":       testModuleText,
+		"query":      queryModuleText,
+		"expose-aug": exposeAugmentModuleText,
+		"expose-rpc": exposeRpcModuleText,
+	})
+	if err := schema.Expose(nil, []string{"unknown"}); err == nil {
+		t.Errorf("Expose of an unknown module: got no error")
+	}
+	if err := schema.Expose([]string{"test"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := schema.ModuleNames(); len(got) != 1 || got[0] != "test" {
+		t.Errorf("got modules %v, want [test]", got)
+	}
+	if err := schema.Expose(nil, []string{"query", "expose-aug", "expose-rpc"}); err != nil {
+		t.Fatal(err)
+	}
+	server := NewRestConf(schema)
+
+	for i, step := range []struct {
+		method, url, body string
+		status            int
+		want              string
+	}{
+		{"PUT", "/restconf/data/query:system", `{"query:system":{"hostname":"a"}}`, http.StatusBadRequest, ""},
+		{"GET", "/restconf/data/query:system", "", http.StatusBadRequest, ""},
+		{"POST", "/restconf/data", `{"query:system":{"hostname":"a"}}`, http.StatusBadRequest, ""},
+		{"GET", "/restconf/yang/query", "", http.StatusNotFound, ""},
+		{"GET", "/restconf/yang/test", "", http.StatusOK, ""},
+		{"POST", "/restconf/operations/expose-rpc:debug", "", http.StatusNotFound, ""},
+		{"GET", "/restconf/operations", "", http.StatusOK, `{"ietf-restconf:operations":{"test:ping":[null],"test:reboot":[null]}}`},
+		// The augment of a hidden module is part of the exposed module.
+		{"PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"a","expose-aug:extra":"b"}}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data", "", http.StatusOK, `{"ietf-restconf:data":{"test:system":{"expose-aug:extra":"b","hostname":"a"}}}`},
+	} {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("step %d: %s %s: got status %d, want %d: %s", i, step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("step %d: %s %s: got body %s, want %s", i, step.method, step.url, rsp.Body, step.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+   The HTTPS listener speaks HTTP/2, negotiated with ALPN, and HTTP/1.1;
+   -http2=false leaves HTTP/1.1 only. A plaintext listener, the listen
+   address without -tls-cert or the -http one, speaks HTTP/1.1, and with
+   -h2c HTTP/2 with prior knowledge as well, as a proxy terminating TLS in
+   front of the server may send it (RFC 9113 section 3.3).
+
+   restconf -addr :8080 -h2c -http2-max-streams 1000
+
+   Every event stream and subscription holds a stream of its connection
+   while it is open, -http2-max-streams bounds the streams of a client
+   connection, and so the event streams it can multiplex.
+*/
+
+var (
+	HTTP2_ENABLED     = true
+	H2C_ENABLED       = false
+	HTTP2_MAX_STREAMS = 0 // 0 for the default of net/http, 100 at least
+
+	HTTP2_MAX_FRAME_SIZE = 0 // 0 for the default of net/http
+	HTTP2_PING_TIMEOUT   = time.Duration(0)
+
+	HEADER_TIMEOUT = 10 * time.Second // time a client has to send its request headers, 0 for no limit
+)
+
+// http2Config returns the HTTP/2 settings of the flags.
+func http2Config() (*http.HTTP2Config, error) {
+	switch {
+	case HTTP2_MAX_STREAMS < 0:
+		return nil, fmt.Errorf("-http2-max-streams %d must not be negative", HTTP2_MAX_STREAMS)
+	case HTTP2_MAX_FRAME_SIZE != 0 && (HTTP2_MAX_FRAME_SIZE < 1<<14 || HTTP2_MAX_FRAME_SIZE > 1<<24):
+		return nil, fmt.Errorf("-http2-max-frame-size %d must be within 16384 and 16777216", HTTP2_MAX_FRAME_SIZE)
+	case HTTP2_PING_TIMEOUT < 0:
+		return nil, fmt.Errorf("-http2-ping %s must not be negative", HTTP2_PING_TIMEOUT)
+	}
+	return &http.HTTP2Config{
+		MaxConcurrentStreams: HTTP2_MAX_STREAMS,
+		MaxReadFrameSize:     HTTP2_MAX_FRAME_SIZE,
+		SendPingTimeout:      HTTP2_PING_TIMEOUT,
+	}, nil
+}
+
+// newServer returns the server of a listener serving handler, over TLS if
+// secure, with the protocols and HTTP/2 settings of the flags. Only the
+// headers are read within a timeout here, the writes read their body within
+// -body-timeout, see readBody, and the event streams keep their connection.
+func newServer(handler http.Handler, secure bool) (*http.Server, error) {
+	config, err := http2Config()
+	if err != nil {
+		return nil, err
+	}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	if secure {
+		protocols.SetHTTP2(HTTP2_ENABLED)
+	} else {
+		protocols.SetUnencryptedHTTP2(H2C_ENABLED)
+	}
+	return &http.Server{Handler: handler, Protocols: protocols, HTTP2: config, ReadHeaderTimeout: HEADER_TIMEOUT}, nil
+}
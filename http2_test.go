@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// startServer starts srv on a loopback listener, over TLS with the
+// certificate of httptest if secure as main serves it, and returns its URL
+// and a client offering HTTP/2, or only speaking h2c if not secure.
+func startServer(t *testing.T, srv *http.Server, secure bool) (string, *http.Client, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secure {
+		go srv.Serve(ln)
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+		return "http://" + ln.Addr().String(), client, func() { srv.Close() }
+	}
+
+	ts := httptest.NewUnstartedServer(nil)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	ts.Close()
+	srv.TLSConfig = &tls.Config{Certificates: ts.TLS.Certificates}
+	go srv.ServeTLS(ln, "", "")
+	return "https://" + ln.Addr().String(), ts.Client(), func() { srv.Close() }
+}
+
+func TestHTTP2Streams(t *testing.T) {
+	server := testServer(t)
+	defer func(h2c bool) { H2C_ENABLED = h2c }(H2C_ENABLED)
+	H2C_ENABLED = true
+
+	for _, secure := range []bool{true, false} {
+		srv, err := newServer(server, secure)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conns int32
+		srv.ConnState = func(c net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		url, client, stop := startServer(t, srv, secure)
+
+		// The event streams and the requests share a connection.
+		var open []*http.Response
+		for i := 0; i < 3; i++ {
+			rsp, err := client.Get(url + STREAMS_PREFIX + "/NETCONF/json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			open = append(open, rsp)
+			if rsp.ProtoMajor != 2 || rsp.StatusCode != http.StatusOK {
+				t.Errorf("secure %v: stream %d: got %s, status %d", secure, i, rsp.Proto, rsp.StatusCode)
+			}
+		}
+		rsp, err := client.Get(url + "/restconf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.ProtoMajor != 2 || rsp.StatusCode != http.StatusOK {
+			t.Errorf("secure %v: GET: got %s, status %d", secure, rsp.Proto, rsp.StatusCode)
+		}
+		for _, rsp := range open {
+			rsp.Body.Close()
+		}
+		if n := atomic.LoadInt32(&conns); n != 1 {
+			t.Errorf("secure %v: got %d connections, want 1", secure, n)
+		}
+		stop()
+	}
+}
+
+func TestHTTP2Disabled(t *testing.T) {
+	server := testServer(t)
+	defer func() { HTTP2_ENABLED, H2C_ENABLED = true, false }()
+
+	for _, secure := range []bool{true, false} {
+		HTTP2_ENABLED, H2C_ENABLED = false, false
+		srv, err := newServer(server, secure)
+		if err != nil {
+			t.Fatal(err)
+		}
+		url, client, stop := startServer(t, srv, secure)
+		rsp, err := client.Get(url + "/restconf")
+		switch {
+		case !secure:
+			if err == nil {
+				rsp.Body.Close()
+				t.Errorf("h2c while disabled: got %s, status %d, want no response", rsp.Proto, rsp.StatusCode)
+			}
+		case err != nil:
+			t.Fatal(err)
+		default:
+			rsp.Body.Close()
+			if rsp.ProtoMajor != 1 || rsp.StatusCode != http.StatusOK {
+				t.Errorf("got %s, status %d, want HTTP/1.1", rsp.Proto, rsp.StatusCode)
+			}
+		}
+		stop()
+	}
+
+	for _, set := range []func(){
+		func() { HTTP2_MAX_STREAMS = -1 },
+		func() { HTTP2_MAX_FRAME_SIZE = 1024 },
+	} {
+		set()
+		if _, err := newServer(server, true); err == nil {
+			t.Errorf("invalid HTTP/2 settings: got no error")
+		}
+		HTTP2_MAX_STREAMS, HTTP2_MAX_FRAME_SIZE = 0, 0
+	}
+}
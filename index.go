@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+)
+
+/*
+   A GET of "/" returns an index of the resources a developer explores the
+   server from, as an HTML page when the Accept header prefers text/html, as
+   it does for a browser, and as JSON otherwise:
+
+   {
+     "go-restconf:index" : {
+       "link" : [
+         { "rel" : "restconf", "href" : "/restconf", "title" : "RESTCONF API root" },
+         ...
+       ]
+     }
+   }
+
+   Only "/" itself is the index, the paths no resource serves are still not
+   found, and a handler registered at "/" replaces the index.
+*/
+
+var TEXT_HTML = "text/html"
+
+type IndexLink struct {
+	Rel   string `json:"rel"`
+	Href  string `json:"href"`
+	Title string `json:"title"`
+}
+
+type IndexJson struct {
+	Index struct {
+		Link []IndexLink `json:"link"`
+	} `json:"go-restconf:index"`
+}
+
+// indexLinks lists the resources of the index.
+var indexLinks = []IndexLink{
+	{"restconf", RESTCONF_PREFIX, "RESTCONF API root"},
+	{"host-meta", "/.well-known/host-meta", "RESTCONF root discovery"},
+	{"yang-library-version", RESTCONF_PREFIX + "/yang-library-version", "YANG library version"},
+	{"yang", YANG_MODULE_PREFIX, "YANG modules"},
+	{"schema", SCHEMA_EXPORT_PREFIX, "schema tree"},
+	{"openapi", OPENAPI_PREFIX, "OpenAPI description"},
+	{"server-state", RESTCONF_PREFIX + "/data/" + SERVER_STATE_MODULE + ":server-state", "server metrics"},
+	{"version", RESTCONF_PREFIX + "/version", "server version"},
+	{"health", HEALTHZ_PATH, "health check"},
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}}</title></head>
+<body><h1>{{.Name}}</h1><ul>
+{{range .Links}}<li><a href="{{.Href}}">{{.Title}}</a> <code>{{.Href}}</code></li>
+{{end}}</ul></body></html>
+`))
+
+// Index sends the index of the resources of the server.
+func (restconf *RestConf) Index(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+
+	addVary(rsp, "Accept")
+	if acceptQuality(req, TEXT_HTML) > acceptQuality(req, APPLICATION_JSON) {
+		rsp.Header().Set("Content-Type", TEXT_HTML+"; charset=utf-8")
+		rsp.WriteHeader(http.StatusOK)
+		if req.Method != "HEAD" {
+			indexTemplate.Execute(rsp, struct {
+				Name  string
+				Links []IndexLink
+			}{restconf.serverName, indexLinks})
+		}
+		return
+	}
+
+	var doc IndexJson
+	doc.Index.Link = indexLinks
+	body, _ := json.Marshal(doc)
+	rsp.Header().Set("Content-Type", APPLICATION_JSON)
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method != "HEAD" {
+		rsp.Write(body)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "GET", "/", "", "")
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != APPLICATION_JSON {
+		t.Fatalf("got status %d type %q: %s", rsp.Code, rsp.Header().Get("Content-Type"), rsp.Body)
+	}
+	var doc IndexJson
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	links := make(map[string]string)
+	for _, link := range doc.Index.Link {
+		links[link.Rel] = link.Href
+	}
+	for rel, href := range map[string]string{
+		"restconf":             RESTCONF_PREFIX,
+		"host-meta":            "/.well-known/host-meta",
+		"yang-library-version": RESTCONF_PREFIX + "/yang-library-version",
+		"schema":               SCHEMA_EXPORT_PREFIX,
+		"server-state":         RESTCONF_PREFIX + "/data/go-restconf-server:server-state",
+	} {
+		if links[rel] != href {
+			t.Errorf("link %s: got %q, want %q", rel, links[rel], href)
+		}
+	}
+
+	for _, test := range []struct {
+		accept string
+		html   bool
+	}{
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"*/*", false},
+		{"application/json", false},
+		{"text/html;q=0.5, application/json", false},
+		{"text/*", true},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", test.accept)
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		html := strings.HasPrefix(rsp.Header().Get("Content-Type"), TEXT_HTML)
+		if rsp.Code != http.StatusOK || html != test.html {
+			t.Errorf("Accept %q: got status %d type %q", test.accept, rsp.Code, rsp.Header().Get("Content-Type"))
+		}
+		if html && !strings.Contains(rsp.Body.String(), `<a href="/restconf/schema">`) {
+			t.Errorf("Accept %q: no link to the schema: %s", test.accept, rsp.Body)
+		}
+	}
+
+	if rsp := doRequest(server, "POST", "/", APPLICATION_DATA_JSON, "{}"); rsp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want 405", rsp.Code)
+	}
+	// The index takes no other path.
+	if rsp := doRequest(server, "GET", "/bogus", "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET /bogus: got status %d, want 404", rsp.Code)
+	}
+
+	// A handler registered at "/" replaces the index.
+	if err := server.Register("/", func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusTeapot)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if rsp := doRequest(server, "GET", "/", "", ""); rsp.Code != http.StatusTeapot {
+		t.Errorf("registered /: got status %d", rsp.Code)
+	}
+}
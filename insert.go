@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The entries of a list or leaf-list ordered-by user are kept, and sent, in
+   the order the client gives them. A POST or PUT of an entry places it with
+   the insert query parameter (RFC 8040 section 4.8.5): first, last, which is
+   the default, or before or after the entry the point parameter addresses
+   (section 4.8.6).
+
+   POST /restconf/data/example:system?insert=before&point=/example:system/dns=10.0.0.1
+
+   {
+     "example:dns" : [ "10.0.0.2" ]
+   }
+*/
+
+var (
+	INSERT_PARAM = "insert"
+	POINT_PARAM  = "point"
+
+	INSERT_FIRST  = "first"
+	INSERT_LAST   = "last"
+	INSERT_BEFORE = "before"
+	INSERT_AFTER  = "after"
+)
+
+// An insertion is the position a list entry or leaf-list value is placed at.
+type insertion struct {
+	where string   // INSERT_FIRST, INSERT_LAST, INSERT_BEFORE or INSERT_AFTER
+	point []string // key values, or the value, of the point entry for before and after
+}
+
+// orderedByUser reports whether the entries of the list or leaf-list e are
+// ordered by the client.
+func orderedByUser(e *yang.Entry) bool {
+	return e.ListAttr != nil && e.ListAttr.OrderedBy != nil && e.ListAttr.OrderedBy.Name == "user"
+}
+
+// insertion returns the position the insert and point parameters of req
+// place the list entry or leaf-list value target at, or nil if req has
+// neither. The point must be an entry of the same list instance as target.
+func (schema *Schema) insertion(req *http.Request, target *Resource) (*insertion, error) {
+	query := req.URL.Query()
+	where, point := query.Get(INSERT_PARAM), query.Get(POINT_PARAM)
+	if where == "" && point == "" {
+		return nil, nil
+	}
+
+	e := target.Entry()
+	switch {
+	case req.Method != "POST" && req.Method != "PUT":
+		return nil, invalidValue("the %s and %s parameters are only allowed with POST and PUT", INSERT_PARAM, POINT_PARAM)
+	case !orderedByUser(e) || target.Segment().Keys == nil:
+		return nil, invalidValue("%s is not an entry of a list ordered-by user", e.Name)
+	}
+
+	ins := &insertion{where: where}
+	switch where {
+	case INSERT_FIRST, INSERT_LAST:
+		if point != "" {
+			return nil, invalidValue("the %s parameter is only allowed with %s=%s or %s", POINT_PARAM, INSERT_PARAM, INSERT_BEFORE, INSERT_AFTER)
+		}
+		return ins, nil
+	case INSERT_BEFORE, INSERT_AFTER:
+		if point == "" {
+			return nil, invalidValue("%s=%s requires the %s parameter", INSERT_PARAM, where, POINT_PARAM)
+		}
+	default:
+		return nil, invalidValue("invalid %s parameter %q", INSERT_PARAM, where)
+	}
+
+	// The point is a data resource identifier, the path of the entry
+	// relative to the datastore resource.
+	var err error
+	ins.point, err = schema.insertPoint(target, nil, point, POINT_PARAM+" parameter")
+	if err != nil {
+		return nil, err
+	}
+	return ins, nil
+}
+
+// insertPoint returns the keys of the point entry of an insertion of target,
+// whose path is point relative to the resource base, nil for the datastore.
+// The point must be an entry of the same list instance as target, what names
+// the point in the errors.
+func (schema *Schema) insertPoint(target, base *Resource, point, what string) ([]string, error) {
+	segs, err := ParsePath(strings.TrimPrefix(point, RESTCONF_PREFIX+"/data"))
+	if err != nil {
+		return nil, invalidValue("invalid %s %q: %s", what, point, err.Error())
+	}
+	if base != nil {
+		segs = append(base.Segments[:len(base.Segments):len(base.Segments)], segs...)
+	}
+	var p *Resource
+	if len(segs) > 0 {
+		p, err = schema.Resolve(segs)
+	}
+	if p == nil || err != nil || !sameInstance(p.Parent(), target.Parent()) ||
+		p.Entry() != target.Entry() || p.Segment().Keys == nil {
+		return nil, invalidValue("%s %q is not an entry of %s", what, point, target.Entry().Name)
+	}
+	return p.Segment().Keys, nil
+}
+
+// sameInstance reports whether the resources a and b address the same data
+// node, nil addressing the datastore.
+func sameInstance(a, b *Resource) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.Entries) != len(b.Entries) {
+		return false
+	}
+	for i, e := range a.Entries {
+		if e != b.Entries[i] || strings.Join(a.Segments[i].Keys, "\x00") != strings.Join(b.Segments[i].Keys, "\x00") ||
+			(a.Segments[i].Keys == nil) != (b.Segments[i].Keys == nil) {
+			return false
+		}
+	}
+	return true
+}
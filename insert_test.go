@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+var orderedModuleText = `
+module ord {
+  namespace "urn:ord";
+  prefix o;
+
+  container system {
+    leaf-list dns {
+      type string;
+      ordered-by user;
+    }
+    list route {
+      key dest;
+      ordered-by user;
+      leaf dest { type string; }
+    }
+    leaf-list tag { type string; }
+  }
+}
+`
+
+func TestInsert(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"ord": orderedModuleText}))
+
+	point := func(path string) string { return url.QueryEscape(path) }
+	steps := []struct {
+		method, url, body string
+		status            int
+		want              string
+	}{
+		{"POST", "/restconf/data/ord:system", `{"ord:dns":["b"]}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data/ord:system?insert=first", `{"ord:dns":["a"]}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data/ord:system?insert=last", `{"ord:dns":["d"]}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data/ord:system?insert=before&point=" + point("/ord:system/dns=d"), `{"ord:dns":["c"]}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data/ord:system?insert=after&point=" + point("/ord:system/dns=d"), `{"ord:dns":["e"]}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data/ord:system/dns", "", http.StatusOK, `{"ord:dns":["a","b","c","d","e"]}`},
+		{"PUT", "/restconf/data/ord:system/dns=a?insert=after&point=" + point("/ord:system/dns=c"), `{"ord:dns":["a"]}`, http.StatusNoContent, ""},
+		{"PUT", "/restconf/data/ord:system/dns=e?insert=first", `{"ord:dns":["e"]}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/ord:system/dns", "", http.StatusOK, `{"ord:dns":["e","b","c","a","d"]}`},
+
+		{"POST", "/restconf/data/ord:system", `{"ord:route":[{"dest":"y"}]}`, http.StatusCreated, ""},
+		{"POST", "/restconf/data/ord:system?insert=before&point=" + point("/ord:system/route=y"), `{"ord:route":[{"dest":"x"}]}`, http.StatusCreated, ""},
+		{"PUT", "/restconf/data/ord:system/route=z?insert=first", `{"ord:route":[{"dest":"z"}]}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data/ord:system/route", "", http.StatusOK, `{"ord:route":[{"dest":"z"},{"dest":"x"},{"dest":"y"}]}`},
+
+		{"POST", "/restconf/data/ord:system?insert=before&point=" + point("/ord:system/dns=q"), `{"ord:dns":["f"]}`, http.StatusBadRequest, ""},
+		{"POST", "/restconf/data/ord:system?insert=before&point=" + point("/ord:system/route=x"), `{"ord:dns":["f"]}`, http.StatusBadRequest, ""},
+		{"POST", "/restconf/data/ord:system?insert=before", `{"ord:dns":["f"]}`, http.StatusBadRequest, ""},
+		{"POST", "/restconf/data/ord:system?insert=middle", `{"ord:dns":["f"]}`, http.StatusBadRequest, ""},
+		{"POST", "/restconf/data/ord:system?insert=first", `{"ord:tag":["f"]}`, http.StatusBadRequest, ""},
+		{"PUT", "/restconf/data/ord:system/dns=a?insert=before&point=" + point("/ord:system/dns=a"), `{"ord:dns":["a"]}`, http.StatusBadRequest, ""},
+		{"PATCH", "/restconf/data/ord:system?insert=first", `{"ord:system":{}}`, http.StatusBadRequest, ""},
+		{"GET", "/restconf/data/ord:system/dns", "", http.StatusOK, `{"ord:dns":["e","b","c","a","d"]}`},
+	}
+	for _, step := range steps {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("%s %s: got %s, want %s", step.method, step.url, rsp.Body, step.want)
+		}
+	}
+}
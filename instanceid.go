@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   An instance-identifier leaf holds the path of a data node (RFC 7950
+   section 9.13), module qualified as in the JSON encoding (RFC 7951 section
+   6.11), with predicates giving the keys of each list entry and the value
+   of a leaf-list entry:
+
+   /example:system/interface[name='eth0']/address[.='10.0.0.1']
+
+   Unless its type says require-instance false, an edit leaving the leaf
+   pointing at a node that does not exist fails with data-missing. In the
+   XML encoding the nodes are qualified by namespace prefixes declared on
+   the leaf element.
+*/
+
+var ERROR_APP_TAG_INSTANCE_REQUIRED = "instance-required"
+
+// An instanceStep is one node of an instance-identifier.
+type instanceStep struct {
+	module string // module name or XML prefix, "" if the node is not qualified
+	name   string
+	preds  []instancePred
+}
+
+// An instancePred is a predicate of an instance-identifier node, the value
+// of a key leaf, of a leaf-list entry when name is ".", or the position of
+// an entry when name is "".
+type instancePred struct {
+	module string
+	name   string
+	value  string
+}
+
+// parseInstanceID splits the instance-identifier s into its nodes.
+func parseInstanceID(s string) ([]instanceStep, error) {
+	pos := 0
+	space := func() {
+		for pos < len(s) && strings.ContainsRune(" \t\r\n", rune(s[pos])) {
+			pos++
+		}
+	}
+	// name reads a node name, qualified or not.
+	name := func() (string, string, error) {
+		start := pos
+		for pos < len(s) && !strings.ContainsRune("/[]= \t\r\n", rune(s[pos])) {
+			pos++
+		}
+		mod, local := splitName(s[start:pos])
+		if !isIdentifier(local) || (mod != "" && !isIdentifier(mod)) {
+			return "", "", fmt.Errorf("expected a node name at offset %d", start)
+		}
+		return mod, local, nil
+	}
+
+	if s == "" || s[0] != '/' {
+		return nil, fmt.Errorf("an instance-identifier starts with /")
+	}
+	var steps []instanceStep
+	for pos < len(s) {
+		if s[pos] != '/' {
+			return nil, fmt.Errorf("unexpected %q at offset %d", s[pos], pos)
+		}
+		pos++
+
+		var step instanceStep
+		var err error
+		if step.module, step.name, err = name(); err != nil {
+			return nil, err
+		}
+		for pos < len(s) && s[pos] == '[' {
+			pos++
+			space()
+			var pred instancePred
+			switch {
+			case pos < len(s) && '0' <= s[pos] && s[pos] <= '9':
+				start := pos
+				for pos < len(s) && '0' <= s[pos] && s[pos] <= '9' {
+					pos++
+				}
+				pred.value = s[start:pos]
+			default:
+				if pos < len(s) && s[pos] == '.' {
+					pos++
+					pred.name = "."
+				} else if pred.module, pred.name, err = name(); err != nil {
+					return nil, err
+				}
+				space()
+				if pos >= len(s) || s[pos] != '=' {
+					return nil, fmt.Errorf("expected = at offset %d", pos)
+				}
+				pos++
+				space()
+				if pos >= len(s) || (s[pos] != '\'' && s[pos] != '"') {
+					return nil, fmt.Errorf("expected a quoted value at offset %d", pos)
+				}
+				end := strings.IndexByte(s[pos+1:], s[pos])
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated value at offset %d", pos)
+				}
+				pred.value = s[pos+1 : pos+1+end]
+				pos += end + 2
+			}
+			space()
+			if pos >= len(s) || s[pos] != ']' {
+				return nil, fmt.Errorf("expected ] at offset %d", pos)
+			}
+			pos++
+			step.preds = append(step.preds, pred)
+		}
+		steps = append(steps, step)
+	}
+	if steps[0].module == "" {
+		return nil, fmt.Errorf("the first node must be qualified with its module")
+	}
+	return steps, nil
+}
+
+// formatInstanceID returns the instance-identifier of steps, without white
+// space.
+func formatInstanceID(steps []instanceStep) string {
+	var b strings.Builder
+	qualified := func(mod, name string) {
+		if mod != "" {
+			b.WriteString(mod + ":")
+		}
+		b.WriteString(name)
+	}
+	for _, step := range steps {
+		b.WriteByte('/')
+		qualified(step.module, step.name)
+		for _, pred := range step.preds {
+			b.WriteByte('[')
+			if pred.name == "" {
+				b.WriteString(pred.value)
+			} else {
+				qualified(pred.module, pred.name)
+				b.WriteString("=" + quoteLiteral(pred.value))
+			}
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
+
+// instanceIDValue checks that s is a well-formed instance-identifier and
+// returns it without white space. The nodes it names are resolved against
+// the schema by instanceResource.
+func instanceIDValue(e *yang.Entry, t *yang.YangType, s string) (*yang.YangType, string, error) {
+	steps, err := parseInstanceID(s)
+	if err != nil {
+		return t, "", invalidValue("invalid instance-identifier %q for leaf %s: %s", s, e.Name, err.Error())
+	}
+	return t, formatInstanceID(steps), nil
+}
+
+// instanceResource resolves the instance-identifier s to the data node it
+// addresses, which must be a single instance: the keys of every list entry,
+// and the value of a leaf-list entry, are given. Key values are returned in
+// their canonical form.
+func (schema *Schema) instanceResource(s string) (*Resource, error) {
+	steps, err := parseInstanceID(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var segs []PathSegment
+	var r *Resource
+	for _, step := range steps {
+		segs = append(segs, PathSegment{Module: step.module, Name: step.name})
+		if r, err = schema.Resolve(segs); err != nil {
+			return nil, err
+		}
+		e := r.Entry()
+		if isOperation(e) {
+			return nil, fmt.Errorf("%s is an operation, not a data node", e.Name)
+		}
+		if segs[len(segs)-1].Keys, err = schema.instanceKeys(e, step.preds); err != nil {
+			return nil, err
+		}
+	}
+	r.Segments = segs
+	return r, nil
+}
+
+// instanceKeys returns the key values the predicates preds of an instance
+// of e give, nil if e is neither a list nor a leaf-list.
+func (schema *Schema) instanceKeys(e *yang.Entry, preds []instancePred) ([]string, error) {
+	for _, pred := range preds {
+		if pred.name == "" {
+			return nil, fmt.Errorf("positional predicate [%s] of %s is not supported", pred.value, e.Name)
+		}
+	}
+
+	switch {
+	case e.IsLeafList():
+		if len(preds) != 1 || preds[0].name != "." {
+			return nil, fmt.Errorf("leaf-list %s takes a single [.=value] predicate", e.Name)
+		}
+		v, err := leafValue(e, preds[0].value)
+		return []string{v}, err
+	case e.IsList():
+		names := keyNames(e)
+		if len(preds) != len(names) {
+			return nil, fmt.Errorf("list %s has %d keys, %s, got %d predicates", e.Name, len(names), strings.Join(names, ", "), len(preds))
+		}
+		keys := make([]string, len(names))
+		for i, name := range names {
+			var found bool
+			for _, pred := range preds {
+				if pred.name != name {
+					continue
+				}
+				leaf := findDataChild(e, name)
+				if pred.module != "" && pred.module != schema.ModuleOf(leaf) {
+					return nil, fmt.Errorf("key %s of %s is not defined in module %s", name, e.Name, pred.module)
+				}
+				v, err := leafValue(leaf, pred.value)
+				if err != nil {
+					return nil, err
+				}
+				keys[i], found = v, true
+			}
+			if !found {
+				return nil, fmt.Errorf("list %s is missing the predicate of key %s", e.Name, name)
+			}
+		}
+		return keys, nil
+	case len(preds) > 0:
+		return nil, fmt.Errorf("%s is not a list, it takes no predicates", e.Name)
+	}
+	return nil, nil
+}
+
+// instanceString returns the canonical instance-identifier of the data node
+// r addresses: a node is qualified where its module differs from that of
+// its parent (RFC 7951 section 6.11), key names are not.
+func (schema *Schema) instanceString(r *Resource) string {
+	steps := make([]instanceStep, len(r.Entries))
+	var parent string
+	for i, e := range r.Entries {
+		steps[i].name = e.Name
+		if mod := schema.ModuleOf(e); mod != parent {
+			steps[i].module, parent = mod, mod
+		}
+		switch keys := r.Segments[i].Keys; {
+		case keys == nil:
+		case e.IsLeafList():
+			steps[i].preds = []instancePred{{name: ".", value: keys[0]}}
+		default:
+			for j, name := range keyNames(e) {
+				steps[i].preds = append(steps[i].preds, instancePred{name: name, value: keys[j]})
+			}
+		}
+	}
+	return formatInstanceID(steps)
+}
+
+// instanceLeaf checks that the value s of the leaf or leaf-list e, if its
+// type is instance-identifier, addresses a data node of the schema, and
+// returns s in its canonical form.
+func (schema *Schema) instanceLeaf(e *yang.Entry, s string) (string, error) {
+	if leafKind(e) != yang.YinstanceIdentifier {
+		return s, nil
+	}
+	r, err := schema.instanceResource(s)
+	if err != nil {
+		return "", invalidValue("instance-identifier %q of leaf %s addresses no data node: %s", s, e.Name, errorMessage(err))
+	}
+	return schema.instanceString(r), nil
+}
+
+// errorMessage returns the message of err, without the RESTCONF error type
+// and tag.
+func errorMessage(err error) string {
+	if rerr, ok := err.(*RestConfError); ok {
+		return rerr.Message
+	}
+	if perr, ok := err.(*PathError); ok {
+		return perr.Message
+	}
+	return err.Error()
+}
+
+// xmlInstanceID replaces the XML namespace prefixes of the instance-
+// identifier s, the value of the element n, with the names of the modules
+// they stand for. s is returned as is if it is not well-formed.
+func (schema *Schema) xmlInstanceID(n *xmlNode, s string) string {
+	steps, err := parseInstanceID(strings.TrimSpace(s))
+	if err != nil {
+		return s
+	}
+	for i := range steps {
+		steps[i].module = schema.xmlPrefixModule(n, steps[i].module)
+		for j := range steps[i].preds {
+			steps[i].preds[j].module = schema.xmlPrefixModule(n, steps[i].preds[j].module)
+		}
+	}
+	return formatInstanceID(steps)
+}
+
+// requiresInstance reports whether the leaf or leaf-list e is an
+// instance-identifier whose target must exist.
+func requiresInstance(e *yang.Entry) bool {
+	t := leafType(e)
+	return t != nil && t.Kind == yang.YinstanceIdentifier && !t.OptionalInstance
+}
+
+// instanceRequired returns the error of the instance-identifier s at p
+// addressing no data.
+func instanceRequired(s string, p *ErrorPath) error {
+	err := NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_DATA_MISSING,
+		"the instance %s is required but does not exist", s)
+	err.AppTag = ERROR_APP_TAG_INSTANCE_REQUIRED
+	return errorAt(err, p)
+}
+
+// eachRequiredInstance calls f with every value of the instance-identifier
+// leafs requiring their instance in dir, the data tree of an instance of e
+// whose error-path is at, along with the error-path of the leaf.
+func (schema *Schema) eachRequiredInstance(e *yang.Entry, at *ErrorPath, dir map[string]interface{}, f func(p *ErrorPath, s string)) {
+	for name, cv := range dir {
+		child := findDataChild(e, name)
+		switch {
+		case child == nil || child.Kind == yang.AnyDataEntry || child.Kind == yang.AnyXMLEntry:
+		case child.IsLeaf() || child.IsLeafList():
+			if !requiresInstance(child) {
+				continue
+			}
+			values, ok := cv.([]interface{})
+			if !ok {
+				values = []interface{}{cv}
+			}
+			for _, value := range values {
+				s, _ := value.(string)
+				f(schema.errorPath(at, child, nil), s)
+			}
+		case child.IsList():
+			values, _ := cv.([]interface{})
+			for _, value := range values {
+				entry, _ := value.(map[string]interface{})
+				schema.eachRequiredInstance(child, schema.errorPath(at, child, instanceKeys(child, entry)), entry, f)
+			}
+		default:
+			cdir, _ := cv.(map[string]interface{})
+			schema.eachRequiredInstance(child, schema.errorPath(at, child, nil), cdir, f)
+		}
+	}
+}
+
+// checkInstances adds an error to errs for every instance-identifier in
+// dir, the data tree of the top-level nodes of the module mod, requiring an
+// instance of mod that dir does not hold. Instances of other modules are
+// checked by foreignInstances before the edit.
+func (schema *Schema) checkInstances(mod string, dir map[string]interface{}, errs *ErrorList) {
+	schema.eachRequiredInstance(schema.Modules[mod], nil, dir, func(p *ErrorPath, s string) {
+		r, err := schema.instanceResource(s)
+		if err != nil || r.Segments[0].Module != mod {
+			return
+		}
+		if !(&moduleData{dir: dir}).locate(r, false).exists() {
+			errs.add(instanceRequired(s, p))
+		}
+	})
+}
+
+// foreignInstances checks that the instances of other modules than that of
+// r, required by the instance-identifiers in value written at r, exist. It
+// is called before the edit, the module of the target is only locked by
+// DataStore.Edit itself: a check within it would lock the modules in no
+// particular order.
+func (restconf *RestConf) foreignInstances(schema *Schema, r *Resource, value interface{}) error {
+	var errs ErrorList
+	check := func(p *ErrorPath, s string) {
+		target, err := schema.instanceResource(s)
+		if err != nil || target.Segments[0].Module == r.Segments[0].Module {
+			return
+		}
+		if !restconf.store.Exists(target) {
+			errs.add(instanceRequired(s, p))
+		}
+	}
+
+	e, at := r.Entry(), schema.resourcePath(r)
+	switch dir, ok := value.(map[string]interface{}); {
+	case ok && e.IsDir():
+		schema.eachRequiredInstance(e, at, dir, check)
+	case (e.IsLeaf() || e.IsLeafList()) && requiresInstance(e):
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			s, _ := v.(string)
+			check(at, s)
+		}
+	}
+	return errs.err()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var instanceModuleText = `
+module iid {
+  namespace "urn:iid";
+  prefix i;
+
+  container system {
+    list interface {
+      key "name unit";
+      leaf name { type string; }
+      leaf unit { type uint8; }
+      leaf-list address { type string; }
+    }
+    leaf primary { type instance-identifier; }
+    leaf optional {
+      type instance-identifier { require-instance false; }
+    }
+  }
+}
+`
+
+var instanceRefModuleText = `
+module iid-ref {
+  namespace "urn:iid-ref";
+  prefix r;
+
+  leaf target { type instance-identifier; }
+}
+`
+
+func TestParseInstanceID(t *testing.T) {
+	for _, tt := range []struct {
+		s, want string
+	}{
+		{"/iid:system", "/iid:system"},
+		{`/iid:system/interface[ name = "eth'0" ][unit='01']`, `/iid:system/interface[name="eth'0"][unit='01']`},
+		{"/iid:system/interface[1]/address[.='10.0.0.1']", "/iid:system/interface[1]/address[.='10.0.0.1']"},
+		{"/i.x:a.b/c", "/i.x:a.b/c"},
+		{"iid:system", ""},
+		{"/system", ""},
+		{"/iid:system/", ""},
+		{"/iid:system[name='a'", ""},
+		{"/iid:system[name='a]", ""},
+		{"/iid:system[name]", ""},
+		{"/iid:system//interface", ""},
+	} {
+		steps, err := parseInstanceID(tt.s)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("parseInstanceID(%q): got %s, want an error", tt.s, formatInstanceID(steps))
+		case tt.want != "" && err != nil:
+			t.Errorf("parseInstanceID(%q): got error %v", tt.s, err)
+		case tt.want != "" && formatInstanceID(steps) != tt.want:
+			t.Errorf("parseInstanceID(%q): got %s, want %s", tt.s, formatInstanceID(steps), tt.want)
+		}
+	}
+}
+
+func TestInstanceIdentifier(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"iid": instanceModuleText, "iid-ref": instanceRefModuleText}))
+
+	for i, step := range []struct {
+		method, url, ctype, body string
+		status                   int
+		want                     string
+	}{
+		{"PUT", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"interface":[{"name":"eth0","unit":0,"address":["10.0.0.1"]}],` +
+				`"primary":"/iid:system/iid:interface[unit='00'][name='eth0']"}}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data/iid:system/primary", "", "", http.StatusOK,
+			`{"iid:primary":"/iid:system/interface[name='eth0'][unit='0']"}`},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"primary":"/iid:system/interface[name='eth1'][unit='0']"}}`, http.StatusConflict, ERROR_APP_TAG_INSTANCE_REQUIRED},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"primary":"/iid:system/interface[name='eth0'][unit='0']/address[.='10.0.0.1']"}}`, http.StatusNoContent, ""},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"optional":"/iid:system/interface[name='eth1'][unit='0']"}}`, http.StatusNoContent, ""},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"optional":"/iid:system/bogus"}}`, http.StatusBadRequest, ERROR_TAG_INVALID_VALUE},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"optional":"/iid:system/interface[name='eth1']"}}`, http.StatusBadRequest, ERROR_TAG_INVALID_VALUE},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"optional":"/iid:system/interface[name='eth1'][unit='x']"}}`, http.StatusBadRequest, ERROR_TAG_INVALID_VALUE},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_JSON,
+			`{"iid:system":{"optional":"iid:system"}}`, http.StatusBadRequest, ERROR_TAG_INVALID_VALUE},
+		{"PATCH", "/restconf/data/iid:system", APPLICATION_DATA_XML,
+			`<system xmlns="urn:iid"><optional xmlns:x="urn:iid">/x:system/x:interface[x:name='eth3'][x:unit='1']</optional></system>`,
+			http.StatusNoContent, ""},
+		{"GET", "/restconf/data/iid:system/optional", "", "", http.StatusOK,
+			`{"iid:optional":"/iid:system/interface[name='eth3'][unit='1']"}`},
+		{"DELETE", "/restconf/data/iid:system/interface=eth0,0/address=10.0.0.1", "", "", http.StatusConflict, ERROR_APP_TAG_INSTANCE_REQUIRED},
+		{"PUT", "/restconf/data/iid-ref:target", APPLICATION_DATA_JSON,
+			`{"iid-ref:target":"/iid:system/interface[name='eth9'][unit='0']"}`, http.StatusConflict, ERROR_APP_TAG_INSTANCE_REQUIRED},
+		{"PUT", "/restconf/data/iid-ref:target", APPLICATION_DATA_JSON,
+			`{"iid-ref:target":"/iid:system/interface[name='eth0'][unit='0']"}`, http.StatusCreated, ""},
+	} {
+		rsp := doRequest(server, step.method, step.url, step.ctype, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("step %d: %s %s: got status %d, want %d: %s", i, step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && !strings.Contains(rsp.Body.String(), step.want) {
+			t.Errorf("step %d: %s %s: got body %s, want %s", i, step.method, step.url, rsp.Body, step.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   Enumerating the entries of a large list is a vendor extension: a GET of
+   a list with keys-only=true returns every entry reduced to its key leafs,
+   as fields naming the keys would. A list without entries is returned as an
+   empty array, no element in XML, rather than data-missing.
+
+   GET /restconf/data/example:system/interface?keys-only=true
+
+   {
+     "example:interface" : [
+       { "name" : "eth0", "unit" : 0 },
+       { "name" : "eth1", "unit" : 0 }
+     ]
+   }
+
+   keys-only is exclusive with fields and is not supported on the datastore
+   resource. It combines with the paging parameters to enumerate the list
+   page by page.
+*/
+
+var KEYS_ONLY_PARAM = "keys-only"
+
+// keysSelect returns the selection of the key leafs of the entries of the
+// list e.
+func keysSelect(e *yang.Entry) fieldSelect {
+	sel := make(fieldSelect)
+	for _, name := range keyNames(e) {
+		sel[name] = nil
+	}
+	return sel
+}
+
+// keysOnlyTarget checks that the resource r of a keys-only read is a list.
+func keysOnlyTarget(r *Resource) error {
+	if e := r.Entry(); !e.IsList() || r.Segment().Keys != nil {
+		return invalidValue("the %s parameter only applies to a list, %s is not one", KEYS_ONLY_PARAM, e.Name)
+	}
+	return nil
+}
+
+// emptyList reports whether err, the error of the read of the list r by req,
+// only tells that the list has no entries: the user may read it and the
+// data holding it exists.
+func (restconf *RestConf) emptyList(req *http.Request, r *Resource, err error) bool {
+	if rerr, ok := err.(*RestConfError); !ok || rerr.Tag != ERROR_TAG_DATA_MISSING {
+		return false
+	}
+	if !restconf.permit(req, ACCESS_READ, r.Entry()) {
+		return false
+	}
+	parent := r.Parent()
+	return parent == nil || restconf.hasState(r) || restconf.store.Exists(parent)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestKeysOnly(t *testing.T) {
+	server := testServer(t)
+	doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`)
+
+	// The list has no entries yet.
+	rsp := doRequest(server, "GET", "/restconf/data/test:system/interface?keys-only=true", "", "")
+	if want := `{"test:interface":[]}`; rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Errorf("GET of an empty list: got status %d, %s, want %s", rsp.Code, rsp.Body, want)
+	}
+
+	rsp = doRequest(server, "PATCH", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"interface":[{"name":"eth0","unit":0,"mtu":1500,"ipv4":{"address":"10.0.0.1"}},{"name":"eth0","unit":1},{"name":"eth1","unit":0,"mtu":9000}]}}`)
+	if rsp.Code != http.StatusNoContent {
+		t.Fatalf("PATCH: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for _, tt := range []struct {
+		url    string
+		status int
+		want   string
+	}{
+		{"/restconf/data/test:system/interface?keys-only=true", http.StatusOK,
+			`{"test:interface":[{"name":"eth0","unit":0},{"name":"eth0","unit":1},{"name":"eth1","unit":0}]}`},
+		{"/restconf/data/test:system/interface?keys-only=false", http.StatusOK,
+			`{"test:interface":[{"ipv4":{"address":"10.0.0.1"},"mtu":1500,"name":"eth0","unit":0},{"name":"eth0","unit":1},{"mtu":9000,"name":"eth1","unit":0}]}`},
+		{"/restconf/data/test:system/interface?keys-only=true&limit=2&offset=1", http.StatusOK,
+			`{"test:interface":[{"name":"eth0","unit":1},{"name":"eth1","unit":0}]}`},
+		{"/restconf/data/test:system/interface?keys-only=yes", http.StatusBadRequest, ""},
+		{"/restconf/data/test:system/interface?keys-only=true&fields=name", http.StatusBadRequest, ""},
+		{"/restconf/data/test:system/interface=eth0,0?keys-only=true", http.StatusBadRequest, ""},
+		{"/restconf/data/test:system?keys-only=true", http.StatusBadRequest, ""},
+		{"/restconf/data?keys-only=true", http.StatusBadRequest, ""},
+		{"/restconf/data/test:system/interface=eth0,0/ipv4?keys-only=true", http.StatusBadRequest, ""},
+	} {
+		rsp := doRequest(server, "GET", tt.url, "", "")
+		if rsp.Code != tt.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", tt.url, rsp.Code, tt.status, rsp.Body)
+		}
+		if tt.want != "" && rsp.Body.String() != tt.want {
+			t.Errorf("GET %s: got %s, want %s", tt.url, rsp.Body, tt.want)
+		}
+	}
+
+	// The list of a missing container is missing, not empty.
+	doRequest(server, "DELETE", "/restconf/data/test:system", "", "")
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system/interface?keys-only=true", "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET below a missing container: got status %d, want %d: %s", rsp.Code, http.StatusNotFound, rsp.Body)
+	}
+}
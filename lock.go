@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+   The writes of the datastore are serialized: a POST, PUT, PATCH, DELETE,
+   copy or move holds the write lock of the server for its whole transaction,
+   so that the edits of concurrent clients never interleave. Reads do not
+   wait for it. The body of a write is read whole before the lock is taken,
+   within -body-timeout, so that a client sending it slowly only holds up
+   its own write.
+
+   Locking the datastore is a vendor extension for a client making several
+   writes in a row: a POST to the datastore resource with the lock media type
+   takes the lock for at most -lock-timeout, or for timeout seconds if fewer.
+
+   {
+     "go-restconf:lock" : { "timeout" : 60 }
+   }
+
+   {
+     "go-restconf:lock" : { "id" : "...", "owner" : "alice", "timeout" : 60 }
+   }
+
+   While the lock is held, only the writes of its owner carrying its ID in
+   the X-Datastore-Lock header succeed, the others fail with lock-denied.
+   Each of them renews the lock, as does locking again with the ID. A lock
+   neither used nor renewed within its timeout, e.g. one of a client that
+   crashed, is released, otherwise the owner releases it with
+
+   {
+     "go-restconf:unlock" : { "id" : "..." }
+   }
+*/
+
+var (
+	APPLICATION_LOCK_JSON = "application/vnd.go-restconf.lock+json"
+	LOCK_HEADER           = "X-Datastore-Lock"
+)
+
+var (
+	LOCK_TIMEOUT = 5 * time.Minute
+	BODY_TIMEOUT = 30 * time.Second // time a write has to send its body, 0 for no limit
+)
+
+type LockRequest struct {
+	ID      string `json:"id,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+	Timeout int    `json:"timeout,omitempty"` // seconds
+}
+
+type LockRequestJson struct {
+	Lock   *LockRequest `json:"go-restconf:lock,omitempty"`
+	Unlock *LockRequest `json:"go-restconf:unlock,omitempty"`
+}
+
+// datastoreLock serializes the writes of the datastore and holds the lock a
+// client took on it.
+type datastoreLock struct {
+	writeMu sync.Mutex // held by each write for its transaction
+
+	mu      sync.Mutex // guards the lock below
+	id      string     // ID of the lock, "" when the datastore is not locked
+	owner   string
+	timeout time.Duration
+	expires time.Time
+}
+
+// held reports whether a client holds the lock, releasing it once it
+// expired, l.mu held.
+func (l *datastoreLock) held() bool {
+	if l.id != "" && time.Now().After(l.expires) {
+		l.id = ""
+	}
+	return l.id != ""
+}
+
+// denied returns the error of a request of user with lock ID id while
+// another client holds the lock, nil if the lock is free or theirs, l.mu
+// held.
+func (l *datastoreLock) denied(id, user string) *RestConfError {
+	if !l.held() || id == l.id && user == l.owner {
+		return nil
+	}
+	return NewError(http.StatusConflict, ERROR_TYPE_PROTOCOL, ERROR_TAG_LOCK_DENIED,
+		"the datastore is locked by another client")
+}
+
+// write waits for the writes in progress and checks the lock for a write
+// by req. It returns the function ending the write.
+func (l *datastoreLock) write(req *http.Request) (func(), error) {
+	l.writeMu.Lock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.denied(req.Header.Get(LOCK_HEADER), requestUser(req)); err != nil {
+		l.writeMu.Unlock()
+		return nil, err
+	}
+	if l.id != "" {
+		l.expires = time.Now().Add(l.timeout)
+	}
+	return l.writeMu.Unlock, nil
+}
+
+// readBody reads the body of the write req into memory within BODY_TIMEOUT,
+// an XML body being limited to MAX_XML_BODY, before the write waits for the
+// lock.
+func readBody(rsp http.ResponseWriter, req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	// Not every connection supports deadlines, e.g. those of the tests.
+	rc := http.NewResponseController(rsp)
+	deadline := BODY_TIMEOUT > 0 && rc.SetReadDeadline(time.Now().Add(BODY_TIMEOUT)) == nil
+
+	var r io.Reader = req.Body
+	if strings.HasSuffix(mediaType(req.Header.Get("Content-Type")), "+xml") {
+		r = limitXMLBody(r)
+	}
+	body, err := io.ReadAll(r)
+	// Closing the body before the error is answered closes the connection,
+	// rather than waiting for the rest of the body.
+	req.Body.Close()
+	if err == errXMLTooBig {
+		return xmlTooBig()
+	}
+	if err != nil {
+		return NewError(http.StatusRequestTimeout, ERROR_TYPE_TRANSPORT, ERROR_TAG_OPERATION_FAILED,
+			"the request body could not be read: %s", err.Error())
+	}
+	if deadline {
+		rc.SetReadDeadline(time.Time{})
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// lock takes or renews the lock for user, timeout being 0 for LOCK_TIMEOUT.
+func (l *datastoreLock) lock(id, user string, timeout time.Duration) (*LockRequest, error) {
+	// Taking the lock waits for the writes in progress.
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.denied(id, user); err != nil {
+		return nil, err
+	}
+	if id != "" && id != l.id {
+		return nil, invalidValue("lock %q is not held", id)
+	}
+	if timeout <= 0 || timeout > LOCK_TIMEOUT {
+		timeout = LOCK_TIMEOUT
+	}
+	if l.id == "" {
+		l.id, l.owner = newRequestID(), user
+	}
+	l.timeout = timeout
+	l.expires = time.Now().Add(timeout)
+	return &LockRequest{ID: l.id, Owner: l.owner, Timeout: int(timeout / time.Second)}, nil
+}
+
+// unlock releases the lock id of user.
+func (l *datastoreLock) unlock(id, user string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.denied(id, user); err != nil {
+		return err
+	}
+	if id == "" || id != l.id {
+		return invalidValue("lock %q is not held", id)
+	}
+	l.id = ""
+	return nil
+}
+
+// isWrite reports whether req, addressing the data resource r, writes the
+// datastore.
+func isWrite(req *http.Request, r *Resource) bool {
+	switch req.Method {
+	case "PUT", "PATCH", "DELETE":
+		return true
+	case "POST":
+		return !readingPost(req, r) && !(r == nil && mediaType(req.Header.Get("Content-Type")) == APPLICATION_LOCK_JSON)
+	}
+	return false
+}
+
+// lockData handles the lock, or unlock, of the datastore the body requests.
+func (restconf *RestConf) lockData(rsp http.ResponseWriter, req *http.Request) {
+	var doc LockRequestJson
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		writeError(rsp, req, malformed("invalid lock request: %s", err.Error()))
+		return
+	}
+	if (doc.Lock == nil) == (doc.Unlock == nil) {
+		writeError(rsp, req, malformed("expected a single go-restconf:lock or go-restconf:unlock member"))
+		return
+	}
+
+	user := requestUser(req)
+	if doc.Unlock != nil {
+		if err := restconf.lock.unlock(doc.Unlock.ID, user); err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+		logRequest(req, "datastore unlocked by", user)
+		rsp.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if doc.Lock.Timeout < 0 {
+		writeError(rsp, req, invalidValue("invalid lock timeout %d", doc.Lock.Timeout))
+		return
+	}
+	l, err := restconf.lock.lock(doc.Lock.ID, user, time.Duration(doc.Lock.Timeout)*time.Second)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	if doc.Lock.ID == "" {
+		logRequest(req, "datastore locked by", user)
+	}
+
+	body, _ := json.Marshal(LockRequestJson{Lock: l})
+	rsp.Header().Set("Content-Type", APPLICATION_LOCK_JSON)
+	rsp.WriteHeader(http.StatusOK)
+	rsp.Write(body)
+}
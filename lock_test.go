@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func doLock(server http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/restconf/data", strings.NewReader(body))
+	req.Header.Set("Content-Type", APPLICATION_LOCK_JSON)
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	return rsp
+}
+
+func doLocked(server http.Handler, method, url, body, lockID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+	if lockID != "" {
+		req.Header.Set(LOCK_HEADER, lockID)
+	}
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	return rsp
+}
+
+func TestDatastoreLock(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doLock(server, `{"go-restconf:lock":{"timeout":60}}`)
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("lock: got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+	var doc LockRequestJson
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil || doc.Lock == nil || doc.Lock.ID == "" {
+		t.Fatalf("lock: got %s, want a lock with an ID", rsp.Body)
+	}
+	if doc.Lock.Timeout != 60 {
+		t.Errorf("lock: got timeout %d, want 60", doc.Lock.Timeout)
+	}
+	id := doc.Lock.ID
+
+	steps := []struct {
+		method, url, body, lock string
+		status                  int
+	}{
+		{"PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"a"}`, "", http.StatusConflict},
+		{"PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"a"}`, "bogus", http.StatusConflict},
+		{"PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"a"}`, id, http.StatusCreated},
+		{"GET", "/restconf/data/test:system/hostname", "", "", http.StatusOK},
+		{"DELETE", "/restconf/data/test:system/hostname", "", "", http.StatusConflict},
+		{"POST", "/restconf/data/test:system", `{"test:counter":1}`, "", http.StatusConflict},
+	}
+	for _, step := range steps {
+		rsp := doLocked(server, step.method, step.url, step.body, step.lock)
+		if rsp.Code != step.status {
+			t.Errorf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.status == http.StatusConflict && !strings.Contains(rsp.Body.String(), `"lock-denied"`) {
+			t.Errorf("%s %s: got %s, want a lock-denied error", step.method, step.url, rsp.Body)
+		}
+	}
+
+	if rsp := doLock(server, `{"go-restconf:lock":{}}`); rsp.Code != http.StatusConflict {
+		t.Errorf("second lock: got status %d, want %d: %s", rsp.Code, http.StatusConflict, rsp.Body)
+	}
+	if rsp := doLock(server, `{"go-restconf:lock":{"id":"`+id+`"}}`); rsp.Code != http.StatusOK {
+		t.Errorf("renew: got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+	if rsp := doLock(server, `{"go-restconf:unlock":{"id":"`+id+`"}}`); rsp.Code != http.StatusNoContent {
+		t.Fatalf("unlock: got status %d, want %d: %s", rsp.Code, http.StatusNoContent, rsp.Body)
+	}
+	if rsp := doLock(server, `{"go-restconf:unlock":{"id":"`+id+`"}}`); rsp.Code != http.StatusBadRequest {
+		t.Errorf("second unlock: got status %d, want %d: %s", rsp.Code, http.StatusBadRequest, rsp.Body)
+	}
+	if rsp := doLocked(server, "DELETE", "/restconf/data/test:system/hostname", "", ""); rsp.Code != http.StatusNoContent {
+		t.Errorf("DELETE after unlock: got status %d, want %d: %s", rsp.Code, http.StatusNoContent, rsp.Body)
+	}
+
+	for _, body := range []string{`{}`, `{"go-restconf:lock":{},"go-restconf:unlock":{}}`, `{"go-restconf:lock":{"timeout":-1}}`} {
+		if rsp := doLock(server, body); rsp.Code != http.StatusBadRequest {
+			t.Errorf("lock %s: got status %d, want %d: %s", body, rsp.Code, http.StatusBadRequest, rsp.Body)
+		}
+	}
+}
+
+func TestDatastoreLockTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { LOCK_TIMEOUT = timeout }(LOCK_TIMEOUT)
+	LOCK_TIMEOUT = 50 * time.Millisecond
+	server := testServer(t)
+
+	// A timeout longer than -lock-timeout is cut to it.
+	rsp := doLock(server, `{"go-restconf:lock":{"timeout":3600}}`)
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("lock: got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+	if rsp := doLocked(server, "PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"a"}`, ""); rsp.Code != http.StatusConflict {
+		t.Fatalf("PUT while locked: got status %d, want %d: %s", rsp.Code, http.StatusConflict, rsp.Body)
+	}
+
+	time.Sleep(2 * LOCK_TIMEOUT)
+	if rsp := doLocked(server, "PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"a"}`, ""); rsp.Code != http.StatusCreated {
+		t.Errorf("PUT after the lock expired: got status %d, want %d: %s", rsp.Code, http.StatusCreated, rsp.Body)
+	}
+}
+
+func TestDatastoreLockOwner(t *testing.T) {
+	var l datastoreLock
+	held, err := l.lock("", "alice", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.unlock(held.ID, "bob"); err == nil {
+		t.Error("bob released the lock of alice")
+	}
+	if _, err := l.lock(held.ID, "bob", time.Minute); err == nil {
+		t.Error("bob renewed the lock of alice")
+	}
+	if err := l.unlock(held.ID, "alice"); err != nil {
+		t.Errorf("alice failed to release the lock: %v", err)
+	}
+}
+
+func TestWritesSerialized(t *testing.T) {
+	var l datastoreLock
+	req := httptest.NewRequest("PUT", "/restconf/data/test:system", nil)
+
+	done, err := l.write(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	go func() {
+		next, err := l.write(req)
+		if err == nil {
+			next()
+		}
+		close(started)
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("a write started while another was in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+	done()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("a write did not start once the previous one ended")
+	}
+}
+
+func TestSlowBody(t *testing.T) {
+	defer func(timeout time.Duration) { BODY_TIMEOUT = timeout }(BODY_TIMEOUT)
+	BODY_TIMEOUT = 200 * time.Millisecond
+	ts := httptest.NewServer(testServer(t))
+	defer ts.Close()
+
+	// A write whose body never comes does not hold up the others.
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("PUT /restconf/data/test:system/hostname HTTP/1.1\r\nHost: test\r\n" +
+		"Content-Type: application/yang-data+json\r\nContent-Length: 100\r\n\r\n{\"test:hostname\""))
+	time.Sleep(20 * time.Millisecond)
+
+	req, _ := http.NewRequest("PUT", ts.URL+"/restconf/data/test:system/hostname", strings.NewReader(`{"test:hostname":"a"}`))
+	req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+	start := time.Now()
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusCreated || time.Since(start) >= BODY_TIMEOUT {
+		t.Errorf("PUT: got status %d after %s, want %d at once", rsp.StatusCode, time.Since(start), http.StatusCreated)
+	}
+
+	// The stalled write fails once its time is up.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	slow, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow.Body.Close()
+	if slow.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("stalled PUT: got status %d, want %d", slow.StatusCode, http.StatusRequestTimeout)
+	}
+}
@@ -1,24 +1,52 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
 	"encoding/xml"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"sort"
 	"strings"
-	"time"
+	"sync"
+	"syscall"
 
 	"github.com/lixiangyun/go-restconf/yang"
 )
 
 var (
-	addr    string
-	verbose bool
-	help    bool
+	addr        string
+	nacmfile    string
+	format      string
+	userfile    string
+	hashpass    bool
+	mountfile   string
+	revfile     string
+	exposed     string
+	hidden      string
+	muted       string
+	pprofaddr   string
+	proxyproto  bool
+	tlscert     string
+	tlskey      string
+	plainaddr   string
+	plainmode   string
+	name        string
+	auditlog    string
+	datafile    string
+	dataform    string
+	exportto    string
+	exporturl   string
+	exportds    string
+	exportform  string
+	auditStrict bool
+	verbose     bool
+	help        bool
 )
 
 /*
@@ -41,7 +69,7 @@ var (
 type YangLibVer struct {
 	XMLName xml.Name `json:"-" xml:"yang-library-version"`
 	XmlLns  string   `json:"-" xml:"xmlns,attr"`
-	Version string   `json:"yang-library-version" xml:",innerxml"`
+	Version string   `json:"yang-library-version" xml:",chardata"`
 }
 
 type RestConfRoot struct {
@@ -64,7 +92,8 @@ var (
 
 	RESTCONF_PREFIX      = "/restconf"
 	PUBLIC_XMLNS         = "urn:ietf:params:xml:ns:yang:ietf-restconf"
-	YANG_LIBRARY_VERSION = "2016-06-21"
+	YANG_LIBRARY_MODULE  = "ietf-yang-library"
+	YANG_LIBRARY_VERSION = "2016-06-21" // reported when ietf-yang-library is not loaded
 	DEFAULT_LISTEN_ADDR  = ":408"
 )
 
@@ -73,156 +102,376 @@ func init() {
 	flag.BoolVar(&help, "h", false, "show help")
 	flag.BoolVar(&verbose, "v", false, "show version")
 	flag.StringVar(&addr, "addr", DEFAULT_LISTEN_ADDR, "restconf listen address")
+	flag.StringVar(&name, "server-name", DEFAULT_SERVER_NAME, "product name sent in the Server header")
+	flag.StringVar(&format, "default-format", "json", "response format (json or xml) when Accept names no supported type")
+	flag.StringVar(&nacmfile, "nacm", "", "access control rules (ietf-netconf-acm:nacm JSON)")
+	flag.StringVar(&auditlog, "audit", "", "audit log file, JSON lines of every datastore edit")
+	flag.BoolVar(&auditStrict, "audit-strict", false, "fail edits that cannot be written to the audit log")
+	flag.StringVar(&datafile, "validate", "", "validate a data file against the models and exit")
+	flag.StringVar(&dataform, "validate-format", "", "format (json or xml) of the data file, by default detected by its extension")
+	flag.StringVar(&exportto, "export", "", "export the datastore of a running server to a data file and exit")
+	flag.StringVar(&exporturl, "export-url", "http://127.0.0.1"+DEFAULT_LISTEN_ADDR, "url of the server to export, user:password@ for basic authentication")
+	flag.StringVar(&exportds, "export-datastore", "running", "datastore to export, running (config only) or operational")
+	flag.StringVar(&exportform, "export-format", "", "format (json or xml) of the export file, by default detected by its extension")
+	flag.BoolVar(&READ_ONLY, "readonly", READ_ONLY, "refuse every write of the datastore, and the rpcs and actions not marked side-effect free")
+	flag.StringVar(&DATA_DATASTORE, "data-datastore", DATA_DATASTORE, "NMDA datastore /restconf/data aliases, running or operational, by default config and state data")
+	flag.BoolVar(&STRICT_VALIDATION, "strict", STRICT_VALIDATION, "reject unknown members of request bodies, -strict=false ignores them with a warning")
+	flag.BoolVar(&CHECK_RESPONSES, "check-responses", CHECK_RESPONSES, "check the data of responses against the models before sending them")
+	flag.DurationVar(&RPC_TIMEOUT, "rpc-timeout", RPC_TIMEOUT, "time an rpc or action handler may run before the operation fails, 0 for no limit")
+	flag.DurationVar(&LOCK_TIMEOUT, "lock-timeout", LOCK_TIMEOUT, "longest time a datastore lock is held without being used or renewed")
+	flag.DurationVar(&BODY_TIMEOUT, "body-timeout", BODY_TIMEOUT, "time a write has to send its body, which is read before the write waits for the others, 0 for no limit")
+	flag.DurationVar(&HEADER_TIMEOUT, "header-timeout", HEADER_TIMEOUT, "time a client has to send the headers of a request, 0 for no limit")
+	flag.DurationVar(&PAGE_CURSOR_TTL, "cursor-ttl", PAGE_CURSOR_TTL, "time the snapshot of a paged read with a cursor is kept after its last page is read")
+	flag.IntVar(&MAX_CURSORS, "max-cursors", MAX_CURSORS, "most snapshots of paged reads with a cursor kept at a time, 0 for no limit")
+	flag.IntVar(&MAX_USER_CURSORS, "max-user-cursors", MAX_USER_CURSORS, "most snapshots of paged reads with a cursor kept for a user at a time, 0 for no limit")
+	flag.DurationVar(&SUBSCRIPTION_TIMEOUT, "subscription-timeout", SUBSCRIPTION_TIMEOUT, "time a dynamic subscription waits for its stream to be opened before it is deleted, 0 for no limit")
+	flag.DurationVar(&MIN_SUBSCRIPTION_PERIOD, "min-subscription-period", MIN_SUBSCRIPTION_PERIOD, "shortest period of a periodic dynamic subscription")
+	flag.IntVar(&MAX_SUBSCRIPTIONS, "max-subscriptions", MAX_SUBSCRIPTIONS, "most dynamic subscriptions kept at a time, 0 for no limit")
+	flag.IntVar(&MAX_USER_SUBSCRIPTIONS, "max-user-subscriptions", MAX_USER_SUBSCRIPTIONS, "most dynamic subscriptions kept for a user at a time, 0 for no limit")
+	flag.DurationVar(&STATE_CACHE_TTL, "state-cache-ttl", STATE_CACHE_TTL, "time the state data of a provider is reused by the following reads, 0 for no caching")
+	flag.DurationVar(&SHUTDOWN_TIMEOUT, "shutdown-timeout", SHUTDOWN_TIMEOUT, "longest time the shutdown waits for the requests in progress")
+	flag.DurationVar(&STREAM_DRAIN, "stream-drain", STREAM_DRAIN, "longest time the shutdown waits for the event streams to close after their final event")
+	flag.IntVar(&STARTUP_RETRY_AFTER, "startup-retry-after", STARTUP_RETRY_AFTER, "seconds of the Retry-After of the 503 answering the requests while the models are processed")
+	flag.IntVar(&MAX_LIST_ENTRIES, "max-list-entries", MAX_LIST_ENTRIES, "most entries of a list a GET returns without paging, 0 for no limit")
+	flag.Int64Var(&MAX_XML_BODY, "max-xml-body", MAX_XML_BODY, "largest XML request body parsed, larger ones are refused with 413, 0 for no limit")
+	flag.IntVar(&MAX_URI_LEN, "max-uri-len", MAX_URI_LEN, "longest request URI served, longer ones are refused with 414, 0 for no limit")
+	flag.BoolVar(&STRICT_MODELS, "strict-models", STRICT_MODELS, "fail the load of modules sharing a namespace, or of two revisions of a module, rather than warn")
+	flag.IntVar(&MAX_SCHEMA_DEPTH, "max-depth", MAX_SCHEMA_DEPTH, "maximum levels of data nodes served below a module")
+	flag.StringVar(&mountfile, "mounts", "", "mounts file of module:label inline|shared-schema module... lines mounting schemas (RFC 8528)")
+	flag.StringVar(&revfile, "revisions", "", "revisions file of module... lines, each serving an alternate schema of older module revisions")
+	flag.StringVar(&exposed, "expose", "", "comma separated modules exposed to the clients, all but the hidden ones by default")
+	flag.StringVar(&hidden, "hide", "", "comma separated modules hidden from the clients")
+	flag.StringVar(&muted, "mute", "", "comma separated modules, or module:notification, whose notifications are not published")
+	flag.StringVar(&tlscert, "tls-cert", "", "certificate file (PEM) serving HTTPS on the listen address, with -tls-key")
+	flag.StringVar(&tlskey, "tls-key", "", "private key file (PEM) of the -tls-cert certificate")
+	flag.StringVar(&plainaddr, "http", "", "plaintext listen address besides the HTTPS one, only with -tls-cert")
+	flag.StringVar(&plainmode, "http-mode", PLAINTEXT_REDIRECT, "plaintext requests are redirected to HTTPS (redirect), refused (reject) or served (none)")
+	flag.BoolVar(&HTTP2_ENABLED, "http2", HTTP2_ENABLED, "speak HTTP/2 on the HTTPS listener, -http2=false for HTTP/1.1 only")
+	flag.BoolVar(&H2C_ENABLED, "h2c", H2C_ENABLED, "speak HTTP/2 with prior knowledge (h2c) on the plaintext listeners, only behind a trusted proxy")
+	flag.IntVar(&HTTP2_MAX_STREAMS, "http2-max-streams", HTTP2_MAX_STREAMS, "concurrent HTTP/2 streams of a connection, event streams among them, 0 for the default")
+	flag.IntVar(&HTTP2_MAX_FRAME_SIZE, "http2-max-frame-size", HTTP2_MAX_FRAME_SIZE, "largest HTTP/2 frame read, 16384 to 16777216 bytes, 0 for the default")
+	flag.DurationVar(&HTTP2_PING_TIMEOUT, "http2-ping", HTTP2_PING_TIMEOUT, "idle time of an HTTP/2 connection before it is checked with a ping, 0 for none")
+	flag.BoolVar(&proxyproto, "proxy-protocol", false, "read a PROXY protocol (v1 or v2) header naming the client address on every connection, only behind a trusted load balancer")
+	flag.StringVar(&pprofaddr, "pprof", "", "loopback listen address serving the runtime profiles under /debug/pprof, off by default")
+	for _, p := range QUERY_PARAMS {
+		flag.BoolVar(&p.Enabled, "query-"+p.Name, p.Enabled, "serve the optional "+p.Name+" query parameter, -query-"+p.Name+"=false refuses it")
+	}
+	flag.StringVar(&userfile, "users", "", "users file of name:password-hash lines for basic authentication, see -hash-password")
+	flag.IntVar(&MAX_PASSWORD_CHECKS, "max-password-checks", MAX_PASSWORD_CHECKS, "passwords checked against their hash at once, the other logins wait for them")
+	flag.BoolVar(&hashpass, "hash-password", false, "print the users file hash of the password read from the standard input")
 
 	flag.Usage = usage
 }
 
 func usage() {
 
-	fmt.Fprintf(os.Stderr, ` Version: restconf/0.1.0
- Usage: resfconf [-hv] [-addr ip:port]
+	fmt.Fprintf(os.Stderr, ` Version: restconf/%s
+ Usage: resfconf -validate file [-validate-format json|xml]
+        resfconf -hash-password < password
+        resfconf -export file [-export-url url] [-export-datastore running|operational] [-export-format json|xml]
+        resfconf [-hv] [-readonly] [-data-datastore running|operational] [-strict=false] [-check-responses] [-strict-models] [-rpc-timeout duration] [-cursor-ttl duration] [-max-cursors n] [-max-user-cursors n] [-subscription-timeout duration] [-min-subscription-period duration] [-max-subscriptions n] [-max-user-subscriptions n] [-lock-timeout duration] [-body-timeout duration] [-header-timeout duration] [-max-uri-len bytes] [-max-xml-body bytes] [-max-list-entries n] [-startup-retry-after seconds] [-shutdown-timeout duration] [-stream-drain duration] [-state-cache-ttl duration] [-mounts file] [-revisions file] [-expose|-hide module,...] [-mute module[:notification],...] [-pprof 127.0.0.1:port] [-proxy-protocol] [-tls-cert file -tls-key file [-http ip:port [-http-mode redirect|reject|none]]] [-http2=false] [-h2c] [-http2-max-streams n] [-http2-max-frame-size bytes] [-http2-ping duration] [-query-depth|-query-fields|-query-with-defaults=false] [-addr ip:port] [-server-name name] [-default-format json|xml] [-nacm file] [-users file [-max-password-checks n]] [-audit file [-audit-strict]]
 
  Options:
-`)
+`, VERSION)
 
 	flag.PrintDefaults()
 }
 
 type RestConf struct {
-	mux map[string]http.HandlerFunc
+	muxMu    sync.RWMutex
+	mux      map[string]http.HandlerFunc // handlers of the top-level resources, see Register
+	prefixes []string                    // urls of mux, longest first, see handler
+	routes   []*route                    // resources with path parameters, in registration order
+
+	schemaMu  sync.RWMutex
+	schema    *Schema
+	revisions []*Schema      // alternate schemas of older module revisions, see SetRevisions
+	discovery discoveryCache // responses of the discovery resources, rebuilt with the schema
+	store     *DataStore
+
+	operationsMu sync.RWMutex
+	operations   map[string]*operation // handlers of the rpcs and actions by schemaKey
+
+	statesMu   sync.RWMutex
+	states     map[string]*stateProvider // providers of state data by schemaKey
+	stateCache stateCache                // state data of the providers, see RegStateTTL
+
+	defaultFormat string // media type sent when Accept names no supported type
+	serverName    string // product name of the Server header
+
+	nacm   *NACM             // access control rules, nil permits everything
+	users  map[string]string // basic authentication users, nil for anonymous access
+	logins logins            // passwords checked against the hashes of users
+
+	audit       AuditSink // records the datastore edits, nil for none
+	auditStrict bool      // fail edits the audit sink cannot record
+
+	bus           *NotificationBus // passes the changes of the datastore on
+	subscriptions *Subscriptions   // dynamic subscriptions to datastore updates
+
+	streamsMu sync.Mutex
+	streams   map[string]*EventStream // event streams by name
+	muted     map[string]bool         // keys of the muted notification types
+
+	cursors cursors       // snapshots of the paged reads with a cursor
+	lock    datastoreLock // serializes the writes, see lockData
+	clock   Clock         // time of the headers, records and events, see SetClock
+	stats   serverStats   // counters of the server state
+	drain   streamDrain   // open streams, drained on shutdown
 }
 
-func NewRestConf() *RestConf {
+func NewRestConf(schema *Schema) *RestConf {
 	server := new(RestConf)
 
 	server.mux = make(map[string]http.HandlerFunc)
+	server.drain.draining = make(chan struct{})
+	server.clock = systemClock{}
+	server.stats.started = server.now()
+	// A server created without a schema only serves the resources that do
+	// not need one until it is set, see Ready.
+	if schema != nil {
+		server.SetSchema(schema)
+	} else {
+		server.discovery, _ = newDiscoveryCache(nil, server.now())
+	}
+	server.store = NewDataStore()
+	server.operations = make(map[string]*operation)
+	server.states = make(map[string]*stateProvider)
+	server.defaultFormat = APPLICATION_DATA_JSON
+	server.serverName = DEFAULT_SERVER_NAME
+	server.bus = NewNotificationBus()
+	server.subscriptions = NewSubscriptions()
+	server.streams = make(map[string]*EventStream)
+	server.muted = make(map[string]bool)
+	server.RegStream(NETCONF_STREAM, "default NETCONF event stream")
+	server.regServerState()
+
+	// The built-in resources are distinct, registering them cannot fail.
+	server.register("/.well-known/host-meta", server.HostMeta, false)
+
+	server.register(RESTCONF_PREFIX, server.Root, false)
+	server.register(RESTCONF_PREFIX+"/data", server.Data, false)
+	server.register(RESTCONF_PREFIX+"/operations", server.Operations, false)
+	server.register(RESTCONF_PREFIX+"/yang-library-version", server.YangLibVer, false)
+	server.register(YANG_MODULE_PREFIX, server.YangModule, false)
+	server.register(RESTCONF_PREFIX+"/version", server.Version, false)
+	server.register(SCHEMA_EXPORT_PREFIX, server.SchemaExport, false)
+	server.register(OPENAPI_PREFIX, server.OpenAPI, false)
+	server.regSubscriptions()
+	server.register(STREAMS_PREFIX, server.StreamEvents, false)
 
-	server.Reg("/.well-known/host-meta", server.HostMeta)
+	return server
+}
 
-	server.Reg(RESTCONF_PREFIX, server.Root)
-	server.Reg(RESTCONF_PREFIX+"/data", server.Data)
-	server.Reg(RESTCONF_PREFIX+"/operations", server.Operations)
-	server.Reg(RESTCONF_PREFIX+"/yang-library-version", server.YangLibVer)
+// Schema returns the schema the server currently serves.
+func (restconf *RestConf) Schema() *Schema {
+	restconf.schemaMu.RLock()
+	defer restconf.schemaMu.RUnlock()
+	return restconf.schema
+}
 
-	return server
+// SetSchema replaces the served schema, e.g. after the modules were reloaded.
+// A schema must not change once it is served: requests, streams and
+// subscriptions keep the schema they started with until they end, as a
+// snapshot, so that a reload neither waits for nor races with them.
+func (restconf *RestConf) SetSchema(schema *Schema) {
+	discovery, err := newDiscoveryCache(schema, restconf.now())
+	if err != nil {
+		log.Println("marshal discovery responses failed!", err.Error())
+	}
+
+	restconf.schemaMu.Lock()
+	restconf.schema = schema
+	restconf.discovery = discovery
+	restconf.schemaMu.Unlock()
+
+	restconf.stateCache.clear()
 }
 
+// Reg registers the handler of the top-level resource url, logging the
+// error if it cannot be registered.
+//
+// Deprecated: use Register, which returns the error.
 func (restconf *RestConf) Reg(url string, handler http.HandlerFunc) {
-	_, b := restconf.mux[url]
-	if b == false {
-		restconf.mux[url] = func(rsp http.ResponseWriter, req *http.Request) {
-			rsp.Header().Set("Server", "RESTCONF")
-			rsp.Header().Set("Date", time.Now().Format(time.RFC1123))
-			handler(rsp, req)
-		}
-	} else {
-		log.Fatal("this handler " + url + " exist!")
+	if err := restconf.Register(url, handler); err != nil {
+		log.Println("register handler failed!", err.Error())
 	}
 }
 
-func (restconf *RestConf) HostMeta(rsp http.ResponseWriter, req *http.Request) {
+// Register registers the handler of the top-level resource url, e.g.
+// "/restconf/example", which also serves the resources below url no other
+// registration takes. The segments of url may be path parameters, e.g.
+// "/restconf/example/{id}", see PathParam. The handler is run after the
+// request was authenticated. It is an error if url is already registered.
+func (restconf *RestConf) Register(url string, handler http.HandlerFunc) error {
+	return restconf.register(url, handler, false)
+}
 
-	if req.Method != "GET" {
-		http.Error(rsp, "method is not GET!", http.StatusBadRequest)
-		return
+// Override registers the handler of the top-level resource url like
+// Register, replacing the handler url is registered with, if any, the
+// built-in resources included.
+func (restconf *RestConf) Override(url string, handler http.HandlerFunc) error {
+	return restconf.register(url, handler, true)
+}
+
+func (restconf *RestConf) register(url string, handler http.HandlerFunc, override bool) error {
+	if url == "" || url != cleanPath(url) || url != "/" && strings.HasSuffix(url, "/") {
+		return fmt.Errorf("invalid resource path %q", url)
+	}
+	if handler == nil {
+		return fmt.Errorf("no handler for %s", url)
 	}
 
-	if req.Header.Get("Accept") != APPLICATION_XRD_XML {
-		http.Error(rsp, "Accept is incorrect!", http.StatusBadRequest)
-		return
+	restconf.muxMu.Lock()
+	defer restconf.muxMu.Unlock()
+
+	if isPattern(url) {
+		return restconf.registerRoute(url, restconf.serve(handler), override)
+	}
+	_, ok := restconf.mux[url]
+	if ok && !override {
+		return fmt.Errorf("handler %s is already registered", url)
 	}
+	if !ok {
+		restconf.addPrefix(url)
+	}
+	restconf.mux[url] = restconf.serve(handler)
+	return nil
+}
 
-	body := `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
-		<Link rel='restconf' href='` + RESTCONF_PREFIX + `'/>
-	</XRD>`
+// addPrefix adds url to the prefixes, kept ordered by decreasing length and
+// then by name, so that the prefix a path falls back to never depends on the
+// order of the registrations or of the map.
+func (restconf *RestConf) addPrefix(url string) {
+	i := sort.Search(len(restconf.prefixes), func(i int) bool {
+		p := restconf.prefixes[i]
+		return len(p) < len(url) || len(p) == len(url) && p > url
+	})
+	restconf.prefixes = append(restconf.prefixes, "")
+	copy(restconf.prefixes[i+1:], restconf.prefixes[i:])
+	restconf.prefixes[i] = url
+}
 
-	rsp.Header().Set("Content-Type", APPLICATION_XRD_XML)
-	rsp.WriteHeader(http.StatusOK)
+// serve returns handler run for the requests the server authenticated, with
+// the headers of every response set.
+func (restconf *RestConf) serve(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.Header().Set("Server", restconf.serverHeader())
+		rsp.Header().Set("Date", restconf.now().UTC().Format(http.TimeFormat))
+
+		id := requestID(req)
+		rsp.Header().Set(REQUEST_ID_HEADER, id)
+		req = withRequestID(req, id)
+
+		user, ok := restconf.authenticate(req)
+		if !ok {
+			rsp.Header().Set("WWW-Authenticate", `Basic realm="restconf"`)
+			writeError(rsp, req, NewError(http.StatusUnauthorized, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_ACCESS_DENIED, "authentication required"))
+			return
+		}
 
-	fmt.Fprint(rsp, body)
+		selected, err := restconf.withRevisions(withChanges(withUser(req, user)))
+		if err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+		handler(rsp, selected)
+		restconf.publishChanges(selected)
+	}
 }
 
-func (restconf *RestConf) Root(rsp http.ResponseWriter, req *http.Request) {
+func (restconf *RestConf) HostMeta(rsp http.ResponseWriter, req *http.Request) {
 
-	var body []byte
-	var err error
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+	addVary(rsp, "Accept")
 
-	format := req.Header.Get("Accept")
+	// A browser following a link sends a list of types or a wildcard,
+	// no Accept at all accepts any type.
+	if acceptQuality(req, APPLICATION_XRD_XML) == 0 {
+		writeError(rsp, req, NewError(http.StatusNotAcceptable, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "host-meta is only sent as %s", APPLICATION_XRD_XML))
+		return
+	}
 
-	root := RestConfRoot{
-		XmlLns: PUBLIC_XMLNS,
-		Yang:   YANG_LIBRARY_VERSION}
+	restconf.serveCached(rsp, req, "/.well-known/host-meta", APPLICATION_XRD_XML)
+}
 
-	switch format {
-	case APPLICATION_DATA_XML:
-		{
-			body, err = xml.Marshal(root)
-		}
-	case APPLICATION_DATA_JSON:
-		{
-			rootjson := RestConfJson{Root: root}
-			body, err = json.Marshal(rootjson)
-		}
-	default:
-		{
-			http.Error(rsp, "Accept is incorrect!", http.StatusBadRequest)
-			return
-		}
+func (restconf *RestConf) Root(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
 	}
 
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
 	if err != nil {
-		http.Error(rsp, "Marshal failed!"+err.Error(), http.StatusExpectationFailed)
+		writeError(rsp, req, err)
 		return
 	}
 
-	rsp.Header().Set("Content-Type", format)
-	rsp.WriteHeader(http.StatusOK)
-
-	fmt.Fprint(rsp, string(body))
+	restconf.serveCached(rsp, req, RESTCONF_PREFIX, format)
 }
 
-func (restconf *RestConf) Data(rsp http.ResponseWriter, req *http.Request) {
-
+// resource resolves the path of req below the resource prefix against the
+// schema. It returns nil if the request addresses the resource itself.
+func (restconf *RestConf) resource(req *http.Request, prefix string) (*Resource, error) {
+	segs, err := ParsePath(strings.TrimPrefix(req.URL.EscapedPath(), prefix))
+	if err != nil || len(segs) == 0 {
+		return nil, err
+	}
+	return restconf.schemaOf(req).Resolve(segs)
 }
 
 func (restconf *RestConf) Operations(rsp http.ResponseWriter, req *http.Request) {
 
-}
+	segs, err := ParsePath(strings.TrimPrefix(req.URL.EscapedPath(), RESTCONF_PREFIX+"/operations"))
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
 
-func (restconf *RestConf) YangLibVer(rsp http.ResponseWriter, req *http.Request) {
+	if len(segs) == 0 {
+		if !allowMethods(rsp, req, "GET", "HEAD") {
+			return
+		}
+		restconf.listOperations(rsp, req)
+		return
+	}
 
-	var body []byte
-	var err error
+	var e *yang.Entry
+	if schema := restconf.schemaOf(req); len(segs) == 1 && segs[0].Keys == nil && schema.exposed(segs[0].Module) {
+		e = schema.Lookup("/" + segs[0].Module + "/" + segs[0].Name)
+	}
+	if e == nil || !isOperation(e) {
+		names := make([]string, len(segs))
+		for i, seg := range segs {
+			names[i] = seg.String()
+		}
+		writeError(rsp, req, NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "unknown operation %q", strings.Join(names, "/")))
+		return
+	}
 
-	yanglibver := YangLibVer{Version: YANG_LIBRARY_VERSION, XmlLns: PUBLIC_XMLNS}
+	if !allowMethods(rsp, req, restconf.operationMethods(e)...) {
+		return
+	}
 
-	format := req.Header.Get("Accept")
+	restconf.invoke(rsp, req, &Resource{Segments: segs, Entries: []*yang.Entry{e}})
+}
 
-	switch format {
-	case APPLICATION_DATA_XML:
-		{
-			body, err = xml.Marshal(yanglibver)
-		}
-	case APPLICATION_DATA_JSON:
-		{
-			body, err = json.Marshal(yanglibver)
-		}
-	default:
-		{
-			http.Error(rsp, "Accept is incorrect!", http.StatusBadRequest)
-			return
-		}
+func (restconf *RestConf) YangLibVer(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
 	}
 
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
 	if err != nil {
-		http.Error(rsp, "Marshal failed!"+err.Error(), http.StatusExpectationFailed)
+		writeError(rsp, req, err)
 		return
 	}
 
-	rsp.Header().Set("Content-Type", format)
-	rsp.WriteHeader(http.StatusOK)
-
-	fmt.Fprint(rsp, string(body))
+	restconf.serveCached(rsp, req, RESTCONF_PREFIX+"/yang-library-version", format)
 }
 
 func cleanPath(p string) string {
@@ -240,21 +489,72 @@ func cleanPath(p string) string {
 }
 
 func (restconf *RestConf) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
-	path := cleanPath(req.URL.Path)
-
-	fun, b := restconf.mux[path]
-	if b == true {
+	restconf.countRequest()
+	if err := uriTooLong(req); err != nil {
+		writeError(rsp, withSchema(req, restconf.Schema()), err)
+		return
+	}
+	req = withSchema(withFormatSuffix(req), restconf.Schema())
+	switch path := cleanPath(req.URL.Path); {
+	case path == HEALTHZ_PATH:
+		restconf.Healthz(rsp, req)
+		return
+	case !restconf.Ready() && !servedEarly(path):
+		notReady(rsp, req)
+		return
+	}
+	if fun, params := restconf.handler(req); fun != nil {
+		if params != nil {
+			req = withPathParams(req, params)
+		}
 		fun(rsp, req)
 		return
 	}
-	for url, fun := range restconf.mux {
-		if strings.HasPrefix(path, url) {
-			fun(rsp, req)
-			return
+	if cleanPath(req.URL.Path) == "/" {
+		restconf.serve(restconf.Index)(rsp, req)
+		return
+	}
+
+	NotFound(rsp, req)
+}
+
+// handler returns the handler of the resource serving req, and the path
+// parameters of req if it is one with parameters, nil if there is none.
+func (restconf *RestConf) handler(req *http.Request) (http.HandlerFunc, map[string]string) {
+	path := cleanPath(req.URL.Path)
+
+	restconf.muxMu.RLock()
+	defer restconf.muxMu.RUnlock()
+
+	// An exact match always wins, e.g. /.well-known/host-meta is HostMeta
+	// whatever else is registered.
+	if fun, ok := restconf.mux[path]; ok {
+		return fun, nil
+	}
+	// Fall back to the longest registered prefix, so that /restconf/data/...
+	// is not taken by /restconf.
+	var match string
+	for _, url := range restconf.prefixes {
+		if strings.HasPrefix(path, strings.TrimSuffix(url, "/")+"/") {
+			match = url
+			break
 		}
 	}
 
-	http.NotFound(rsp, req)
+	// A parametric resource takes precedence over the prefix if it starts
+	// with more literal segments.
+	n := -1
+	switch match {
+	case "":
+	case "/":
+		n = 0
+	default:
+		n = strings.Count(match, "/")
+	}
+	if r, params := restconf.matchRoute(cleanPath(req.URL.EscapedPath()), n); r != nil {
+		return r.handler, params
+	}
+	return restconf.mux[match], nil
 }
 
 func YangModulesLoad(ms *yang.Modules, modules ...string) error {
@@ -268,6 +568,22 @@ func YangModulesLoad(ms *yang.Modules, modules ...string) error {
 	return nil
 }
 
+// LoadSchema reads the modules from the yang path and processes them.
+func LoadSchema(modules ...string) (*Schema, []error) {
+	ms := yang.NewModules()
+
+	YangModulesLoad(ms, modules...)
+	loadServerState(ms)
+
+	if errs := ms.Process(); len(errs) > 0 {
+		return nil, errs
+	}
+	if errs := modulesChecked(ms); len(errs) > 0 {
+		return nil, errs
+	}
+	return NewSchema(ms), nil
+}
+
 func YangPathSet(paths ...string) {
 	for _, path := range paths {
 		expanded, err := yang.PathsWithModules(path)
@@ -279,6 +595,44 @@ func YangPathSet(paths ...string) {
 	}
 }
 
+// exposeModules hides the modules of the schema, and of its alternate
+// revisions, the -expose and -hide flags hide.
+func exposeModules(schema *Schema, revisions ...*Schema) error {
+	if err := schema.Expose(moduleList(exposed), moduleList(hidden)); err != nil {
+		return err
+	}
+	for _, alt := range revisions {
+		alt.hidden = schema.hidden
+	}
+	return nil
+}
+
+// loadModels loads the schema of the models, with its mounts, and the
+// alternate schemas of older module revisions, exposing the modules given to
+// -expose or -hide.
+func loadModels() (*Schema, []*Schema, []error) {
+	schema, errs := LoadSchema("base")
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	if mountfile != "" {
+		if err := LoadMounts(schema, mountfile); err != nil {
+			return nil, nil, []error{err}
+		}
+	}
+	var revisions []*Schema
+	if revfile != "" {
+		var err error
+		if revisions, err = LoadRevisions(revfile); err != nil {
+			return nil, nil, []error{err}
+		}
+	}
+	if err := exposeModules(schema, revisions...); err != nil {
+		return nil, nil, []error{err}
+	}
+	return schema, revisions, nil
+}
+
 func main() {
 	flag.Parse()
 	if help || verbose {
@@ -286,34 +640,195 @@ func main() {
 		return
 	}
 
+	if hashpass {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			log.Fatalf("no password on the standard input: %s", err)
+		}
+		hash, err := HashPassword(strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		fmt.Println(hash)
+		return
+	}
+
 	YangPathSet("./models")
 
-	ms := yang.NewModules()
+	if datafile != "" || exportto != "" {
+		// Process the read files, exiting if any errors were found.
+		schema, errs := LoadSchema("base")
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Println(err.Error())
+			}
+			os.Exit(1)
+		}
+		if mountfile != "" {
+			if err := LoadMounts(schema, mountfile); err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+
+		if datafile != "" {
+			if err := schema.ValidateFile(datafile, dataform); err != nil {
+				var errs ErrorList
+				errs.add(err)
+				for _, err := range errs {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", datafile, err.Error())
+				}
+				os.Exit(1)
+			}
+			return
+		}
+
+		if err := exposeModules(schema); err != nil {
+			log.Fatal(err.Error())
+		}
+		ctype := dataFileFormat(exportto, exportform)
+		if ctype == "" {
+			log.Fatalf("unknown export format %q", exportform)
+		}
+		f, err := os.Create(exportto)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		err = schema.Export(http.DefaultClient, exporturl, exportds, ctype, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
 
-	YangModulesLoad(ms, "base")
+	// The server listens while the models are processed, answering 503
+	// until they are, see Ready.
+	server := NewRestConf(nil)
 
-	// Process the read files, exiting if any errors were found.
-	errs := ms.Process()
+	server.serverName = name
 
-	if len(errs) > 0 {
-		for _, err := range errs {
-			log.Println(err.Error())
+	if err := server.Mute(moduleList(muted)...); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	server.defaultFormat = formatNames[format]
+	if server.defaultFormat == "" {
+		log.Fatalf("unknown default format %q", format)
+	}
+	if !validDataDatastore(DATA_DATASTORE) {
+		log.Fatalf("unknown datastore %q, -data-datastore is running or operational", DATA_DATASTORE)
+	}
+
+	var err error
+	if nacmfile != "" {
+		server.nacm, err = LoadNACM(nacmfile)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if userfile != "" {
+		server.users, err = LoadUsers(userfile)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	if auditlog != "" {
+		audit, err := OpenAudit(auditlog, auditStrict)
+		if err != nil {
+			log.Fatal(err.Error())
 		}
-		os.Exit(1)
+		defer audit.Close()
+		server.audit = audit
+		server.auditStrict = auditStrict
 	}
 
-	entries := make([]*yang.Entry, len(ms.Modules))
-	x := 0
-	for _, mod := range ms.Modules {
-		log.Println("models: ", mod.NName())
-		entries[x] = yang.ToEntry(mod)
-		x++
+	go func() {
+		// Process the read files, exiting if any errors were found.
+		schema, revisions, errs := loadModels()
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Println(err.Error())
+			}
+			os.Exit(1)
+		}
+		for _, name := range schema.ModuleNames() {
+			log.Println("models: ", name)
+		}
+		server.SetSchema(schema)
+		if err := server.SetRevisions(revisions...); err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Println("models ready")
+
+		// Reload the modules on SIGHUP, keeping the current schema if they
+		// fail to process.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			schema, revisions, errs := loadModels()
+			if len(errs) > 0 {
+				for _, err := range errs {
+					log.Println(err.Error())
+				}
+				log.Println("reload models failed, keep the current schema")
+				continue
+			}
+			server.SetSchema(schema)
+			if err := server.SetRevisions(revisions...); err != nil {
+				log.Println(err.Error())
+				log.Println("alternate revisions are not served")
+				server.SetRevisions()
+			}
+			log.Println("models reloaded")
+		}
+	}()
+
+	if pprofaddr != "" {
+		if err := listenPprof(pprofaddr); err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Println("pprof listen ", pprofaddr)
 	}
 
-	server := NewRestConf()
-	log.Println("restconf start and listen ", addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if proxyproto {
+		ln = ProxyListener(ln)
+	}
 
-	err := http.ListenAndServe(addr, server)
+	if (tlscert == "") != (tlskey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	srv, err := newServer(server, tlscert != "")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	shutdown := shutdownOnSignal(server, srv)
+	if tlscert == "" {
+		if plainaddr != "" {
+			log.Fatal("-http requires -tls-cert and -tls-key")
+		}
+		log.Println("restconf start and listen ", addr)
+		err = srv.Serve(ln)
+	} else {
+		if plainaddr != "" {
+			if err := listenPlaintext(plainaddr, plainmode, addr, server); err != nil {
+				log.Fatal(err.Error())
+			}
+			log.Println("plaintext listen ", plainaddr, plainmode)
+		}
+		log.Println("restconf start and listen ", addr, "tls")
+		err = srv.ServeTLS(ln, tlscert, tlskey)
+	}
+	if err == http.ErrServerClosed {
+		<-shutdown
+		return
+	}
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func BenchmarkMarshalRoot(b *testing.B) {
+	root := RestConfRoot{XmlLns: PUBLIC_XMLNS, Yang: YANG_LIBRARY_VERSION}
+
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(RestConfJson{Root: root}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("xml", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := xml.Marshal(root); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMarshalYangLibVer(b *testing.B) {
+	yanglibver := YangLibVer{Version: YANG_LIBRARY_VERSION, XmlLns: PUBLIC_XMLNS}
+
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(yanglibver); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("xml", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := xml.Marshal(yanglibver); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkHandlers measures whole requests to the discovery resources,
+// routing and headers included.
+func BenchmarkHandlers(b *testing.B) {
+	server := testServer(b)
+
+	for _, bench := range []struct {
+		name   string
+		url    string
+		accept string
+	}{
+		{"root/json", "/restconf", APPLICATION_DATA_JSON},
+		{"root/xml", "/restconf", APPLICATION_DATA_XML},
+		{"yang-library-version/json", "/restconf/yang-library-version", APPLICATION_DATA_JSON},
+		{"yang-library-version/xml", "/restconf/yang-library-version", APPLICATION_DATA_XML},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			req := httptest.NewRequest("GET", bench.url, nil)
+			req.Header.Set("Accept", bench.accept)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rsp := httptest.NewRecorder()
+				server.ServeHTTP(rsp, req)
+				if rsp.Code != http.StatusOK {
+					b.Fatalf("got status %d: %s", rsp.Code, rsp.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	server := testServer(t)
+
+	root, _ := json.Marshal(RestConfJson{Root: RestConfRoot{XmlLns: PUBLIC_XMLNS, Yang: YANG_LIBRARY_VERSION}})
+	yanglibver, _ := xml.Marshal(YangLibVer{Version: YANG_LIBRARY_VERSION, XmlLns: PUBLIC_XMLNS})
+
+	for _, test := range []struct {
+		url    string
+		accept string
+		want   string
+	}{
+		{"/restconf", APPLICATION_DATA_JSON, string(root)},
+		{"/restconf/yang-library-version", APPLICATION_DATA_XML, string(yanglibver)},
+		{"/.well-known/host-meta", APPLICATION_XRD_XML, ""},
+	} {
+		req := httptest.NewRequest("GET", test.url, nil)
+		req.Header.Set("Accept", test.accept)
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		etag := rsp.Header().Get("ETag")
+		if rsp.Code != http.StatusOK || etag == "" || rsp.Header().Get("Content-Type") != test.accept {
+			t.Fatalf("GET %s: got status %d, ETag %q, Content-Type %q", test.url,
+				rsp.Code, etag, rsp.Header().Get("Content-Type"))
+		}
+		if test.want != "" && rsp.Body.String() != test.want {
+			t.Errorf("GET %s: got body %s, want %s", test.url, rsp.Body, test.want)
+		}
+
+		req.Header.Set("If-None-Match", etag)
+		rsp = httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != http.StatusNotModified || rsp.Body.Len() != 0 {
+			t.Errorf("GET %s with If-None-Match: got status %d, body %q", test.url, rsp.Code, rsp.Body)
+		}
+	}
+
+	key := discoveryKey(RESTCONF_PREFIX, APPLICATION_DATA_JSON)
+	cached := server.discovery[key]
+	server.SetSchema(server.Schema())
+	if server.discovery[key] == cached {
+		t.Errorf("SetSchema did not rebuild the discovery cache")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	server := testServer(t)
+	server.serverName = "router"
+
+	req := httptest.NewRequest("GET", "/restconf/version", nil)
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+
+	if got, want := rsp.Header().Get("Server"), "router/"+VERSION; got != want {
+		t.Errorf("got Server %q, want %q", got, want)
+	}
+	var doc VersionJson
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil || rsp.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s: %v", rsp.Code, rsp.Body, err)
+	}
+	if doc.Version.Product != "router" || doc.Version.Version != VERSION {
+		t.Errorf("got version %+v", doc.Version)
+	}
+}
+
+func TestYangLibVerAccept(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		accept string
+		ctype  string
+		want   string
+	}{
+		{"", APPLICATION_DATA_JSON, `{"yang-library-version":"2016-06-21"}`},
+		{APPLICATION_DATA_XML, APPLICATION_DATA_XML,
+			`<yang-library-version xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">2016-06-21</yang-library-version>`},
+	} {
+		req := httptest.NewRequest("GET", "/restconf/yang-library-version", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != test.ctype {
+			t.Fatalf("Accept %q: got status %d, Content-Type %q, want %d, %q", test.accept,
+				rsp.Code, rsp.Header().Get("Content-Type"), http.StatusOK, test.ctype)
+		}
+		if rsp.Body.String() != test.want {
+			t.Errorf("Accept %q: got body %s, want %s", test.accept, rsp.Body, test.want)
+		}
+	}
+}
+
+func TestYangLibVerXML(t *testing.T) {
+	server := testServer(t)
+
+	req := httptest.NewRequest("GET", "/restconf/yang-library-version", nil)
+	req.Header.Set("Accept", APPLICATION_DATA_XML)
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+
+	golden, err := os.ReadFile("testdata/yang-library-version.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Body.String() != string(golden) {
+		t.Errorf("got body %s, want %s", rsp.Body, golden)
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Version string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal(rsp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("parse %s: %v", rsp.Body, err)
+	}
+	if doc.XMLName.Space != PUBLIC_XMLNS || doc.XMLName.Local != "yang-library-version" || doc.Version != YANG_LIBRARY_VERSION {
+		t.Errorf("got element {%s}%s holding %q", doc.XMLName.Space, doc.XMLName.Local, doc.Version)
+	}
+}
+
+func TestYangLibraryVersion(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"test": testModuleText, "ietf-yang-library": `
+module ietf-yang-library {
+  namespace "urn:ietf:params:xml:ns:yang:ietf-yang-library";
+  prefix yanglib;
+  revision 2019-01-04;
+  revision 2016-06-21;
+}
+`}))
+
+	for _, test := range []struct {
+		url  string
+		want string
+	}{
+		{"/restconf", `{"ietf-restconf:restconf":{"data":{},"operations":{},"yang-library-version":"2019-01-04"}}`},
+		{"/restconf/yang-library-version", `{"yang-library-version":"2019-01-04"}`},
+	} {
+		req := httptest.NewRequest("GET", test.url, nil)
+		req.Header.Set("Accept", APPLICATION_DATA_JSON)
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != http.StatusOK || rsp.Body.String() != test.want {
+			t.Errorf("GET %s: got status %d, body %s, want %s", test.url, rsp.Code, rsp.Body, test.want)
+		}
+	}
+
+	if got := testServer(t).Schema().YangLibraryVersion(); got != YANG_LIBRARY_VERSION {
+		t.Errorf("without ietf-yang-library: got version %q, want %q", got, YANG_LIBRARY_VERSION)
+	}
+}
+
+func TestDiscoveryGzip(t *testing.T) {
+	server := testServer(t)
+
+	for _, url := range []string{"/restconf", "/restconf/yang-library-version"} {
+		get := func(encoding, etag string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Header.Set("Accept", APPLICATION_DATA_JSON)
+			req.Header.Set("Accept-Encoding", encoding)
+			req.Header.Set("If-None-Match", etag)
+			rsp := httptest.NewRecorder()
+			server.ServeHTTP(rsp, req)
+			return rsp
+		}
+
+		plain := get("", "")
+		if plain.Code != http.StatusOK || plain.Header().Get("Content-Encoding") != "" || plain.Header().Get("Vary") != "Accept, Accept-Encoding" {
+			t.Fatalf("GET %s: got status %d, Content-Encoding %q, Vary %q", url, plain.Code,
+				plain.Header().Get("Content-Encoding"), plain.Header().Get("Vary"))
+		}
+
+		rsp := get("gzip, deflate", "")
+		if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Encoding") != "gzip" || rsp.Header().Get("Vary") != "Accept, Accept-Encoding" {
+			t.Fatalf("GET %s gzip: got status %d, Content-Encoding %q, Vary %q", url, rsp.Code,
+				rsp.Header().Get("Content-Encoding"), rsp.Header().Get("Vary"))
+		}
+		zr, err := gzip.NewReader(rsp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := io.ReadAll(zr); string(body) != plain.Body.String() {
+			t.Errorf("GET %s gzip: got body %s, want %s", url, body, plain.Body)
+		}
+
+		// Each encoding has its own entity tag.
+		etag := rsp.Header().Get("ETag")
+		if etag == plain.Header().Get("ETag") {
+			t.Errorf("GET %s: the encodings share the ETag %s", url, etag)
+		}
+		if rsp := get("gzip", etag); rsp.Code != http.StatusNotModified {
+			t.Errorf("GET %s gzip If-None-Match: got status %d", url, rsp.Code)
+		}
+		if rsp := get("", etag); rsp.Code != http.StatusOK {
+			t.Errorf("GET %s If-None-Match of the gzip ETag: got status %d", url, rsp.Code)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	server := testServer(t)
+	hello := func(body string) http.HandlerFunc {
+		return func(rsp http.ResponseWriter, req *http.Request) {
+			rsp.Write([]byte(body))
+		}
+	}
+
+	if err := server.Register("/restconf/example", hello("example")); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"/restconf/example", "/restconf/example/sub"} {
+		rsp := doRequest(server, "GET", url, "", "")
+		if rsp.Code != http.StatusOK || rsp.Body.String() != "example" {
+			t.Errorf("GET %s: got status %d, body %s", url, rsp.Code, rsp.Body)
+		}
+		if rsp.Header().Get(REQUEST_ID_HEADER) == "" {
+			t.Errorf("GET %s: got no %s header", url, REQUEST_ID_HEADER)
+		}
+	}
+
+	for _, url := range []string{"/restconf/example", RESTCONF_PREFIX + "/data", "", "restconf/x", "/restconf/x/", "/restconf/../x"} {
+		if err := server.Register(url, hello("again")); err == nil {
+			t.Errorf("Register %q: got no error", url)
+		}
+	}
+	if rsp := doRequest(server, "GET", "/restconf/example", "", ""); rsp.Body.String() != "example" {
+		t.Errorf("got body %s after a failed Register", rsp.Body)
+	}
+
+	if err := server.Override(RESTCONF_PREFIX+"/version", hello("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	if rsp := doRequest(server, "GET", "/restconf/version", "", ""); rsp.Body.String() != "replaced" {
+		t.Errorf("got body %s after Override", rsp.Body)
+	}
+}
+
+func TestHostMetaAccept(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		accept string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"*/*", http.StatusOK},
+		{"application/*", http.StatusOK},
+		{"text/html, " + APPLICATION_XRD_XML + ";q=0.9", http.StatusOK},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusOK},
+		{"text/html", http.StatusNotAcceptable},
+		{APPLICATION_XRD_XML + ";q=0, */*", http.StatusNotAcceptable},
+	} {
+		req := httptest.NewRequest("GET", "/.well-known/host-meta", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != test.status {
+			t.Errorf("Accept %q: got status %d, want %d: %s", test.accept, rsp.Code, test.status, rsp.Body)
+		}
+	}
+}
+
+func TestHostMetaNotShadowed(t *testing.T) {
+	hello := func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.Write([]byte("shadow"))
+	}
+	urls := []string{"/", "/.well-known", "/.well-known/{name}", "/{a}/{b}", "/{a}/host-meta", "/.well-known/host-meta/x"}
+
+	// In any order of registration, before and after the built-in resources
+	// are taken, the exact match resolves to HostMeta.
+	for i := range urls {
+		server := testServer(t)
+		for _, url := range append(urls[i:], urls[:i]...) {
+			if err := server.Register(url, hello); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/.well-known/host-meta", nil)
+		req.Header.Set("Accept", APPLICATION_XRD_XML)
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != APPLICATION_XRD_XML ||
+			!strings.Contains(rsp.Body.String(), RESTCONF_PREFIX) {
+			t.Errorf("registered %v: got status %d, Content-Type %q, body %s", urls, rsp.Code,
+				rsp.Header().Get("Content-Type"), rsp.Body)
+		}
+	}
+}
+
+func TestPrefixOrder(t *testing.T) {
+	server := testServer(t)
+	for _, url := range []string{"/a", "/a/b/c", "/a/b", "/b"} {
+		body := url
+		if err := server.Register(url, func(rsp http.ResponseWriter, req *http.Request) {
+			rsp.Write([]byte(body))
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, want := range map[string]string{
+		"/a/x": "/a", "/a/b/x": "/a/b", "/a/b/c/x": "/a/b/c", "/b/x": "/b",
+	} {
+		if rsp := doRequest(server, "GET", path, "", ""); rsp.Body.String() != want {
+			t.Errorf("GET %s: got %s, want %s", path, rsp.Body, want)
+		}
+	}
+}
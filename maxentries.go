@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   A GET returns at most -max-list-entries entries of any one list or
+   leaf-list without paging, so that the response to a read of an unbounded
+   list does not grow without bound. A response holding more is refused
+   with too-big, telling the client to page the list, select less of it with
+   fields or depth, or lift the cap with the max-entries query parameter:
+
+   GET /restconf/data/example:system/interface?max-entries=unbounded
+   GET /restconf/data/example:system?max-entries=500000
+
+   The cap is counted after the other query parameters selected the data,
+   the entries of a page count against the limit of the page instead. It
+   only limits the size of the responses: the data is read in full, the
+   state providers called, before the entries are counted, so the server
+   holds the whole list of a refused read all the same. It is advertised in
+   the restconf-state capabilities, with its value:
+
+   urn:go-restconf:capability:max-list-entries:1.0?max=100000
+*/
+
+var MAX_LIST_ENTRIES = 100000
+
+var (
+	MAX_ENTRIES_PARAM     = "max-entries"
+	MAX_ENTRIES_UNBOUNDED = "unbounded"
+
+	MAX_ENTRIES_CAPABILITY = "urn:go-restconf:capability:max-list-entries:1.0"
+)
+
+// maxEntriesParam parses the max-entries parameter v, returning -1 for
+// unbounded.
+func maxEntriesParam(v string) (int, error) {
+	if v == MAX_ENTRIES_UNBOUNDED {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, invalidValue("invalid %s parameter %q", MAX_ENTRIES_PARAM, v)
+	}
+	return n, nil
+}
+
+// maxEntriesCapability returns the capability URI of the cap, "" if there is
+// none.
+func maxEntriesCapability() string {
+	if MAX_LIST_ENTRIES <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s?max=%d", MAX_ENTRIES_CAPABILITY, MAX_LIST_ENTRIES)
+}
+
+// entriesCap returns the most entries of a list a response to the read
+// params returns, 0 for no cap.
+func (params *readParams) entriesCap() int {
+	switch {
+	case params.maxEntries < 0:
+		return 0
+	case params.maxEntries > 0:
+		return params.maxEntries
+	case MAX_LIST_ENTRIES > 0:
+		return MAX_LIST_ENTRIES
+	}
+	return 0
+}
+
+// checkEntries checks that no list or leaf-list of the data tree v of the
+// node e holds more than max entries, 0 for no cap.
+func checkEntries(e *yang.Entry, v interface{}, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if len(v) > max {
+			return NewError(http.StatusBadRequest, ERROR_TYPE_APPLICATION, ERROR_TAG_TOO_BIG,
+				"%s holds %d entries, more than the %d returned at once: page it with the %s parameter, "+
+					"select less with %s, or set %s=%s", e.Name, len(v), max,
+				PAGE_LIMIT_PARAM, FIELDS_PARAM, MAX_ENTRIES_PARAM, MAX_ENTRIES_UNBOUNDED)
+		}
+		for _, value := range v {
+			if err := checkEntries(e, value, max); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if !e.IsDir() {
+			return nil
+		}
+		for name, cv := range v {
+			if child := findDataChild(e, name); child != nil {
+				if err := checkEntries(child, cv, max); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaxListEntries(t *testing.T) {
+	defer func(max int) { MAX_LIST_ENTRIES = max }(MAX_LIST_ENTRIES)
+	MAX_LIST_ENTRIES = 3
+	server := testServer(t)
+	for i := 0; i < 5; i++ {
+		rsp := doRequest(server, "POST", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			fmt.Sprintf(`{"test:interface":[{"name":"eth%d","unit":0}]}`, i))
+		if rsp.Code != http.StatusCreated {
+			t.Fatalf("POST: got status %d: %s", rsp.Code, rsp.Body)
+		}
+	}
+
+	for _, test := range []struct {
+		url    string
+		status int
+	}{
+		{"/restconf/data/test:system/interface", http.StatusBadRequest},
+		{"/restconf/data/test:system", http.StatusBadRequest},
+		{"/restconf/data", http.StatusBadRequest},
+		{"/restconf/data/test:system/interface?limit=3", http.StatusOK},
+		{"/restconf/data/test:system?depth=1", http.StatusOK},
+		{"/restconf/data/test:system?fields=hostname", http.StatusOK},
+		{"/restconf/data/test:system/interface?max-entries=unbounded", http.StatusOK},
+		{"/restconf/data/test:system?max-entries=5", http.StatusOK},
+		{"/restconf/data?max-entries=unbounded", http.StatusOK},
+		{"/restconf/data/test:system?max-entries=4", http.StatusBadRequest},
+		{"/restconf/data/test:system?max-entries=0", http.StatusBadRequest},
+		{"/restconf/data/test:system/interface=eth0,0", http.StatusOK},
+	} {
+		rsp := doRequest(server, "GET", test.url, "", "")
+		if rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", test.url, rsp.Code, test.status, rsp.Body)
+		}
+	}
+
+	rsp := doRequest(server, "GET", "/restconf/data/test:system/interface", "", "")
+	if body := rsp.Body.String(); !strings.Contains(body, ERROR_TAG_TOO_BIG) || !strings.Contains(body, PAGE_LIMIT_PARAM) {
+		t.Errorf("got %s, want a too-big error directing to paging", body)
+	}
+
+	if caps := fmt.Sprint(capabilities()); !strings.Contains(caps, "urn:go-restconf:capability:max-list-entries:1.0?max=3") {
+		t.Errorf("the cap is not advertised: %s", caps)
+	}
+
+	// Without a cap every entry is returned, and none is advertised.
+	MAX_LIST_ENTRIES = 0
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system/interface", "", ""); rsp.Code != http.StatusOK {
+		t.Errorf("no cap: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	if caps := fmt.Sprint(capabilities()); strings.Contains(caps, MAX_ENTRIES_CAPABILITY) {
+		t.Errorf("no cap: the cap is advertised: %s", caps)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// mediaType returns the lower-cased media type of a Content-Type or Accept
+// element, without parameters, or "" if s cannot be parsed.
+func mediaType(s string) string {
+	t, _, err := mime.ParseMediaType(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+// requestFormat returns the yang-data media type of the request body. A
+// request without Content-Type is taken to be JSON.
+func requestFormat(req *http.Request) (string, error) {
+	ctype := req.Header.Get("Content-Type")
+	if ctype == "" {
+		return APPLICATION_DATA_JSON, nil
+	}
+
+	switch t := mediaType(ctype); t {
+	case APPLICATION_DATA_JSON, APPLICATION_DATA_XML:
+		return t, nil
+	}
+
+	return "", NewError(http.StatusUnsupportedMediaType, ERROR_TYPE_PROTOCOL,
+		ERROR_TAG_INVALID_VALUE, "unsupported content type %q", ctype)
+}
+
+// SUPPORTED_FORMATS lists the media types the server can send, in order of
+// preference.
+var SUPPORTED_FORMATS = []string{APPLICATION_DATA_JSON, APPLICATION_DATA_XML}
+
+// formatNames maps the values of the -default-format and -validate-format
+// flags to media types.
+var formatNames = map[string]string{
+	"json": APPLICATION_DATA_JSON,
+	"xml":  APPLICATION_DATA_XML,
+}
+
+// responseFormat returns the yang-data media type the request's Accept header
+// gives the highest quality, or fallback when Accept is absent. A tie goes to
+// fallback, then to the order of SUPPORTED_FORMATS.
+//
+// An Accept naming only types that cannot be negotiated, e.g. "text/*" or an
+// unparsable element, falls back to the server's default format and adds a
+// Warning to rsp. A concrete type the server does not support, or a
+// supported type refused with q=0, is not acceptable.
+func (restconf *RestConf) responseFormat(rsp http.ResponseWriter, req *http.Request, fallback string) (string, error) {
+	addVary(rsp, "Accept")
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return fallback, nil
+	}
+
+	best, quality := "", 0.0
+	for _, t := range append([]string{fallback}, SUPPORTED_FORMATS...) {
+		if q := acceptQuality(req, t); q > quality {
+			best, quality = t, q
+		}
+	}
+	if best != "" {
+		return best, nil
+	}
+
+	var concrete []string
+	var refused bool
+	for _, elem := range strings.Split(accept, ",") {
+		switch t := mediaType(elem); t {
+		case APPLICATION_DATA_JSON, APPLICATION_DATA_XML, "*/*", "application/*":
+			refused = true
+		case "":
+		default:
+			if !strings.HasSuffix(t, "/*") && acceptQuality(req, t) > 0 {
+				concrete = append(concrete, t)
+			}
+		}
+	}
+
+	switch {
+	case len(concrete) != 0:
+		return "", NewError(http.StatusNotAcceptable, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "media type %s is not supported, supported media types are %s",
+			strings.Join(concrete, ", "), strings.Join(SUPPORTED_FORMATS, ", "))
+	case refused:
+		return "", NewError(http.StatusNotAcceptable, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "none of the supported media types %s is acceptable",
+			strings.Join(SUPPORTED_FORMATS, ", "))
+	}
+
+	rsp.Header().Add("Warning", `299 restconf "no supported media type is acceptable, sending `+restconf.defaultFormat+`"`)
+	return restconf.defaultFormat, nil
+}
+
+// acceptQuality returns the quality the Accept header of req gives the media
+// type t, through t itself or a range holding it, 0 if it is not accepted.
+// An empty header accepts every type.
+func acceptQuality(req *http.Request, t string) float64 {
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return 1
+	}
+	major := strings.SplitN(t, "/", 2)[0] + "/*"
+	best, specificity := 0.0, -1
+	for _, elem := range strings.Split(accept, ",") {
+		params := strings.Split(elem, ";")
+		var s int
+		switch mediaType(params[0]) {
+		case t:
+			s = 2
+		case major:
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+				q, _ = strconv.ParseFloat(p[2:], 64)
+			}
+		}
+		// The most specific range sets the quality.
+		if s > specificity {
+			best, specificity = q, s
+		}
+	}
+	return best
+}
+
+// addVary adds the request header fields the response rsp was negotiated
+// with to its Vary header, once each.
+func addVary(rsp http.ResponseWriter, fields ...string) {
+	vary := rsp.Header().Values("Vary")
+	for _, field := range fields {
+		found := false
+		for _, v := range vary {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name == "*" || strings.EqualFold(name, field) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			vary = append(vary, field)
+		}
+	}
+	if len(vary) > 0 {
+		rsp.Header().Set("Vary", strings.Join(vary, ", "))
+	}
+}
+
+// formatSuffixes maps the suffixes a resource path may end in to the media
+// type they request.
+var formatSuffixes = map[string]string{
+	".json": APPLICATION_DATA_JSON,
+	".xml":  APPLICATION_DATA_XML,
+}
+
+// withFormatSuffix returns req with a trailing .json or .xml stripped from
+// its RESTCONF resource path and Accept replaced by the media type the suffix
+// requests. A list entry takes no suffix, the values of its keys end the path
+// and may end in ".json" themselves, its format is selected with Accept. The
+// suffix is matched in the escaped path, so that a node name that itself
+// ends in ".json" is addressed with the dot encoded as %2E.
+func withFormatSuffix(req *http.Request) *http.Request {
+	p := req.URL.EscapedPath()
+	if !strings.HasPrefix(p, RESTCONF_PREFIX+"/") || strings.Contains(p[strings.LastIndex(p, "/"):], "=") {
+		return req
+	}
+
+	for suffix, format := range formatSuffixes {
+		if !strings.HasSuffix(p, suffix) || strings.HasSuffix(p, "/"+suffix) {
+			continue
+		}
+		raw := strings.TrimSuffix(p, suffix)
+		path, err := url.PathUnescape(raw)
+		if err != nil {
+			return req
+		}
+
+		req = req.Clone(req.Context())
+		req.URL.Path, req.URL.RawPath = path, raw
+		req.Header.Set("Accept", format)
+		return req
+	}
+	return req
+}
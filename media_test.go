@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseFormat(t *testing.T) {
+	server := testServer(t)
+	server.defaultFormat = APPLICATION_DATA_XML
+
+	tests := []struct {
+		accept  string
+		want    string
+		status  int
+		warning bool
+	}{
+		{"", APPLICATION_DATA_JSON, 0, false},
+		{APPLICATION_DATA_XML, APPLICATION_DATA_XML, 0, false},
+		{"text/html, " + APPLICATION_DATA_JSON, APPLICATION_DATA_JSON, 0, false},
+		{"*/*", APPLICATION_DATA_JSON, 0, false},
+		{"text/*", APPLICATION_DATA_XML, 0, true},
+		{"no media type", APPLICATION_DATA_XML, 0, true},
+		{"text/html", "", http.StatusNotAcceptable, false},
+		{"text/*, text/html", "", http.StatusNotAcceptable, false},
+		// The type of the highest quality wins, a tie goes to the
+		// fallback, and q=0 refuses a type.
+		{APPLICATION_DATA_JSON + ";q=0, " + APPLICATION_DATA_XML, APPLICATION_DATA_XML, 0, false},
+		{APPLICATION_DATA_XML + ";q=0.5, " + APPLICATION_DATA_JSON, APPLICATION_DATA_JSON, 0, false},
+		{APPLICATION_DATA_XML + ";q=0.5, " + APPLICATION_DATA_JSON + ";q=0.5", APPLICATION_DATA_JSON, 0, false},
+		{"*/*;q=0.1, " + APPLICATION_DATA_XML, APPLICATION_DATA_XML, 0, false},
+		{"*/*, " + APPLICATION_DATA_JSON + ";q=0", APPLICATION_DATA_XML, 0, false},
+		{APPLICATION_DATA_JSON + ";q=0", "", http.StatusNotAcceptable, false},
+		{"text/html;q=0, text/*", APPLICATION_DATA_XML, 0, true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/restconf/data", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rsp := httptest.NewRecorder()
+
+		got, err := server.responseFormat(rsp, req, APPLICATION_DATA_JSON)
+		if test.status != 0 {
+			rcerr, ok := err.(*RestConfError)
+			if !ok || rcerr.Status != test.status {
+				t.Errorf("Accept %q: got error %v, want status %d", test.accept, err, test.status)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Accept %q: got %q, %v, want %q", test.accept, got, err, test.want)
+		}
+		if warned := rsp.Header().Get("Warning") != ""; warned != test.warning {
+			t.Errorf("Accept %q: got Warning %q", test.accept, rsp.Header().Get("Warning"))
+		}
+	}
+}
+
+func TestNotAcceptable(t *testing.T) {
+	server := testServer(t)
+
+	for _, url := range []string{
+		"/restconf",
+		"/restconf/yang-library-version",
+		"/restconf/data/test:system",
+		"/restconf/operations",
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "text/html")
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		if rsp.Code != http.StatusNotAcceptable {
+			t.Errorf("GET %s: got status %d, want %d", url, rsp.Code, http.StatusNotAcceptable)
+			continue
+		}
+		body := rsp.Body.String()
+		if !strings.Contains(body, ERROR_TAG_INVALID_VALUE) ||
+			!strings.Contains(body, APPLICATION_DATA_JSON) || !strings.Contains(body, APPLICATION_DATA_XML) {
+			t.Errorf("GET %s: error body %s does not list the supported media types", url, body)
+		}
+	}
+}
+
+func TestFormatSuffix(t *testing.T) {
+	server := testServer(t)
+	body := `{"test:system":{"hostname":"a","interface":[{"name":"eth0.100","unit":0},{"name":"a.json","unit":0}]}}`
+	if rsp := doRequest(server, "PUT", "/restconf/data/test:system.json", APPLICATION_DATA_JSON, body); rsp.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d: %s", rsp.Code, http.StatusCreated, rsp.Body)
+	}
+
+	tests := []struct {
+		url    string
+		accept string
+		ctype  string
+		want   string
+	}{
+		{"/restconf/data/test:system/hostname.xml", APPLICATION_DATA_JSON, APPLICATION_DATA_XML, `<hostname xmlns="urn:test">a</hostname>`},
+		{"/restconf/data/test:system/hostname.json", APPLICATION_DATA_XML, APPLICATION_DATA_JSON, `{"test:hostname":"a"}`},
+		{"/restconf/data/test:system/interface=eth0.100,0/name", "", APPLICATION_DATA_JSON, `{"test:name":"eth0.100"}`},
+		{"/restconf/data/test:system/interface=a%2Ejson,0/name", APPLICATION_DATA_XML, APPLICATION_DATA_XML, `<name xmlns="urn:test">a.json</name>`},
+		{"/restconf/yang-library-version.xml", "", APPLICATION_DATA_XML, ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != test.ctype {
+			t.Errorf("GET %s: got status %d, Content-Type %q, want %d, %q: %s", test.url,
+				rsp.Code, rsp.Header().Get("Content-Type"), http.StatusOK, test.ctype, rsp.Body)
+			continue
+		}
+		if test.want != "" && rsp.Body.String() != test.want {
+			t.Errorf("GET %s: got %s, want %s", test.url, rsp.Body, test.want)
+		}
+	}
+}
+
+func TestFormatSuffixKeys(t *testing.T) {
+	// The last key value of a list entry keeps its suffix.
+	for _, url := range []string{
+		"/restconf/data/test:system/interface=eth0,a.json",
+		"/restconf/data/test:system/interface=a.xml",
+		"/restconf/data/test:system/interface=a,b.json",
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", APPLICATION_DATA_JSON)
+		if got := withFormatSuffix(req); got.URL.EscapedPath() != url || got.Header.Get("Accept") != APPLICATION_DATA_JSON {
+			t.Errorf("%s: got path %s, Accept %q", url, got.URL.EscapedPath(), got.Header.Get("Accept"))
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	server := testServer(t)
+	server.RegRpc("test:ping", func(op *Operation) (map[string]interface{}, error) {
+		return map[string]interface{}{"reply": "pong"}, nil
+	})
+	doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`)
+
+	for _, test := range []struct {
+		method, url string
+		want        string
+	}{
+		{"GET", "/restconf", "Accept, Accept-Encoding"},
+		{"GET", "/restconf/yang-library-version", "Accept, Accept-Encoding"},
+		{"GET", "/restconf/data/test:system", "Accept"},
+		{"GET", "/restconf/data", "Accept"},
+		{"GET", "/restconf/operations", "Accept"},
+		{"POST", "/restconf/operations/test:ping", "Accept"},
+		// The errors are negotiated as well.
+		{"GET", "/restconf/data/test:system/counter", "Accept"},
+	} {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		req.Header.Set("Accept", APPLICATION_DATA_XML)
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if got := rsp.Header().Values("Vary"); len(got) != 1 || got[0] != test.want {
+			t.Errorf("%s %s: got status %d, Vary %q, want %q", test.method, test.url, rsp.Code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// METHODS lists the methods the server implements. A request with any other
+// method is answered 501 Not Implemented, a request with a method a resource
+// does not support 405 Method Not Allowed (RFC 7231 section 6.5.5 and 6.6.2).
+var METHODS = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// hasMethod reports whether method is one of methods.
+func hasMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// methodError returns the error of req, whose method is not one of the
+// methods its resource supports.
+func methodError(req *http.Request) *RestConfError {
+	if !hasMethod(METHODS, req.Method) {
+		return NewError(http.StatusNotImplemented, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_OPERATION_NOT_SUPPORTED, "method %s is not implemented", req.Method)
+	}
+	return NewError(http.StatusMethodNotAllowed, ERROR_TYPE_PROTOCOL,
+		ERROR_TAG_OPERATION_NOT_SUPPORTED, "method %s is not allowed on %s", req.Method, req.URL.Path)
+}
+
+// allowMethods reports whether the method of req is one of methods. If it is
+// not, allowMethods sends the error of req, with the methods as the Allow
+// header, and the handler must not answer req any further. Every resource
+// supports OPTIONS (RFC 8040 section 4.1), allowMethods answers it with the
+// Allow header.
+func allowMethods(rsp http.ResponseWriter, req *http.Request, methods ...string) bool {
+	if hasMethod(methods, req.Method) {
+		return true
+	}
+	methods = append(methods[:len(methods):len(methods)], "OPTIONS")
+	rsp.Header().Set("Allow", strings.Join(methods, ", "))
+	if req.Method == "OPTIONS" {
+		rsp.WriteHeader(http.StatusOK)
+		return false
+	}
+	MethodNotAllowed(rsp, req)
+	return false
+}
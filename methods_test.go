@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMethods(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		method string
+		url    string
+		status int
+		allow  string
+	}{
+		{"POST", "/restconf", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"PUT", "/restconf/yang-library-version", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"DELETE", "/.well-known/host-meta", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"POST", "/restconf/operations", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"GET", "/restconf/operations/test:reboot", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{"PATCH", "/restconf/version", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"PUT", "/restconf/data", http.StatusMethodNotAllowed, "GET, HEAD, POST, PATCH, OPTIONS"},
+		{"PROPFIND", "/restconf/data/test:system", http.StatusNotImplemented, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"PROPFIND", "/restconf", http.StatusNotImplemented, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/restconf/data", http.StatusOK, "GET, HEAD, POST, PATCH, OPTIONS"},
+		{"OPTIONS", "/restconf", http.StatusOK, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/restconf/yang-library-version", http.StatusOK, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/restconf/operations", http.StatusOK, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/restconf/operations/test:reboot", http.StatusOK, "POST, OPTIONS"},
+	} {
+		rsp := doRequest(server, test.method, test.url, "", "")
+		if rsp.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.url, rsp.Code, test.status)
+			continue
+		}
+		if allow := rsp.Header().Get("Allow"); allow != test.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", test.method, test.url, allow, test.allow)
+		}
+		if test.status != http.StatusOK && rsp.Body.Len() == 0 {
+			t.Errorf("%s %s: got an empty error body", test.method, test.url)
+		}
+	}
+}
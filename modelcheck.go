@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The loaded modules are checked for the packaging mistakes the YANG
+   processing lets through: two modules declaring the same namespace, e.g. a
+   module copied under a new name, and two revisions of a module both loaded
+   from different files. They are logged as warnings, and fail the load with
+   -strict-models:
+
+   models/example.yang:1:1: namespace "urn:example" is declared by modules example and example-copy (models/example-copy.yang:1:1)
+*/
+
+var STRICT_MODELS = false
+
+// checkModules returns the errors of the modules loaded into ms sharing a
+// namespace or a name, holding the modules and the files they were read
+// from.
+func checkModules(ms *yang.Modules) []error {
+	// The modules are listed under their name and their name@revision.
+	var mods []*yang.Module
+	seen := make(map[*yang.Module]bool)
+	for _, m := range ms.Modules {
+		if !seen[m] {
+			seen[m] = true
+			mods = append(mods, m)
+		}
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		return mods[i].FullName() < mods[j].FullName()
+	})
+
+	var errs []error
+	byName := make(map[string]*yang.Module)
+	byNS := make(map[string]*yang.Module)
+	for _, m := range mods {
+		if o, ok := byName[m.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s: module %s is loaded twice, as %s and %s (%s)",
+				yang.Source(o), m.Name, o.FullName(), m.FullName(), yang.Source(m)))
+			continue
+		}
+		byName[m.Name] = m
+
+		if m.Namespace == nil {
+			continue
+		}
+		ns := m.Namespace.Name
+		if o, ok := byNS[ns]; ok {
+			errs = append(errs, fmt.Errorf("%s: namespace %q is declared by modules %s and %s (%s)",
+				yang.Source(o), ns, o.Name, m.Name, yang.Source(m)))
+			continue
+		}
+		byNS[ns] = m
+	}
+	return errs
+}
+
+// modulesChecked returns the errors of checkModules for ms if the models are
+// strict, and logs them as warnings otherwise.
+func modulesChecked(ms *yang.Modules) []error {
+	errs := checkModules(ms)
+	if STRICT_MODELS {
+		return errs
+	}
+	for _, err := range errs {
+		log.Println("warning:", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yang":            `module a { namespace "urn:a"; prefix a; leaf x { type string; } }`,
+		"b.yang":            `module b { namespace "urn:a"; prefix b; leaf y { type string; } }`,
+		"c.yang":            `module c { namespace "urn:c"; prefix c; revision 2024-01-01; }`,
+		"c@2023-01-01.yang": `module c { namespace "urn:c"; prefix c; revision 2023-01-01; }`,
+		"d.yang":            `module d { namespace "urn:d"; prefix d; }`,
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	defer func(strict bool) { STRICT_MODELS = strict }(STRICT_MODELS)
+	for _, tt := range []struct {
+		files []string
+		want  []string // the errors, each holding the strings
+	}{
+		{[]string{"a.yang", "c.yang", "d.yang"}, nil},
+		{[]string{"a.yang", "b.yang", "d.yang"},
+			[]string{`namespace "urn:a" is declared by modules a and b`, path("a.yang"), path("b.yang")}},
+		{[]string{"c.yang", "c@2023-01-01.yang"},
+			[]string{"module c is loaded twice, as c@2023-01-01 and c@2024-01-01", path("c.yang"), path("c@2023-01-01.yang")}},
+	} {
+		var names []string
+		for _, file := range tt.files {
+			names = append(names, path(file))
+		}
+
+		STRICT_MODELS = false
+		if schema, errs := LoadSchema(names...); schema == nil || len(errs) > 0 {
+			t.Errorf("LoadSchema %v: got errors %v, want warnings", tt.files, errs)
+		}
+
+		STRICT_MODELS = true
+		_, errs := LoadSchema(names...)
+		if (len(errs) > 0) != (tt.want != nil) {
+			t.Errorf("LoadSchema %v: got errors %v, want %q", tt.files, errs, tt.want)
+			continue
+		}
+		for _, err := range errs {
+			for _, s := range tt.want {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("LoadSchema %v: got error %q, want it to hold %q", tt.files, err, s)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   Schema mount (RFC 8528): a container or list marked with the mount-point
+   extension of ietf-yang-schema-mount holds the top-level nodes of another
+   schema. The mount points and the type of their mounts are served as the
+   schema-mounts state data:
+
+   {
+     "ietf-yang-schema-mount:schema-mounts" : {
+       "mount-point" : [
+         { "module" : "example", "label" : "root", "inline" : {} },
+         { "module" : "example", "label" : "vrf", "shared-schema" : {} }
+       ]
+     }
+   }
+
+   Every instance of a mount point holds the same mounted schema. An inline
+   mount, which may hold a schema of its own in each instance, is therefore
+   only accepted at a mount point outside any list, the one instance of
+   which holds the mounted schema; the mount points within lists are
+   mounted shared-schema.
+*/
+
+var (
+	SCHEMA_MOUNT_MODULE = "ietf-yang-schema-mount"
+
+	// An inline mount may mount a schema of its own in every instance of
+	// the mount point, a shared-schema mount mounts the same schema in all.
+	MOUNT_INLINE        = "inline"
+	MOUNT_SHARED_SCHEMA = "shared-schema"
+)
+
+// A MountPoint is a node of the schema marked as a mount point.
+type MountPoint struct {
+	Module string // module defining the mount point
+	Label  string
+	Entry  *yang.Entry
+
+	Type   string  // MOUNT_INLINE or MOUNT_SHARED_SCHEMA, "" while nothing is mounted
+	Schema *Schema // the mounted schema, nil while nothing is mounted
+}
+
+// mountLabel returns the label of the mount-point extension of e, or "" if e
+// is not a mount point.
+func mountLabel(e *yang.Entry) string {
+	if e.Node == nil || !e.IsDir() {
+		return ""
+	}
+	for _, ext := range e.Exts {
+		i := strings.Index(ext.Keyword, ":")
+		if i < 0 || ext.Keyword[i+1:] != "mount-point" {
+			continue
+		}
+		if mod := yang.FindModuleByPrefix(e.Node, ext.Keyword[:i]); mod != nil && mod.Name == SCHEMA_MOUNT_MODULE {
+			return ext.Argument
+		}
+	}
+	return ""
+}
+
+// MountPoints returns the mount points of the schema, sorted by module and
+// label.
+func (schema *Schema) MountPoints() []*MountPoint {
+	mps := make([]*MountPoint, 0, len(schema.mounts))
+	for _, mp := range schema.mounts {
+		mps = append(mps, mp)
+	}
+	sort.Slice(mps, func(i, j int) bool {
+		if mps[i].Module != mps[j].Module {
+			return mps[i].Module < mps[j].Module
+		}
+		return mps[i].Label < mps[j].Label
+	})
+	return mps
+}
+
+// Mount mounts the schema mounted at the mount points labelled label of the
+// module mod, with the mount type typ. The top-level nodes of the modules of
+// mounted become children of the mount points, so that data paths, bodies
+// and the datastore descend into them as into any other node. Mount must be
+// called before the schema is served.
+func (schema *Schema) Mount(mod, label, typ string, mounted *Schema) error {
+	if typ != MOUNT_INLINE && typ != MOUNT_SHARED_SCHEMA {
+		return fmt.Errorf("unknown mount type %q", typ)
+	}
+
+	var found bool
+	for key, mp := range schema.mounts {
+		if mp.Module != mod || mp.Label != label {
+			continue
+		}
+		found = true
+		if mp.Schema != nil {
+			return fmt.Errorf("mount point %s:%s is already mounted", mod, label)
+		}
+		for e := mp.Entry; typ == MOUNT_INLINE && e != nil; e = e.Parent {
+			if e.IsList() {
+				return fmt.Errorf("mount point %s:%s is within the list %s, the schema of each entry cannot be mounted inline, mount it %s",
+					mod, label, e.Name, MOUNT_SHARED_SCHEMA)
+			}
+		}
+
+		if mp.Entry.Dir == nil {
+			mp.Entry.Dir = make(map[string]*yang.Entry)
+		}
+		for _, name := range mounted.ModuleNames() {
+			for cname, child := range mounted.Modules[name].Dir {
+				if _, ok := mp.Entry.Dir[cname]; ok {
+					return fmt.Errorf("mount point %s:%s already has a node %s", mod, label, cname)
+				}
+				mp.Entry.Dir[cname] = child
+			}
+			// The nodes below the mounted module, mounts of the mounted
+			// schema included, are indexed below the mount point.
+			prefix := "/" + name + "/"
+			for mkey, e := range mounted.index {
+				if strings.HasPrefix(mkey, prefix) {
+					schema.index[key+"/"+strings.TrimPrefix(mkey, prefix)] = e
+				}
+			}
+		}
+		if len(mounted.constraints) > 0 {
+			schema.constrained[strings.SplitN(key, "/", 3)[1]] = true
+		}
+		mp.Type, mp.Schema = typ, mounted
+	}
+	if !found {
+		return fmt.Errorf("no mount point %s:%s", mod, label)
+	}
+
+	for e, c := range mounted.constraints {
+		schema.constraints[e] = c
+	}
+
+	// The mounted modules are known to the schema only for their namespaces
+	// and sources, they are not top-level modules of the datastore.
+	for ns, name := range mounted.namespaces {
+		if _, ok := schema.namespaces[ns]; !ok {
+			schema.namespaces[ns] = name
+		}
+	}
+	for name, m := range mounted.modules {
+		if _, ok := schema.modules[name]; !ok {
+			schema.modules[name] = m
+		}
+	}
+	return nil
+}
+
+// readMounts returns the schema-mounts state data at r, r being a resource
+// of the ietf-yang-schema-mount module.
+func (schema *Schema) readMounts(r *Resource) (interface{}, bool) {
+	var mps []interface{}
+	for _, mp := range schema.MountPoints() {
+		if mp.Schema == nil {
+			continue
+		}
+		mps = append(mps, map[string]interface{}{
+			"module": mp.Module,
+			"label":  mp.Label,
+			mp.Type:  map[string]interface{}{},
+		})
+	}
+
+	mounts := make(map[string]interface{})
+	if mps != nil {
+		mounts["mount-point"] = mps
+	}
+	return readTree(map[string]interface{}{"schema-mounts": mounts}, r)
+}
+
+// LoadMounts reads a mounts file holding one "module:label type module..."
+// line per mount point, type being inline or shared-schema, and mounts the
+// schema of the listed modules at the mount point. Empty lines and lines
+// starting with # are ignored.
+func LoadMounts(schema *Schema, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		i := strings.Index(fields[0], ":")
+		if len(fields) < 3 || i <= 0 {
+			return fmt.Errorf("%s:%d: expected module:label type module...", file, n)
+		}
+
+		mounted, errs := LoadSchema(fields[2:]...)
+		if len(errs) > 0 {
+			return fmt.Errorf("%s:%d: %v", file, n, errs[0])
+		}
+		if err := schema.Mount(fields[0][:i], fields[0][i+1:], fields[1], mounted); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+	}
+	return scanner.Err()
+}
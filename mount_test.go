@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// schemaMountModuleText holds the parts of ietf-yang-schema-mount the
+// mount points and the schema-mounts state data use.
+var schemaMountModuleText = `
+module ietf-yang-schema-mount {
+  namespace "urn:ietf:params:xml:ns:yang:ietf-yang-schema-mount";
+  prefix yangmnt;
+
+  extension mount-point {
+    argument label;
+  }
+
+  container schema-mounts {
+    config false;
+    list mount-point {
+      key "module label";
+      leaf module { type string; }
+      leaf label { type string; }
+      choice schema-ref {
+        container inline {
+          presence "inline mount";
+        }
+        container shared-schema {
+          presence "shared-schema mount";
+          leaf-list parent-reference { type string; }
+        }
+      }
+    }
+  }
+}
+`
+
+var hostModuleText = `
+module host {
+  namespace "urn:host";
+  prefix h;
+
+  import ietf-yang-schema-mount { prefix yangmnt; }
+
+  list lne {
+    key name;
+    leaf name { type string; }
+    container root {
+      yangmnt:mount-point "root";
+    }
+  }
+  container vrf {
+    yangmnt:mount-point "vrf";
+  }
+}
+`
+
+func testMountServer(t *testing.T) *RestConf {
+	schema := testSchema(t, map[string]string{SCHEMA_MOUNT_MODULE: schemaMountModuleText, "host": hostModuleText})
+	if err := schema.Mount("host", "root", MOUNT_SHARED_SCHEMA, testSchema(t, map[string]string{"test": testModuleText})); err != nil {
+		t.Fatalf("Mount(root): %v", err)
+	}
+	return NewRestConf(schema)
+}
+
+func TestMountPoints(t *testing.T) {
+	schema := testSchema(t, map[string]string{SCHEMA_MOUNT_MODULE: schemaMountModuleText, "host": hostModuleText})
+	mps := schema.MountPoints()
+	if len(mps) != 2 || mps[0].Label != "root" || mps[0].Entry.Name != "root" || mps[1].Label != "vrf" || mps[1].Module != "host" {
+		t.Fatalf("got mount points %v, want host:root and host:vrf", mps)
+	}
+
+	mounted := testSchema(t, map[string]string{"test": testModuleText})
+	if err := schema.Mount("host", "vrf", "nested", mounted); err == nil {
+		t.Errorf("Mount with unknown type: got no error")
+	}
+	if err := schema.Mount("host", "lne", MOUNT_INLINE, mounted); err == nil {
+		t.Errorf("Mount at unknown label: got no error")
+	}
+	// The entries of a list cannot each have a schema of their own.
+	if err := schema.Mount("host", "root", MOUNT_INLINE, mounted); err == nil {
+		t.Errorf("inline Mount within a list: got no error")
+	}
+	if err := schema.Mount("host", "vrf", MOUNT_INLINE, mounted); err != nil {
+		t.Fatalf("Mount(vrf): %v", err)
+	}
+	if err := schema.Mount("host", "vrf", MOUNT_SHARED_SCHEMA, mounted); err == nil {
+		t.Errorf("Mount twice: got no error")
+	}
+	if schema.Lookup("/host/vrf/system/interface") == nil {
+		t.Errorf("mounted node is not indexed below the mount point")
+	}
+}
+
+func TestMountData(t *testing.T) {
+	server := testMountServer(t)
+
+	steps := []struct {
+		method, url, body string
+		status            int
+		want              string
+	}{
+		{"GET", "/restconf/data/ietf-yang-schema-mount:schema-mounts", "", http.StatusOK,
+			`{"ietf-yang-schema-mount:schema-mounts":{"mount-point":[{"label":"root","module":"host","shared-schema":{}}]}}`},
+		{"PUT", "/restconf/data/host:lne=a/root/test:system", `{"test:system":{"hostname":"a"}}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data/host:lne=a/root/test:system/hostname", "", http.StatusOK, `{"test:hostname":"a"}`},
+		{"GET", "/restconf/data/host:lne=a", "", http.StatusOK,
+			`{"host:lne":[{"name":"a","root":{"test:system":{"hostname":"a"}}}]}`},
+		{"GET", "/restconf/data/host:lne=a/root/system", "", http.StatusBadRequest, ""},
+		{"GET", "/restconf/data/host:vrf/test:system", "", http.StatusBadRequest, ""},
+	}
+	for _, step := range steps {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("%s %s: got status %d, want %d: %s", step.method, step.url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("%s %s: got %s, want %s", step.method, step.url, rsp.Body, step.want)
+		}
+	}
+}
+
+func TestLoadMounts(t *testing.T) {
+	schema := testSchema(t, map[string]string{SCHEMA_MOUNT_MODULE: schemaMountModuleText, "host": hostModuleText})
+
+	file := filepath.Join(t.TempDir(), "mounts")
+	if err := os.WriteFile(file, []byte("# mounts\nhost:vrf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadMounts(schema, file); err == nil {
+		t.Errorf("LoadMounts: got no error for a line without type and modules")
+	}
+}
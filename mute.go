@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The notifications of busy modules are muted by module, or by notification
+   as "module:notification", nested ones by their schema path:
+
+   restconf -mute example-debug,example:link-flap
+
+   Notify drops a muted notification before it is encoded or queued for any
+   listener, it takes no room in their queues. A stream registered with the
+   notifications it carries is listed in the restconf-state streams only
+   while some of them are not muted, the NETCONF stream is always listed.
+
+   server.RegStream("links", "link notifications", "example:link-up", "example:link-down")
+*/
+
+// notificationKey returns the key of the notification types name stands
+// for: "/module" for a module, "/module/notification" for a notification.
+func notificationKey(name string) (string, error) {
+	if strings.HasPrefix(name, "/") {
+		return nodeKey("notification", name, 1)
+	}
+	mod, notif := splitName(name)
+	if mod == "" {
+		mod, notif = notif, ""
+	}
+	if !isIdentifier(mod) || notif != "" && !isIdentifier(notif) {
+		return "", fmt.Errorf("invalid notification %q", name)
+	}
+	if notif == "" {
+		return "/" + mod, nil
+	}
+	return "/" + mod + "/" + notif, nil
+}
+
+// notificationKeys returns the keys of the notification types names.
+func notificationKeys(names []string) ([]string, error) {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key, err := notificationKey(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Mute drops the notifications names stand for, modules or notifications
+// given as to -mute, until they are unmuted.
+func (restconf *RestConf) Mute(names ...string) error {
+	keys, err := notificationKeys(names)
+	if err != nil {
+		return err
+	}
+
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+	for _, key := range keys {
+		restconf.muted[key] = true
+	}
+	return nil
+}
+
+// Unmute publishes the notifications names stand for again. A notification
+// of a muted module stays muted when it is unmuted alone.
+func (restconf *RestConf) Unmute(names ...string) error {
+	keys, err := notificationKeys(names)
+	if err != nil {
+		return err
+	}
+
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+	for _, key := range keys {
+		delete(restconf.muted, key)
+	}
+	return nil
+}
+
+// isMuted reports whether the notification type key is muted, by itself or
+// by its module, restconf.streamsMu held.
+func (restconf *RestConf) isMuted(key string) bool {
+	mod := strings.SplitN(strings.TrimPrefix(key, "/"), "/", 2)[0]
+	return restconf.muted[key] || restconf.muted["/"+mod]
+}
+
+// notificationMuted reports whether the notification e is muted.
+func (restconf *RestConf) notificationMuted(e *yang.Entry) bool {
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+	return restconf.isMuted(schemaKey(e))
+}
+
+// carries reports whether the stream carries the notification e: the NETCONF
+// stream and a stream registered without notifications carry all of them.
+func (stream *EventStream) carries(e *yang.Entry) bool {
+	if len(stream.types) == 0 {
+		return true
+	}
+	key := schemaKey(e)
+	for _, t := range stream.types {
+		if t == key || strings.HasPrefix(key, t+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// streamActive reports whether the stream carries a notification type that
+// is not muted.
+func (restconf *RestConf) streamActive(stream *EventStream) bool {
+	if len(stream.types) == 0 {
+		return true
+	}
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+	for _, t := range stream.types {
+		if !restconf.isMuted(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	CHANGE_CREATE  = "create"
+	CHANGE_REPLACE = "replace"
+	CHANGE_DELETE  = "delete"
+)
+
+// A Change is a single change of the datastore made by an edit, named like
+// the operations of a YANG patch edit (RFC 8072).
+type Change struct {
+	Operation string
+	Resource  *Resource
+	Before    interface{} // data at Resource before the edit, nil if created
+	After     interface{} // data at Resource after the edit, nil if deleted
+}
+
+func newChange(r *Resource, before, after interface{}) *Change {
+	op := CHANGE_REPLACE
+	switch {
+	case before == nil:
+		op = CHANGE_CREATE
+	case after == nil:
+		op = CHANGE_DELETE
+	}
+	return &Change{Operation: op, Resource: r, Before: before, After: after}
+}
+
+// A ChangeEvent holds the changes made by a single request.
+type ChangeEvent struct {
+	Time      time.Time
+	RequestID string
+	User      string
+	Changes   []*Change
+}
+
+// A NotificationBus passes the change events of the datastore to its
+// subscribers, each receiving the changes within the subtree it subscribed
+// to. Subscribers are called synchronously and must not block.
+type NotificationBus struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]*busSubscriber
+}
+
+type busSubscriber struct {
+	filter *Resource // nil for all changes
+	fn     func(ev *ChangeEvent)
+}
+
+func NewNotificationBus() *NotificationBus {
+	return &NotificationBus{subs: make(map[int]*busSubscriber)}
+}
+
+// Subscribe calls fn with the changes overlapping the resource filter, or
+// all of them when filter is nil, until cancel is called.
+func (bus *NotificationBus) Subscribe(filter *Resource, fn func(ev *ChangeEvent)) (cancel func()) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.next++
+	id := bus.next
+	bus.subs[id] = &busSubscriber{filter: filter, fn: fn}
+
+	return func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		delete(bus.subs, id)
+	}
+}
+
+// Publish passes ev to its subscribers. The changes are shared and must not
+// be modified.
+func (bus *NotificationBus) Publish(ev *ChangeEvent) {
+	bus.mu.Lock()
+	subs := make([]*busSubscriber, 0, len(bus.subs))
+	for _, sub := range bus.subs {
+		subs = append(subs, sub)
+	}
+	bus.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.filter == nil {
+			sub.fn(ev)
+			continue
+		}
+		filtered := *ev
+		filtered.Changes = nil
+		for _, c := range ev.Changes {
+			if overlaps(sub.filter, c.Resource) {
+				filtered.Changes = append(filtered.Changes, c)
+			}
+		}
+		if len(filtered.Changes) > 0 {
+			sub.fn(&filtered)
+		}
+	}
+}
+
+// A changeSet collects the changes of a request, published together once
+// the request is handled.
+type changeSet struct {
+	changes []*Change
+}
+
+var changesContextKey = contextKey("changes")
+
+// withChanges returns req collecting its changes.
+func withChanges(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), changesContextKey, &changeSet{}))
+}
+
+func recordChange(req *http.Request, c *Change) {
+	if cs, ok := req.Context().Value(changesContextKey).(*changeSet); ok {
+		cs.changes = append(cs.changes, c)
+	}
+}
+
+// publishChanges publishes the changes made by req as a single event.
+func (restconf *RestConf) publishChanges(req *http.Request) {
+	cs, ok := req.Context().Value(changesContextKey).(*changeSet)
+	if !ok || len(cs.changes) == 0 {
+		return
+	}
+	restconf.bus.Publish(&ChangeEvent{
+		Time:      restconf.now(),
+		RequestID: requestIDOf(req),
+		User:      requestUser(req),
+		Changes:   cs.changes,
+	})
+}
+
+// commitEdit returns the commit function of an edit of r by req. It audits
+// the edit and records its change.
+func (restconf *RestConf) commitEdit(req *http.Request, r *Resource) func(before, after interface{}) error {
+	return func(before, after interface{}) error {
+		return restconf.commitChanges(req, []*Change{newChange(r, before, after)})
+	}
+}
+
+// commitChanges audits the changes of a single transaction of req together
+// and records them, none of them if they cannot be audited.
+func (restconf *RestConf) commitChanges(req *http.Request, changes []*Change) error {
+	if err := restconf.auditChanges(req, changes); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		recordChange(req, c)
+	}
+	return nil
+}
+
+// narrow returns the change c seen from the resource to within the changed
+// resource, false if c leaves the data of to unchanged. Changes within to
+// are returned as they are.
+func narrow(c *Change, to *Resource) (*Change, bool) {
+	if len(c.Resource.Segments) >= len(to.Segments) {
+		return c, true
+	}
+
+	before, bok := subtree(c.Before, c.Resource, to)
+	after, aok := subtree(c.After, c.Resource, to)
+	switch {
+	case !bok && !aok:
+		return nil, false
+	case !aok:
+		return &Change{Operation: CHANGE_DELETE, Resource: to, Before: before}, true
+	case !bok:
+		return &Change{Operation: CHANGE_CREATE, Resource: to, After: after}, true
+	case reflect.DeepEqual(before, after):
+		return nil, false
+	}
+	return &Change{Operation: CHANGE_REPLACE, Resource: to, Before: before, After: after}, true
+}
+
+// subtree returns the data of the resource to within the data v of the
+// resource from above it.
+func subtree(v interface{}, from, to *Resource) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	for i := len(from.Segments); i < len(to.Segments); i++ {
+		e, seg := to.Entries[i], to.Segments[i]
+		dir, _ := v.(map[string]interface{})
+		var ok bool
+		if v, ok = dir[e.Name]; !ok {
+			return nil, false
+		}
+		if seg.Keys != nil {
+			values, _ := v.([]interface{})
+			index := matchInstance(values, e, seg.Keys)
+			if index < 0 {
+				return nil, false
+			}
+			v = values[index]
+		}
+	}
+	return v, true
+}
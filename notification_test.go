@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotificationBus(t *testing.T) {
+	server := testServer(t)
+	schema := server.Schema()
+
+	resource := func(path string) *Resource {
+		segs, err := ParsePath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := schema.Resolve(segs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	var all, hostname, eth1 []*ChangeEvent
+	server.bus.Subscribe(nil, func(ev *ChangeEvent) { all = append(all, ev) })
+	server.bus.Subscribe(resource("test:system/hostname"), func(ev *ChangeEvent) { hostname = append(hostname, ev) })
+	cancel := server.bus.Subscribe(resource("test:system/interface=eth1,0"), func(ev *ChangeEvent) { eth1 = append(eth1, ev) })
+
+	// The changes of a request are published as one event.
+	req := withChanges(httptest.NewRequest("PATCH", "/restconf/data/test:system", nil))
+	recordChange(req, newChange(resource("test:system/hostname"), nil, "a"))
+	recordChange(req, newChange(resource("test:system/interface=eth0,0"), map[string]interface{}{}, nil))
+	server.publishChanges(req)
+
+	if len(all) != 1 || len(all[0].Changes) != 2 {
+		t.Fatalf("got events %v, want a single event of 2 changes", all)
+	}
+	if ops := all[0].Changes[0].Operation + " " + all[0].Changes[1].Operation; ops != "create delete" {
+		t.Errorf("got operations %s, want create delete", ops)
+	}
+	if len(hostname) != 1 || len(hostname[0].Changes) != 1 || hostname[0].Changes[0].After != "a" {
+		t.Errorf("got hostname events %v, want the hostname change", hostname)
+	}
+	if len(eth1) != 0 {
+		t.Errorf("got eth1 events %v, want none", eth1)
+	}
+
+	cancel()
+	req = withChanges(httptest.NewRequest("PUT", "/restconf/data/test:system", nil))
+	recordChange(req, newChange(resource("test:system"), nil, map[string]interface{}{}))
+	server.publishChanges(req)
+	if len(all) != 2 || len(hostname) != 2 || len(eth1) != 0 {
+		t.Errorf("got %d, %d and %d events, want 2, 2 and 0", len(all), len(hostname), len(eth1))
+	}
+}
+
+func TestNarrowChange(t *testing.T) {
+	server := testServer(t)
+	resolve := func(path string) *Resource {
+		segs, _ := ParsePath(path)
+		r, err := server.Schema().Resolve(segs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	system := resolve("test:system")
+	eth0 := resolve("test:system/interface=eth0,0")
+	before := map[string]interface{}{"hostname": "a", "interface": []interface{}{
+		map[string]interface{}{"name": "eth0", "unit": "0", "mtu": "1500"}}}
+
+	tests := []struct {
+		after map[string]interface{}
+		op    string // "" if unchanged
+	}{
+		{map[string]interface{}{"hostname": "b", "interface": []interface{}{
+			map[string]interface{}{"name": "eth0", "unit": "0", "mtu": "1500"}}}, ""},
+		{map[string]interface{}{"interface": []interface{}{
+			map[string]interface{}{"name": "eth0", "unit": "0", "mtu": "9000"}}}, CHANGE_REPLACE},
+		{map[string]interface{}{"hostname": "a"}, CHANGE_DELETE},
+		{nil, CHANGE_DELETE},
+	}
+	for i, tt := range tests {
+		var after interface{}
+		if tt.after != nil {
+			after = tt.after
+		}
+		got := ""
+		if c, ok := narrow(newChange(system, before, after), eth0); ok {
+			got = c.Operation
+			if c.Resource != eth0 {
+				t.Errorf("test %d: got resource %v, want eth0", i, c.Resource.Segments)
+			}
+		}
+		if got != tt.op {
+			t.Errorf("test %d: got operation %q, want %q", i, got, tt.op)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The OpenAPI document of the data and operations resources is a vendor
+   resource, generated from the schema: a GET of /restconf/openapi returns
+   an OpenAPI 3.0 document with a path of every container, list, list entry
+   and leaf, with the methods the server serves on it, and of every rpc and
+   action. The module parameter scopes the document to the top-level nodes
+   and rpcs of a single module.
+
+   GET /restconf/openapi?module=example
+
+   The bodies are described in their JSON encoding (RFC 7951), a component
+   schema for each container and list entry. The document is generated once
+   per schema and module, and sent with an ETag.
+*/
+
+var (
+	OPENAPI_PREFIX       = RESTCONF_PREFIX + "/openapi"
+	OPENAPI_MODULE_PARAM = "module"
+	OPENAPI_VERSION      = "3.0.3"
+)
+
+// An openAPI builds the OpenAPI document of a schema.
+type openAPI struct {
+	restconf *RestConf
+	schema   *Schema
+	paths    map[string]interface{}
+	schemas  map[string]interface{} // component schemas by name
+}
+
+// OpenAPI sends the OpenAPI document of the schema, or of a single module
+// of it. It is a vendor resource, not part of RESTCONF.
+func (restconf *RestConf) OpenAPI(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+
+	schema := restconf.schemaOf(req)
+	var mod string
+	if s, ok := req.URL.Query()[OPENAPI_MODULE_PARAM]; ok {
+		mod = s[0]
+		if _, ok := schema.Modules[mod]; len(s) != 1 || !ok || schema.hidden[mod] {
+			writeError(rsp, req, NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_INVALID_VALUE, "unknown module %q", mod))
+			return
+		}
+	}
+
+	// A schema does not change once it is served, neither does its
+	// document.
+	schema.openapiMu.Lock()
+	cached, ok := schema.openapi[mod]
+	if !ok {
+		body, err := json.Marshal(restconf.openAPIDocument(schema, mod))
+		if err != nil {
+			schema.openapiMu.Unlock()
+			writeError(rsp, req, err)
+			return
+		}
+		cached = newCachedResponse(body)
+		if schema.openapi == nil {
+			schema.openapi = make(map[string]*cachedResponse)
+		}
+		schema.openapi[mod] = cached
+	}
+	schema.openapiMu.Unlock()
+
+	writeCached(rsp, req, APPLICATION_JSON, cached)
+}
+
+// openAPIDocument returns the OpenAPI document of the modules of schema, or
+// of the module mod only if it is not "".
+func (restconf *RestConf) openAPIDocument(schema *Schema, mod string) map[string]interface{} {
+	b := &openAPI{restconf: restconf, schema: schema,
+		paths: make(map[string]interface{}), schemas: make(map[string]interface{})}
+
+	for _, name := range schema.ModuleNames() {
+		if mod != "" && name != mod {
+			continue
+		}
+		for _, e := range dataChildren(schema.Modules[name]) {
+			b.node(RESTCONF_PREFIX+"/data", nil, nil, e, name, 1)
+		}
+		for _, e := range operationChildren(schema.Modules[name]) {
+			b.operation(RESTCONF_PREFIX+"/operations/"+name+":"+e.Name, nil, e, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": OPENAPI_VERSION,
+		"info": map[string]interface{}{
+			"title":   restconf.serverName,
+			"version": schema.YangLibraryVersion(),
+		},
+		"paths":      b.paths,
+		"components": map[string]interface{}{"schemas": b.schemas},
+	}
+}
+
+// memberName returns the name of the member of e in the JSON encoding of
+// its parent, qualified if e is of another module than the parent.
+func (b *openAPI) memberName(e *yang.Entry) string {
+	if e.Parent == nil || e.Parent.Parent == nil || b.schema.ModuleOf(e) != b.schema.ModuleOf(e.Parent) {
+		return b.schema.ModuleOf(e) + ":" + e.Name
+	}
+	return e.Name
+}
+
+// node adds the paths of the data node e and the nodes below it, e being
+// below the resource r at path, with the path parameters params. mod is the
+// module of the parent of e.
+func (b *openAPI) node(path string, r *Resource, params []interface{}, e *yang.Entry, mod string, depth int) {
+	if depth > MAX_SCHEMA_DEPTH {
+		return
+	}
+
+	seg := PathSegment{Name: e.Name}
+	if m := b.schema.ModuleOf(e); m != mod || r == nil {
+		seg.Module = m
+	}
+	mod = b.schema.ModuleOf(e)
+	path += "/" + seg.String()
+	res := &Resource{Segments: []PathSegment{seg}, Entries: []*yang.Entry{e}}
+	if r != nil {
+		res.Segments = append(r.Segments[:len(r.Segments):len(r.Segments)], seg)
+		res.Entries = append(r.Entries[:len(r.Entries):len(r.Entries)], e)
+	}
+
+	member := map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+		b.memberName(e): b.valueSchema(e)}}
+	b.methods(path, res, params, e, member)
+
+	if !e.IsList() {
+		if e.IsDir() {
+			b.children(path, res, params, e, mod, depth)
+		}
+		return
+	}
+
+	// The entries of a list are addressed by their keys. The parameter of a
+	// key is named after its list, or after the path of the list if a list
+	// above has the same name and key.
+	names := keyNames(e)
+	var keys []string
+	params = params[:len(params):len(params)]
+	for _, key := range names {
+		name := e.Name + "-" + key
+		if hasParam(params, name) {
+			var segs []string
+			for _, s := range res.Segments {
+				segs = append(segs, s.Name)
+			}
+			name = strings.Join(segs, ".") + "-" + key
+		}
+		keys = append(keys, "{"+name+"}")
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}})
+	}
+	entry := *res
+	entry.Segments = append(res.Segments[:len(res.Segments)-1:len(res.Segments)-1], PathSegment{Module: seg.Module, Name: seg.Name, Keys: names})
+	path += "=" + strings.Join(keys, ",")
+	b.methods(path, &entry, params, e, member)
+	b.children(path, &entry, params, e, mod, depth)
+}
+
+// hasParam reports whether params holds a parameter named name.
+func hasParam(params []interface{}, name string) bool {
+	for _, p := range params {
+		if p.(map[string]interface{})["name"] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// children adds the paths of the data nodes, and of the actions, below the
+// container or list entry e at the resource r.
+func (b *openAPI) children(path string, r *Resource, params []interface{}, e *yang.Entry, mod string, depth int) {
+	for _, child := range dataChildren(e) {
+		b.node(path, r, params, child, mod, depth+1)
+	}
+	for _, action := range operationChildren(e) {
+		seg := PathSegment{Name: action.Name}
+		if m := b.schema.ModuleOf(action); m != mod {
+			seg.Module = m
+		}
+		b.operation(path+"/"+seg.String(), params, action, b.schema.ModuleOf(action))
+	}
+}
+
+// methods adds the path of the data resource r, with the methods the server
+// serves on it. body is the schema of the body of the node e.
+func (b *openAPI) methods(path string, r *Resource, params []interface{}, e *yang.Entry, body map[string]interface{}) {
+	content := func(schema interface{}) map[string]interface{} {
+		return map[string]interface{}{APPLICATION_DATA_JSON: map[string]interface{}{"schema": schema}}
+	}
+	if r.Segment().Keys != nil {
+		// A request addresses a single entry, still sent as a list.
+		body = map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+			b.memberName(e): map[string]interface{}{"type": "array", "items": b.entrySchema(e), "minItems": 1, "maxItems": 1}}}
+	}
+	errors := map[string]interface{}{"description": "the errors of the request, as ietf-restconf:errors"}
+
+	item := map[string]interface{}{}
+	if len(params) > 0 {
+		item["parameters"] = params
+	}
+	for _, method := range b.restconf.dataMethods(r) {
+		op := map[string]interface{}{}
+		switch method {
+		case "GET":
+			op["responses"] = map[string]interface{}{
+				"200": map[string]interface{}{"description": "the data of " + e.Name, "content": content(body)}, "default": errors}
+		case "PUT":
+			op["requestBody"] = map[string]interface{}{"required": true, "content": content(body)}
+			op["responses"] = map[string]interface{}{
+				"201": map[string]interface{}{"description": e.Name + " created"},
+				"204": map[string]interface{}{"description": e.Name + " replaced"}, "default": errors}
+		case "PATCH":
+			op["requestBody"] = map[string]interface{}{"required": true, "content": content(body)}
+			op["responses"] = map[string]interface{}{
+				"204": map[string]interface{}{"description": e.Name + " merged"}, "default": errors}
+		case "DELETE":
+			op["responses"] = map[string]interface{}{
+				"204": map[string]interface{}{"description": e.Name + " deleted"}, "default": errors}
+		case "POST":
+			// A POST creates a single child of the container or entry.
+			children := map[string]interface{}{}
+			for _, child := range dataChildren(e) {
+				if !child.ReadOnly() {
+					children[b.memberName(child)] = b.valueSchema(child)
+				}
+			}
+			op["requestBody"] = map[string]interface{}{"required": true, "content": content(map[string]interface{}{
+				"type": "object", "properties": children, "minProperties": 1, "maxProperties": 1})}
+			op["responses"] = map[string]interface{}{
+				"201": map[string]interface{}{"description": "child of " + e.Name + " created"}, "default": errors}
+		default:
+			continue
+		}
+		item[strings.ToLower(method)] = op
+	}
+	b.paths[path] = item
+}
+
+// operation adds the path of the rpc or action e, invoked at path.
+func (b *openAPI) operation(path string, params []interface{}, e *yang.Entry, mod string) {
+	op := map[string]interface{}{}
+	if e.Description != "" {
+		op["description"] = e.Description
+	}
+	if input := e.RPC.Input; input != nil {
+		op["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+			APPLICATION_DATA_JSON: map[string]interface{}{"schema": map[string]interface{}{
+				"type": "object", "properties": map[string]interface{}{mod + ":input": b.entrySchema(input)}}}}}
+	}
+	responses := map[string]interface{}{
+		"204":     map[string]interface{}{"description": e.Name + " invoked"},
+		"default": map[string]interface{}{"description": "the errors of the request, as ietf-restconf:errors"},
+	}
+	if output := e.RPC.Output; output != nil {
+		responses["200"] = map[string]interface{}{"description": "the output of " + e.Name, "content": map[string]interface{}{
+			APPLICATION_DATA_JSON: map[string]interface{}{"schema": map[string]interface{}{
+				"type": "object", "properties": map[string]interface{}{mod + ":output": b.entrySchema(output)}}}}}
+	}
+	op["responses"] = responses
+
+	if len(b.restconf.operationMethods(e)) == 0 {
+		return
+	}
+	item := map[string]interface{}{"post": op}
+	if len(params) > 0 {
+		item["parameters"] = params
+	}
+	b.paths[path] = item
+}
+
+// valueSchema returns the schema of the value of the data node e in JSON.
+func (b *openAPI) valueSchema(e *yang.Entry) map[string]interface{} {
+	switch {
+	case e.IsList():
+		return map[string]interface{}{"type": "array", "items": b.entrySchema(e)}
+	case e.IsLeafList():
+		return map[string]interface{}{"type": "array", "items": b.leafSchema(e)}
+	case e.IsDir():
+		return b.entrySchema(e)
+	case e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry:
+		return map[string]interface{}{}
+	}
+	return b.leafSchema(e)
+}
+
+// entrySchema returns a reference to the component schema of the container,
+// list entry, input or output e, adding the component first.
+func (b *openAPI) entrySchema(e *yang.Entry) map[string]interface{} {
+	name := strings.Replace(strings.TrimPrefix(schemaKey(e), "/"), "/", ".", -1)
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, ok := b.schemas[name]; ok {
+		return ref
+	}
+
+	properties := map[string]interface{}{}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if e.Description != "" {
+		schema["description"] = e.Description
+	}
+	if e.IsList() {
+		schema["required"] = keyNames(e)
+	}
+	// Added before its children, a recursive schema refers to itself.
+	b.schemas[name] = schema
+	for _, child := range dataChildren(e) {
+		properties[b.memberName(child)] = b.valueSchema(child)
+	}
+	return ref
+}
+
+// leafSchema returns the schema of a value of the leaf or leaf-list e in
+// JSON (RFC 7951 section 6).
+func (b *openAPI) leafSchema(e *yang.Entry) map[string]interface{} {
+	schema := typeSchema(leafType(e))
+	if e.Description != "" {
+		schema["description"] = e.Description
+	}
+	return schema
+}
+
+// typeSchema returns the schema of a value of type t in JSON, nil standing
+// for an unresolved type.
+func typeSchema(t *yang.YangType) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind {
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yuint8, yang.Yuint16, yang.Yuint32:
+		return map[string]interface{}{"type": "integer"}
+	case yang.Ybool:
+		return map[string]interface{}{"type": "boolean"}
+	case yang.Yempty:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"nullable": true}, "minItems": 1, "maxItems": 1}
+	case yang.Yenum:
+		if t.Enum != nil {
+			return map[string]interface{}{"type": "string", "enum": t.Enum.Names()}
+		}
+	case yang.Ybinary:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case yang.Yunion:
+		var members []interface{}
+		for _, m := range t.Type {
+			members = append(members, typeSchema(m))
+		}
+		return map[string]interface{}{"anyOf": members}
+	}
+	// Strings, 64-bit numbers, decimal64, bits, identityrefs and
+	// instance-identifiers are sent as strings.
+	return map[string]interface{}{"type": "string"}
+}
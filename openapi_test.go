@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "GET", "/restconf/openapi", "", "")
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	if ctype := rsp.Header().Get("Content-Type"); ctype != APPLICATION_JSON {
+		t.Errorf("got Content-Type %q", ctype)
+	}
+	var doc struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage        `json:"paths"`
+		Components struct{ Schemas map[string]json.RawMessage } `json:"components"`
+	}
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("got %s: %s", err, rsp.Body)
+	}
+	if doc.OpenAPI != OPENAPI_VERSION {
+		t.Errorf("got openapi %q", doc.OpenAPI)
+	}
+
+	for path, want := range map[string]string{
+		"/restconf/data/test:system":                                                       "delete get patch post put",
+		"/restconf/data/test:system/hostname":                                              "delete get patch put",
+		"/restconf/data/test:system/uptime":                                                "get",
+		"/restconf/data/test:system/interface":                                             "get",
+		"/restconf/data/test:system/interface={interface-name},{interface-unit}":           "delete get parameters patch post put",
+		"/restconf/data/test:system/interface={interface-name},{interface-unit}/ipv4/dhcp": "delete get parameters patch post put",
+		"/restconf/data/test:system/interface={interface-name},{interface-unit}/reset":     "parameters post",
+		"/restconf/operations/test:reboot":                                                 "post",
+	} {
+		item, ok := doc.Paths[path]
+		if !ok {
+			t.Errorf("no path %s", path)
+			continue
+		}
+		var methods []string
+		for m := range item {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		if got := strings.Join(methods, " "); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+
+	// Every reference names a component.
+	for _, ref := range strings.Split(rsp.Body.String(), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("no component %s", name)
+		}
+	}
+	if _, ok := doc.Components.Schemas["test.system.interface"]; !ok {
+		t.Errorf("no component of the interface entries")
+	}
+
+	req := httptest.NewRequest("GET", "/restconf/openapi", nil)
+	req.Header.Set("If-None-Match", rsp.Header().Get("ETag"))
+	cached := httptest.NewRecorder()
+	server.ServeHTTP(cached, req)
+	if cached.Code != http.StatusNotModified {
+		t.Errorf("GET with the ETag: got status %d", cached.Code)
+	}
+
+	for _, test := range []struct {
+		query  string
+		status int
+	}{
+		{"?module=test", http.StatusOK},
+		{"?module=other", http.StatusNotFound},
+	} {
+		if rsp := doRequest(server, "GET", "/restconf/openapi"+test.query, "", ""); rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", test.query, rsp.Code, test.status, rsp.Body)
+		}
+	}
+}
+
+func TestOpenAPINestedKeys(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"nest": `module nest {
+  namespace "urn:nest"; prefix n;
+  list item {
+    key name;
+    leaf name { type string; }
+    container sub {
+      list item {
+        key name;
+        leaf name { type string; }
+      }
+    }
+  }
+}`}))
+
+	rsp := doRequest(server, "GET", "/restconf/openapi", "", "")
+	var doc struct {
+		Paths map[string]struct {
+			Parameters []struct{ Name string }
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("got %s: %s", err, rsp.Body)
+	}
+	path := "/restconf/data/nest:item={item-name}/sub/item={item.sub.item-name}"
+	item, ok := doc.Paths[path]
+	if !ok {
+		t.Fatalf("no path %s", path)
+	}
+	var names []string
+	for _, p := range item.Parameters {
+		names = append(names, p.Name)
+	}
+	if got := strings.Join(names, " "); got != "item-name item.sub.item-name" {
+		t.Errorf("%s: got parameters %s", path, got)
+	}
+}
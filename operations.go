@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   {
+     "ietf-restconf:operations" : {
+       "example-ops:reboot" : [null]
+     }
+   }
+
+	<operations xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">
+		<reboot xmlns="https://example.com/ns/example-ops"/>
+	</operations>
+*/
+
+// RPC_TIMEOUT bounds the time an rpc or action handler runs, if it is not
+// registered with a timeout of its own. Zero runs the handlers without one.
+var RPC_TIMEOUT = 30 * time.Second
+
+// An OperationHandler implements a YANG rpc or action. It returns the output
+// of the operation as a data tree, or nil when there is no output to send.
+// A handler running for longer than its timeout, or after the client went
+// away, is expected to return once op.Context() is done, its output is not
+// sent.
+type OperationHandler func(op *Operation) (map[string]interface{}, error)
+
+// An operation is a registered rpc or action handler.
+type operation struct {
+	handler OperationHandler
+	timeout time.Duration // zero for RPC_TIMEOUT, negative for none
+	safe    bool          // side-effect free, invoked while read-only, see MarkSafe
+}
+
+// An Operation is a single invocation of an rpc or action.
+type Operation struct {
+	Request *http.Request
+	Entry   *yang.Entry // schema node of the rpc or action
+
+	// Keys holds the key values of every list instance on the path an
+	// action was invoked on, outermost first. It is empty for rpcs.
+	Keys []InstanceKey
+
+	// Input is the decoded input of the operation, nil when the operation
+	// has no input.
+	Input map[string]interface{}
+}
+
+// Context returns the context of the operation, done when its timeout
+// expires or the client cancels its request.
+func (op *Operation) Context() context.Context {
+	return op.Request.Context()
+}
+
+// Key returns the value of the key leaf name of the innermost list instance
+// on the action's path that has such a key, or "" if there is none.
+func (op *Operation) Key(name string) string {
+	return keyValue(op.Keys, name)
+}
+
+// keyValue returns the value of the key leaf name of the innermost list
+// instance of keys that has such a key, or "" if there is none.
+func keyValue(keys []InstanceKey, name string) string {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if value, ok := keys[i].Values[name]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// schemaKey identifies the schema node e by the names of the data nodes from
+// its module down to it, i.e. "/module/container/list/action".
+func schemaKey(e *yang.Entry) string {
+	var names []string
+	for ; e != nil; e = e.Parent {
+		if e.IsChoice() || e.IsCase() {
+			continue
+		}
+		names = append([]string{e.Name}, names...)
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// RegRpc registers the handler of the rpc name, given as "module:rpc".
+func (restconf *RestConf) RegRpc(name string, handler OperationHandler) error {
+	return restconf.RegRpcTimeout(name, 0, handler)
+}
+
+// RegRpcTimeout registers the handler of the rpc name like RegRpc, running
+// for timeout at most rather than RPC_TIMEOUT. A negative timeout runs the
+// handler without one.
+func (restconf *RestConf) RegRpcTimeout(name string, timeout time.Duration, handler OperationHandler) error {
+	mod, rpc := splitName(name)
+	if mod == "" || rpc == "" {
+		return fmt.Errorf("rpc %q is not module qualified", name)
+	}
+	return restconf.regOperation("/"+mod+"/"+rpc, handler, timeout)
+}
+
+// RegAction registers the handler of the action at the schema path given as
+// "/module:node/.../action". The path holds no list keys, the keys of the
+// instance an action is invoked on are passed in Operation.Keys.
+func (restconf *RestConf) RegAction(path string, handler OperationHandler) error {
+	return restconf.RegActionTimeout(path, 0, handler)
+}
+
+// RegActionTimeout registers the handler of the action at path like
+// RegAction, running for timeout at most rather than RPC_TIMEOUT. A negative
+// timeout runs the handler without one.
+func (restconf *RestConf) RegActionTimeout(path string, timeout time.Duration, handler OperationHandler) error {
+	key, err := nodeKey("action", path, 2)
+	if err != nil {
+		return err
+	}
+	return restconf.regOperation(key, handler, timeout)
+}
+
+// nodeKey returns the schemaKey of the node of the schema path given as
+// "/module:node/...", holding min segments at least, what naming the node
+// in the errors.
+func nodeKey(what, path string, min int) (string, error) {
+	segs, err := ParsePath(path)
+	if err != nil {
+		return "", err
+	}
+	if len(segs) < min || segs[0].Module == "" {
+		return "", fmt.Errorf("%s path %q must be module qualified", what, path)
+	}
+
+	names := []string{segs[0].Module}
+	for _, seg := range segs {
+		if seg.Keys != nil {
+			return "", fmt.Errorf("%s path %q must not hold list keys", what, path)
+		}
+		names = append(names, seg.Name)
+	}
+	return "/" + strings.Join(names, "/"), nil
+}
+
+func (restconf *RestConf) regOperation(key string, handler OperationHandler, timeout time.Duration) error {
+	restconf.operationsMu.Lock()
+	defer restconf.operationsMu.Unlock()
+
+	if _, b := restconf.operations[key]; b {
+		return fmt.Errorf("operation %s is already registered", key)
+	}
+	restconf.operations[key] = &operation{handler: handler, timeout: timeout}
+	return nil
+}
+
+// lookupOperation returns the registered handler of the rpc or action key.
+func (restconf *RestConf) lookupOperation(key string) (*operation, bool) {
+	restconf.operationsMu.RLock()
+	defer restconf.operationsMu.RUnlock()
+
+	o, ok := restconf.operations[key]
+	return o, ok
+}
+
+// run runs the handler of op within the timeout of the operation. It returns
+// an operation-failed error if the handler does not return in time, and
+// ok false if the client cancelled the request, which is not answered.
+func (o *operation) run(op *Operation) (output map[string]interface{}, ok bool, err error) {
+	timeout := o.timeout
+	if timeout == 0 {
+		timeout = RPC_TIMEOUT
+	}
+	ctx := op.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	op.Request = op.Request.WithContext(ctx)
+
+	type result struct {
+		output map[string]interface{}
+		err    error
+	}
+	// The result buffered, a handler returning after the deadline does not
+	// block.
+	done := make(chan result, 1)
+	go func() {
+		output, err := o.handler(op)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, true, r.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, true, NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+				ERROR_TAG_OPERATION_FAILED, "operation %s timed out after %s", op.Entry.Name, timeout)
+		}
+		return nil, false, ctx.Err()
+	}
+}
+
+// invoke decodes the input of the rpc or action addressed by r, runs its
+// handler and sends the output.
+func (restconf *RestConf) invoke(rsp http.ResponseWriter, req *http.Request, r *Resource) {
+	e := r.Entry()
+
+	if !restconf.permit(req, ACCESS_EXEC, e) {
+		writeError(rsp, req, accessDenied(ACCESS_EXEC, e))
+		return
+	}
+
+	handler, ok := restconf.lookupOperation(schemaKey(e))
+	if !ok {
+		writeError(rsp, req, NewError(http.StatusNotImplemented, ERROR_TYPE_APPLICATION,
+			ERROR_TAG_OPERATION_NOT_SUPPORTED, "operation %s is not implemented", e.Name))
+		return
+	}
+
+	if isAction(e) {
+		if err := restconf.boundInstance(req, r); err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+	}
+
+	// The output is negotiated before the operation runs, so that it is
+	// not run for a client that cannot accept its output.
+	var format string
+	if e.RPC.Output != nil {
+		reqformat, _ := requestFormat(req)
+		var err error
+		if format, err = restconf.responseFormat(rsp, req, reqformat); err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+	}
+
+	op := &Operation{Request: req, Entry: e, Keys: r.InstanceKeys()}
+
+	if e.RPC.Input != nil {
+		schema := restconf.schemaOf(req)
+		var input interface{}
+		var err error
+		// An empty body is an empty input, if it has no mandatory child.
+		if emptyBody(req) {
+			input, err = schema.emptyValue(schema.resourcePath(r), e.RPC.Input)
+		} else {
+			input, err = schema.decode(req, schema.resourcePath(r), e.RPC.Input)
+		}
+		if err != nil {
+			writeError(rsp, req, err)
+			return
+		}
+		op.Input, _ = input.(map[string]interface{})
+	} else if !emptyBody(req) {
+		// An operation without input is invoked without a message-body
+		// (RFC 8040 section 3.6.1).
+		writeError(rsp, req, malformed("operation %s has no input, the request body must be empty", e.Name))
+		return
+	}
+
+	output, ok, err := handler.run(op)
+	if !ok {
+		logRequest(req, "operation", e.Name, "cancelled:", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	if e.RPC.Output == nil || len(output) == 0 {
+		rsp.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body := restconf.schemaOf(req).encode(format, e.RPC.Output, output)
+
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(http.StatusOK)
+	rsp.Write(body)
+}
+
+// boundInstance returns a data-missing error when the data instance the
+// action r is bound to does not exist (RFC 7950 section 7.15). A non-presence
+// container has no instance of its own, the nearest node above it that has is
+// looked up instead.
+func (restconf *RestConf) boundInstance(req *http.Request, r *Resource) error {
+	p := r.Parent()
+	for p != nil {
+		if c, _ := p.Entry().Node.(*yang.Container); c == nil || c.Presence != nil {
+			break
+		}
+		p = p.Parent()
+	}
+	if p == nil {
+		return nil
+	}
+
+	var ok bool
+	if restconf.hasState(p) {
+		var err error
+		if _, ok, err = restconf.readState(req, p); err != nil {
+			return err
+		}
+	} else {
+		_, ok = restconf.store.Get(p)
+	}
+	if !ok {
+		return dataMissing(p)
+	}
+	return nil
+}
+
+// listOperations sends the operations resource listing every rpc of the
+// schema the client may execute (RFC 8040 section 3.3.2).
+func (restconf *RestConf) listOperations(rsp http.ResponseWriter, req *http.Request) {
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return
+	}
+
+	buf := bufio.NewWriter(rsp)
+	switch format {
+	case APPLICATION_DATA_XML:
+		{
+			buf.WriteString(`<operations xmlns="` + PUBLIC_XMLNS + `">`)
+			restconf.eachRpc(req, func(mod string, e *yang.Entry) {
+				buf.WriteString("<" + e.Name + ` xmlns="`)
+				xml.EscapeText(buf, []byte(e.Namespace().Name))
+				buf.WriteString(`"/>`)
+			})
+			buf.WriteString(`</operations>`)
+		}
+	default:
+		{
+			buf.WriteString(`{"ietf-restconf:operations":{`)
+			first := true
+			restconf.eachRpc(req, func(mod string, e *yang.Entry) {
+				if !first {
+					buf.WriteByte(',')
+				}
+				first = false
+				appendJSONString(buf, mod+":"+e.Name)
+				buf.WriteString(":[null]")
+			})
+			buf.WriteString(`}}`)
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		logRequest(req, "write operations response failed!", err.Error())
+	}
+}
+
+// eachRpc calls fn for every top-level rpc of the schema the user of req may
+// execute, ordered by module and rpc name.
+func (restconf *RestConf) eachRpc(req *http.Request, fn func(mod string, e *yang.Entry)) {
+	schema := restconf.schemaOf(req)
+	for _, mod := range schema.ModuleNames() {
+		for _, e := range operationChildren(schema.Modules[mod]) {
+			if restconf.permit(req, ACCESS_EXEC, e) {
+				fn(mod, e)
+			}
+		}
+	}
+}
+
+// operationChildren returns the rpcs or actions defined directly in e,
+// sorted by name.
+func operationChildren(e *yang.Entry) []*yang.Entry {
+	var ops []*yang.Entry
+	for _, name := range sortedNames(e.Dir) {
+		if child := e.Dir[name]; isOperation(child) {
+			ops = append(ops, child)
+		}
+	}
+	return ops
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func doRequest(server http.Handler, method, url, ctype, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	return rsp
+}
+
+func TestActionInvocation(t *testing.T) {
+	server := testServer(t)
+
+	var got *Operation
+	err := server.RegAction("/test:system/interface/reset", func(op *Operation) (map[string]interface{}, error) {
+		got = op
+		return map[string]interface{}{"status": "reset in " + op.Input["delay"].(string)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An action is bound to an existing instance.
+	rsp := doRequest(server, "POST", "/restconf/data/test:system/interface=eth%2F0,1/reset",
+		APPLICATION_DATA_JSON, `{"test:input":{"delay":5}}`)
+	if rsp.Code != http.StatusNotFound || !strings.Contains(rsp.Body.String(), `"error-tag":"data-missing"`) {
+		t.Fatalf("absent entry: got status %d body %s, want a data-missing error", rsp.Code, rsp.Body)
+	}
+	if got != nil {
+		t.Fatal("action handler was called for an absent entry")
+	}
+
+	createInterface(t, server, "eth/0", 1)
+	rsp = doRequest(server, "POST", "/restconf/data/test:system/interface=eth%2F0,1/reset",
+		APPLICATION_DATA_JSON, `{"test:input":{"delay":5}}`)
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+	if want := `{"test:output":{"status":"reset in 5"}}`; rsp.Body.String() != want {
+		t.Errorf("got body %s, want %s", rsp.Body, want)
+	}
+
+	if got == nil {
+		t.Fatal("action handler was not called")
+	}
+	if len(got.Keys) != 1 || got.Keys[0].List != "interface" {
+		t.Fatalf("got keys %v, want a single interface instance", got.Keys)
+	}
+	if got.Key("name") != "eth/0" || got.Key("unit") != "1" {
+		t.Errorf("got keys name=%q unit=%q, want eth/0 and 1", got.Key("name"), got.Key("unit"))
+	}
+}
+
+// createInterface creates the system container of the test module with the
+// interface entry of the given keys.
+func createInterface(t *testing.T, server *RestConf, name string, unit int) {
+	t.Helper()
+	body := fmt.Sprintf(`{"test:system":{"interface":[{"name":%q,"unit":%d}]}}`, name, unit)
+	rsp := doRequest(server, "POST", "/restconf/data", APPLICATION_DATA_JSON, body)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("create interface %s,%d: got status %d: %s", name, unit, rsp.Code, rsp.Body)
+	}
+}
+
+func TestActionInvocationXML(t *testing.T) {
+	server := testServer(t)
+	server.RegAction("/test:system/interface/reset", func(op *Operation) (map[string]interface{}, error) {
+		return map[string]interface{}{"status": op.Key("name") + " " + op.Input["delay"].(string)}, nil
+	})
+
+	createInterface(t, server, "eth0", 1)
+
+	rsp := doRequest(server, "POST", "/restconf/data/test:system/interface=eth0,1/reset",
+		APPLICATION_DATA_XML, `<input xmlns="urn:test"><delay>7</delay></input>`)
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+	if want := `<output xmlns="urn:test"><status>eth0 7</status></output>`; rsp.Body.String() != want {
+		t.Errorf("got body %s, want %s", rsp.Body, want)
+	}
+	if ctype := rsp.Header().Get("Content-Type"); ctype != APPLICATION_DATA_XML {
+		t.Errorf("got Content-Type %s, want %s", ctype, APPLICATION_DATA_XML)
+	}
+}
+
+func TestActionErrors(t *testing.T) {
+	server := testServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"unregistered", "POST", "/restconf/data/test:system/interface=eth0,1/reset", `{"test:input":{}}`, http.StatusNotImplemented},
+		{"not POST", "GET", "/restconf/data/test:system/interface=eth0,1/reset", "", http.StatusMethodNotAllowed},
+		{"unknown action", "POST", "/restconf/data/test:system/interface=eth0,1/boot", `{}`, http.StatusBadRequest},
+		{"missing keys", "POST", "/restconf/data/test:system/interface/reset", `{}`, http.StatusBadRequest},
+		{"rpc in data", "POST", "/restconf/data/test:reboot", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rsp := doRequest(server, tt.method, tt.url, APPLICATION_DATA_JSON, tt.body)
+		if rsp.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, rsp.Code, tt.status, rsp.Body)
+		}
+		if !strings.Contains(rsp.Body.String(), `"ietf-restconf:errors"`) {
+			t.Errorf("%s: got body %s, want an errors document", tt.name, rsp.Body)
+		}
+	}
+}
+
+func TestRpcInvocation(t *testing.T) {
+	server := testServer(t)
+
+	var delay string
+	server.RegRpc("test:reboot", func(op *Operation) (map[string]interface{}, error) {
+		delay, _ = op.Input["delay"].(string)
+		return nil, nil
+	})
+	server.RegRpc("test:ping", func(op *Operation) (map[string]interface{}, error) {
+		return nil, errors.New("no route to host")
+	})
+
+	rsp := doRequest(server, "POST", "/restconf/operations/test:reboot", APPLICATION_DATA_JSON, `{"test:input":{"delay":10}}`)
+	if rsp.Code != http.StatusNoContent {
+		t.Errorf("reboot: got status %d, want %d: %s", rsp.Code, http.StatusNoContent, rsp.Body)
+	}
+	if delay != "10" {
+		t.Errorf("reboot: got delay %q, want 10", delay)
+	}
+
+	rsp = doRequest(server, "POST", "/restconf/operations/test:ping", "", "")
+	if rsp.Code != http.StatusInternalServerError || !strings.Contains(rsp.Body.String(), "no route to host") {
+		t.Errorf("ping: got status %d body %s, want an operation-failed error", rsp.Code, rsp.Body)
+	}
+
+	if err := server.RegRpc("test:reboot", nil); err == nil {
+		t.Error("registering test:reboot twice succeeded")
+	}
+}
+
+func TestUnknownOperation(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "POST", "/restconf/operations/test:nosuch", "", "")
+	if rsp.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d: %s", rsp.Code, http.StatusNotFound, rsp.Body)
+	}
+	if want := `unknown operation \"test:nosuch\"`; !strings.Contains(rsp.Body.String(), want) {
+		t.Errorf("got body %s, want the message %s", rsp.Body, want)
+	}
+}
+
+func TestRpcNotAcceptable(t *testing.T) {
+	server := testServer(t)
+	var called bool
+	server.RegRpc("test:ping", func(op *Operation) (map[string]interface{}, error) {
+		called = true
+		return map[string]interface{}{"reply": "pong"}, nil
+	})
+
+	// The operation is not run for a client that cannot accept its
+	// output.
+	req := httptest.NewRequest("POST", "/restconf/operations/test:ping", nil)
+	req.Header.Set("Accept", "text/html")
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	if rsp.Code != http.StatusNotAcceptable {
+		t.Errorf("got status %d, want %d: %s", rsp.Code, http.StatusNotAcceptable, rsp.Body)
+	}
+	if called {
+		t.Error("the operation ran for an unacceptable response")
+	}
+}
+
+func TestRpcRegisterWhileServing(t *testing.T) {
+	server := testServer(t)
+	server.RegRpc("test:reboot", func(op *Operation) (map[string]interface{}, error) { return nil, nil })
+
+	// Operations registered while requests are served are safe to invoke.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.RegRpc("test:ping", func(op *Operation) (map[string]interface{}, error) { return nil, nil })
+		server.MarkSafe("test:ping")
+	}()
+	for i := 0; i < 10; i++ {
+		if rsp := doRequest(server, "POST", "/restconf/operations/test:reboot", "", ""); rsp.Code != http.StatusNoContent {
+			t.Fatalf("reboot: got status %d: %s", rsp.Code, rsp.Body)
+		}
+	}
+	<-done
+	if rsp := doRequest(server, "POST", "/restconf/operations/test:ping", "", ""); rsp.Code != http.StatusNoContent {
+		t.Errorf("ping: got status %d: %s", rsp.Code, rsp.Body)
+	}
+}
+
+func TestRpcEmptyBody(t *testing.T) {
+	server := testServer(t)
+
+	calls := 0
+	server.RegRpc("test:ping", func(op *Operation) (map[string]interface{}, error) {
+		calls++
+		return map[string]interface{}{"reply": "pong"}, nil
+	})
+	var input map[string]interface{}
+	server.RegRpc("test:reboot", func(op *Operation) (map[string]interface{}, error) {
+		input = op.Input
+		return nil, nil
+	})
+
+	tests := []struct {
+		name   string
+		url    string
+		ctype  string
+		body   string
+		status int
+	}{
+		{"no input, no body", "/restconf/operations/test:ping", "", "", http.StatusOK},
+		{"no input, blank body", "/restconf/operations/test:ping", APPLICATION_DATA_JSON, " \n", http.StatusOK},
+		{"no input, body", "/restconf/operations/test:ping", APPLICATION_DATA_JSON, `{"test:input":{}}`, http.StatusBadRequest},
+		{"no input, XML body", "/restconf/operations/test:ping", APPLICATION_DATA_XML, `<input xmlns="urn:test"/>`, http.StatusBadRequest},
+		{"input, no body", "/restconf/operations/test:reboot", "", "", http.StatusNoContent},
+		{"input, blank body", "/restconf/operations/test:reboot", APPLICATION_DATA_XML, "\t", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		rsp := doRequest(server, "POST", tt.url, tt.ctype, tt.body)
+		if rsp.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, rsp.Code, tt.status, rsp.Body)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("ping was called %d times, want 2", calls)
+	}
+	if input == nil || len(input) != 0 {
+		t.Errorf("reboot got input %v, want an empty input", input)
+	}
+}
+
+var mandatoryInputModuleText = `
+module mand {
+  namespace "urn:mand";
+  prefix m;
+
+  rpc restart {
+    input {
+      container options {
+        leaf mode {
+          type string;
+          mandatory true;
+        }
+      }
+    }
+  }
+  rpc sync {
+    input {
+      leaf-list peer {
+        type string;
+        min-elements 1;
+      }
+    }
+  }
+}
+`
+
+func TestRpcEmptyBodyMandatory(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"mand": mandatoryInputModuleText}))
+	for _, name := range []string{"restart", "sync"} {
+		server.RegRpc("mand:"+name, func(op *Operation) (map[string]interface{}, error) {
+			return nil, nil
+		})
+	}
+
+	for _, want := range []struct{ rpc, child string }{{"restart", "mode"}, {"sync", "peer"}} {
+		rsp := doRequest(server, "POST", "/restconf/operations/mand:"+want.rpc, "", "")
+		if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), `"missing-element"`) ||
+			!strings.Contains(rsp.Body.String(), "requires "+want.child) {
+			t.Errorf("%s: got status %d body %s, want a missing-element error for %s", want.rpc, rsp.Code, rsp.Body, want.child)
+		}
+	}
+}
+
+func TestRpcTimeout(t *testing.T) {
+	server := testServer(t)
+
+	done := make(chan error, 1)
+	hang := func(op *Operation) (map[string]interface{}, error) {
+		<-op.Context().Done()
+		done <- op.Context().Err()
+		return nil, nil
+	}
+	server.RegRpcTimeout("test:ping", 10*time.Millisecond, hang)
+	server.RegActionTimeout("/test:system/interface/reset", -1, hang)
+	createInterface(t, server, "eth0", 0)
+
+	rsp := doRequest(server, "POST", "/restconf/operations/test:ping", "", "")
+	if rsp.Code != http.StatusInternalServerError || !strings.Contains(rsp.Body.String(), "timed out") {
+		t.Fatalf("ping: got status %d body %s, want an operation-failed error", rsp.Code, rsp.Body)
+	}
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("ping: handler got context error %v", err)
+	}
+
+	// A cancelled request stops the handler, without a timeout, and is
+	// not answered.
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/restconf/data/test:system/interface=eth0,0/reset",
+		strings.NewReader(`{"test:input":{"delay":5}}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+	rsp = httptest.NewRecorder()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	server.ServeHTTP(rsp, req)
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("reset: handler got context error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reset: handler not cancelled, got status %d body %s", rsp.Code, rsp.Body)
+	}
+	if rsp.Body.Len() != 0 {
+		t.Errorf("reset: got body %s for a cancelled request", rsp.Body)
+	}
+}
+
+func TestListOperations(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "GET", "/restconf/operations", "", "")
+	if want := `{"ietf-restconf:operations":{"test:ping":[null],"test:reboot":[null]}}`; rsp.Body.String() != want {
+		t.Errorf("got body %s, want %s", rsp.Body, want)
+	}
+
+	rsp = doRequest(server, "HEAD", "/restconf/operations", "", "")
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != APPLICATION_DATA_JSON || rsp.Body.Len() != 0 {
+		t.Errorf("HEAD: got status %d, Content-Type %q, body %s", rsp.Code, rsp.Header().Get("Content-Type"), rsp.Body)
+	}
+}
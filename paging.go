@@ -0,0 +1,271 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+   Paged retrieval is a vendor extension: a GET of a list or leaf-list with
+   the limit and/or offset query parameters returns at most limit entries
+   starting at entry offset. A Link header with rel="next" holds the absolute
+   URL of the following page, if any.
+
+   GET /restconf/data/example:system/interface?limit=10&offset=20
+
+   The pages of offsets are read from the list as it is at each request, the
+   entries created or deleted meanwhile shift the following ones. The cursor
+   parameter pages over a snapshot of the list instead: cursor=start takes
+   the snapshot and returns its first page, and the next link of each page
+   carries the cursor of the following one.
+
+   GET /restconf/data/example:system/interface?limit=10&cursor=start
+
+   A snapshot expires once it is not read for -cursor-ttl, its cursors are
+   then refused with 410 Gone and the client starts over. Snapshots are held
+   in memory: a user keeps at most -max-user-cursors of them at a time and
+   the server -max-cursors, cursor=start is refused with resource-denied
+   beyond either until one expires.
+*/
+
+var (
+	PAGE_LIMIT_PARAM  = "limit"
+	PAGE_OFFSET_PARAM = "offset"
+	PAGE_CURSOR_PARAM = "cursor"
+	PAGE_CURSOR_START = "start"
+)
+
+var PAGE_CURSOR_TTL = 5 * time.Minute
+
+// MAX_CURSORS bounds the snapshots held by all users and MAX_USER_CURSORS
+// those of each user, 0 for no limit.
+var (
+	MAX_CURSORS      = 1024
+	MAX_USER_CURSORS = 16
+)
+
+// A snapshot is the copy of a list the cursors of a paged read page over.
+type snapshot struct {
+	path    string // escaped path of the list resource
+	user    string // user who took the snapshot
+	values  []interface{}
+	expires time.Time
+}
+
+// cursors holds the snapshots of the paged reads with a cursor by ID.
+type cursors struct {
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+}
+
+// take stores a snapshot of the entries values of the list at path read by
+// user, and returns its ID. It fails if user or the server hold as many
+// snapshots as they may.
+func (c *cursors) take(path, user string, values []interface{}) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.snapshots == nil {
+		c.snapshots = make(map[string]*snapshot)
+	}
+	held := 0
+	for id, s := range c.snapshots {
+		switch {
+		case now.After(s.expires):
+			delete(c.snapshots, id)
+		case s.user == user:
+			held++
+		}
+	}
+	if MAX_USER_CURSORS > 0 && held >= MAX_USER_CURSORS {
+		return "", NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_RESOURCE_DENIED,
+			"too many paged reads with a %s, at most %d are kept for a user", PAGE_CURSOR_PARAM, MAX_USER_CURSORS)
+	}
+	if MAX_CURSORS > 0 && len(c.snapshots) >= MAX_CURSORS {
+		return "", NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_RESOURCE_DENIED,
+			"too many paged reads with a %s, at most %d are kept", PAGE_CURSOR_PARAM, MAX_CURSORS)
+	}
+	id := newRequestID()
+	c.snapshots[id] = &snapshot{path: path, user: user, values: values, expires: now.Add(PAGE_CURSOR_TTL)}
+	return id, nil
+}
+
+// get returns the snapshot id, nil if it expired, extending its lifetime.
+func (c *cursors) get(id string) *snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.snapshots[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if now.After(s.expires) {
+		delete(c.snapshots, id)
+		return nil
+	}
+	s.expires = now.Add(PAGE_CURSOR_TTL)
+	return s
+}
+
+// pageParams returns the offset, limit and cursor query parameters of req.
+// paged is false when none is given, in which case the whole list is
+// returned.
+func pageParams(req *http.Request) (offset, limit int, cursor string, paged bool, err error) {
+	query := rawQuery(req.URL.RawQuery)
+	if s, ok := query[PAGE_CURSOR_PARAM]; ok {
+		_, offsetted := query[PAGE_OFFSET_PARAM]
+		switch {
+		case len(s) != 1 || s[0] == "":
+			return 0, 0, "", false, invalidValue("invalid %s parameter %q", PAGE_CURSOR_PARAM, s[0])
+		case offsetted:
+			return 0, 0, "", false, invalidValue("the %s and %s parameters are exclusive", PAGE_CURSOR_PARAM, PAGE_OFFSET_PARAM)
+		}
+		cursor, paged = s[0], true
+	}
+	for _, p := range []struct {
+		name string
+		v    *int
+		min  int
+	}{
+		{PAGE_OFFSET_PARAM, &offset, 0},
+		{PAGE_LIMIT_PARAM, &limit, 1},
+	} {
+		s, ok := query[p.name]
+		if !ok {
+			continue
+		}
+		paged = true
+		n, cerr := strconv.Atoi(s[0])
+		if len(s) != 1 || cerr != nil || n < p.min {
+			return 0, 0, "", false, invalidValue("invalid %s parameter %q", p.name, s[0])
+		}
+		*p.v = n
+	}
+	return offset, limit, cursor, paged, nil
+}
+
+// readPage returns the page of the list or leaf-list at r selected by offset
+// and limit, or by cursor and limit, in the form readData does, and links the
+// next page from rsp.
+func (restconf *RestConf) readPage(rsp http.ResponseWriter, req *http.Request, r *Resource, offset, limit int, cursor string) (interface{}, error) {
+	e := r.Entry()
+	if (!e.IsList() && !e.IsLeafList()) || r.Segment().Keys != nil {
+		return nil, invalidValue("%s is not a list, only lists can be paged", e.Name)
+	}
+
+	if !restconf.permit(req, ACCESS_READ, e) {
+		return nil, dataMissing(r)
+	}
+	if cursor != "" {
+		return restconf.readCursor(rsp, req, r, cursor, limit)
+	}
+	var page []interface{}
+	var total int
+	var ok bool
+	if restconf.hasState(r) {
+		var err error
+		if page, total, ok, err = restconf.statePage(req, r, offset, limit); err != nil {
+			return nil, err
+		}
+	} else {
+		page, total, ok = restconf.store.GetPage(r, offset, limit)
+	}
+	if !ok {
+		return nil, dataMissing(r)
+	}
+
+	if next := offset + len(page); limit > 0 && next < total {
+		query := rawQuery(req.URL.RawQuery)
+		query.Set(PAGE_OFFSET_PARAM, strconv.Itoa(next))
+		query.Set(PAGE_LIMIT_PARAM, strconv.Itoa(limit))
+		rsp.Header().Add("Link", "<"+absoluteURL(req, req.URL.EscapedPath(), query)+`>; rel="next"`)
+	}
+
+	return restconf.filterRead(req, e, page), nil
+}
+
+// readCursor returns the page of the list or leaf-list at r selected by
+// cursor and limit, in the form readData does, and links the next page from
+// rsp.
+func (restconf *RestConf) readCursor(rsp http.ResponseWriter, req *http.Request, r *Resource, cursor string, limit int) (interface{}, error) {
+	var id string
+	var offset int
+	var values []interface{}
+	path, user := req.URL.EscapedPath(), requestUser(req)
+	if cursor == PAGE_CURSOR_START {
+		var v interface{}
+		var ok bool
+		if restconf.hasState(r) {
+			var err error
+			if v, ok, err = restconf.readState(req, r); err != nil {
+				return nil, err
+			}
+		} else {
+			v, ok = restconf.store.Get(r)
+		}
+		if !ok {
+			return nil, dataMissing(r)
+		}
+		values, _ = v.([]interface{})
+		var err error
+		if id, err = restconf.cursors.take(path, user, values); err != nil {
+			return nil, err
+		}
+	} else {
+		i := strings.LastIndex(cursor, ".")
+		n, err := strconv.Atoi(cursor[i+1:])
+		if i <= 0 || err != nil || n < 0 {
+			return nil, invalidValue("invalid %s parameter %q", PAGE_CURSOR_PARAM, cursor)
+		}
+		id, offset = cursor[:i], n
+		s := restconf.cursors.get(id)
+		if s == nil {
+			return nil, NewError(http.StatusGone, ERROR_TYPE_PROTOCOL, ERROR_TAG_INVALID_VALUE,
+				"the %s %q expired, start over with %s=%s", PAGE_CURSOR_PARAM, cursor, PAGE_CURSOR_PARAM, PAGE_CURSOR_START)
+		}
+		// The snapshot is only paged by its list and the user who took it.
+		if s.path != path || s.user != user {
+			return nil, invalidValue("the %s %q does not page %s", PAGE_CURSOR_PARAM, cursor, r.Entry().Name)
+		}
+		values = s.values
+	}
+
+	total := len(values)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	page, _ := copyTree(values[offset:end]).([]interface{})
+
+	if end < total {
+		query := rawQuery(req.URL.RawQuery)
+		query.Set(PAGE_CURSOR_PARAM, id+"."+strconv.Itoa(end))
+		query.Set(PAGE_LIMIT_PARAM, strconv.Itoa(limit))
+		rsp.Header().Add("Link", "<"+absoluteURL(req, req.URL.EscapedPath(), query)+`>; rel="next"`)
+	}
+
+	return restconf.filterRead(req, r.Entry(), page), nil
+}
+
+// absoluteURL returns the absolute URL of the escaped path with the query
+// query on the server req was sent to.
+func absoluteURL(req *http.Request, path string, query url.Values) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	u := scheme + "://" + req.Host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
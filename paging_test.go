@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPagedList(t *testing.T) {
+	server := testServer(t)
+	for i := 0; i < 5; i++ {
+		rsp := doRequest(server, "POST", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			fmt.Sprintf(`{"test:interface":[{"name":"eth%d","unit":0}]}`, i))
+		if rsp.Code != http.StatusCreated {
+			t.Fatalf("POST: got status %d: %s", rsp.Code, rsp.Body)
+		}
+	}
+
+	entries := func(names ...int) string {
+		s := `{"test:interface":[`
+		for i, n := range names {
+			if i > 0 {
+				s += ","
+			}
+			s += fmt.Sprintf(`{"name":"eth%d","unit":0}`, n)
+		}
+		return s + `]}`
+	}
+
+	for _, test := range []struct {
+		query  string
+		status int
+		want   string
+		next   string
+	}{
+		{"", http.StatusOK, entries(0, 1, 2, 3, 4), ""},
+		{"?limit=2", http.StatusOK, entries(0, 1), "http://example.com/restconf/data/test:system/interface?limit=2&offset=2"},
+		{"?limit=2&offset=2", http.StatusOK, entries(2, 3), "http://example.com/restconf/data/test:system/interface?limit=2&offset=4"},
+		{"?offset=4&limit=2", http.StatusOK, entries(4), ""},
+		{"?limit=4&fields=name;unit", http.StatusOK, entries(0, 1, 2, 3), "http://example.com/restconf/data/test:system/interface?fields=name%3Bunit&limit=4&offset=4"},
+		{"?fields=name%3Bunit&limit=4&offset=4", http.StatusOK, entries(4), ""},
+		{"?offset=3", http.StatusOK, entries(3, 4), ""},
+		{"?offset=9", http.StatusOK, entries(), ""},
+		{"?limit=0", http.StatusBadRequest, "", ""},
+		{"?offset=-1", http.StatusBadRequest, "", ""},
+		{"?limit=x", http.StatusBadRequest, "", ""},
+	} {
+		url := "/restconf/data/test:system/interface" + test.query
+		rsp := doRequest(server, "GET", url, "", "")
+		if rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", url, rsp.Code, test.status, rsp.Body)
+			continue
+		}
+		if test.want != "" && rsp.Body.String() != test.want {
+			t.Errorf("GET %s: got %s, want %s", url, rsp.Body, test.want)
+		}
+		if got := linkTarget(rsp.Header(), "next"); got != test.next {
+			t.Errorf("GET %s: got next page %q, want %q", url, got, test.next)
+		}
+	}
+
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system?limit=1", "", ""); rsp.Code != http.StatusBadRequest {
+		t.Errorf("GET of a paged container: got status %d, want %d", rsp.Code, http.StatusBadRequest)
+	}
+}
+
+// linkTarget returns the target of the Link header with relation rel.
+func linkTarget(h http.Header, rel string) string {
+	for _, link := range h["Link"] {
+		if strings.HasSuffix(link, `>; rel="`+rel+`"`) && strings.HasPrefix(link, "<") {
+			return link[1:strings.Index(link, ">")]
+		}
+	}
+	return ""
+}
+
+func TestCursorPages(t *testing.T) {
+	server := testServer(t)
+	post := func(i int) {
+		rsp := doRequest(server, "POST", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+			fmt.Sprintf(`{"test:interface":[{"name":"eth%d","unit":0}]}`, i))
+		if rsp.Code != http.StatusCreated {
+			t.Fatalf("POST: got status %d: %s", rsp.Code, rsp.Body)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		post(i)
+	}
+
+	// The entries created while paging are not in the snapshot.
+	var got []string
+	var cursor string
+	url := "/restconf/data/test:system/interface?limit=2&cursor=start"
+	for n := 0; url != ""; n++ {
+		rsp := doRequest(server, "GET", url, "", "")
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d: %s", url, rsp.Code, rsp.Body)
+		}
+		got = append(got, rsp.Body.String())
+		post(10 + n)
+		cursor = url
+		url = strings.TrimPrefix(linkTarget(rsp.Header(), "next"), "http://example.com")
+	}
+	want := []string{
+		`{"test:interface":[{"name":"eth0","unit":0},{"name":"eth1","unit":0}]}`,
+		`{"test:interface":[{"name":"eth2","unit":0},{"name":"eth3","unit":0}]}`,
+		`{"test:interface":[{"name":"eth4","unit":0}]}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got pages\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, test := range []struct {
+		url    string
+		status int
+	}{
+		{"/restconf/data/test:system/interface?cursor=start&offset=1", http.StatusBadRequest},
+		{"/restconf/data/test:system/interface?cursor=", http.StatusBadRequest},
+		{"/restconf/data/test:system/interface?cursor=x", http.StatusBadRequest},
+		{"/restconf/data/test:system/interface?cursor=0123.x", http.StatusBadRequest},
+		{"/restconf/data/test:system/interface?cursor=0123.2", http.StatusGone},
+		{cursor, http.StatusOK},
+	} {
+		if rsp := doRequest(server, "GET", test.url, "", ""); rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", test.url, rsp.Code, test.status, rsp.Body)
+		}
+	}
+
+	// The link to the next page keeps the other parameters.
+	rsp := doRequest(server, "GET", "/restconf/data/test:system/interface?limit=2&cursor=start&fields=name;unit", "", "")
+	if next := linkTarget(rsp.Header(), "next"); !strings.Contains(next, "fields=name%3Bunit") {
+		t.Errorf("got next page %q, want it to keep the fields parameter", next)
+	}
+
+	defer func(ttl time.Duration) { PAGE_CURSOR_TTL = ttl }(PAGE_CURSOR_TTL)
+	PAGE_CURSOR_TTL = time.Millisecond
+	rsp = doRequest(server, "GET", "/restconf/data/test:system/interface?limit=2&cursor=start", "", "")
+	next := strings.TrimPrefix(linkTarget(rsp.Header(), "next"), "http://example.com")
+	time.Sleep(10 * time.Millisecond)
+	if rsp := doRequest(server, "GET", next, "", ""); rsp.Code != http.StatusGone {
+		t.Errorf("GET %s after the TTL: got status %d, want %d: %s", next, rsp.Code, http.StatusGone, rsp.Body)
+	}
+}
+
+func TestCursorLimits(t *testing.T) {
+	defer func(n, user int) { MAX_CURSORS, MAX_USER_CURSORS = n, user }(MAX_CURSORS, MAX_USER_CURSORS)
+	MAX_CURSORS, MAX_USER_CURSORS = 3, 2
+
+	var c cursors
+	for _, step := range []struct {
+		user string
+		ok   bool
+	}{
+		{"alice", true},
+		{"alice", true},
+		{"alice", false},
+		{"bob", true},
+		{"carol", false},
+	} {
+		_, err := c.take("/restconf/data/test:system/interface", step.user, nil)
+		if (err == nil) != step.ok {
+			t.Fatalf("snapshot of %s: got %v, want ok %v", step.user, err, step.ok)
+		}
+		if err != nil && err.(*RestConfError).Tag != ERROR_TAG_RESOURCE_DENIED {
+			t.Errorf("snapshot of %s: got %v, want resource-denied", step.user, err)
+		}
+	}
+
+	// Expired snapshots no longer count.
+	for _, s := range c.snapshots {
+		s.expires = time.Now().Add(-time.Second)
+	}
+	if _, err := c.take("/restconf/data/test:system/interface", "carol", nil); err != nil {
+		t.Errorf("snapshot after the others expired: %v", err)
+	}
+
+	server := testServer(t)
+	if rsp := doRequest(server, "POST", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:interface":[{"name":"eth0","unit":0}]}`); rsp.Code != http.StatusCreated {
+		t.Fatalf("POST: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	url := "/restconf/data/test:system/interface?limit=1&cursor=start"
+	for i, status := range []int{http.StatusOK, http.StatusOK, http.StatusConflict} {
+		if rsp := doRequest(server, "GET", url, "", ""); rsp.Code != status {
+			t.Errorf("GET %s #%d: got status %d, want %d: %s", url, i, rsp.Code, status, rsp.Body)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+// MAX_URI_LEN is the longest request URI served, path and query, 0 for no
+// limit. Longer ones are refused with 414 before their path is parsed.
+var MAX_URI_LEN = 16384
+
+// uriTooLong returns the error of a request whose URI is longer than
+// MAX_URI_LEN, nil if it is not.
+func uriTooLong(req *http.Request) error {
+	uri := req.RequestURI
+	if uri == "" {
+		uri = req.URL.RequestURI()
+	}
+	if MAX_URI_LEN > 0 && len(uri) > MAX_URI_LEN {
+		return NewError(http.StatusRequestURITooLong, ERROR_TYPE_PROTOCOL, ERROR_TAG_TOO_BIG,
+			"the request URI is %d bytes long, at most %d are served", len(uri), MAX_URI_LEN)
+	}
+	return nil
+}
+
+// A PathSegment is one api-segment of a RESTCONF resource path, as defined in
+// RFC 8040 section 3.5.3:
+//
+//	api-segment = list-instance / api-identifier
+//	api-identifier = [module-name ":"] identifier
+//	list-instance = api-identifier "=" key-value *("," key-value)
+type PathSegment struct {
+	Module string   // module name, "" if the segment is not qualified
+	Name   string   // node identifier
+	Keys   []string // decoded key values, nil if the segment has no "="
+}
+
+// String returns the segment in its URI form, keys percent-encoded.
+func (seg PathSegment) String() string {
+	s := seg.Name
+	if seg.Module != "" {
+		s = seg.Module + ":" + s
+	}
+	for i, key := range seg.Keys {
+		if i == 0 {
+			s += "="
+		} else {
+			s += ","
+		}
+		s += url.PathEscape(key)
+	}
+	return s
+}
+
+// A PathError is an error in a resource path. A malformed path is not an
+// api-path at all (RFC 8040 section 3.5.3) and fails with malformed-message,
+// a well-formed path naming no node of the schema with unknown-element, both
+// client errors. A path to a node of the schema without an instance is no
+// PathError, it fails with 404 data-missing.
+type PathError struct {
+	Malformed bool
+	Message   string
+}
+
+func malformedPath(format string, args ...interface{}) *PathError {
+	return &PathError{Malformed: true, Message: fmt.Sprintf(format, args...)}
+}
+
+func unknownPath(format string, args ...interface{}) *PathError {
+	return &PathError{Message: fmt.Sprintf(format, args...)}
+}
+
+// restconfError returns the RESTCONF error err is sent as.
+func (err *PathError) restconfError() *RestConfError {
+	if err.Malformed {
+		return NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL, ERROR_TAG_MALFORMED_MESSAGE, "%s", err.Message)
+	}
+	return NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL, ERROR_TAG_UNKNOWN_ELEMENT, "%s", err.Message)
+}
+
+func (err *PathError) Error() string {
+	return err.restconfError().Error()
+}
+
+// ParsePath splits the escaped resource path p, relative to the data or
+// operations resource, into its segments. A segment is split on its first
+// "=" into the api-identifier and its key values, and the api-identifier on
+// its first ":" into the module and node names, before each part is
+// percent-decoded: an encoded "=" or ":" belongs to the part it is in, and
+// encoded "/" and "," characters of key values survive. Empty segments, bad
+// percent-encodings, XPath predicates and names that are no YANG identifiers
+// make the path malformed.
+func ParsePath(p string) ([]PathSegment, error) {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil, nil
+	}
+
+	var segs []PathSegment
+	for _, raw := range strings.Split(p, "/") {
+		var seg PathSegment
+
+		ident := raw
+		if i := strings.Index(raw, "="); i >= 0 {
+			ident = raw[:i]
+			for _, key := range strings.Split(raw[i+1:], ",") {
+				value, err := url.PathUnescape(key)
+				if err != nil {
+					return nil, malformedPath("invalid percent-encoding in key value %q", key)
+				}
+				seg.Keys = append(seg.Keys, value)
+			}
+		}
+
+		mod, name, qualified := "", ident, false
+		if i := strings.Index(ident, ":"); i >= 0 {
+			mod, name, qualified = ident[:i], ident[i+1:], true
+		}
+		mod, merr := url.PathUnescape(mod)
+		name, err := url.PathUnescape(name)
+		switch {
+		case raw == "":
+			return nil, malformedPath("empty path segment")
+		case err != nil || merr != nil:
+			return nil, malformedPath("invalid percent-encoding in path segment %q", raw)
+		case strings.Count(mod+name, "[") != strings.Count(mod+name, "]"):
+			return nil, malformedPath("unbalanced predicate in path segment %q", raw)
+		case strings.ContainsAny(mod+name, "[]"):
+			return nil, malformedPath("predicate in path segment %q, list keys are given with \"=\"", raw)
+		case qualified && !isIdentifier(mod):
+			return nil, malformedPath("invalid module name in path segment %q", raw)
+		case !isIdentifier(name):
+			return nil, malformedPath("invalid identifier in path segment %q", raw)
+		}
+		seg.Module, seg.Name = mod, name
+
+		segs = append(segs, seg)
+	}
+
+	return segs, nil
+}
+
+// isIdentifier reports whether s is a YANG identifier (RFC 7950 section
+// 6.2).
+func isIdentifier(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && (c == '-' || c == '.' || '0' <= c && c <= '9'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// A Resource is a resource path resolved against the schema.
+type Resource struct {
+	Segments []PathSegment
+	Entries  []*yang.Entry // the schema node addressed by each segment
+}
+
+// Entry returns the schema node the resource addresses.
+func (r *Resource) Entry() *yang.Entry {
+	return r.Entries[len(r.Entries)-1]
+}
+
+// Segment returns the last segment of the resource path.
+func (r *Resource) Segment() PathSegment {
+	return r.Segments[len(r.Segments)-1]
+}
+
+// Parent returns the resource one level up, or nil for a top-level node.
+func (r *Resource) Parent() *Resource {
+	if len(r.Segments) < 2 {
+		return nil
+	}
+	n := len(r.Segments) - 1
+	return &Resource{Segments: r.Segments[:n], Entries: r.Entries[:n]}
+}
+
+// URL returns the path of the data resource r, the datastore resource
+// followed by the segments of r with their keys percent-encoded (RFC 8040
+// section 3.5.3), as sent in a Location header.
+func (r *Resource) URL() string {
+	segs := make([]string, 0, len(r.Segments))
+	for _, seg := range r.Segments {
+		segs = append(segs, seg.String())
+	}
+	return RESTCONF_PREFIX + "/data/" + strings.Join(segs, "/")
+}
+
+// An InstanceKey holds the key values of one list instance on a resource
+// path.
+type InstanceKey struct {
+	List   string            // list node name
+	Values map[string]string // key leaf name to value
+}
+
+// InstanceKeys returns the keys of every list instance on the path, from the
+// outermost list inwards.
+func (r *Resource) InstanceKeys() []InstanceKey {
+	var keys []InstanceKey
+	for i, e := range r.Entries {
+		if !e.IsList() || r.Segments[i].Keys == nil {
+			continue
+		}
+		key := InstanceKey{List: e.Name, Values: make(map[string]string)}
+		for j, name := range keyNames(e) {
+			key.Values[name] = r.Segments[i].Keys[j]
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// errorPath returns the error-path of the instance of e below the data node
+// at, nil for a top-level node. values are the keys of a list entry or the
+// value of a leaf-list, the path addresses all instances of e if they are
+// nil.
+func (schema *Schema) errorPath(at *ErrorPath, e *yang.Entry, values []string) *ErrorPath {
+	n := pathNode{module: schema.ModuleOf(e), namespace: e.Namespace().Name, name: e.Name}
+	switch {
+	case values == nil:
+	case e.IsLeafList() && len(values) == 1:
+		n.keys, n.values = []string{"."}, values
+	case e.IsList() && len(values) == len(keyNames(e)):
+		n.keys, n.values = keyNames(e), values
+	}
+
+	p := &ErrorPath{}
+	if at != nil {
+		p.nodes = at.nodes[:len(at.nodes):len(at.nodes)]
+	}
+	p.nodes = append(p.nodes, n)
+	return p
+}
+
+// resourcePath returns the error-path of the data node r addresses, nil if
+// r is nil.
+func (schema *Schema) resourcePath(r *Resource) *ErrorPath {
+	var p *ErrorPath
+	if r != nil {
+		for i, e := range r.Entries {
+			p = schema.errorPath(p, e, r.Segments[i].Keys)
+		}
+	}
+	return p
+}
+
+// Resolve looks up the schema node of every segment of segs. The first
+// segment must be qualified with its module name, the others take the module
+// of the segment above unless they are qualified, as they must be where the
+// path crosses into the nodes of another module (RFC 8040 section 3.5.3).
+// Below a mount point the path descends into the nodes of the mounted
+// schema, its top-level nodes qualified with their module.
+func (schema *Schema) Resolve(segs []PathSegment) (*Resource, error) {
+	r := &Resource{Segments: append([]PathSegment(nil), segs...)}
+
+	var parent *yang.Entry
+	var key string
+	for i, seg := range segs {
+		switch {
+		case i == 0:
+			if _, ok := schema.Modules[seg.Module]; seg.Module == "" || !ok {
+				return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+					ERROR_TAG_UNKNOWN_NAMESPACE, "unknown module %q", seg.Module)
+			}
+			// The nodes of a hidden module do not exist for the clients.
+			if schema.hidden[seg.Module] {
+				return nil, unknownPath("unknown data node %q", seg.Name)
+			}
+			key = "/" + seg.Module
+		case isOperation(parent):
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_INVALID_VALUE, "%s is an operation and has no data nodes", parent.Name)
+		}
+		key += "/" + seg.Name
+		e := schema.index[key]
+
+		if e == nil || isNotification(e) || (isOperation(e) && !isAction(e)) {
+			return nil, unknownPath("unknown data node %q", seg.Name)
+		}
+		if seg.Module != "" && seg.Module != schema.ModuleOf(e) {
+			return nil, unknownPath("data node %q is not defined in module %q", seg.Name, seg.Module)
+		}
+		if mod := schema.ModuleOf(e); seg.Module == "" && mod != schema.ModuleOf(parent) {
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_INVALID_VALUE, "data node %q must be qualified with module %q", seg.Name, mod)
+		}
+
+		last := i == len(segs)-1
+		switch {
+		case e.IsList() && seg.Keys == nil && !last:
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_MISSING_ATTRIBUTE, "list %q requires the values of its keys %s", e.Name,
+				strings.Join(keyNames(e), ", "))
+		case e.IsList() && seg.Keys != nil && len(seg.Keys) != len(keyNames(e)):
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_INVALID_VALUE, "list %q has %d keys, %s, got %d values in %q", e.Name, len(keyNames(e)),
+				strings.Join(keyNames(e), ", "), len(seg.Keys), seg.String())
+		case e.IsLeafList() && seg.Keys != nil && len(seg.Keys) != 1:
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_INVALID_VALUE, "leaf-list %q takes a single value", e.Name)
+		case !e.IsList() && !e.IsLeafList() && seg.Keys != nil:
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL,
+				ERROR_TAG_INVALID_VALUE, "%q is not a list", e.Name)
+		}
+		if seg.Keys != nil {
+			keys, err := keyValues(e, seg.Keys)
+			if err != nil {
+				return nil, err
+			}
+			r.Segments[i].Keys = keys
+		}
+
+		r.Entries = append(r.Entries, e)
+		parent = e
+	}
+
+	return r, nil
+}
+
+// keyValues checks the key values keys of a list entry or leaf-list value of
+// e given in a path and returns them in their canonical form, the form the
+// data holds them in.
+func keyValues(e *yang.Entry, keys []string) ([]string, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		leaf := e
+		if e.IsList() {
+			leaf = findDataChild(e, keyNames(e)[i])
+		}
+		if leaf == nil {
+			values[i] = key
+			continue
+		}
+		v, err := leafValue(leaf, key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var baseModuleText = `
+module base {
+  namespace "urn:base";
+  prefix b;
+
+  container system {
+    leaf hostname { type string; }
+  }
+}
+`
+
+var extModuleText = `
+module ext {
+  namespace "urn:ext";
+  prefix e;
+
+  import base { prefix b; }
+
+  augment "/b:system" {
+    container stats {
+      leaf packets { type uint64; }
+    }
+  }
+}
+`
+
+func TestResolveNamespaces(t *testing.T) {
+	schema := testSchema(t, map[string]string{"base": baseModuleText, "ext": extModuleText})
+
+	tests := []struct {
+		path   string
+		status int // 0 if the path resolves
+		module string
+	}{
+		{"base:system/hostname", 0, "base"},
+		{"base:system/base:hostname", 0, "base"},
+		{"base:system/ext:stats", 0, "ext"},
+		{"base:system/ext:stats/packets", 0, "ext"},
+		{"base:system/ext:stats/ext:packets", 0, "ext"},
+		{"system/hostname", http.StatusBadRequest, ""},
+		{"base:system/stats", http.StatusBadRequest, ""},
+		{"base:system/ext:stats/base:packets", http.StatusBadRequest, ""},
+		{"base:system/ext:hostname", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		segs, err := ParsePath(tt.path)
+		if err != nil {
+			t.Fatalf("ParsePath(%s): %v", tt.path, err)
+		}
+		r, err := schema.Resolve(segs)
+		if tt.status != 0 {
+			var errs ErrorList
+			errs.add(err)
+			if err == nil || errs.status() != tt.status {
+				t.Errorf("Resolve(%s): got error %v, want status %d", tt.path, err, tt.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%s): %v", tt.path, err)
+			continue
+		}
+		if got := schema.ModuleOf(r.Entry()); got != tt.module {
+			t.Errorf("Resolve(%s): got module %s, want %s", tt.path, got, tt.module)
+		}
+	}
+}
+
+func TestPathErrors(t *testing.T) {
+	schema := testSchema(t, map[string]string{"base": baseModuleText, "test": testModuleText})
+
+	tests := []struct {
+		path   string
+		status int
+		tag    string
+	}{
+		{"test:system//hostname", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:system/interface[name='eth0'", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:system/interface[name='eth0']", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:system/interface=eth0,%zz", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:sys%zztem", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:1system", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{":system", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test%3Asystem", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:system%3Ahostname", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:system/interface%3Deth0,0", http.StatusBadRequest, ERROR_TAG_MALFORMED_MESSAGE},
+		{"test:system/interface=", http.StatusBadRequest, ERROR_TAG_INVALID_VALUE},
+		{"base:nonexistent", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+		{"base:system/test:hostname", http.StatusBadRequest, ERROR_TAG_UNKNOWN_ELEMENT},
+	}
+
+	for _, tt := range tests {
+		segs, err := ParsePath(tt.path)
+		if err == nil {
+			_, err = schema.Resolve(segs)
+		}
+		var errs ErrorList
+		errs.add(err)
+		if err == nil || errs.status() != tt.status || errs[0].Tag != tt.tag {
+			t.Errorf("%s: got error %v, want status %d %s", tt.path, err, tt.status, tt.tag)
+		}
+	}
+}
+
+func TestKeyCountErrors(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+
+	tests := []struct {
+		path string
+		tag  string
+		want string
+	}{
+		{"test:system/interface=eth0", ERROR_TAG_INVALID_VALUE, `list "interface" has 2 keys, name, unit, got 1 values in "interface=eth0"`},
+		{"test:system/interface=eth0,0,1", ERROR_TAG_INVALID_VALUE, `list "interface" has 2 keys, name, unit, got 3 values`},
+		{"test:system/interface/mtu", ERROR_TAG_MISSING_ATTRIBUTE, `list "interface" requires the values of its keys name, unit`},
+		// The key count fails the path before the unknown node below the list.
+		{"test:system/interface=eth0/bogus", ERROR_TAG_INVALID_VALUE, `list "interface" has 2 keys`},
+	}
+
+	for _, tt := range tests {
+		segs, err := ParsePath(tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		_, err = schema.Resolve(segs)
+		rerr, ok := err.(*RestConfError)
+		if !ok || rerr.Status != http.StatusBadRequest || rerr.Tag != tt.tag || !strings.Contains(rerr.Message, tt.want) {
+			t.Errorf("%s: got error %v, want a %s error holding %q", tt.path, err, tt.tag, tt.want)
+		}
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+
+	// Key values are checked against the type of their key leaf and take
+	// their canonical form.
+	for path, want := range map[string]string{
+		"test:system/interface=eth0,01":    "/restconf/data/test:system/interface=eth0,1",
+		"test:system/interface=eth0,002":   "/restconf/data/test:system/interface=eth0,2",
+		"test:system/interface=eth0,0/mtu": "/restconf/data/test:system/interface=eth0,0/mtu",
+	} {
+		segs, err := ParsePath(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		r, err := schema.Resolve(segs)
+		if err != nil || r.URL() != want {
+			t.Errorf("%s: got %v, %v, want %s", path, r, err, want)
+		}
+	}
+
+	for _, path := range []string{
+		"test:system/interface=eth0,abc",
+		"test:system/interface=eth0,256",
+		"test:system/interface=eth0,-1/mtu",
+	} {
+		segs, err := ParsePath(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		_, err = schema.Resolve(segs)
+		rerr, ok := err.(*RestConfError)
+		if !ok || rerr.Status != http.StatusBadRequest || rerr.Tag != ERROR_TAG_INVALID_VALUE {
+			t.Errorf("%s: got error %v, want a 400 %s error", path, err, ERROR_TAG_INVALID_VALUE)
+		}
+	}
+}
+
+func TestParseEncodedPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []PathSegment
+	}{
+		{"t%65st:system", []PathSegment{{Module: "test", Name: "system"}}},
+		{"test:sys%74em/host%6Eame", []PathSegment{{Module: "test", Name: "system"}, {Name: "hostname"}}},
+		{"test:system/interface=a%3Ab,0", []PathSegment{{Module: "test", Name: "system"}, {Name: "interface", Keys: []string{"a:b", "0"}}}},
+		{"test:system/interface=a:b%2C%3D,0", []PathSegment{{Module: "test", Name: "system"}, {Name: "interface", Keys: []string{"a:b,=", "0"}}}},
+		{"test:system/test:interface=%2F,", []PathSegment{{Module: "test", Name: "system"}, {Module: "test", Name: "interface", Keys: []string{"/", ""}}}},
+	}
+
+	for _, tt := range tests {
+		segs, err := ParsePath(tt.path)
+		if err != nil {
+			t.Errorf("ParsePath(%s): %v", tt.path, err)
+			continue
+		}
+		if fmt.Sprint(segs) != fmt.Sprint(tt.want) {
+			t.Errorf("ParsePath(%s): got %q, want %q", tt.path, segs, tt.want)
+		}
+	}
+}
+
+func TestURITooLong(t *testing.T) {
+	server := testServer(t)
+	defer func(n int) { MAX_URI_LEN = n }(MAX_URI_LEN)
+	MAX_URI_LEN = 64
+
+	for _, tt := range []struct {
+		uri    string
+		status int
+	}{
+		{"/restconf/data/test:system", http.StatusNotFound},
+		{"/restconf/data/test:system/interface=" + strings.Repeat("x", 64), http.StatusRequestURITooLong},
+		{"/restconf/data/test:system?fields=" + strings.Repeat("hostname;", 8), http.StatusRequestURITooLong},
+		{"/restconf/data/test:system.xml?depth=" + strings.Repeat("1", 64), http.StatusRequestURITooLong},
+	} {
+		rsp := doRequest(server, "GET", tt.uri, "", "")
+		if rsp.Code != tt.status {
+			t.Errorf("GET %s: got status %d, want %d", tt.uri, rsp.Code, tt.status)
+		}
+		if tt.status == http.StatusRequestURITooLong && !strings.Contains(rsp.Body.String(), `"error-tag":"`+ERROR_TAG_TOO_BIG+`"`) {
+			t.Errorf("GET %s: got body %s", tt.uri, rsp.Body)
+		}
+	}
+
+	MAX_URI_LEN = 0
+	uri := "/restconf/data/test:system/interface=" + strings.Repeat("x", 1024) + ",0"
+	if rsp := doRequest(server, "GET", uri, "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET without a limit: got status %d, want %d", rsp.Code, http.StatusNotFound)
+	}
+}
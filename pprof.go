@@ -0,0 +1,69 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+/*
+   The runtime profiles of net/http/pprof are served under /debug/pprof when
+   the -pprof flag names a listen address. They are served by a listener of
+   their own, which must be bound to a loopback address, and never by the
+   RESTCONF server itself:
+
+   restconf -pprof 127.0.0.1:6060
+   go tool pprof http://127.0.0.1:6060/debug/pprof/profile
+
+   The expvar variables, e.g. the statistics of the state cache, are served
+   as JSON at /debug/vars.
+*/
+
+var (
+	PPROF_PREFIX = "/debug/pprof/"
+	EXPVAR_PATH  = "/debug/vars"
+)
+
+// pprofHandler returns the handler of the profiling endpoints.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PPROF_PREFIX, pprof.Index)
+	mux.HandleFunc(PPROF_PREFIX+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PPROF_PREFIX+"profile", pprof.Profile)
+	mux.HandleFunc(PPROF_PREFIX+"symbol", pprof.Symbol)
+	mux.HandleFunc(PPROF_PREFIX+"trace", pprof.Trace)
+	mux.Handle(EXPVAR_PATH, expvar.Handler())
+	return mux
+}
+
+// loopbackAddr checks that the listen address addr is bound to a loopback
+// address, "localhost" or an address of 127.0.0.0/8 or ::1.
+func loopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("pprof address %s is not a loopback address", addr)
+	}
+	return nil
+}
+
+// listenPprof starts serving the profiling endpoints on the loopback address
+// addr.
+func listenPprof(addr string) error {
+	if err := loopbackAddr(addr); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go http.Serve(ln, pprofHandler())
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		"localhost:6060": true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.1:6060":  false,
+		"127.0.0.1":      false,
+	} {
+		if err := loopbackAddr(addr); (err == nil) != ok {
+			t.Errorf("loopbackAddr(%q): got %v, want ok %v", addr, err, ok)
+		}
+	}
+}
+
+func TestPprofHandler(t *testing.T) {
+	rsp := httptest.NewRecorder()
+	pprofHandler().ServeHTTP(rsp, httptest.NewRequest("GET", PPROF_PREFIX, nil))
+	if rsp.Code != http.StatusOK {
+		t.Errorf("GET %s: got status %d, want %d", PPROF_PREFIX, rsp.Code, http.StatusOK)
+	}
+
+	// The RESTCONF server never serves the profiles.
+	if rsp := doRequest(testServer(t), "GET", PPROF_PREFIX, "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET %s of the RESTCONF server: got status %d, want %d", PPROF_PREFIX, rsp.Code, http.StatusNotFound)
+	}
+}
+
+func TestExpvarHandler(t *testing.T) {
+	rsp := httptest.NewRecorder()
+	pprofHandler().ServeHTTP(rsp, httptest.NewRequest("GET", EXPVAR_PATH, nil))
+	if rsp.Code != http.StatusOK || !strings.Contains(rsp.Body.String(), `"state-cache"`) {
+		t.Errorf("GET %s: got status %d, %s", EXPVAR_PATH, rsp.Code, rsp.Body)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+   Behind a layer 4 load balancer the server only sees the address of the
+   balancer. With the -proxy-protocol flag every connection must start with
+   a PROXY protocol header, version 1 (text) or 2 (binary), naming the
+   address of the client the balancer accepted the connection from:
+
+   PROXY TCP4 192.0.2.10 198.51.100.1 51234 443\r\n
+
+   The header is trusted, the flag must only be set when all connections come
+   from a balancer sending it. A connection without a valid header is closed.
+*/
+
+var (
+	PROXY_V1_PREFIX      = "PROXY "
+	PROXY_V1_MAX_LEN     = 107 // the longest version 1 header, CRLF included
+	PROXY_V2_SIGNATURE   = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	PROXY_HEADER_TIMEOUT = 10 * time.Second
+)
+
+// A proxyListener accepts the connections of a listener with a PROXY
+// protocol header.
+type proxyListener struct {
+	net.Listener
+}
+
+// ProxyListener returns a listener reading the PROXY protocol header of the
+// connections ln accepts. The remote address of a connection, and so the
+// RemoteAddr of its requests, is the client address of its header.
+func ProxyListener(ln net.Listener) net.Listener {
+	return &proxyListener{ln}
+}
+
+func (ln *proxyListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// A proxyConn is a connection starting with a PROXY protocol header. The
+// header is read by the first Read or RemoteAddr, in the goroutine serving
+// the connection rather than the one accepting connections.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr // the client address of the header, nil for the address of the connection
+	err    error    // the error reading the header
+}
+
+func (conn *proxyConn) readHeader() {
+	conn.once.Do(func() {
+		conn.SetReadDeadline(time.Now().Add(PROXY_HEADER_TIMEOUT))
+		conn.remote, conn.err = readProxyHeader(conn.reader)
+		conn.SetReadDeadline(time.Time{})
+		if conn.err != nil {
+			// The connection is refused, without an answer the client
+			// could take for one of the server.
+			log.Println("proxy protocol:", conn.Conn.RemoteAddr(), conn.err)
+			conn.Conn.Close()
+		}
+	})
+}
+
+func (conn *proxyConn) Read(b []byte) (int, error) {
+	conn.readHeader()
+	if conn.err != nil {
+		return 0, conn.err
+	}
+	return conn.reader.Read(b)
+}
+
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	conn.readHeader()
+	if conn.remote != nil {
+		return conn.remote
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads the PROXY protocol header of version 1 or 2 from r.
+// It returns the source address of the header, or nil if the header does not
+// name one (UNKNOWN, LOCAL or a family other than TCP over IPv4 and IPv6).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(PROXY_V2_SIGNATURE))
+	if err == nil && bytes.Equal(sig, PROXY_V2_SIGNATURE) {
+		return readProxyV2(r)
+	}
+	if sig, err := r.Peek(len(PROXY_V1_PREFIX)); err != nil || string(sig) != PROXY_V1_PREFIX {
+		return nil, fmt.Errorf("no PROXY protocol header")
+	}
+	return readProxyV1(r)
+}
+
+// readProxyV1 reads a version 1 header:
+//
+//	PROXY TCP4|TCP6 source destination source-port destination-port\r\n
+//	PROXY UNKNOWN ...\r\n
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < PROXY_V1_MAX_LEN {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("PROXY protocol header is not terminated by CRLF")
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("invalid PROXY protocol header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("invalid PROXY protocol source address %s port %s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 reads a version 2 header: the signature, the version and
+// command, the address family and protocol, the length of the addresses and
+// the addresses, followed by TLVs that are skipped.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unknown PROXY protocol version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	switch cmd := hdr[12] & 0x0f; cmd {
+	case 0x0: // LOCAL, a connection of the balancer itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unknown PROXY protocol command %d", cmd)
+	}
+
+	switch hdr[13] {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, fmt.Errorf("short PROXY protocol IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("short PROXY protocol IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil
+}
+
+// clientAddr returns the IP address of the client of req, the address the
+// PROXY protocol header named when the listener reads one.
+func clientAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(cmd, family byte, addrs ...byte) string {
+		return string(PROXY_V2_SIGNATURE) + string([]byte{0x20 | cmd, family, 0, byte(len(addrs))}) + string(addrs)
+	}
+	ipv4 := []byte{192, 0, 2, 10, 198, 51, 100, 1, 0xc8, 0x22, 0x01, 0xbb}
+	ipv6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0xc8, 0x22, 0x01, 0xbb)
+
+	for _, test := range []struct {
+		header string
+		addr   string // "" for no address
+		err    bool
+	}{
+		{"PROXY TCP4 192.0.2.10 198.51.100.1 51234 443\r\n", "192.0.2.10:51234", false},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 51234 443\r\n", "[2001:db8::1]:51234", false},
+		{"PROXY UNKNOWN\r\n", "", false},
+		{"PROXY TCP4 2001:db8::1 198.51.100.1 51234 443\r\n", "", true},
+		{"PROXY TCP4 192.0.2.10 198.51.100.1 65536 443\r\n", "", true},
+		{"PROXY TCP4 192.0.2.10 198.51.100.1 51234 443\n", "", true},
+		{"PROXY " + strings.Repeat("x", PROXY_V1_MAX_LEN), "", true},
+		{"GET / HTTP/1.1\r\n", "", true},
+		{v2(1, 0x11, ipv4...), "192.0.2.10:51234", false},
+		{v2(1, 0x21, ipv6...), "[2001:db8::1]:51234", false},
+		{v2(0, 0x00), "", false},
+		{v2(1, 0x11, ipv4[:8]...), "", true},
+		{v2(2, 0x11, ipv4...), "", true},
+	} {
+		addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(test.header + "GET / HTTP/1.1\r\n")))
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v", test.header, err)
+			continue
+		}
+		var got string
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != test.addr {
+			t.Errorf("%q: got address %q, want %q", test.header, got, test.addr)
+		}
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ProxyListener(ln), http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rsp, clientAddr(req))
+	}))
+
+	for _, test := range []struct {
+		header string
+		want   string
+	}{
+		{"PROXY TCP4 192.0.2.10 198.51.100.1 51234 443\r\n", "192.0.2.10"},
+		{"PROXY UNKNOWN\r\n", "127.0.0.1"},
+		{"", ""},
+	} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "%sGET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n", test.header)
+		rsp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: got status %d, want the connection closed", test.header, rsp.StatusCode)
+			}
+			conn.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", test.header, err)
+		}
+		body, _ := ioutil.ReadAll(rsp.Body)
+		if string(body) != test.want {
+			t.Errorf("%q: got client %q, want %q", test.header, body, test.want)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The query parameters of a data GET (RFC 8040 section 4.8) select what is
+   returned of the target resource: content its configuration or state data,
+   depth the levels of descendants, fields the descendants themselves and
+   with-defaults how default values are reported (RFC 6243). All but content
+   are optional, each is served only while enabled, its capability is then
+   listed in the restconf-state capabilities:
+
+   GET /restconf/data/example:system?content=config&depth=2&fields=ntp(server/name)&with-defaults=report-all
+
+   A disabled parameter is refused with operation-not-supported. The
+   report-all-tagged mode of with-defaults reports the default values as
+   report-all does, and tags every leaf holding its default value with the
+   default attribute of ietf-netconf-with-defaults in XML, a metadata
+   member in JSON:
+
+   <mtu xmlns:wd="urn:ietf:params:xml:ns:netconf:default:1.0" wd:default="true">1500</mtu>
+   "mtu" : 1500, "@mtu" : { "ietf-netconf-with-defaults:default" : true }
+
+   The fields are selected first, depth then limits the descendants of each
+   selected node, counting it one level below the target however deep its
+   path is: fields=ntp/server&depth=3 returns the servers with their leafs.
+   The nodes on the path of a selected node are returned whatever the depth,
+   but with depth=1 only the target.
+
+   When depth leaves out data the target holds, the response carries a
+   Warning header telling the client to ask for more levels:
+
+   Warning: 299 - "data nested deeper than depth=2 is omitted"
+*/
+
+var (
+	CONTENT_PARAM       = "content"
+	DEPTH_PARAM         = "depth"
+	FIELDS_PARAM        = "fields"
+	WITH_DEFAULTS_PARAM = "with-defaults"
+
+	CONTENT_CONFIG    = "config"
+	CONTENT_NONCONFIG = "nonconfig"
+	CONTENT_ALL       = "all"
+
+	DEPTH_UNBOUNDED = "unbounded"
+
+	// DEPTH_WARNING is the Warning header value (RFC 7234 section 5.5) of a
+	// response cut short by the depth parameter, formatted with the depth.
+	DEPTH_WARNING = `299 restconf "data nested deeper than depth=%d is omitted"`
+
+	WITH_DEFAULTS_REPORT_ALL        = "report-all"
+	WITH_DEFAULTS_REPORT_ALL_TAGGED = "report-all-tagged"
+	WITH_DEFAULTS_TRIM              = "trim"
+	WITH_DEFAULTS_EXPLICIT          = "explicit"
+
+	WITH_DEFAULTS_MODULE = "ietf-netconf-with-defaults"
+	WITH_DEFAULTS_XMLNS  = "urn:ietf:params:xml:ns:netconf:default:1.0"
+
+	// The server reports the default values it holds the way they were
+	// set, the basic mode of RFC 6243 section 2.3.
+	DEFAULTS_CAPABILITY = "urn:ietf:params:restconf:capability:defaults:1.0?basic-mode=" + WITH_DEFAULTS_EXPLICIT
+)
+
+// A QueryParam is an optional query parameter, enabled by default and
+// disabled with its -query-name flag.
+type QueryParam struct {
+	Name       string
+	Capability string // URI of the capability advertising the parameter
+	Enabled    bool
+}
+
+var QUERY_PARAMS = []*QueryParam{
+	{DEPTH_PARAM, "urn:ietf:params:restconf:capability:depth:1.0", true},
+	{FIELDS_PARAM, "urn:ietf:params:restconf:capability:fields:1.0", true},
+	{WITH_DEFAULTS_PARAM, "urn:ietf:params:restconf:capability:with-defaults:1.0", true},
+}
+
+// capabilities returns the capability URIs of the server, those of the
+// disabled query parameters left out, the cap of the list entries if there
+// is one, and the read-only capability if the server is read-only.
+func capabilities() []interface{} {
+	caps := []interface{}{DEFAULTS_CAPABILITY}
+	for _, p := range QUERY_PARAMS {
+		if p.Enabled {
+			caps = append(caps, p.Capability)
+		}
+	}
+	if c := maxEntriesCapability(); c != "" {
+		caps = append(caps, c)
+	}
+	if READ_ONLY {
+		caps = append(caps, READ_ONLY_CAPABILITY)
+	} else {
+		caps = append(caps, YANG_PATCH_CAPABILITY)
+	}
+	return caps
+}
+
+// queryParam returns the optional query parameter name, nil if name is not
+// one.
+func queryParam(name string) *QueryParam {
+	for _, p := range QUERY_PARAMS {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// readParams are the query parameters of a data GET.
+type readParams struct {
+	content      string // "" or CONTENT_ALL returning both config and state data
+	depth        int    // levels returned, 0 for unbounded
+	fields       string // the fields expression, "" selecting everything
+	withDefaults string // "" or WITH_DEFAULTS_EXPLICIT returning the data as it is
+	keysOnly     bool   // the entries of the target list reduced to their keys
+	running      bool   // the configuration only, /restconf/data aliasing running
+	maxEntries   int    // the max-entries parameter, 0 if not given, -1 for unbounded
+}
+
+// tagged reports whether the leafs holding their default value are tagged,
+// with-defaults being report-all-tagged.
+func (params *readParams) tagged() bool {
+	return params.withDefaults == WITH_DEFAULTS_REPORT_ALL_TAGGED
+}
+
+// queryParams returns the query parameters of a data GET in req, checking
+// that the optional ones are enabled and that req is a GET or HEAD. Any
+// parameter of a data request given more than once, read or not, is refused
+// rather than one of its values taken.
+func queryParams(req *http.Request) (*readParams, error) {
+	query := rawQuery(req.URL.RawQuery)
+	if err := uniqueParams(query); err != nil {
+		return nil, err
+	}
+	params := &readParams{running: DATA_DATASTORE == DATASTORE_RUNNING}
+	for _, name := range []string{CONTENT_PARAM, DEPTH_PARAM, FIELDS_PARAM, WITH_DEFAULTS_PARAM, KEYS_ONLY_PARAM, MAX_ENTRIES_PARAM} {
+		s, ok := query[name]
+		switch p := queryParam(name); {
+		case !ok:
+			continue
+		case p != nil && !p.Enabled:
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL, ERROR_TAG_OPERATION_NOT_SUPPORTED,
+				"the %s query parameter is not supported", name)
+		case req.Method != "GET" && req.Method != "HEAD":
+			return nil, invalidValue("the %s parameter is only allowed with GET and HEAD", name)
+		}
+
+		switch v := s[0]; name {
+		case CONTENT_PARAM:
+			switch v {
+			case CONTENT_CONFIG, CONTENT_NONCONFIG, CONTENT_ALL:
+				params.content = v
+			default:
+				return nil, invalidValue("invalid %s parameter %q", CONTENT_PARAM, v)
+			}
+		case DEPTH_PARAM:
+			if v == DEPTH_UNBOUNDED {
+				break
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 65535 {
+				return nil, invalidValue("invalid %s parameter %q", DEPTH_PARAM, v)
+			}
+			params.depth = n
+		case FIELDS_PARAM:
+			if v == "" {
+				return nil, invalidValue("empty %s parameter", FIELDS_PARAM)
+			}
+			params.fields = v
+		case WITH_DEFAULTS_PARAM:
+			switch v {
+			case WITH_DEFAULTS_REPORT_ALL, WITH_DEFAULTS_REPORT_ALL_TAGGED, WITH_DEFAULTS_TRIM, WITH_DEFAULTS_EXPLICIT:
+				params.withDefaults = v
+			default:
+				return nil, invalidValue("invalid %s parameter %q", WITH_DEFAULTS_PARAM, v)
+			}
+		case KEYS_ONLY_PARAM:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, invalidValue("invalid %s parameter %q", KEYS_ONLY_PARAM, v)
+			}
+			params.keysOnly = b
+		case MAX_ENTRIES_PARAM:
+			n, err := maxEntriesParam(v)
+			if err != nil {
+				return nil, err
+			}
+			params.maxEntries = n
+		}
+	}
+	if params.keysOnly && params.fields != "" {
+		return nil, invalidValue("the %s and %s parameters are exclusive", KEYS_ONLY_PARAM, FIELDS_PARAM)
+	}
+	return params, nil
+}
+
+// uniqueParams checks that no parameter of query is given more than once.
+func uniqueParams(query url.Values) error {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(query[name]) > 1 {
+			return invalidValue("the %s parameter is given more than once", name)
+		}
+	}
+	return nil
+}
+
+// rawQuery parses the query string q into its parameters. Unlike
+// url.ParseQuery it splits at "&" only, the ";" separating the paths of a
+// fields expression is not escaped by clients. Parameters that cannot be
+// unescaped are left out.
+func rawQuery(q string) url.Values {
+	query := make(url.Values)
+	for _, pair := range strings.Split(q, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		name, err1 := url.QueryUnescape(name)
+		value, err2 := url.QueryUnescape(value)
+		if err1 == nil && err2 == nil {
+			query[name] = append(query[name], value)
+		}
+	}
+	return query
+}
+
+// apply returns the data tree v of the node e as the parameters select it,
+// v being in the form readData returns it, and whether the depth parameter
+// left out some of it. The returned tree is nil if content selects none of
+// v. v is modified in place.
+func (params *readParams) apply(schema *Schema, e *yang.Entry, v interface{}) (interface{}, bool, error) {
+	return params.applyAt(schema, e, v, 1)
+}
+
+// applyAt is apply for the data tree v at level, the level depth counts
+// from.
+func (params *readParams) applyAt(schema *Schema, e *yang.Entry, v interface{}, level int) (interface{}, bool, error) {
+	if params.running {
+		v = configOnly(e, v)
+	}
+	switch params.content {
+	case CONTENT_CONFIG:
+		v = configOnly(e, v)
+	case CONTENT_NONCONFIG:
+		v = stateOnly(e, v)
+	}
+	if v == nil {
+		return nil, false, nil
+	}
+
+	switch params.withDefaults {
+	case WITH_DEFAULTS_REPORT_ALL, WITH_DEFAULTS_REPORT_ALL_TAGGED:
+		v = reportDefaults(e, v)
+	case WITH_DEFAULTS_TRIM:
+		v = trimDefaults(e, v)
+	}
+	var truncated bool
+	if params.fields != "" || params.keysOnly {
+		sel := keysSelect(e)
+		var err error
+		if !params.keysOnly {
+			sel, err = schema.parseFields(e, params.fields)
+		}
+		if err != nil {
+			return nil, false, invalidValue("invalid %s parameter %q: %s", FIELDS_PARAM, params.fields, err.Error())
+		}
+		if params.depth == 0 || level < params.depth {
+			return selectFields(e, v, sel, level, params.depth, &truncated), truncated, nil
+		}
+	}
+	if params.depth > 0 {
+		v = limitDepth(e, v, level, params.depth, &truncated)
+	}
+	return v, truncated, nil
+}
+
+// stateOnly returns the state data of the data tree v of the node e, along
+// with the keys of the list entries holding it. It returns nil when v holds
+// no state data.
+func stateOnly(e *yang.Entry, v interface{}) interface{} {
+	if e.ReadOnly() {
+		return v
+	}
+	if !e.IsDir() {
+		return nil
+	}
+
+	if values, ok := v.([]interface{}); ok {
+		var state []interface{}
+		for _, value := range values {
+			if s := stateOnly(e, value); s != nil {
+				state = append(state, s)
+			}
+		}
+		if state == nil {
+			return nil
+		}
+		return state
+	}
+
+	dir, _ := v.(map[string]interface{})
+	state := make(map[string]interface{})
+	for name, cv := range dir {
+		if child := findDataChild(e, name); child != nil {
+			if s := stateOnly(child, cv); s != nil {
+				state[name] = s
+			}
+		}
+	}
+	if len(state) == 0 {
+		return nil
+	}
+	for _, key := range keyNames(e) {
+		if k, ok := dir[key]; ok {
+			state[key] = k
+		}
+	}
+	return state
+}
+
+// limitDepth returns the data tree v of the node e at level, without the
+// descendants below depth, and sets truncated if there were any. The target
+// resource is at level 1, as are the entries of a target list.
+func limitDepth(e *yang.Entry, v interface{}, level, depth int, truncated *bool) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, value := range v {
+			v[i] = limitDepth(e, value, level, depth, truncated)
+		}
+		return v
+	case map[string]interface{}:
+		if !e.IsDir() {
+			return v
+		}
+		for name, cv := range v {
+			child := findDataChild(e, name)
+			if child == nil || level >= depth {
+				*truncated = *truncated || child != nil
+				delete(v, name)
+				continue
+			}
+			v[name] = limitDepth(child, cv, level+1, depth, truncated)
+		}
+		return v
+	}
+	return v
+}
+
+// A fieldSelect holds the selected children of a data node, by name. A nil
+// fieldSelect selects all the descendants.
+type fieldSelect map[string]fieldSelect
+
+// add selects sub below the child name.
+func (sel fieldSelect) add(name string, sub fieldSelect) {
+	cur, ok := sel[name]
+	switch {
+	case !ok:
+		sel[name] = sub
+	case cur == nil || sub == nil:
+		sel[name] = nil
+	default:
+		for n, s := range sub {
+			cur.add(n, s)
+		}
+	}
+}
+
+// selectFields returns the data tree v of the node e at level holding only
+// the descendants sel selects. fields selects before depth limits: the
+// selected nodes are at the level below e however deep their path is, depth
+// limits the levels of descendants returned below them, and the nodes on
+// their path are kept. depth is 0 for unbounded, otherwise above level.
+func selectFields(e *yang.Entry, v interface{}, sel fieldSelect, level, depth int, truncated *bool) interface{} {
+	if sel == nil {
+		return v
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		for i, value := range v {
+			v[i] = selectFields(e, value, sel, level, depth, truncated)
+		}
+		return v
+	case map[string]interface{}:
+		for name, cv := range v {
+			sub, ok := sel[name]
+			child := findDataChild(e, name)
+			if !ok || child == nil {
+				delete(v, name)
+				continue
+			}
+			if sub == nil && depth > 0 {
+				v[name] = limitDepth(child, cv, level+1, depth, truncated)
+				continue
+			}
+			v[name] = selectFields(child, cv, sub, level, depth, truncated)
+		}
+		return v
+	}
+	return v
+}
+
+// A fieldsParser parses a fields expression (RFC 8040 section 4.8.3):
+//
+//	fields-expr = path "(" fields-expr ")" / path ";" fields-expr / path
+//	path = api-identifier [ "/" path ]
+type fieldsParser struct {
+	schema *Schema
+	s      string
+	pos    int
+}
+
+// parseFields parses the fields expression s selecting descendants of e.
+func (schema *Schema) parseFields(e *yang.Entry, s string) (fieldSelect, error) {
+	p := &fieldsParser{schema: schema, s: s}
+	sel, err := p.expr(e)
+	if err == nil && p.pos < len(s) {
+		err = fmt.Errorf("unexpected %q at offset %d", s[p.pos], p.pos)
+	}
+	return sel, err
+}
+
+// peek reports whether the next character is c.
+func (p *fieldsParser) peek(c byte) bool {
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+// expr parses the ";" separated paths of descendants of e.
+func (p *fieldsParser) expr(e *yang.Entry) (fieldSelect, error) {
+	sel := make(fieldSelect)
+	for {
+		if err := p.path(e, sel); err != nil {
+			return nil, err
+		}
+		if !p.peek(';') {
+			return sel, nil
+		}
+		p.pos++
+	}
+}
+
+// path parses a path of descendants of e, along with the expression in
+// parentheses following it, and adds it to sel.
+func (p *fieldsParser) path(e *yang.Entry, sel fieldSelect) error {
+	child, err := p.node(e)
+	if err != nil {
+		return err
+	}
+
+	var sub fieldSelect
+	switch {
+	case p.peek('/'):
+		p.pos++
+		sub = make(fieldSelect)
+		if err := p.path(child, sub); err != nil {
+			return err
+		}
+	case p.peek('('):
+		p.pos++
+		if sub, err = p.expr(child); err != nil {
+			return err
+		}
+		if !p.peek(')') {
+			return fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		p.pos++
+	}
+	sel.add(child.Name, sub)
+	return nil
+}
+
+// node parses an api-identifier naming a data node child of e, module
+// qualified or not.
+func (p *fieldsParser) node(e *yang.Entry) (*yang.Entry, error) {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("/;()", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	mod, name := splitName(p.s[start:p.pos])
+	if !isIdentifier(name) || (mod != "" && !isIdentifier(mod)) {
+		return nil, fmt.Errorf("expected a node name at offset %d", start)
+	}
+
+	child := findDataChild(e, name)
+	if child == nil || !e.IsDir() || (mod != "" && p.schema.ModuleOf(child) != mod) {
+		return nil, fmt.Errorf("%s has no child node %s", e.Name, p.s[start:p.pos])
+	}
+	return child, nil
+}
+
+// reportDefaults returns the data tree v of the node e with the default
+// values of its missing leafs filled in, the with-defaults report-all mode.
+// The leafs of non-presence containers are reported as well, those of a
+// case only when the case is the one present or the default of its choice.
+func reportDefaults(e *yang.Entry, v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, value := range v {
+			v[i] = reportDefaults(e, value)
+		}
+		return v
+	case map[string]interface{}:
+		if e.IsDir() {
+			addDefaults(e, v)
+		}
+		return v
+	}
+	return v
+}
+
+// addDefaults adds the default values of the leafs of e missing in dir, the
+// data tree of an instance of e, and descends into its children.
+func addDefaults(e *yang.Entry, dir map[string]interface{}) {
+	for _, child := range e.Dir {
+		switch {
+		case child.IsChoice():
+			if c := activeCase(child, dir); c != nil {
+				addDefaults(c, dir)
+			}
+		case child.IsCase() || isOperation(child) || isNotification(child):
+		case child.IsLeaf():
+			if _, ok := dir[child.Name]; !ok {
+				if def := child.DefaultValue(); def != "" {
+					dir[child.Name] = def
+				}
+			}
+		case child.IsList():
+			if values, ok := dir[child.Name].([]interface{}); ok {
+				for _, value := range values {
+					if entry, ok := value.(map[string]interface{}); ok {
+						addDefaults(child, entry)
+					}
+				}
+			}
+		case child.IsContainer():
+			cdir, ok := dir[child.Name].(map[string]interface{})
+			if !ok {
+				if c, _ := child.Node.(*yang.Container); c == nil || c.Presence != nil {
+					continue
+				}
+				cdir = make(map[string]interface{})
+			}
+			addDefaults(child, cdir)
+			if len(cdir) > 0 {
+				dir[child.Name] = cdir
+			}
+		}
+	}
+}
+
+// activeCase returns the case of the choice e holding data in dir, or else
+// the default case of e, nil if there is neither.
+func activeCase(e *yang.Entry, dir map[string]interface{}) *yang.Entry {
+	for _, c := range e.Dir {
+		if hasData(c, dir) {
+			if !c.IsCase() {
+				return nil // the shorthand case of a single data node
+			}
+			return c
+		}
+	}
+	if c := e.Dir[e.Default]; c != nil && c.IsCase() {
+		return c
+	}
+	return nil
+}
+
+// hasData reports whether dir holds data of e or of its descendants through
+// choices and cases.
+func hasData(e *yang.Entry, dir map[string]interface{}) bool {
+	if !e.IsChoice() && !e.IsCase() {
+		_, ok := dir[e.Name]
+		return ok
+	}
+	for _, child := range e.Dir {
+		if hasData(child, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDefaultLeaf reports whether the leaf e holds its default value s.
+func isDefaultLeaf(e *yang.Entry, s string) bool {
+	def := e.DefaultValue()
+	return def != "" && s == def
+}
+
+// trimDefaults returns the data tree v of the node e without the leafs set
+// to their default value, the with-defaults trim mode.
+func trimDefaults(e *yang.Entry, v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, value := range v {
+			v[i] = trimDefaults(e, value)
+		}
+		return v
+	case map[string]interface{}:
+		if !e.IsDir() {
+			return v
+		}
+		for name, cv := range v {
+			child := findDataChild(e, name)
+			switch {
+			case child == nil:
+			case child.IsLeaf():
+				if s, _ := cv.(string); isDefaultLeaf(child, s) && !isKey(e, name) {
+					delete(v, name)
+				}
+			default:
+				v[name] = trimDefaults(child, cv)
+			}
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var queryModuleText = `
+module query {
+  namespace "urn:query";
+  prefix q;
+
+  container system {
+    leaf hostname { type string; }
+    leaf mtu { type uint16; default 1500; }
+    container ntp {
+      leaf enabled { type boolean; default true; }
+      list server {
+        key name;
+        leaf name { type string; }
+        leaf prefer { type boolean; default false; }
+      }
+    }
+    container login {
+      presence "login is configured";
+      leaf banner { type string; default "welcome"; }
+    }
+    choice transport {
+      default udp;
+      case udp { leaf udp-port { type uint16; default 514; } }
+      case tcp { leaf tcp-port { type uint16; default 601; } }
+    }
+  }
+}
+`
+
+func TestQueryParams(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"query": queryModuleText}))
+	rsp := doRequest(server, "PUT", "/restconf/data/query:system", APPLICATION_DATA_JSON,
+		`{"query:system":{"hostname":"a","mtu":1500,"ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for i, step := range []struct {
+		method string
+		query  string
+		status int
+		want   string
+	}{
+		{"GET", "", http.StatusOK,
+			`{"query:system":{"hostname":"a","mtu":1500,"ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`},
+		{"GET", "depth=1", http.StatusOK, `{"query:system":{}}`},
+		{"GET", "depth=2", http.StatusOK, `{"query:system":{"hostname":"a","mtu":1500,"ntp":{}}}`},
+		{"GET", "depth=unbounded", http.StatusOK,
+			`{"query:system":{"hostname":"a","mtu":1500,"ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`},
+		{"GET", "depth=0", http.StatusBadRequest, ""},
+		{"GET", "depth=1&depth=2", http.StatusBadRequest, ""},
+		{"GET", "fields=hostname;ntp/server(name)", http.StatusOK,
+			`{"query:system":{"hostname":"a","ntp":{"server":[{"name":"s1"},{"name":"s2"}]}}}`},
+		{"GET", "fields=query:mtu;ntp/server/prefer;ntp/server", http.StatusOK,
+			`{"query:system":{"mtu":1500,"ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`},
+		{"GET", "fields=ntp(server(name))&depth=2", http.StatusOK, `{"query:system":{"ntp":{"server":[{"name":"s1"},{"name":"s2"}]}}}`},
+		{"GET", "fields=unknown", http.StatusBadRequest, ""},
+		{"GET", "fields=other:mtu", http.StatusBadRequest, ""},
+		{"GET", "fields=ntp(server", http.StatusBadRequest, ""},
+		{"GET", "fields=hostname)", http.StatusBadRequest, ""},
+		{"GET", "with-defaults=explicit", http.StatusOK,
+			`{"query:system":{"hostname":"a","mtu":1500,"ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`},
+		{"GET", "with-defaults=trim", http.StatusOK,
+			`{"query:system":{"hostname":"a","ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`},
+		{"GET", "with-defaults=report-all", http.StatusOK,
+			`{"query:system":{"hostname":"a","mtu":1500,"ntp":{"enabled":true,"server":[{"name":"s1","prefer":true},{"name":"s2","prefer":false}]},"udp-port":514}}`},
+		{"GET", "with-defaults=report-all-tagged", http.StatusOK, ""},
+		{"GET", "with-defaults=all", http.StatusBadRequest, ""},
+		{"DELETE", "depth=1", http.StatusBadRequest, ""},
+	} {
+		url := "/restconf/data/query:system"
+		if step.query != "" {
+			url += "?" + step.query
+		}
+		rsp := doRequest(server, step.method, url, "", "")
+		if rsp.Code != step.status {
+			t.Fatalf("step %d: %s %s: got status %d, want %d: %s", i, step.method, url, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("step %d: %s %s: got body %s, want %s", i, step.method, url, rsp.Body, step.want)
+		}
+	}
+}
+
+func TestQueryParamsDisabled(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		"query":           queryModuleText,
+		MONITORING_MODULE: monitoringModuleText,
+	}))
+	defer func() { QUERY_PARAMS[0].Enabled = true }()
+	QUERY_PARAMS[0].Enabled = false // depth
+
+	rsp := doRequest(server, "GET", "/restconf/data/query:system?depth=1", "", "")
+	if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), `"error-tag":"operation-not-supported"`) {
+		t.Errorf("GET with disabled depth: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	rsp = doRequest(server, "GET", "/restconf/data/ietf-restconf-monitoring:restconf-state/capabilities", "", "")
+	want := `{"ietf-restconf-monitoring:capabilities":{"capability":[` +
+		`"urn:ietf:params:restconf:capability:defaults:1.0?basic-mode=explicit",` +
+		`"urn:ietf:params:restconf:capability:fields:1.0",` +
+		`"urn:ietf:params:restconf:capability:with-defaults:1.0",` +
+		`"urn:go-restconf:capability:max-list-entries:1.0?max=100000","urn:ietf:params:restconf:capability:yang-patch:1.0"]}}`
+	if rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Errorf("GET capabilities: got status %d, %s, want %s", rsp.Code, rsp.Body, want)
+	}
+}
+
+func TestDuplicateQueryParams(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		method, query string
+	}{
+		{"GET", "depth=1&depth=2"},
+		{"GET", "depth=1&depth=1"},
+		{"GET", "content=config&content=nonconfig"},
+		{"GET", "content=all&depth=2&content=all"},
+		{"GET", "limit=1&limit=2"},
+		{"GET", "unknown=a&unknown=b"},
+		{"PUT", "insert=first&insert=last"},
+	} {
+		rsp := doRequest(server, test.method, "/restconf/data/test:system?"+test.query, APPLICATION_DATA_JSON, `{"test:system":{}}`)
+		if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), `"error-tag":"invalid-value"`) ||
+			!strings.Contains(rsp.Body.String(), "more than once") {
+			t.Errorf("%s ?%s: got status %d: %s", test.method, test.query, rsp.Code, rsp.Body)
+		}
+	}
+
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system?depth=1&content=all", "", ""); rsp.Code == http.StatusBadRequest {
+		t.Errorf("distinct parameters: got status %d: %s", rsp.Code, rsp.Body)
+	}
+}
+
+func TestWithDefaultsTagged(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"query": queryModuleText}))
+	rsp := doRequest(server, "PUT", "/restconf/data/query:system", APPLICATION_DATA_JSON,
+		`{"query:system":{"hostname":"a","mtu":1500,"ntp":{"enabled":false,"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	// The leafs set to their default value are tagged as the ones the
+	// server reports, the others are not.
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"/restconf/data/query:system?with-defaults=report-all-tagged",
+			`{"query:system":{"hostname":"a","mtu":1500,"@mtu":{"ietf-netconf-with-defaults:default":true},` +
+				`"ntp":{"enabled":false,"server":[{"name":"s1","prefer":true},` +
+				`{"name":"s2","prefer":false,"@prefer":{"ietf-netconf-with-defaults:default":true}}]},` +
+				`"udp-port":514,"@udp-port":{"ietf-netconf-with-defaults:default":true}}}`},
+		{"/restconf/data/query:system/mtu?with-defaults=report-all-tagged",
+			`{"query:mtu":1500,"@query:mtu":{"ietf-netconf-with-defaults:default":true}}`},
+		{"/restconf/data/query:system/hostname?with-defaults=report-all-tagged", `{"query:hostname":"a"}`},
+		{"/restconf/data/query:system/ntp.xml?with-defaults=report-all-tagged",
+			`<ntp xmlns="urn:query"><enabled>false</enabled>` +
+				`<server><name>s1</name><prefer>true</prefer></server>` +
+				`<server><name>s2</name><prefer xmlns:wd="` + WITH_DEFAULTS_XMLNS + `" wd:default="true">false</prefer></server></ntp>`},
+		{"/restconf/data/query:system/mtu.xml?with-defaults=report-all",
+			`<mtu xmlns="urn:query">1500</mtu>`},
+		{"/restconf/data.xml?with-defaults=report-all-tagged",
+			`<data xmlns="` + PUBLIC_XMLNS + `"><system xmlns="urn:query"><hostname>a</hostname>` +
+				`<mtu xmlns:wd="` + WITH_DEFAULTS_XMLNS + `" wd:default="true">1500</mtu>` +
+				`<ntp><enabled>false</enabled><server><name>s1</name><prefer>true</prefer></server>` +
+				`<server><name>s2</name><prefer xmlns:wd="` + WITH_DEFAULTS_XMLNS + `" wd:default="true">false</prefer></server></ntp>` +
+				`<udp-port xmlns:wd="` + WITH_DEFAULTS_XMLNS + `" wd:default="true">514</udp-port></system></data>`},
+	} {
+		rsp := doRequest(server, "GET", tt.url, "", "")
+		if rsp.Code != http.StatusOK || rsp.Body.String() != tt.want {
+			t.Errorf("GET %s: got status %d, %s, want %s", tt.url, rsp.Code, rsp.Body, tt.want)
+		}
+	}
+}
+
+func TestFieldsDepth(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"query": queryModuleText}))
+	rsp := doRequest(server, "PUT", "/restconf/data/query:system", APPLICATION_DATA_JSON,
+		`{"query:system":{"hostname":"a","ntp":{"enabled":false,"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	// The selected nodes count one level below the target, the nodes on
+	// their path are kept.
+	for _, tt := range []struct {
+		url       string
+		want      string
+		truncated bool
+	}{
+		{"/restconf/data/query:system?fields=ntp/server(name)&depth=2",
+			`{"query:system":{"ntp":{"server":[{"name":"s1"},{"name":"s2"}]}}}`, false},
+		{"/restconf/data/query:system?fields=ntp/server&depth=2",
+			`{"query:system":{"ntp":{"server":[{},{}]}}}`, true},
+		{"/restconf/data/query:system?fields=ntp/server&depth=3",
+			`{"query:system":{"ntp":{"server":[{"name":"s1","prefer":true},{"name":"s2"}]}}}`, false},
+		{"/restconf/data/query:system?fields=hostname;ntp&depth=2",
+			`{"query:system":{"hostname":"a","ntp":{}}}`, true},
+		{"/restconf/data/query:system?fields=hostname;ntp&depth=3",
+			`{"query:system":{"hostname":"a","ntp":{"enabled":false,"server":[{},{}]}}}`, true},
+		{"/restconf/data/query:system?fields=hostname;ntp/server/name&depth=1",
+			`{"query:system":{}}`, true},
+		{"/restconf/data/query:system/ntp?fields=server/prefer&depth=2",
+			`{"query:ntp":{"server":[{"prefer":true},{}]}}`, false},
+	} {
+		rsp := doRequest(server, "GET", tt.url, "", "")
+		if rsp.Code != http.StatusOK || rsp.Body.String() != tt.want {
+			t.Errorf("GET %s: got status %d, %s, want %s", tt.url, rsp.Code, rsp.Body, tt.want)
+		}
+		if got := rsp.Header().Get("Warning") != ""; got != tt.truncated {
+			t.Errorf("GET %s: got Warning %q", tt.url, rsp.Header().Get("Warning"))
+		}
+	}
+}
+
+func TestDepthWarning(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"query": queryModuleText}))
+	rsp := doRequest(server, "PUT", "/restconf/data/query:system", APPLICATION_DATA_JSON,
+		`{"query:system":{"hostname":"a","ntp":{"server":[{"name":"s1"}]},"login":{}}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"/restconf/data/query:system", ""},
+		{"/restconf/data/query:system?depth=unbounded", ""},
+		{"/restconf/data/query:system?depth=4", ""},
+		{"/restconf/data/query:system?depth=3", `299 restconf "data nested deeper than depth=3 is omitted"`},
+		{"/restconf/data/query:system?depth=1", `299 restconf "data nested deeper than depth=1 is omitted"`},
+		{"/restconf/data/query:system/login?depth=1", ""},
+		{"/restconf/data/query:system?fields=hostname&depth=2", ""},
+	} {
+		rsp := doRequest(server, "GET", tt.url, "", "")
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d: %s", tt.url, rsp.Code, rsp.Body)
+		}
+		if got := rsp.Header().Get("Warning"); got != tt.want {
+			t.Errorf("GET %s: got Warning %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	// The warning is added besides that of the format fallback.
+	req := httptest.NewRequest("GET", "/restconf/data/query:system?depth=1", nil)
+	req.Header.Set("Accept", "text/*")
+	rsp = httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	if got := rsp.Header().Values("Warning"); len(got) != 2 {
+		t.Errorf("GET with Accept text/*: got Warning %q, want two warnings", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   With -readonly the server refuses every write of the datastore: the data
+   resources only allow GET, HEAD and OPTIONS, the other methods are answered
+   405 with the Allow header of the methods left, and the read-only
+   capability is listed in the restconf-state capabilities.
+
+   restconf -readonly
+
+   The rpcs and actions change the data as their handlers do, they are
+   refused as well unless marked side-effect free, e.g. one reading a
+   counter:
+
+   server.RegRpc("example:get-counters", getCounters)
+   server.MarkSafe("example:get-counters")
+
+   The batch retrievals and diffs only read the data, they are served. The
+   resources the application registers with Register are not affected.
+*/
+
+var READ_ONLY = false
+
+var READ_ONLY_CAPABILITY = "urn:go-restconf:capability:read-only:1.0"
+
+// MarkSafe marks the registered rpc or action name, given as to RegRpc or
+// RegAction, as side-effect free, invoked even when the server is read-only.
+func (restconf *RestConf) MarkSafe(name string) error {
+	var key string
+	if strings.HasPrefix(name, "/") {
+		k, err := nodeKey("action", name, 2)
+		if err != nil {
+			return err
+		}
+		key = k
+	} else {
+		mod, rpc := splitName(name)
+		if mod == "" || rpc == "" {
+			return fmt.Errorf("rpc %q is not module qualified", name)
+		}
+		key = "/" + mod + "/" + rpc
+	}
+	restconf.operationsMu.Lock()
+	defer restconf.operationsMu.Unlock()
+
+	o, ok := restconf.operations[key]
+	if !ok {
+		return fmt.Errorf("operation %s is not registered", key)
+	}
+	o.safe = true
+	return nil
+}
+
+// readOnly returns methods without the methods writing data when the data
+// resources are read-only, see readOnlyData.
+func readOnly(methods []string) []string {
+	if !readOnlyData() {
+		return methods
+	}
+	var read []string
+	for _, m := range methods {
+		if m == "GET" || m == "HEAD" || m == "OPTIONS" {
+			read = append(read, m)
+		}
+	}
+	return read
+}
+
+// operationMethods returns the methods the rpc or action e is invoked with,
+// none if the server is read-only and its handler is not side-effect free.
+func (restconf *RestConf) operationMethods(e *yang.Entry) []string {
+	restconf.operationsMu.RLock()
+	o, ok := restconf.operations[schemaKey(e)]
+	safe := ok && o.safe
+	restconf.operationsMu.RUnlock()
+	if READ_ONLY && !safe {
+		return []string{}
+	}
+	return []string{"POST"}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test":            testModuleText,
+		MONITORING_MODULE: monitoringModuleText,
+	}))
+	rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON,
+		`{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0}]}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	noop := func(op *Operation) (map[string]interface{}, error) { return nil, nil }
+	server.RegRpc("test:ping", noop)
+	server.RegRpc("test:reboot", noop)
+	server.RegAction("/test:system/interface/reset", noop)
+	if err := server.MarkSafe("test:ping"); err != nil {
+		t.Fatalf("MarkSafe: %s", err)
+	}
+	if err := server.MarkSafe("test:unknown"); err == nil {
+		t.Errorf("MarkSafe of an unregistered rpc: got no error")
+	}
+
+	defer func() { READ_ONLY = false }()
+	READ_ONLY = true
+
+	for _, test := range []struct {
+		method, url, body string
+		status            int
+		allow             string
+	}{
+		{"GET", "/restconf/data/test:system/hostname", "", http.StatusOK, ""},
+		{"PUT", "/restconf/data/test:system/hostname", `{"test:hostname":"b"}`, http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"DELETE", "/restconf/data/test:system", "", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"POST", "/restconf/data", `{"test:system":{}}`, http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/restconf/data/test:system", "", http.StatusOK, "GET, HEAD, OPTIONS"},
+		{"DIFF", "/restconf/data", `{"test:system":{"hostname":"b"}}`, http.StatusOK, ""},
+		{"POST", "/restconf/operations/test:ping", "", http.StatusNoContent, ""},
+		{"POST", "/restconf/operations/test:reboot", `{"test:input":{"delay":1}}`, http.StatusMethodNotAllowed, ""},
+		{"POST", "/restconf/data/test:system/interface=eth0,0/reset", `{"test:input":{"delay":1}}`, http.StatusMethodNotAllowed, ""},
+		{"OPTIONS", "/restconf/data/test:system/interface=eth0,0/reset", "", http.StatusOK, "OPTIONS"},
+	} {
+		method, ctype := test.method, ""
+		switch {
+		case method == "DIFF":
+			method, ctype = "POST", APPLICATION_DIFF_JSON
+		case test.body != "":
+			ctype = APPLICATION_DATA_JSON
+		}
+		rsp := doRequest(server, method, test.url, ctype, test.body)
+		if rsp.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d: %s", test.method, test.url, rsp.Code, test.status, rsp.Body)
+		}
+		if allow := rsp.Header().Get("Allow"); test.allow != "" && allow != test.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", test.method, test.url, allow, test.allow)
+		}
+	}
+
+	rsp = doRequest(server, "GET", "/restconf/data/ietf-restconf-monitoring:restconf-state/capabilities", "", "")
+	if !strings.Contains(rsp.Body.String(), `"`+READ_ONLY_CAPABILITY+`"`) {
+		t.Errorf("GET capabilities: got %s, want the read-only capability", rsp.Body)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+/*
+   The server listens while the modules are still being processed, so that a
+   large schema does not delay it behind a load balancer. Until the schema is
+   set the requests are answered with 503 and a Retry-After header of
+   -startup-retry-after seconds, but for the resources that do not depend on
+   the schema: the host-meta discovery, the version of the server and
+
+   GET /healthz
+
+   which answers 200 with "ok" once the server is ready, and 503 with
+   "starting" and the Retry-After header until then, so that the load
+   balancer only routes requests to a server with its models. It is served
+   without authentication.
+*/
+
+var (
+	HEALTHZ_PATH        = "/healthz"
+	STARTUP_RETRY_AFTER = 5 // seconds
+)
+
+// Ready reports whether the server serves a schema. A server created
+// without one is not ready until SetSchema is called.
+func (restconf *RestConf) Ready() bool {
+	return restconf.Schema() != nil
+}
+
+// servedEarly reports whether the resource path is served before the
+// server is ready.
+func servedEarly(path string) bool {
+	switch path {
+	case HEALTHZ_PATH, "/.well-known/host-meta", RESTCONF_PREFIX + "/version":
+		return true
+	}
+	return false
+}
+
+// Healthz answers the health checks of the server.
+func (restconf *RestConf) Healthz(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+	code, status := http.StatusOK, "ok\n"
+	if !restconf.Ready() {
+		code, status = http.StatusServiceUnavailable, "starting\n"
+		rsp.Header().Set("Retry-After", strconv.Itoa(STARTUP_RETRY_AFTER))
+	}
+	rsp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rsp.Header().Set("Cache-Control", "no-store")
+	rsp.WriteHeader(code)
+	if req.Method != "HEAD" {
+		io.WriteString(rsp, status)
+	}
+}
+
+// notReady answers a request arriving before the server is ready.
+func notReady(rsp http.ResponseWriter, req *http.Request) {
+	rsp.Header().Set("Retry-After", strconv.Itoa(STARTUP_RETRY_AFTER))
+	writeError(rsp, req, NewError(http.StatusServiceUnavailable, ERROR_TYPE_TRANSPORT,
+		ERROR_TAG_RESOURCE_DENIED, "the server is starting, the modules are not processed yet"))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotReady(t *testing.T) {
+	server := NewRestConf(nil)
+
+	get := func(url, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		return rsp
+	}
+
+	for _, test := range []struct {
+		url, accept string
+		status      int
+	}{
+		{RESTCONF_PREFIX, "", http.StatusServiceUnavailable},
+		{RESTCONF_PREFIX + "/data/test:system", "", http.StatusServiceUnavailable},
+		{RESTCONF_PREFIX + "/operations", "", http.StatusServiceUnavailable},
+		{RESTCONF_PREFIX + "/yang-library-version", "", http.StatusServiceUnavailable},
+		{"/.well-known/host-meta", APPLICATION_XRD_XML, http.StatusOK},
+		{RESTCONF_PREFIX + "/version", "", http.StatusOK},
+		{HEALTHZ_PATH, "", http.StatusServiceUnavailable},
+	} {
+		rsp := get(test.url, test.accept)
+		if rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", test.url, rsp.Code, test.status, rsp.Body)
+			continue
+		}
+		if retry := rsp.Header().Get("Retry-After"); (test.status == http.StatusServiceUnavailable) != (retry == "5") {
+			t.Errorf("GET %s: got Retry-After %q", test.url, retry)
+		}
+	}
+	if rsp := get(HEALTHZ_PATH, ""); rsp.Body.String() != "starting\n" {
+		t.Errorf("healthz: got %q, want starting", rsp.Body)
+	}
+
+	server.SetSchema(testSchema(t, map[string]string{"test": testModuleText}))
+	if !server.Ready() {
+		t.Fatal("the server is not ready once its schema is set")
+	}
+	if rsp := get(RESTCONF_PREFIX+"/operations", ""); rsp.Code != http.StatusOK {
+		t.Errorf("operations: got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+	if rsp := get(HEALTHZ_PATH, ""); rsp.Code != http.StatusOK || rsp.Body.String() != "ok\n" {
+		t.Errorf("healthz: got status %d body %q, want ok", rsp.Code, rsp.Body)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+var (
+	REQUEST_ID_HEADER  = "X-Request-ID"
+	MAX_REQUEST_ID_LEN = 128
+)
+
+var requestIDContextKey = contextKey("request-id")
+
+// requestID returns the correlation ID of req, the client's X-Request-ID when
+// it is acceptable, otherwise a new one.
+func requestID(req *http.Request) string {
+	if id := req.Header.Get(REQUEST_ID_HEADER); validRequestID(id) {
+		return id
+	}
+	return newRequestID()
+}
+
+// validRequestID reports whether a client supplied ID is short enough and
+// made of characters that are safe in headers and log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LEN {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Println("generate request id failed!", err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// withRequestID returns req carrying the correlation ID id.
+func withRequestID(req *http.Request, id string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestIDContextKey, id))
+}
+
+// requestIDOf returns the correlation ID of req, "" outside of a request.
+func requestIDOf(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	id, _ := req.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// logRequest logs v like log.Println, prefixed with the correlation ID of
+// req.
+func logRequest(req *http.Request, v ...interface{}) {
+	if id := requestIDOf(req); id != "" {
+		v = append([]interface{}{"[" + id + "]"}, v...)
+	}
+	log.Println(v...)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		id   string
+		keep bool
+	}{
+		{"", false},
+		{"abc-123.def_4:5", true},
+		{strings.Repeat("a", MAX_REQUEST_ID_LEN), true},
+		{strings.Repeat("a", MAX_REQUEST_ID_LEN+1), false},
+		{"bad id\r\n", false},
+	} {
+		req := httptest.NewRequest("GET", "/restconf", nil)
+		if test.id != "" {
+			req.Header.Set(REQUEST_ID_HEADER, test.id)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+
+		got := rsp.Header().Get(REQUEST_ID_HEADER)
+		switch {
+		case test.keep && got != test.id:
+			t.Errorf("X-Request-ID %q: got %q, want it echoed", test.id, got)
+		case !test.keep && (got == test.id || len(got) != 32):
+			t.Errorf("X-Request-ID %q: got %q, want a generated ID", test.id, got)
+		}
+	}
+
+	if a, b := newRequestID(), newRequestID(); a == b {
+		t.Errorf("generated the same ID %s twice", a)
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	req := withRequestID(httptest.NewRequest("GET", "/restconf", nil), "abc")
+	logRequest(req, "something failed")
+	if !strings.Contains(buf.String(), "[abc] something failed") {
+		t.Errorf("log line %q does not carry the request ID", buf.String())
+	}
+}
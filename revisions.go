@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   Besides the schema it serves, the server may serve alternate schemas
+   holding older revisions of its modules, e.g. while clients migrate to a
+   new revision. A client resolves its requests against older revisions by
+   listing them in the X-Yang-Revision header:
+
+   GET /restconf/data/example:system
+   X-Yang-Revision: example@2023-01-01, example-types@2023-01-01
+
+   Requests without the header use the served schema, which holds the latest
+   revisions. Every served revision is downloaded from
+   /restconf/yang/module@revision.
+
+   The revisions only change how requests are resolved and answered, not
+   the data: every schema reads and writes the one datastore of the server,
+   and a response holds the nodes of the data its schema defines, so that
+   the nodes of a revision are not seen through another that lacks them,
+   and a DELETE through any revision removes them all. The alternate
+   revisions are not advertised by a YANG library (RFC 8525), a client
+   learns of them out of band.
+*/
+
+var YANG_REVISION_HEADER = "X-Yang-Revision"
+
+var schemaContextKey = contextKey("schema")
+
+// SetRevisions replaces the alternate schemas served besides the schema of
+// the server. The revisions of their modules must not be newer than those of
+// the served schema, and every alternate schema must differ from it in one
+// revision at least.
+func (restconf *RestConf) SetRevisions(schemas ...*Schema) error {
+	current := restconf.Schema()
+	for _, schema := range schemas {
+		var differs bool
+		for _, name := range schema.ModuleNames() {
+			rev, cur := schema.ModuleRevision(name), current.ModuleRevision(name)
+			_, served := current.Modules[name]
+			switch {
+			case !served:
+				differs = true
+			case rev > cur: // revisions are dates, they compare as strings
+				return fmt.Errorf("revision %s@%s is newer than the served %s@%s", name, rev, name, cur)
+			case rev != cur:
+				differs = true
+			}
+		}
+		if !differs {
+			return fmt.Errorf("alternate schema of %s holds the served revisions only",
+				strings.Join(schema.ModuleNames(), ", "))
+		}
+	}
+
+	restconf.schemaMu.Lock()
+	restconf.revisions = schemas
+	restconf.schemaMu.Unlock()
+	return nil
+}
+
+// withRevisions returns req carrying the schema the module revisions listed
+// in its X-Yang-Revision header select: the served schema if it holds all of
+// them, otherwise the first alternate schema that does.
+func (restconf *RestConf) withRevisions(req *http.Request) (*http.Request, error) {
+	header := req.Header.Get(YANG_REVISION_HEADER)
+	if header == "" {
+		return req, nil
+	}
+
+	restconf.schemaMu.RLock()
+	candidates := append([]*Schema{restconf.schema}, restconf.revisions...)
+	restconf.schemaMu.RUnlock()
+
+	for _, field := range strings.Split(header, ",") {
+		field = strings.TrimSpace(field)
+		i := strings.Index(field, "@")
+		if i <= 0 {
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL, ERROR_TAG_INVALID_VALUE,
+				"expected module@revision in %s, got %q", YANG_REVISION_HEADER, field)
+		}
+		name, rev := field[:i], field[i+1:]
+
+		var matching []*Schema
+		for _, schema := range candidates {
+			if schema.exposed(name) && schema.ModuleRevision(name) == rev {
+				matching = append(matching, schema)
+			}
+		}
+		if matching == nil {
+			return nil, NewError(http.StatusBadRequest, ERROR_TYPE_PROTOCOL, ERROR_TAG_INVALID_VALUE,
+				"revision %s is not served along with the other revisions of %s", field, YANG_REVISION_HEADER)
+		}
+		candidates = matching
+	}
+
+	return withSchema(req, candidates[0]), nil
+}
+
+// withSchema returns req carrying schema, the schema its data and
+// operations resolve against until it is answered.
+func withSchema(req *http.Request, schema *Schema) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), schemaContextKey, schema))
+}
+
+// schemaOf returns the schema the data and operations of req resolve
+// against, the one selected by its X-Yang-Revision header or the served
+// schema.
+func (restconf *RestConf) schemaOf(req *http.Request) *Schema {
+	if schema, ok := req.Context().Value(schemaContextKey).(*Schema); ok {
+		return schema
+	}
+	return restconf.Schema()
+}
+
+// moduleRevision returns the parsed module name at revision rev, looked up
+// in the served schema and then in the alternate schemas. An empty rev
+// selects the revision of the schema of req. Hidden modules are not found.
+func (restconf *RestConf) moduleRevision(req *http.Request, name, rev string) *yang.Module {
+	if rev == "" {
+		if schema := restconf.schemaOf(req); !schema.hidden[name] {
+			return schema.modules[name]
+		}
+		return nil
+	}
+
+	restconf.schemaMu.RLock()
+	schemas := append([]*Schema{restconf.schema}, restconf.revisions...)
+	restconf.schemaMu.RUnlock()
+
+	for _, schema := range schemas {
+		if mod, ok := schema.modules[name]; ok && mod.Current() == rev && !schema.hidden[name] {
+			return mod
+		}
+	}
+	return nil
+}
+
+// LoadRevisions reads a revisions file holding one "module..." line per
+// alternate schema and loads the listed modules, file names of older
+// revisions among them. Empty lines and lines starting with # are ignored.
+func LoadRevisions(file string) ([]*Schema, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var schemas []*Schema
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		schema, errs := LoadSchema(strings.Fields(line)...)
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, errs[0])
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, scanner.Err()
+}
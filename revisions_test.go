@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var revModuleText = `
+module rev {
+  namespace "urn:rev";
+  prefix r;
+
+  revision 2024-01-01;
+  revision 2023-01-01;
+
+  container system {
+    leaf hostname { type string; }
+  }
+}
+`
+
+var oldRevModuleText = `
+module rev {
+  namespace "urn:rev";
+  prefix r;
+
+  revision 2023-01-01;
+
+  container system {
+    leaf name { type string; }
+  }
+}
+`
+
+func TestRevisions(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"rev": revModuleText}))
+	if err := server.SetRevisions(testSchema(t, map[string]string{"rev": revModuleText})); err == nil {
+		t.Errorf("SetRevisions of the served revisions: got no error")
+	}
+	if err := server.SetRevisions(testSchema(t, map[string]string{"rev": oldRevModuleText})); err != nil {
+		t.Fatalf("SetRevisions: %v", err)
+	}
+
+	steps := []struct {
+		method, url, revision, body string
+		status                      int
+		want                        string
+	}{
+		{"PUT", "/restconf/data/rev:system", "", `{"rev:system":{"hostname":"a"}}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data/rev:system/name", "", "", http.StatusBadRequest, ""},
+		{"PATCH", "/restconf/data/rev:system", "rev@2023-01-01", `{"rev:system":{"name":"b"}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/rev:system/name", "rev@2023-01-01", "", http.StatusOK, `{"rev:name":"b"}`},
+		{"GET", "/restconf/data/rev:system/hostname", "rev@2024-01-01", "", http.StatusOK, `{"rev:hostname":"a"}`},
+		{"GET", "/restconf/data/rev:system", "rev@2022-01-01", "", http.StatusBadRequest, ""},
+		{"GET", "/restconf/data/rev:system", "rev", "", http.StatusBadRequest, ""},
+		{"GET", "/restconf/yang/rev@2023-01-01", "", "", http.StatusOK, ""},
+		{"GET", "/restconf/yang/rev@2024-01-01", "", "", http.StatusOK, ""},
+		{"GET", "/restconf/yang/rev@2022-01-01", "", "", http.StatusNotFound, ""},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.url, strings.NewReader(step.body))
+		req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+		if step.revision != "" {
+			req.Header.Set(YANG_REVISION_HEADER, step.revision)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != step.status {
+			t.Fatalf("%s %s (%s): got status %d, want %d: %s", step.method, step.url, step.revision, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("%s %s (%s): got %s, want %s", step.method, step.url, step.revision, rsp.Body, step.want)
+		}
+	}
+}
+
+var olderRevModuleText = `
+module rev {
+  namespace "urn:rev";
+  prefix r;
+
+  revision 2022-01-01;
+
+  container system {
+    leaf label { type string; }
+  }
+}
+`
+
+func TestRevisionsCoexist(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"rev": revModuleText}))
+	if err := server.SetRevisions(
+		testSchema(t, map[string]string{"rev": oldRevModuleText}),
+		testSchema(t, map[string]string{"rev": olderRevModuleText})); err != nil {
+		t.Fatalf("SetRevisions: %v", err)
+	}
+
+	// The revisions share the datastore, each seeing the nodes it defines.
+	steps := []struct {
+		method, revision, body string
+		status                 int
+		want                   string
+	}{
+		{"PUT", "", `{"rev:system":{"hostname":"a"}}`, http.StatusCreated, ""},
+		{"PATCH", "rev@2023-01-01", `{"rev:system":{"name":"b"}}`, http.StatusNoContent, ""},
+		{"PATCH", "rev@2022-01-01", `{"rev:system":{"label":"c"}}`, http.StatusNoContent, ""},
+		{"GET", "", "", http.StatusOK, `{"rev:system":{"hostname":"a"}}`},
+		{"GET", "rev@2023-01-01", "", http.StatusOK, `{"rev:system":{"name":"b"}}`},
+		{"GET", "rev@2022-01-01", "", http.StatusOK, `{"rev:system":{"label":"c"}}`},
+		{"PATCH", "rev@2022-01-01", `{"rev:system":{"name":"d"}}`, http.StatusBadRequest, ""},
+		{"DELETE", "rev@2022-01-01", "", http.StatusNoContent, ""},
+		{"GET", "", "", http.StatusNotFound, ""},
+		{"GET", "rev@2023-01-01", "", http.StatusNotFound, ""},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, "/restconf/data/rev:system", strings.NewReader(step.body))
+		req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+		if step.revision != "" {
+			req.Header.Set(YANG_REVISION_HEADER, step.revision)
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != step.status {
+			t.Fatalf("%s (%s) %s: got status %d, want %d: %s", step.method, step.revision, step.body, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && rsp.Body.String() != step.want {
+			t.Errorf("%s (%s): got %s, want %s", step.method, step.revision, rsp.Body, step.want)
+		}
+	}
+
+	for _, rev := range []string{"2024-01-01", "2023-01-01", "2022-01-01"} {
+		if rsp := doRequest(server, "GET", "/restconf/yang/rev@"+rev, "", ""); rsp.Code != http.StatusOK {
+			t.Errorf("GET /restconf/yang/rev@%s: got status %d", rev, rsp.Code)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+   A resource registered with Register may name path parameters, segments of
+   the form {name} matching any single segment:
+
+   server.Register("/custom/{id}/status", handler)
+
+   The handler reads the segments the parameters matched, unescaped, with
+   PathParam(req, "id"). A parametric resource serves the paths with exactly
+   as many segments, not the resources below it. A path matching a resource
+   without parameters, or one below it, is served by that resource, unless a
+   parametric resource starts with more literal segments: /restconf/custom/{id}
+   takes precedence over /restconf. Parametric resources cannot be registered
+   below /restconf/data, the resources of the RESTCONF data tree are served
+   by the data resource.
+*/
+
+var pathParamsContextKey = contextKey("path-params")
+
+// A route is a registered resource with path parameters.
+type route struct {
+	pattern string
+	segs    []string // the segments of the pattern, "" for a parameter
+	params  []string // the names of the parameters by segment, "" for a literal
+	handler http.HandlerFunc
+}
+
+// isPattern reports whether the path of a registered resource names path
+// parameters.
+func isPattern(path string) bool {
+	return strings.ContainsAny(path, "{}")
+}
+
+// parseRoute parses the pattern of a resource with path parameters.
+func parseRoute(pattern string, handler http.HandlerFunc) (*route, error) {
+	r := &route{pattern: pattern, handler: handler}
+	names := make(map[string]bool)
+	for _, seg := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		name := ""
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name, seg = seg[1:len(seg)-1], ""
+			if !isIdentifier(name) || names[name] {
+				return nil, fmt.Errorf("invalid path parameter %q in %s", name, pattern)
+			}
+			names[name] = true
+		} else if strings.ContainsAny(seg, "{}") {
+			return nil, fmt.Errorf("invalid segment %q in %s", seg, pattern)
+		}
+		r.segs = append(r.segs, seg)
+		r.params = append(r.params, name)
+	}
+	return r, nil
+}
+
+// sameRoute reports whether the routes r and o match the same paths.
+func (r *route) sameRoute(o *route) bool {
+	if len(r.segs) != len(o.segs) {
+		return false
+	}
+	for i := range r.segs {
+		if r.segs[i] != o.segs[i] || (r.params[i] == "") != (o.params[i] == "") {
+			return false
+		}
+	}
+	return true
+}
+
+// literals returns the number of literal segments the pattern of r starts
+// with, and the number of its literal segments.
+func (r *route) literals() (prefix, all int) {
+	prefix = -1
+	for i, name := range r.params {
+		if name == "" {
+			all++
+		} else if prefix < 0 {
+			prefix = i
+		}
+	}
+	return prefix, all
+}
+
+// match returns the parameters of r the unescaped path segments segs match,
+// nil if they do not match r.
+func (r *route) match(segs []string) map[string]string {
+	if len(segs) != len(r.segs) {
+		return nil
+	}
+	params := make(map[string]string)
+	for i, seg := range segs {
+		if r.params[i] != "" {
+			if seg == "" {
+				return nil
+			}
+			params[r.params[i]] = seg
+		} else if seg != r.segs[i] {
+			return nil
+		}
+	}
+	return params
+}
+
+// registerRoute registers the resource with path parameters pattern,
+// restconf.muxMu held.
+func (restconf *RestConf) registerRoute(pattern string, handler http.HandlerFunc, override bool) error {
+	if data := RESTCONF_PREFIX + "/data"; strings.HasPrefix(pattern, data+"/") {
+		return fmt.Errorf("handler %s is below %s, the resources of the data tree are served by the data resource", pattern, data)
+	}
+	r, err := parseRoute(pattern, handler)
+	if err != nil {
+		return err
+	}
+	for i, o := range restconf.routes {
+		if !r.sameRoute(o) {
+			continue
+		}
+		if !override {
+			return fmt.Errorf("handler %s is already registered as %s", pattern, o.pattern)
+		}
+		restconf.routes[i] = r
+		return nil
+	}
+	restconf.routes = append(restconf.routes, r)
+	return nil
+}
+
+// matchRoute returns the route matching the escaped path and its parameters,
+// nil if no route starting with more than n literal segments matches.
+func (restconf *RestConf) matchRoute(path string, n int) (*route, map[string]string) {
+	segs := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, seg := range segs {
+		s, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, nil
+		}
+		segs[i] = s
+	}
+
+	var best *route
+	var bestParams map[string]string
+	bestPrefix, bestAll := n, 0
+	for _, r := range restconf.routes {
+		prefix, all := r.literals()
+		if prefix < bestPrefix || prefix == bestPrefix && (best == nil || all <= bestAll) {
+			continue
+		}
+		if params := r.match(segs); params != nil {
+			best, bestParams, bestPrefix, bestAll = r, params, prefix, all
+		}
+	}
+	return best, bestParams
+}
+
+// withPathParams returns req carrying the path parameters params.
+func withPathParams(req *http.Request, params map[string]string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), pathParamsContextKey, params))
+}
+
+// PathParam returns the path segment the parameter name of the resource
+// serving req matched, "" if the resource has no such parameter.
+func PathParam(req *http.Request, name string) string {
+	params, _ := req.Context().Value(pathParamsContextKey).(map[string]string)
+	return params[name]
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	server := testServer(t)
+	echo := func(name string, params ...string) http.HandlerFunc {
+		return func(rsp http.ResponseWriter, req *http.Request) {
+			body := name
+			for _, p := range params {
+				body += " " + p + "=" + PathParam(req, p)
+			}
+			rsp.Write([]byte(body))
+		}
+	}
+
+	for url, handler := range map[string]http.HandlerFunc{
+		"/custom/{id}":             echo("custom", "id"),
+		"/custom/{id}/status":      echo("status", "id"),
+		"/custom/all/status":       echo("all"),
+		"/custom/{id}/{part}":      echo("part", "id", "part"),
+		"/restconf/example/{name}": echo("example", "name"),
+		"/{any}/x":                 echo("any", "any"),
+	} {
+		if err := server.Register(url, handler); err != nil {
+			t.Fatalf("Register %s: %v", url, err)
+		}
+	}
+
+	for _, test := range []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/custom/a", http.StatusOK, "custom id=a"},
+		{"/custom/a%2Fb", http.StatusOK, "custom id=a/b"},
+		{"/custom/a/status", http.StatusOK, "status id=a"},
+		{"/custom/all/status", http.StatusOK, "all"},
+		{"/custom/a/info", http.StatusOK, "part id=a part=info"},
+		{"/custom", http.StatusNotFound, ""},
+		{"/custom/a/b/c", http.StatusNotFound, ""},
+		{"/restconf/example/eth%200", http.StatusOK, "example name=eth 0"},
+		{"/other/x", http.StatusOK, "any any=other"},
+		{"/restconf/x", http.StatusOK, `{"ietf-restconf:restconf"`},
+	} {
+		rsp := doRequest(server, "GET", test.url, "", "")
+		if rsp.Code != test.code || !strings.HasPrefix(rsp.Body.String(), test.body) {
+			t.Errorf("GET %s: got status %d, body %s, want %d %s", test.url, rsp.Code, rsp.Body, test.code, test.body)
+		}
+	}
+
+	// Patterns below the data resource are refused with the invalid ones,
+	// the resources of the data tree are served by the data resource.
+	for _, url := range []string{"/custom/{other}", "/custom/{a}/{a}", "/custom/{}", "/custom/x{id}", "/custom/{id",
+		"/restconf/data/{module}/foo", "/restconf/data/test:system/{name}"} {
+		if err := server.Register(url, echo("again")); err == nil {
+			t.Errorf("Register %s: got no error", url)
+		}
+	}
+	if err := server.Override("/custom/{other}", echo("other", "other")); err != nil {
+		t.Fatal(err)
+	}
+	if rsp := doRequest(server, "GET", "/custom/a", "", ""); rsp.Body.String() != "other other=a" {
+		t.Errorf("got body %s after Override", rsp.Body)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+// MAX_SCHEMA_DEPTH bounds the levels of data nodes indexed and encoded below
+// a module, guarding against schemas that nest without end.
+var MAX_SCHEMA_DEPTH = 256
+
+// Schema is the set of processed YANG modules served by the RESTCONF server.
+type Schema struct {
+	// Modules maps a module name to the root of its entry tree.
+	Modules map[string]*yang.Entry
+
+	namespaces map[string]string
+	modules    map[string]*yang.Module // parsed modules, for their source and revision
+
+	// index maps the schema key (see schemaKey) of every node below the
+	// modules to its entry, so that paths resolve with one lookup per
+	// segment.
+	index map[string]*yang.Entry
+
+	// mounts maps the schema key of every mount point to it.
+	mounts map[string]*MountPoint
+
+	// constraints holds the compiled must and when expressions of the
+	// data nodes, constrained the modules having any or instance-identifier
+	// leafs requiring their instance.
+	constraints map[*yang.Entry]*nodeConstraints
+	constrained map[string]bool
+
+	// hidden holds the modules not exposed to the clients, see Expose.
+	hidden map[string]bool
+
+	// yangErrors is the errors container of the yang-errors structure of
+	// ietf-restconf, nil if the module is not loaded.
+	yangErrors *yang.Entry
+
+	// openapi holds the OpenAPI documents of the schema by module, "" for
+	// all of them, generated on first request.
+	openapiMu sync.Mutex
+	openapi   map[string]*cachedResponse
+}
+
+// NewSchema builds the entry trees of every module in ms. Process must have
+// been called on ms beforehand.
+func NewSchema(ms *yang.Modules) *Schema {
+	schema := &Schema{
+		Modules:    make(map[string]*yang.Entry),
+		namespaces: make(map[string]string),
+		modules:    make(map[string]*yang.Module),
+		index:      make(map[string]*yang.Entry),
+		mounts:     make(map[string]*MountPoint),
+
+		constraints: make(map[*yang.Entry]*nodeConstraints),
+		constrained: make(map[string]bool),
+	}
+
+	for name, mod := range ms.Modules {
+		// ms.Modules also holds revision qualified aliases (name@revision)
+		// of every module, skip those.
+		if name != mod.Name {
+			continue
+		}
+		schema.Modules[name] = yang.ToEntry(mod)
+		schema.modules[name] = mod
+		if mod.Namespace != nil {
+			schema.namespaces[mod.Namespace.Name] = name
+		}
+	}
+
+	for name, e := range schema.Modules {
+		schema.indexChildren("/"+name, e, 1)
+	}
+	if mod, ok := schema.modules[RESTCONF_MODULE]; ok {
+		schema.yangErrors = yangData(mod, YANG_ERRORS_STRUCT)
+	}
+
+	return schema
+}
+
+// indexChildren adds the children of e, whose schema key is key, and their
+// descendants to the index, the children being at level depth. Choice and
+// case nodes are looked through, as findChild does. Nodes below
+// MAX_SCHEMA_DEPTH are left out. Mount points, the must and when expressions
+// of the nodes and the instance-identifier leafs requiring their instance
+// are recorded as they are found.
+func (schema *Schema) indexChildren(key string, e *yang.Entry, depth int) {
+	if depth > MAX_SCHEMA_DEPTH {
+		if len(e.Dir) > 0 {
+			log.Println("schema", key, "is nested deeper than", MAX_SCHEMA_DEPTH, "levels, its children are not served!")
+		}
+		return
+	}
+	for name, child := range e.Dir {
+		if child.IsChoice() || child.IsCase() {
+			schema.indexChildren(key, child, depth)
+			continue
+		}
+		schema.index[key+"/"+name] = child
+		if c := compileConstraints(key+"/"+name, child); c != nil {
+			schema.constraints[child] = c
+			schema.constrained[strings.SplitN(key, "/", 3)[1]] = true
+		}
+		if requiresInstance(child) {
+			schema.constrained[strings.SplitN(key, "/", 3)[1]] = true
+		}
+		if label := mountLabel(child); label != "" {
+			schema.mounts[key+"/"+name] = &MountPoint{Module: schema.ModuleOf(child), Label: label, Entry: child}
+		}
+		schema.indexChildren(key+"/"+name, child, depth+1)
+	}
+}
+
+// entryDepth returns the level of the data node e below its module.
+func entryDepth(e *yang.Entry) int {
+	depth := 0
+	for ; e != nil && e.Parent != nil; e = e.Parent {
+		if !e.IsChoice() && !e.IsCase() {
+			depth++
+		}
+	}
+	return depth
+}
+
+// Lookup returns the node with the schema key "/module/node/...", or nil if
+// there is no such node.
+func (schema *Schema) Lookup(key string) *yang.Entry {
+	return schema.index[key]
+}
+
+// ModuleNames returns the name of every exposed module in the schema,
+// sorted.
+func (schema *Schema) ModuleNames() []string {
+	names := make([]string, 0, len(schema.Modules))
+	for name := range schema.Modules {
+		if !schema.hidden[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModuleRevision returns the most recent revision of the module name, or ""
+// if it has none.
+func (schema *Schema) ModuleRevision(name string) string {
+	if mod, ok := schema.modules[name]; ok {
+		return mod.Current()
+	}
+	return ""
+}
+
+// YangLibraryVersion returns the revision of the loaded ietf-yang-library
+// module, or YANG_LIBRARY_VERSION if it is not loaded. Only a top-level
+// module counts, not one mounted below a mount point.
+func (schema *Schema) YangLibraryVersion() string {
+	if _, ok := schema.Modules[YANG_LIBRARY_MODULE]; ok {
+		if rev := schema.ModuleRevision(YANG_LIBRARY_MODULE); rev != "" {
+			return rev
+		}
+	}
+	return YANG_LIBRARY_VERSION
+}
+
+// ModuleOf returns the name of the module whose namespace e is defined in.
+// Nodes added by an augment belong to the augmenting module.
+func (schema *Schema) ModuleOf(e *yang.Entry) string {
+	return schema.namespaces[e.Namespace().Name]
+}
+
+// ModuleByNamespace returns the name of the module with namespace ns, or ""
+// if no such module is loaded.
+func (schema *Schema) ModuleByNamespace(ns string) string {
+	return schema.namespaces[ns]
+}
+
+// findChild returns the data node child of e called name. Choice and case
+// nodes are not part of the data tree, so their children are searched as if
+// they were direct children of e.
+func findChild(e *yang.Entry, name string) *yang.Entry {
+	if child, ok := e.Dir[name]; ok && !child.IsChoice() && !child.IsCase() {
+		return child
+	}
+	for _, child := range e.Dir {
+		if child.IsChoice() || child.IsCase() {
+			if found := findChild(child, name); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// findDataChild is findChild for data nodes only, it does not return rpcs,
+// actions or notifications.
+func findDataChild(e *yang.Entry, name string) *yang.Entry {
+	child := findChild(e, name)
+	if child == nil || isOperation(child) || isNotification(child) {
+		return nil
+	}
+	return child
+}
+
+// dataChildren returns the data node children of e sorted by name, looking
+// through choice and case nodes and leaving out rpcs, actions and
+// notifications.
+func dataChildren(e *yang.Entry) []*yang.Entry {
+	var children []*yang.Entry
+	for _, child := range e.Dir {
+		switch {
+		case child.IsChoice() || child.IsCase():
+			children = append(children, dataChildren(child)...)
+		case isOperation(child) || isNotification(child):
+		default:
+			children = append(children, child)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// isOperation reports whether e is an rpc or an action.
+func isOperation(e *yang.Entry) bool {
+	return e.RPC != nil
+}
+
+// isAction reports whether e is an action, i.e. an operation bound to a data
+// node rather than a top-level rpc.
+func isAction(e *yang.Entry) bool {
+	return e.RPC != nil && e.Node != nil && e.Node.Kind() == "action"
+}
+
+// isNotification reports whether e is a notification.
+func isNotification(e *yang.Entry) bool {
+	return e.Kind == yang.NotificationEntry
+}
+
+// sortedNames returns the keys of dir in sorted order.
+func sortedNames(dir map[string]*yang.Entry) []string {
+	names := make([]string, 0, len(dir))
+	for name := range dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keyNames returns the names of the key leafs of the list e.
+func keyNames(e *yang.Entry) []string {
+	return strings.Fields(e.Key)
+}
+
+// isKey reports whether name is a key leaf of the list e.
+func isKey(e *yang.Entry, name string) bool {
+	for _, key := range keyNames(e) {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
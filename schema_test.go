@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+var testModuleText = `
+module test {
+  yang-version 1.1;
+  namespace "urn:test";
+  prefix t;
+
+  revision 2024-01-01;
+
+  identity speed;
+  identity fast { base speed; }
+  identity slow { base speed; }
+
+  typedef level {
+    type union {
+      type uint8 { range "0..10"; }
+      type enumeration { enum low; enum high; }
+    }
+  }
+
+  container system {
+    leaf hostname { type string; }
+    leaf debug { type empty; }
+    leaf counter { type uint64; }
+    leaf uptime { type uint32; config false; }
+    leaf ratio {
+      type decimal64 { fraction-digits 2; range "-1.5..100"; }
+    }
+    leaf precise {
+      type decimal64 { fraction-digits 18; }
+    }
+    leaf mode {
+      type union {
+        type level;
+        type identityref { base speed; }
+        type leafref { path "../counter"; }
+        type boolean;
+      }
+    }
+    leaf flags {
+      type bits {
+        bit up { position 0; }
+        bit running { position 2; }
+        bit loopback { position 1; }
+      }
+    }
+    leaf offset {
+      type int64 { range "min..-1 | 1..9007199254740993"; }
+    }
+    list interface {
+      key "name unit";
+      leaf name { type string; }
+      leaf unit { type uint8; }
+      leaf mtu { type uint16; }
+      container ipv4 {
+        leaf address { type string; }
+        container dhcp {
+          leaf enabled { type boolean; }
+          leaf lease { type uint32; }
+        }
+      }
+      action reset {
+        input {
+          leaf delay { type uint32; }
+        }
+        output {
+          leaf status { type string; }
+        }
+      }
+    }
+  }
+
+  rpc reboot {
+    input {
+      leaf delay { type uint32; }
+    }
+  }
+
+  rpc ping {
+    output {
+      leaf reply { type string; }
+    }
+  }
+}
+`
+
+// testSchema parses and processes the given modules, named by the key of
+// modules.
+func testSchema(t testing.TB, modules map[string]string) *Schema {
+	ms := yang.NewModules()
+	for name, text := range modules {
+		if err := ms.Parse(text, name+".yang"); err != nil {
+			t.Fatalf("parse %s: %v", name, err)
+		}
+	}
+	if errs := ms.Process(); len(errs) > 0 {
+		t.Fatalf("process: %v", errs)
+	}
+	return NewSchema(ms)
+}
+
+func testServer(t testing.TB) *RestConf {
+	return NewRestConf(testSchema(t, map[string]string{"test": testModuleText}))
+}
+
+// deepModule returns a module of depth nested containers. Each container is
+// defined in a choice besides siblings other choices, the children of which
+// findChild has to search through.
+func deepModule(depth, siblings int) (string, []PathSegment) {
+	var b strings.Builder
+	var segs []PathSegment
+	b.WriteString("module deep { namespace \"urn:deep\"; prefix d;\n")
+	for i := 0; i < depth; i++ {
+		name := fmt.Sprintf("c%d", i)
+		for j := 0; j < siblings; j++ {
+			fmt.Fprintf(&b, "choice s%d { leaf l%d { type string; } }\n", j, j)
+		}
+		fmt.Fprintf(&b, "choice n%d { container %s {\n", i, name)
+		segs = append(segs, PathSegment{Name: name})
+	}
+	b.WriteString(strings.Repeat("} }\n", depth))
+	b.WriteString("}\n")
+	segs[0].Module = "deep"
+	return b.String(), segs
+}
+
+func TestSchemaIndex(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+
+	for key, want := range map[string]string{
+		"/test/system":                  "system",
+		"/test/system/interface/mtu":    "mtu",
+		"/test/system/interface/reset":  "reset",
+		"/test/reboot":                  "reboot",
+		"/test/system/interface/name/x": "",
+		"/test/nosuchnode":              "",
+	} {
+		e := schema.Lookup(key)
+		if (e == nil && want != "") || (e != nil && e.Name != want) {
+			t.Errorf("Lookup(%s) = %v, want %q", key, e, want)
+		}
+	}
+}
+
+// resolveLinear resolves segs by searching the children of each node, as
+// done before the schema index.
+func resolveLinear(schema *Schema, segs []PathSegment) *yang.Entry {
+	e := schema.Modules[segs[0].Module]
+	for _, seg := range segs {
+		if e = findChild(e, seg.Name); e == nil {
+			return nil
+		}
+	}
+	return e
+}
+
+func BenchmarkResolve(b *testing.B) {
+	text, segs := deepModule(16, 16)
+	schema := testSchema(b, map[string]string{"deep": text})
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := schema.Resolve(segs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if resolveLinear(schema, segs) == nil {
+				b.Fatal("unresolved path")
+			}
+		}
+	})
+}
+
+func TestMaxSchemaDepth(t *testing.T) {
+	defer func(depth int) { MAX_SCHEMA_DEPTH = depth }(MAX_SCHEMA_DEPTH)
+
+	server := testServer(t)
+	body := `{"test:system":{"interface":[{"name":"eth0","unit":0,"ipv4":{"dhcp":{"enabled":true}}}]}}`
+	if rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, body); rsp.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d: %s", rsp.Code, http.StatusCreated, rsp.Body)
+	}
+
+	MAX_SCHEMA_DEPTH = 4
+	rsp := doRequest(server, "GET", "/restconf/data/test:system", "", "")
+	if rsp.Code != http.StatusInternalServerError || !strings.Contains(rsp.Body.String(), "deeper than 4 levels") {
+		t.Errorf("got status %d, want %d: %s", rsp.Code, http.StatusInternalServerError, rsp.Body)
+	}
+	MAX_SCHEMA_DEPTH = 5
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system", "", ""); rsp.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d: %s", rsp.Code, http.StatusOK, rsp.Body)
+	}
+
+	MAX_SCHEMA_DEPTH = 4
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+	if schema.Lookup("/test/system/interface/ipv4/dhcp") == nil {
+		t.Errorf("node at level 4 is not indexed")
+	}
+	if schema.Lookup("/test/system/interface/ipv4/dhcp/enabled") != nil {
+		t.Errorf("node at level 5 is indexed")
+	}
+}
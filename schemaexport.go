@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The schema export is a vendor resource: a GET of /restconf/schema returns
+   the schema tree of every module, for tooling building on the models
+   without a YANG parser of its own. The descriptions query parameter adds
+   the description, reference and status of every node.
+
+   GET /restconf/schema?descriptions=true
+
+   {
+     "go-restconf:schema" : {
+       "module" : [
+         {
+           "name" : "example",
+           "revision" : "2024-01-01",
+           "namespace" : "urn:example",
+           "node" : [
+             {
+               "name" : "system",
+               "kind" : "container",
+               "config" : true,
+               "description" : "System parameters.",
+               "status" : "current",
+               "node" : [ ... ]
+             }
+           ]
+         }
+       ]
+     }
+   }
+*/
+
+var (
+	SCHEMA_EXPORT_PREFIX      = RESTCONF_PREFIX + "/schema"
+	SCHEMA_DESCRIPTIONS_PARAM = "descriptions"
+	APPLICATION_JSON          = "application/json"
+)
+
+type SchemaModule struct {
+	Name      string        `json:"name"`
+	Revision  string        `json:"revision,omitempty"`
+	Namespace string        `json:"namespace"`
+	Nodes     []*SchemaNode `json:"node,omitempty"`
+}
+
+type SchemaNode struct {
+	Name   string   `json:"name"`
+	Kind   string   `json:"kind"`             // the YANG keyword of the node, e.g. "leaf-list"
+	Config *bool    `json:"config,omitempty"` // nil for the nodes of operations and notifications
+	Type   string   `json:"type,omitempty"`
+	Keys   []string `json:"key,omitempty"`
+
+	Description string `json:"description,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Status      string `json:"status,omitempty"`
+
+	Nodes []*SchemaNode `json:"node,omitempty"`
+}
+
+type SchemaExportJson struct {
+	Schema struct {
+		Modules []*SchemaModule `json:"module"`
+	} `json:"go-restconf:schema"`
+}
+
+// substatement returns the argument of the substatement keyword of the
+// statement of e, "" if it has none.
+func substatement(e *yang.Entry, keyword string) string {
+	if e.Node == nil {
+		return ""
+	}
+	for _, s := range e.Node.Statement().SubStatements() {
+		if s.Keyword == keyword {
+			return s.Argument
+		}
+	}
+	return ""
+}
+
+// schemaNode returns the export of the schema node e and those below it,
+// with their descriptions if described. data reports whether e is within
+// the data tree rather than an operation or notification.
+func schemaNode(e *yang.Entry, data, described bool) *SchemaNode {
+	node := &SchemaNode{Name: e.Name}
+	if data = data && !isOperation(e) && !isNotification(e); data {
+		config := !e.ReadOnly()
+		node.Config = &config
+	}
+	if e.Node != nil {
+		node.Kind = e.Node.Kind()
+	}
+	if e.Type != nil {
+		node.Type = e.Type.Name
+	}
+	if e.IsList() {
+		node.Keys = keyNames(e)
+	}
+	if described {
+		node.Description = e.Description
+		node.Reference = substatement(e, "reference")
+		if node.Status = substatement(e, "status"); node.Status == "" {
+			node.Status = "current"
+		}
+	}
+
+	children := e.Dir
+	if isOperation(e) {
+		children = map[string]*yang.Entry{}
+		for _, io := range []*yang.Entry{e.RPC.Input, e.RPC.Output} {
+			if io != nil {
+				children[io.Name] = io
+			}
+		}
+	}
+	for _, name := range sortedNames(children) {
+		node.Nodes = append(node.Nodes, schemaNode(children[name], data, described))
+	}
+	return node
+}
+
+// SchemaExport sends the schema tree of the modules of the schema. It is a
+// vendor resource, not part of RESTCONF.
+func (restconf *RestConf) SchemaExport(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+
+	var described bool
+	if s, ok := req.URL.Query()[SCHEMA_DESCRIPTIONS_PARAM]; ok {
+		b, err := strconv.ParseBool(s[0])
+		if len(s) != 1 || err != nil {
+			writeError(rsp, req, invalidValue("invalid %s parameter %q", SCHEMA_DESCRIPTIONS_PARAM, s[0]))
+			return
+		}
+		described = b
+	}
+
+	schema := restconf.schemaOf(req)
+	var export SchemaExportJson
+	export.Schema.Modules = []*SchemaModule{}
+	for _, name := range schema.ModuleNames() {
+		e := schema.Modules[name]
+		mod := &SchemaModule{Name: name, Revision: schema.ModuleRevision(name), Namespace: e.Namespace().Name}
+		for _, child := range sortedNames(e.Dir) {
+			mod.Nodes = append(mod.Nodes, schemaNode(e.Dir[child], true, described))
+		}
+		export.Schema.Modules = append(export.Schema.Modules, mod)
+	}
+
+	body, err := json.Marshal(export)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	rsp.Header().Set("Content-Type", APPLICATION_JSON)
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return
+	}
+	rsp.Write(body)
+}
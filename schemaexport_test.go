@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+var exportModuleText = `
+module export {
+  namespace "urn:export";
+  prefix x;
+
+  container system {
+    description "System parameters.";
+    leaf hostname {
+      type string;
+      reference "RFC 1123";
+    }
+    leaf uptime {
+      type uint32;
+      config false;
+      status deprecated;
+    }
+    list user {
+      key name;
+      leaf name { type string; }
+    }
+  }
+
+  rpc ping {
+    output {
+      leaf time { type uint32; }
+    }
+  }
+}
+`
+
+func TestSchemaExport(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"export": exportModuleText}))
+
+	for _, test := range []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{"", http.StatusOK, `{"go-restconf:schema":{"module":[{"name":"export","namespace":"urn:export","node":[` +
+			`{"name":"ping","kind":"rpc","node":[{"name":"output","kind":"output","node":[` +
+			`{"name":"time","kind":"leaf","type":"uint32"}]}]},` +
+			`{"name":"system","kind":"container","config":true,"node":[` +
+			`{"name":"hostname","kind":"leaf","config":true,"type":"string"},` +
+			`{"name":"uptime","kind":"leaf","config":false,"type":"uint32"},` +
+			`{"name":"user","kind":"list","config":true,"key":["name"],"node":[` +
+			`{"name":"name","kind":"leaf","config":true,"type":"string"}]}]}]}]}}`},
+		{"?descriptions=true", http.StatusOK, `{"go-restconf:schema":{"module":[{"name":"export","namespace":"urn:export","node":[` +
+			`{"name":"ping","kind":"rpc","status":"current","node":[{"name":"output","kind":"output","status":"current","node":[` +
+			`{"name":"time","kind":"leaf","type":"uint32","status":"current"}]}]},` +
+			`{"name":"system","kind":"container","config":true,"description":"System parameters.","status":"current","node":[` +
+			`{"name":"hostname","kind":"leaf","config":true,"type":"string","reference":"RFC 1123","status":"current"},` +
+			`{"name":"uptime","kind":"leaf","config":false,"type":"uint32","status":"deprecated"},` +
+			`{"name":"user","kind":"list","config":true,"key":["name"],"status":"current","node":[` +
+			`{"name":"name","kind":"leaf","config":true,"type":"string","status":"current"}]}]}]}]}}`},
+		{"?descriptions=maybe", http.StatusBadRequest, ""},
+	} {
+		url := "/restconf/schema" + test.query
+		rsp := doRequest(server, "GET", url, "", "")
+		if rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d: %s", url, rsp.Code, test.status, rsp.Body)
+			continue
+		}
+		if test.want != "" && rsp.Body.String() != test.want {
+			t.Errorf("GET %s: got\n%s\nwant\n%s", url, rsp.Body, test.want)
+		}
+	}
+
+	rsp := doRequest(server, "HEAD", "/restconf/schema", "", "")
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != APPLICATION_JSON || rsp.Body.Len() != 0 {
+		t.Errorf("HEAD: got status %d, Content-Type %q, body %s", rsp.Code, rsp.Header().Get("Content-Type"), rsp.Body)
+	}
+}
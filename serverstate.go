@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The server describes itself in the built-in module go-restconf-server,
+   loaded along with the models, whose state data it provides:
+
+   GET /restconf/data/go-restconf-server:server-state
+
+   {
+     "go-restconf-server:server-state" : {
+       "start-time" : "2021-03-04T05:06:07Z",
+       "uptime" : "3600",
+       "total-requests" : "1234",
+       "active-streams" : 2
+     }
+   }
+
+   The module has a namespace of its own, under the URL of the project. It is
+   hidden with -hide go-restconf-server like any other module. Its start-time
+   is a date-and-time of ietf-yang-types (RFC 6991), read from the yang path,
+   or built in with that type alone when the path does not hold the module.
+*/
+
+var SERVER_STATE_MODULE = "go-restconf-server"
+
+var serverStateModuleText = `
+module go-restconf-server {
+  namespace "https://github.com/lixiangyun/go-restconf/server";
+  prefix rcsrv;
+
+  import ietf-yang-types { prefix yang; }
+
+  organization "go-restconf";
+  description "The state of the RESTCONF server itself.";
+
+  revision 2021-03-02 {
+    description "The start-time is a yang:date-and-time.";
+  }
+  revision 2021-03-01 {
+    description "Initial revision.";
+  }
+
+  container server-state {
+    config false;
+    description "The state of the server.";
+
+    leaf start-time {
+      type yang:date-and-time;
+      description "The time the server started.";
+    }
+    leaf uptime {
+      type uint64;
+      units seconds;
+      description "The time since the server started.";
+    }
+    leaf total-requests {
+      type uint64;
+      description "The number of requests received since the server started.";
+    }
+    leaf active-streams {
+      type uint32;
+      description "The number of clients listening to an event stream.";
+    }
+  }
+}
+`
+
+// YANG_TYPES_MODULE is the module of the date-and-time type.
+var YANG_TYPES_MODULE = "ietf-yang-types"
+
+// yangTypesModuleText is the part of ietf-yang-types the server state module
+// uses, loaded when the yang path does not hold the module.
+var yangTypesModuleText = `
+module ietf-yang-types {
+  namespace "urn:ietf:params:xml:ns:yang:ietf-yang-types";
+  prefix yang;
+
+  organization "IETF NETMOD (NETCONF Data Modeling Language) Working Group";
+  description "The date-and-time type of RFC 6991, built into go-restconf.";
+
+  revision 2013-07-15 {
+    reference "RFC 6991: Common YANG Data Types";
+  }
+
+  typedef date-and-time {
+    type string {
+      pattern '\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?'
+            + '(Z|[\+\-]\d{2}:\d{2})';
+    }
+  }
+}
+`
+
+// loadServerState adds the server state module to ms, along with
+// ietf-yang-types if it is neither in ms nor on the yang path. The built-in
+// modules cannot fail to parse.
+func loadServerState(ms *yang.Modules) {
+	if ms.Modules[YANG_TYPES_MODULE] == nil && ms.Read(YANG_TYPES_MODULE) != nil {
+		ms.Parse(yangTypesModuleText, YANG_TYPES_MODULE+".yang")
+	}
+	ms.Parse(serverStateModuleText, SERVER_STATE_MODULE+".yang")
+}
+
+// serverStats are the counters of the server state.
+type serverStats struct {
+	started  time.Time
+	requests int64 // atomic
+}
+
+// countRequest counts a request received by the server.
+func (restconf *RestConf) countRequest() {
+	atomic.AddInt64(&restconf.stats.requests, 1)
+}
+
+// activeStreams returns the number of listeners of the event streams.
+func (restconf *RestConf) activeStreams() int {
+	n := 0
+	for _, stream := range restconf.Streams() {
+		stream.mu.Lock()
+		n += len(stream.listeners)
+		stream.mu.Unlock()
+	}
+	return n
+}
+
+// serverState provides the server-state of the go-restconf-server module.
+func (restconf *RestConf) serverState(st *StateRequest) (interface{}, error) {
+	now := restconf.now()
+	uptime := now.Sub(restconf.stats.started) / time.Second
+	if uptime < 0 {
+		uptime = 0
+	}
+	return map[string]interface{}{
+		"start-time":     restconf.stats.started.UTC().Format(time.RFC3339),
+		"uptime":         strconv.FormatInt(int64(uptime), 10),
+		"total-requests": strconv.FormatInt(atomic.LoadInt64(&restconf.stats.requests), 10),
+		"active-streams": restconf.activeStreams(),
+	}, nil
+}
+
+// regServerState registers the provider of the server state.
+func (restconf *RestConf) regServerState() {
+	restconf.RegStateTTL("/"+SERVER_STATE_MODULE+":server-state", -1, restconf.serverState)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServerState(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		SERVER_STATE_MODULE: serverStateModuleText,
+		YANG_TYPES_MODULE:   yangTypesModuleText,
+	}))
+	start := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	server.SetClock(fixedClock(start))
+
+	doRequest(server, "GET", RESTCONF_PREFIX, "", "")
+	doRequest(server, "GET", "/restconf/bogus", "", "")
+	server.clock = fixedClock(start.Add(90 * time.Second))
+
+	rsp := doRequest(server, "GET", "/restconf/data/go-restconf-server:server-state", "", "")
+	want := `{"go-restconf-server:server-state":{"active-streams":0,"start-time":"2021-03-04T05:06:07Z",` +
+		`"total-requests":"3","uptime":"90"}}`
+	if rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Errorf("got status %d body %s, want %s", rsp.Code, rsp.Body, want)
+	}
+
+	// The module is not configuration, writing it fails.
+	rsp = doRequest(server, "PUT", "/restconf/data/go-restconf-server:server-state", APPLICATION_DATA_JSON,
+		`{"go-restconf-server:server-state":{}}`)
+	if rsp.Code == http.StatusCreated || rsp.Code == http.StatusNoContent {
+		t.Errorf("PUT server-state: got status %d", rsp.Code)
+	}
+}
+
+func TestServerStateLoaded(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.yang")
+	if err := os.WriteFile(file, []byte(`module a { namespace "urn:a"; prefix a; leaf x { type string; } }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schema, errs := LoadSchema(file)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if schema.Lookup("/"+SERVER_STATE_MODULE+"/server-state") == nil {
+		t.Errorf("the %s module is not loaded along with the models", SERVER_STATE_MODULE)
+	}
+	if e := schema.Lookup("/" + SERVER_STATE_MODULE + "/server-state/start-time"); e == nil || e.Type.Name != "date-and-time" {
+		t.Errorf("start-time is not a date-and-time")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/*
+   On SIGINT or SIGTERM the server shuts down gracefully. The event streams
+   and subscription streams are drained first: each is sent a final shutdown
+   event and closed, and the server waits up to -stream-drain for them to
+   end. It then stops accepting connections and waits up to
+   -shutdown-timeout for the other requests in progress, closing the
+   connections left after that.
+
+   event: shutdown
+   data: the server is shutting down
+
+   The shutdown event is a named event, the message handlers of the clients
+   reading the notifications do not receive it.
+*/
+
+var (
+	SHUTDOWN_TIMEOUT = 30 * time.Second
+	STREAM_DRAIN     = 5 * time.Second
+)
+
+var SHUTDOWN_EVENT = "event: shutdown\ndata: the server is shutting down\n\n"
+
+// streamDrain tracks the open streams of the server to drain them on
+// shutdown.
+type streamDrain struct {
+	once     sync.Once
+	draining chan struct{} // closed once the streams are drained
+	open     int64         // atomic
+}
+
+// trackStream counts a stream opened until the returned func is called, and
+// returns the channel closed once the stream must end.
+func (restconf *RestConf) trackStream() (draining <-chan struct{}, done func()) {
+	atomic.AddInt64(&restconf.drain.open, 1)
+	return restconf.drain.draining, func() { atomic.AddInt64(&restconf.drain.open, -1) }
+}
+
+// endStream sends the shutdown event ending a stream to rsp.
+func endStream(rsp http.ResponseWriter, req *http.Request) {
+	if _, err := fmt.Fprint(rsp, SHUTDOWN_EVENT); err != nil {
+		logRequest(req, "write shutdown event failed!", err.Error())
+		return
+	}
+	if flusher, ok := rsp.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// DrainStreams ends the event streams and subscription streams of the server
+// with the shutdown event, those opened later at once, and waits up to
+// timeout for them to close. It reports whether every stream closed.
+func (restconf *RestConf) DrainStreams(timeout time.Duration) bool {
+	restconf.drain.once.Do(func() { close(restconf.drain.draining) })
+
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&restconf.drain.open) > 0 {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// shutdownOnSignal shuts srv serving server down gracefully on SIGINT or
+// SIGTERM, and returns the channel closed once it is shut down.
+func shutdownOnSignal(server *RestConf, srv *http.Server) <-chan struct{} {
+	done := make(chan struct{})
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-term
+		signal.Stop(term)
+		log.Println("shutting down")
+
+		if !server.DrainStreams(STREAM_DRAIN) {
+			log.Println("streams still open after", STREAM_DRAIN, "are closed")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("requests still in progress after", SHUTDOWN_TIMEOUT, "are closed")
+			srv.Close()
+		}
+		close(done)
+	}()
+	return done
+}
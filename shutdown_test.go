@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainStreams(t *testing.T) {
+	server := testServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	stream, done := openStream(t, ts, STREAMS_PREFIX+"/"+NETCONF_STREAM+"/json")
+	defer done()
+	for server.activeStreams() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if !server.DrainStreams(time.Second) {
+		t.Fatal("the stream is still open")
+	}
+	rest, _ := io.ReadAll(stream)
+	if string(rest) != SHUTDOWN_EVENT {
+		t.Errorf("got %q, want the shutdown event", rest)
+	}
+	if n := server.activeStreams(); n != 0 {
+		t.Errorf("got %d active streams", n)
+	}
+
+	// A stream opened while the server shuts down ends at once.
+	stream, done = openStream(t, ts, STREAMS_PREFIX+"/"+NETCONF_STREAM+"/json")
+	defer done()
+	if rest, _ := io.ReadAll(stream); !strings.HasPrefix(string(rest), "event: shutdown\n") {
+		t.Errorf("got %q, want the shutdown event", rest)
+	}
+}
+
+func TestDrainStreamsTimeout(t *testing.T) {
+	server := testServer(t)
+	// A stream that does not close in time.
+	_, done := server.trackStream()
+	defer done()
+
+	start := time.Now()
+	if server.DrainStreams(50 * time.Millisecond) {
+		t.Error("DrainStreams reported the streams closed")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond || d > time.Second {
+		t.Errorf("DrainStreams waited %v", d)
+	}
+}
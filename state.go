@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   State data (config false) is not written by the clients, the application
+   computes it. A StateProvider registered for a state node returns its data
+   whenever a GET reads the node, merged with the configuration:
+
+   server.RegState("/example:system/interface/statistics", func(st *StateRequest) (interface{}, error) {
+     return map[string]interface{}{"in-octets": counters(st.Key("name"))}, nil
+   })
+
+   A provider within a list is called for every configured entry of the list
+   that is read, with the keys of the entry. The data is returned as it is
+   encoded in JSON (RFC 7951), e.g. a map for a container, a slice of
+   entries for a list and a number or a string for a leaf.
+*/
+
+// A StateProvider returns the state data of the node of st, nil if there is
+// none. A provider failing the read fails it with operation-failed.
+type StateProvider func(st *StateRequest) (interface{}, error)
+
+// A StateRequest is a single read of the state data of a provider.
+type StateRequest struct {
+	Request *http.Request
+	Entry   *yang.Entry // schema node of the provider
+
+	// Keys holds the key values of every list instance above the node,
+	// outermost first.
+	Keys []InstanceKey
+}
+
+// Key returns the value of the key leaf name of the innermost list instance
+// above the node that has such a key, or "" if there is none.
+func (st *StateRequest) Key(name string) string {
+	return keyValue(st.Keys, name)
+}
+
+// RegState registers the provider of the state data at the schema path given
+// as "/module:node/...", like the path of RegAction. The node must be
+// config false, a provider of a configuration node is not called.
+func (restconf *RestConf) RegState(path string, provider StateProvider) error {
+	return restconf.RegStateTTL(path, 0, provider)
+}
+
+// RegStateTTL registers the provider of the state data at path like
+// RegState, its data being cached for ttl rather than STATE_CACHE_TTL. A
+// negative ttl never caches it.
+func (restconf *RestConf) RegStateTTL(path string, ttl time.Duration, provider StateProvider) error {
+	key, err := nodeKey("state", path, 1)
+	if err != nil {
+		return err
+	}
+
+	restconf.statesMu.Lock()
+	defer restconf.statesMu.Unlock()
+
+	if _, ok := restconf.states[key]; ok {
+		return fmt.Errorf("state %s is already registered", key)
+	}
+	restconf.states[key] = &stateProvider{provider: provider, ttl: ttl}
+	return nil
+}
+
+// lookupState returns the provider of the state data of the node key.
+func (restconf *RestConf) lookupState(key string) (*stateProvider, bool) {
+	restconf.statesMu.RLock()
+	defer restconf.statesMu.RUnlock()
+
+	p, ok := restconf.states[key]
+	return p, ok
+}
+
+// hasState reports whether a provider serves a node at, above or below the
+// resource r.
+func (restconf *RestConf) hasState(r *Resource) bool {
+	rk := schemaKey(r.Entry())
+	restconf.statesMu.RLock()
+	defer restconf.statesMu.RUnlock()
+
+	for key := range restconf.states {
+		if key == rk || strings.HasPrefix(key, rk+"/") || strings.HasPrefix(rk, key+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// statesBelow reports whether a provider serves a node below the node key.
+func (restconf *RestConf) statesBelow(key string) bool {
+	restconf.statesMu.RLock()
+	defer restconf.statesMu.RUnlock()
+
+	for k := range restconf.states {
+		if strings.HasPrefix(k, key+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readState returns a copy of the data at r, the configuration merged with
+// the state data of the providers.
+func (restconf *RestConf) readState(req *http.Request, r *Resource) (interface{}, bool, error) {
+	e := r.Entries[0]
+	top := &Resource{Segments: []PathSegment{{Module: r.Segments[0].Module, Name: e.Name}}, Entries: r.Entries[:1]}
+	v, _ := restconf.store.Get(top)
+
+	v, err := restconf.provide(req, restconf.schemaOf(req), r, 0, e, nil, v)
+	if err != nil || v == nil {
+		return nil, false, err
+	}
+	value, ok := readTree(map[string]interface{}{e.Name: v}, r)
+	return value, ok, nil
+}
+
+// provide returns the data v of the node e, level i of the resource r, with
+// the state data of the providers at and below e within the instances r
+// addresses. keys holds the keys of the list instances above e.
+func (restconf *RestConf) provide(req *http.Request, schema *Schema, r *Resource, i int, e *yang.Entry,
+	keys []InstanceKey, v interface{}) (interface{}, error) {
+
+	key := schemaKey(e)
+	if p, ok := restconf.lookupState(key); ok && e.ReadOnly() {
+		return restconf.readProvider(req, schema, p, key, e, keys)
+	}
+	if !restconf.statesBelow(key) {
+		return v, nil
+	}
+
+	switch {
+	case e.IsList():
+		values, _ := v.([]interface{})
+		for j, value := range values {
+			if i < len(r.Entries) && r.Segments[i].Keys != nil && matchInstance(values[j:j+1], e, r.Segments[i].Keys) < 0 {
+				continue
+			}
+			entry, _ := value.(map[string]interface{})
+			instance := InstanceKey{List: e.Name, Values: make(map[string]string)}
+			for _, name := range keyNames(e) {
+				instance.Values[name], _ = entry[name].(string)
+			}
+			dir, err := restconf.provideDir(req, schema, r, i, e, append(keys[:len(keys):len(keys)], instance), entry)
+			if err != nil {
+				return nil, err
+			}
+			values[j] = dir
+		}
+		return v, nil
+	case e.IsDir():
+		dir, _ := v.(map[string]interface{})
+		dir, err := restconf.provideDir(req, schema, r, i, e, keys, dir)
+		if err != nil || v == nil && len(dir) == 0 {
+			return nil, err
+		}
+		return dir, nil
+	}
+	return v, nil
+}
+
+// provideDir returns the data dir of the container or list entry e, level i
+// of the resource r, with the state data of the providers below e.
+func (restconf *RestConf) provideDir(req *http.Request, schema *Schema, r *Resource, i int, e *yang.Entry,
+	keys []InstanceKey, dir map[string]interface{}) (map[string]interface{}, error) {
+
+	if dir == nil {
+		dir = make(map[string]interface{})
+	}
+	for _, child := range dataChildren(e) {
+		// Above r only the nodes on its path are read.
+		if i+1 < len(r.Entries) && r.Entries[i+1].Name != child.Name {
+			continue
+		}
+		cv, err := restconf.provide(req, schema, r, i+1, child, keys, dir[child.Name])
+		if err != nil {
+			return nil, err
+		}
+		if cv == nil {
+			delete(dir, child.Name)
+		} else {
+			dir[child.Name] = cv
+		}
+	}
+	return dir, nil
+}
+
+// stateValue returns the JSON form v of the data of e a provider returned as
+// the decoded data of e. Data that does not match the schema is a fault of
+// the provider, it fails the read without the details.
+func (schema *Schema) stateValue(req *http.Request, e *yang.Entry, v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var doc interface{}
+		if err = dec.Decode(&doc); err == nil {
+			v, err = schema.fromJSON(req, e, nil, doc)
+		}
+	}
+	if err != nil {
+		logRequest(req, "invalid state data!", err.Error())
+		return nil, NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+			ERROR_TAG_OPERATION_FAILED, "the state of %s does not match the schema", e.Name)
+	}
+	return v, nil
+}
+
+// statePage returns at most limit entries of the list or leaf-list at r,
+// starting at entry offset, with the state data of the providers, along
+// with the total number of entries.
+func (restconf *RestConf) statePage(req *http.Request, r *Resource, offset, limit int) ([]interface{}, int, bool, error) {
+	v, ok, err := restconf.readState(req, r)
+	if !ok || err != nil {
+		return nil, 0, false, err
+	}
+	values, _ := v.([]interface{})
+	total := len(values)
+
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return values[offset:end], total, true, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var stateModuleText = `
+module state {
+  namespace "urn:state";
+  prefix s;
+
+  container box {
+    leaf name { type string; }
+    leaf uptime { type uint32; config false; }
+    list port {
+      key id;
+      leaf id { type string; }
+      leaf speed { type uint32; }
+      container counters {
+        config false;
+        leaf in { type uint64; }
+        leaf errors { type uint32; }
+      }
+    }
+  }
+}
+`
+
+func TestStateProviders(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"state": stateModuleText}))
+
+	calls := make(map[string]int)
+	if err := server.RegState("/state:box/uptime", func(st *StateRequest) (interface{}, error) {
+		calls["uptime"]++
+		return 42, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegState("/state:box/port/counters", func(st *StateRequest) (interface{}, error) {
+		calls["counters"]++
+		switch st.Key("id") {
+		case "p1":
+			return map[string]interface{}{"in": 1000, "errors": 2}, nil
+		case "bad":
+			return map[string]interface{}{"in": "many"}, nil
+		case "down":
+			return nil, errors.New("port is down")
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegState("/state:box/uptime", nil); err == nil {
+		t.Error("registering uptime twice succeeded")
+	}
+
+	// The state is served without configuration.
+	rsp := doRequest(server, "GET", "/restconf/data/state:box", "", "")
+	if want := `{"state:box":{"uptime":42}}`; rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Errorf("got status %d body %s, want %s", rsp.Code, rsp.Body, want)
+	}
+
+	rsp = doRequest(server, "PUT", "/restconf/data/state:box", APPLICATION_DATA_JSON,
+		`{"state:box":{"name":"b","port":[{"id":"p1","speed":10},{"id":"p2"}]}}`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	for _, test := range []struct {
+		url  string
+		want string
+	}{
+		{"/restconf/data/state:box",
+			`{"state:box":{"name":"b","port":[{"counters":{"errors":2,"in":"1000"},"id":"p1","speed":10},{"id":"p2"}],"uptime":42}}`},
+		{"/restconf/data/state:box/port=p1/counters/in", `{"state:in":"1000"}`},
+		{"/restconf/data/state:box/uptime", `{"state:uptime":42}`},
+		{"/restconf/data/state:box?content=config", `{"state:box":{"name":"b","port":[{"id":"p1","speed":10},{"id":"p2"}]}}`},
+		{"/restconf/data/state:box/port?limit=1", `{"state:port":[{"counters":{"errors":2,"in":"1000"},"id":"p1","speed":10}]}`},
+	} {
+		rsp := doRequest(server, "GET", test.url, "", "")
+		if rsp.Code != http.StatusOK || rsp.Body.String() != test.want {
+			t.Errorf("GET %s: got status %d body %s, want %s", test.url, rsp.Code, rsp.Body, test.want)
+		}
+	}
+
+	// Reading a single entry asks the provider of that entry only.
+	calls = make(map[string]int)
+	doRequest(server, "GET", "/restconf/data/state:box/port=p2", "", "")
+	if calls["counters"] != 1 || calls["uptime"] != 0 {
+		t.Errorf("got provider calls %v reading a port", calls)
+	}
+
+	if rsp := doRequest(server, "GET", "/restconf/data/state:box/port=p2/counters", "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET of empty state: got status %d, want %d", rsp.Code, http.StatusNotFound)
+	}
+
+	for _, id := range []string{"down", "bad"} {
+		doRequest(server, "POST", "/restconf/data/state:box", APPLICATION_DATA_JSON, `{"state:port":[{"id":"`+id+`"}]}`)
+		for _, url := range []string{"/restconf/data/state:box/port=" + id, "/restconf/data"} {
+			rsp := doRequest(server, "GET", url, "", "")
+			if rsp.Code != http.StatusInternalServerError || !strings.Contains(rsp.Body.String(), ERROR_TAG_OPERATION_FAILED) {
+				t.Errorf("GET %s: got status %d body %s, want operation-failed", url, rsp.Code, rsp.Body)
+			}
+		}
+		doRequest(server, "DELETE", "/restconf/data/state:box/port="+id, "", "")
+	}
+}
+
+func TestStateRegisterWhileServing(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"state": stateModuleText}))
+	if rsp := doRequest(server, "PUT", "/restconf/data/state:box", APPLICATION_DATA_JSON, `{"state:box":{"name":"b"}}`); rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	// Providers registered while requests are served are safe to read.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.RegState("/state:box/uptime", func(st *StateRequest) (interface{}, error) { return 42, nil })
+	}()
+	for i := 0; i < 10; i++ {
+		if rsp := doRequest(server, "GET", "/restconf/data/state:box", "", ""); rsp.Code != http.StatusOK {
+			t.Fatalf("GET: got status %d: %s", rsp.Code, rsp.Body)
+		}
+	}
+	<-done
+	if rsp := doRequest(server, "GET", "/restconf/data/state:box/uptime", "", ""); rsp.Body.String() != `{"state:uptime":42}` {
+		t.Errorf("GET uptime: got status %d: %s", rsp.Code, rsp.Body)
+	}
+}
+
+func TestStateCache(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"state": stateModuleText}))
+	defer func(ttl time.Duration) { STATE_CACHE_TTL = ttl }(STATE_CACHE_TTL)
+	STATE_CACHE_TTL = time.Hour
+
+	calls := make(map[string]int)
+	uptime := 0
+	if err := server.RegState("/state:box/uptime", func(st *StateRequest) (interface{}, error) {
+		calls["uptime"]++
+		uptime++
+		return uptime, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegStateTTL("/state:box/port/counters", 50*time.Millisecond, func(st *StateRequest) (interface{}, error) {
+		calls[st.Key("id")]++
+		return map[string]interface{}{"in": calls[st.Key("id")]}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	doRequest(server, "PUT", "/restconf/data/state:box", APPLICATION_DATA_JSON, `{"state:box":{"port":[{"id":"p1"},{"id":"p2"}]}}`)
+
+	get := func(url, want string) {
+		t.Helper()
+		if rsp := doRequest(server, "GET", url, "", ""); rsp.Code != http.StatusOK || rsp.Body.String() != want {
+			t.Errorf("GET %s: got status %d, %s, want %s", url, rsp.Code, rsp.Body, want)
+		}
+	}
+
+	// The instances of a list are cached apart, the reads modifying the
+	// data they return leave the cache intact.
+	get("/restconf/data/state:box", `{"state:box":{"port":[{"counters":{"in":"1"},"id":"p1"},{"counters":{"in":"1"},"id":"p2"}],"uptime":1}}`)
+	get("/restconf/data/state:box?fields=uptime", `{"state:box":{"uptime":1}}`)
+	get("/restconf/data/state:box/port=p1/counters", `{"state:counters":{"in":"1"}}`)
+	get("/restconf/data/state:box/uptime", `{"state:uptime":1}`)
+	if calls["uptime"] != 1 || calls["p1"] != 1 || calls["p2"] != 1 {
+		t.Errorf("got provider calls %v, want 1 each", calls)
+	}
+	want := map[string]StateCacheStats{"/state/box/uptime": {Hits: 2, Misses: 1}, "/state/box/port/counters": {Hits: 3, Misses: 2}}
+	if stats := server.StateCacheStats(); !reflect.DeepEqual(stats, want) {
+		t.Errorf("got stats %v, want %v", stats, want)
+	}
+
+	// Key values holding the separators of the cache IDs do not collide.
+	a := stateCacheID("/state/box/port/counters", []InstanceKey{{List: "port", Values: map[string]string{"id": "a,id=b"}}})
+	b := stateCacheID("/state/box/port/counters", []InstanceKey{{List: "port", Values: map[string]string{"id": "a", "id=b": ""}}})
+	c := stateCacheID("/state/box/port/counters", []InstanceKey{{List: "port", Values: map[string]string{"id": "a|port"}}, {List: "x"}})
+	d := stateCacheID("/state/box/port/counters", []InstanceKey{{List: "port", Values: map[string]string{"id": "a"}}, {List: "port|x"}})
+	if a == b || c == d {
+		t.Errorf("cache IDs of distinct instances collide: %q %q, %q %q", a, b, c, d)
+	}
+
+	// The TTL of the provider expires before the default one.
+	time.Sleep(60 * time.Millisecond)
+	get("/restconf/data/state:box/port=p1/counters", `{"state:counters":{"in":"2"}}`)
+	get("/restconf/data/state:box/uptime", `{"state:uptime":1}`)
+
+	// A reload empties the cache.
+	server.SetSchema(testSchema(t, map[string]string{"state": stateModuleText}))
+	get("/restconf/data/state:box/uptime", `{"state:uptime":2}`)
+
+	// A provider opting out is called on every read.
+	if err := server.RegStateTTL("/state:box/port/speed", -1, func(st *StateRequest) (interface{}, error) {
+		calls["speed"]++
+		return 10, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	STATE_CACHE_TTL = 0
+	server.SetSchema(testSchema(t, map[string]string{"state": strings.Replace(stateModuleText,
+		"leaf speed { type uint32; }", "leaf speed { type uint32; config false; }", 1)}))
+	get("/restconf/data/state:box/port=p2/speed", `{"state:speed":10}`)
+	get("/restconf/data/state:box/port=p2/speed", `{"state:speed":10}`)
+	get("/restconf/data/state:box/uptime", `{"state:uptime":3}`)
+	get("/restconf/data/state:box/uptime", `{"state:uptime":4}`)
+	if calls["speed"] != 2 {
+		t.Errorf("got %d calls of the provider opting out, want 2", calls["speed"])
+	}
+}
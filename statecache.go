@@ -0,0 +1,186 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The state data of expensive providers, e.g. ones querying the hardware, is
+   cached for -state-cache-ttl, 0 by default caching nothing: the reads within
+   the TTL reuse the data the provider returned for the same node and list
+   instance rather than calling it again. A provider declares its own TTL, or
+   opts out of the cache with a negative one, when it is registered:
+
+   server.RegStateTTL("/example:system/interface/statistics", 2*time.Second, statistics)
+
+   The cache is emptied when the schema is reloaded. Its hits and misses by
+   provider are returned by StateCacheStats, and summed over the providers
+   in the state-cache map of the expvar variables, served with the profiles
+   under /debug/vars.
+*/
+
+var STATE_CACHE_TTL time.Duration = 0
+
+var stateCacheVars = expvar.NewMap("state-cache")
+
+// A stateProvider is a registered provider of state data.
+type stateProvider struct {
+	provider StateProvider
+	ttl      time.Duration // zero for STATE_CACHE_TTL, negative for no caching
+}
+
+// cacheTTL returns the time the data of the provider is cached for, 0 if it
+// is not cached.
+func (p *stateProvider) cacheTTL() time.Duration {
+	switch {
+	case p.ttl < 0:
+		return 0
+	case p.ttl == 0:
+		return STATE_CACHE_TTL
+	}
+	return p.ttl
+}
+
+// StateCacheStats are the hits and misses of the cache of a provider.
+type StateCacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// A cachedState is the state data a provider returned, as the schema it was
+// read with defines it.
+type cachedState struct {
+	schema  *Schema
+	value   interface{}
+	expires time.Time
+}
+
+// stateCache holds the cached state data by provider and list instance.
+type stateCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedState
+	stats   map[string]*StateCacheStats // by provider key
+}
+
+// get returns a copy of the data cached under id for schema, counting the
+// hit or miss of the provider key.
+func (c *stateCache) get(key, id string, schema *Schema) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats == nil {
+		c.stats = make(map[string]*StateCacheStats)
+	}
+	stats, ok := c.stats[key]
+	if !ok {
+		stats = new(StateCacheStats)
+		c.stats[key] = stats
+	}
+	if s, ok := c.entries[id]; ok && s.schema == schema && time.Now().Before(s.expires) {
+		stats.Hits++
+		stateCacheVars.Add("hits", 1)
+		return copyTree(s.value), true
+	}
+	stats.Misses++
+	stateCacheVars.Add("misses", 1)
+	return nil, false
+}
+
+// put caches a copy of the data value under id for schema, for ttl.
+func (c *stateCache) put(id string, schema *Schema, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.entries == nil {
+		c.entries = make(map[string]*cachedState)
+	}
+	for k, s := range c.entries {
+		if now.After(s.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[id] = &cachedState{schema: schema, value: copyTree(value), expires: now.Add(ttl)}
+}
+
+// clear empties the cache, keeping its statistics.
+func (c *stateCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// StateCacheStats returns the hits and misses of the caches of the providers
+// by the schema path they were registered at, for the providers read with
+// caching since the server started.
+func (restconf *RestConf) StateCacheStats() map[string]StateCacheStats {
+	c := &restconf.stateCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]StateCacheStats, len(c.stats))
+	for key, s := range c.stats {
+		stats[key] = *s
+	}
+	return stats
+}
+
+// stateCacheID returns the key of the data of the provider key within the
+// list instances keys in the cache. The names and values are escaped, so
+// that key values holding the separators cannot make two instances share an
+// ID.
+func stateCacheID(key string, keys []InstanceKey) string {
+	var b strings.Builder
+	b.WriteString(url.QueryEscape(key))
+	for _, k := range keys {
+		names := make([]string, 0, len(k.Values))
+		for name := range k.Values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("|" + url.QueryEscape(k.List))
+		for _, name := range names {
+			b.WriteString("," + url.QueryEscape(name) + "=" + url.QueryEscape(k.Values[name]))
+		}
+	}
+	return b.String()
+}
+
+// readProvider returns the state data of the provider p of the node e, key
+// being its schemaKey and keys the list instances above it, from the cache
+// if the data is cached.
+func (restconf *RestConf) readProvider(req *http.Request, schema *Schema, p *stateProvider, key string, e *yang.Entry,
+	keys []InstanceKey) (interface{}, error) {
+
+	ttl := p.cacheTTL()
+	id := stateCacheID(key, keys)
+	if ttl > 0 {
+		if v, ok := restconf.stateCache.get(key, id, schema); ok {
+			return v, nil
+		}
+	}
+
+	value, err := p.provider(&StateRequest{Request: req, Entry: e, Keys: keys})
+	if err != nil {
+		return nil, NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+			ERROR_TAG_OPERATION_FAILED, "reading the state of %s failed: %s", e.Name, err.Error())
+	}
+	var v interface{}
+	if value != nil {
+		if v, err = schema.stateValue(req, e, value); err != nil {
+			return nil, err
+		}
+	}
+	if ttl > 0 {
+		restconf.stateCache.put(id, schema, v, ttl)
+	}
+	return v, nil
+}
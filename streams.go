@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   Event streams (RFC 8040 section 6) deliver the notifications of the schema
+   as server sent events, in the JSON or XML encoding. The NETCONF stream
+   carries every notification, other streams the notifications sent on them.
+   The streams are listed in the restconf-state state data of
+   ietf-restconf-monitoring, with the location of each encoding:
+
+   {
+     "ietf-restconf-monitoring:streams" : {
+       "stream" : [
+         {
+           "name" : "NETCONF",
+           "description" : "default NETCONF event stream",
+           "replay-support" : false,
+           "access" : [
+             { "encoding" : "json", "location" : "https://example.com/restconf/streams/NETCONF/json" },
+             { "encoding" : "xml", "location" : "https://example.com/restconf/streams/NETCONF/xml" }
+           ]
+         }
+       ]
+     }
+   }
+*/
+
+var (
+	MONITORING_MODULE  = "ietf-restconf-monitoring"
+	STREAMS_PREFIX     = RESTCONF_PREFIX + "/streams"
+	NETCONF_STREAM     = "NETCONF"
+	NOTIFICATION_XMLNS = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+)
+
+// streamEncodings maps the encodings of the event streams to the media type
+// of their notifications.
+var streamEncodings = map[string]string{
+	"json": APPLICATION_DATA_JSON,
+	"xml":  APPLICATION_DATA_XML,
+}
+
+// An EventStream is a named stream of notifications.
+type EventStream struct {
+	Name        string
+	Description string
+
+	types []string // keys of the notification types carried, none for all
+
+	mu        sync.Mutex
+	next      int
+	listeners map[int]*streamListener
+}
+
+// A streamListener is a client receiving the events of a stream in format.
+type streamListener struct {
+	request *http.Request // the request of the client, for access checks
+	schema  *Schema       // the schema when the client started listening
+	format  string
+	events  chan []byte
+}
+
+// RegStream registers the event stream name, carrying the notifications
+// given as to Mute, or any notification if none is given. The NETCONF stream
+// is always registered.
+func (restconf *RestConf) RegStream(name, description string, notifications ...string) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid stream name %q", name)
+	}
+	types, err := notificationKeys(notifications)
+	if err != nil {
+		return err
+	}
+
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+
+	if _, ok := restconf.streams[name]; ok {
+		return fmt.Errorf("stream %s is already registered", name)
+	}
+	restconf.streams[name] = &EventStream{Name: name, Description: description, types: types,
+		listeners: make(map[int]*streamListener)}
+	return nil
+}
+
+// stream returns the registered stream name, nil if there is none.
+func (restconf *RestConf) stream(name string) *EventStream {
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+	return restconf.streams[name]
+}
+
+// Streams returns the registered streams, sorted by name.
+func (restconf *RestConf) Streams() []*EventStream {
+	restconf.streamsMu.Lock()
+	defer restconf.streamsMu.Unlock()
+
+	streams := make([]*EventStream, 0, len(restconf.streams))
+	for _, stream := range restconf.streams {
+		streams = append(streams, stream)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].Name < streams[j].Name
+	})
+	return streams
+}
+
+// Notify sends the notification e of the schema, holding value, on the
+// stream name and on the NETCONF stream, unless it is muted. Listeners not
+// permitted to read e do not receive it, nor do listeners whose queue is
+// full.
+//
+// A listener receives the notification as the schema it started listening
+// with defines it, which may be older than the schema of e after a reload.
+// Listeners of a schema without the notification do not receive it.
+func (restconf *RestConf) Notify(name string, e *yang.Entry, value interface{}) error {
+	if !isNotification(e) {
+		return fmt.Errorf("%s is not a notification", e.Name)
+	}
+	streams := []*EventStream{restconf.stream(NETCONF_STREAM)}
+	if name != NETCONF_STREAM {
+		stream := restconf.stream(name)
+		if stream == nil {
+			return fmt.Errorf("stream %s is not registered", name)
+		}
+		if !stream.carries(e) {
+			return fmt.Errorf("stream %s does not carry %s", name, e.Name)
+		}
+		streams = append(streams, stream)
+	}
+	if restconf.notificationMuted(e) {
+		return nil
+	}
+
+	// The events are encoded once for each schema and format listened to.
+	key := schemaKey(e)
+	eventTime := restconf.now().UTC().Format(time.RFC3339Nano)
+	events := make(map[*Schema]map[string][]byte)
+	event := func(l *streamListener) (*yang.Entry, []byte) {
+		n := l.schema.Lookup(key)
+		if n == nil {
+			return nil, nil
+		}
+		byFormat, ok := events[l.schema]
+		if !ok {
+			byFormat = make(map[string][]byte, len(streamEncodings))
+			events[l.schema] = byFormat
+		}
+		if _, ok := byFormat[l.format]; !ok {
+			byFormat[l.format] = notificationEvent(l.format, eventTime, l.schema.encode(l.format, n, value))
+		}
+		return n, byFormat[l.format]
+	}
+
+	for _, stream := range streams {
+		stream.mu.Lock()
+		for _, l := range stream.listeners {
+			n, msg := event(l)
+			if n == nil || !restconf.permit(l.request, ACCESS_READ, n) {
+				continue
+			}
+			select {
+			case l.events <- msg:
+			default:
+				logRequest(l.request, "stream", stream.Name, "queue is full, notification dropped!")
+			}
+		}
+		stream.mu.Unlock()
+	}
+	return nil
+}
+
+// notificationEvent wraps the encoded notification body in the notification
+// envelope of format (RFC 8040 section 6.4).
+func notificationEvent(format, eventTime string, body []byte) []byte {
+	var buf bytes.Buffer
+	if format == APPLICATION_DATA_XML {
+		buf.WriteString(`<notification xmlns="` + NOTIFICATION_XMLNS + `"><eventTime>` + eventTime + `</eventTime>`)
+		buf.Write(body)
+		buf.WriteString(`</notification>`)
+		return buf.Bytes()
+	}
+	// The body is a JSON object holding the notification member alone.
+	fmt.Fprintf(&buf, `{"ietf-restconf:notification":{"eventTime":%q,`, eventTime)
+	buf.Write(bytes.TrimPrefix(body, []byte("{")))
+	buf.WriteString(`}`)
+	return buf.Bytes()
+}
+
+// listen adds a listener of the stream for req, receiving the notifications
+// as schema defines them, until cancel is called.
+func (stream *EventStream) listen(req *http.Request, schema *Schema, format string) (l *streamListener, cancel func()) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.next++
+	id := stream.next
+	l = &streamListener{request: req, schema: schema, format: format, events: make(chan []byte, SUBSCRIPTION_QUEUE_LEN)}
+	stream.listeners[id] = l
+
+	return l, func() {
+		stream.mu.Lock()
+		defer stream.mu.Unlock()
+		delete(stream.listeners, id)
+	}
+}
+
+// StreamEvents sends the notifications of the stream addressed as
+// /restconf/streams/name/encoding as server sent events, until the client
+// goes away.
+func (restconf *RestConf) StreamEvents(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET") {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, STREAMS_PREFIX+"/"), "/")
+	stream := restconf.stream(parts[0])
+	format, ok := "", false
+	if len(parts) == 2 {
+		format, ok = streamEncodings[parts[1]]
+	}
+	if stream == nil || !ok {
+		writeError(rsp, req, NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "unknown stream %q", strings.TrimPrefix(req.URL.Path, STREAMS_PREFIX+"/")))
+		return
+	}
+
+	// The stream keeps the schema it started with for its lifetime: a
+	// reload neither waits for the stream nor changes the encoding of its
+	// notifications midway.
+	l, cancel := stream.listen(req, restconf.schemaOf(req), format)
+	defer cancel()
+
+	draining, done := restconf.trackStream()
+	defer done()
+
+	flusher, _ := rsp.(http.Flusher)
+	rsp.Header().Set("Content-Type", TEXT_EVENT_STREAM)
+	rsp.Header().Set("Cache-Control", "no-cache")
+	rsp.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-draining:
+			endStream(rsp, req)
+			return
+		case msg := <-l.events:
+			if _, err := fmt.Fprintf(rsp, "data: %s\n\n", msg); err != nil {
+				logRequest(req, "write stream failed!", err.Error())
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// readMonitoring returns the restconf-state state data at r, r being a
+// resource of the ietf-restconf-monitoring module: the capabilities of the
+// server and its streams, but those whose notifications are all muted. The
+// stream locations are absolute URLs on the server req was sent to.
+func (restconf *RestConf) readMonitoring(req *http.Request, r *Resource) (interface{}, bool) {
+	var streams []interface{}
+	for _, stream := range restconf.Streams() {
+		if !restconf.streamActive(stream) {
+			continue
+		}
+		var access []interface{}
+		for _, encoding := range sortedEncodings() {
+			access = append(access, map[string]interface{}{
+				"encoding": encoding,
+				"location": absoluteURL(req, STREAMS_PREFIX+"/"+stream.Name+"/"+encoding, nil),
+			})
+		}
+		entry := map[string]interface{}{
+			"name":           stream.Name,
+			"replay-support": "false",
+			"access":         access,
+		}
+		if stream.Description != "" {
+			entry["description"] = stream.Description
+		}
+		streams = append(streams, entry)
+	}
+
+	return readTree(map[string]interface{}{
+		"restconf-state": map[string]interface{}{
+			"capabilities": map[string]interface{}{"capability": capabilities()},
+			"streams":      map[string]interface{}{"stream": streams},
+		},
+	}, r)
+}
+
+// sortedEncodings returns the encodings of the event streams, sorted.
+func sortedEncodings() []string {
+	encodings := make([]string, 0, len(streamEncodings))
+	for encoding := range streamEncodings {
+		encodings = append(encodings, encoding)
+	}
+	sort.Strings(encodings)
+	return encodings
+}
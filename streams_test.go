@@ -0,0 +1,214 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// monitoringModuleText holds the capabilities and streams of the
+// restconf-state of ietf-restconf-monitoring.
+var monitoringModuleText = `
+module ietf-restconf-monitoring {
+  namespace "urn:ietf:params:xml:ns:yang:ietf-restconf-monitoring";
+  prefix rcmon;
+
+  container restconf-state {
+    config false;
+    container capabilities {
+      leaf-list capability { type string; }
+    }
+    container streams {
+      list stream {
+        key name;
+        leaf name { type string; }
+        leaf description { type string; }
+        leaf replay-support { type boolean; }
+        list access {
+          key encoding;
+          leaf encoding { type string; }
+          leaf location { type string; }
+        }
+      }
+    }
+  }
+}
+`
+
+var alarmModuleText = `
+module alarm {
+  namespace "urn:alarm";
+  prefix a;
+
+  notification alarm {
+    leaf severity { type string; }
+  }
+}
+`
+
+func TestStreamsMonitoring(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{MONITORING_MODULE: monitoringModuleText}))
+	if err := server.RegStream("alarms", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegStream(NETCONF_STREAM, ""); err == nil {
+		t.Errorf("RegStream of the NETCONF stream: got no error")
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/restconf/data/ietf-restconf-monitoring:restconf-state/streams", nil)
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	want := `{"ietf-restconf-monitoring:streams":{"stream":[` +
+		`{"access":[{"encoding":"json","location":"https://example.com/restconf/streams/NETCONF/json"},` +
+		`{"encoding":"xml","location":"https://example.com/restconf/streams/NETCONF/xml"}],` +
+		`"description":"default NETCONF event stream","name":"NETCONF","replay-support":false},` +
+		`{"access":[{"encoding":"json","location":"https://example.com/restconf/streams/alarms/json"},` +
+		`{"encoding":"xml","location":"https://example.com/restconf/streams/alarms/xml"}],` +
+		`"name":"alarms","replay-support":false}]}}`
+	if rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Errorf("GET streams: got status %d, %s, want %s", rsp.Code, rsp.Body, want)
+	}
+
+	rsp = doRequest(server, "GET", "/restconf/data/ietf-restconf-monitoring:restconf-state/streams/stream=alarms/access=xml/location", "", "")
+	if want := `{"ietf-restconf-monitoring:location":"http://example.com/restconf/streams/alarms/xml"}`; rsp.Body.String() != want {
+		t.Errorf("GET location: got %s, want %s", rsp.Body, want)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"alarm": alarmModuleText}))
+	if err := server.RegStream("alarms", "alarm notifications"); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	alarms, done := openStream(t, ts, STREAMS_PREFIX+"/alarms/json")
+	defer done()
+	netconf, done := openStream(t, ts, STREAMS_PREFIX+"/NETCONF/xml")
+	defer done()
+
+	e := server.Schema().Lookup("/alarm/alarm")
+	if err := server.Notify("alarms", e, map[string]interface{}{"severity": "major"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Notify("bogus", e, nil); err == nil {
+		t.Errorf("Notify on an unknown stream: got no error")
+	}
+
+	if event := nextEvent(t, alarms); !strings.HasPrefix(event, `{"ietf-restconf:notification":{"eventTime":`) ||
+		!strings.HasSuffix(event, `,"alarm:alarm":{"severity":"major"}}}`) {
+		t.Errorf("alarms stream: got event %s", event)
+	}
+	if event := nextEvent(t, netconf); !strings.HasPrefix(event, `<notification xmlns="`+NOTIFICATION_XMLNS+`"><eventTime>`) ||
+		!strings.HasSuffix(event, `</eventTime><alarm xmlns="urn:alarm"><severity>major</severity></alarm></notification>`) {
+		t.Errorf("NETCONF stream: got event %s", event)
+	}
+
+	for _, uri := range []string{"/bogus/json", "/alarms/text", "/alarms"} {
+		if rsp := doRequest(server, "GET", STREAMS_PREFIX+uri, "", ""); rsp.Code != http.StatusNotFound {
+			t.Errorf("GET %s: got status %d, want %d", uri, rsp.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestStreamSchemaReload(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"alarm": alarmModuleText}))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	before, done := openStream(t, ts, STREAMS_PREFIX+"/NETCONF/json")
+	defer done()
+
+	// The reload does not wait for the stream.
+	reloaded := make(chan struct{})
+	go func() {
+		server.SetSchema(testSchema(t, map[string]string{"alarm": strings.Replace(alarmModuleText,
+			"leaf severity { type string; }", "leaf severity { type string; }\n    leaf source { type string; }", 1)}))
+		close(reloaded)
+	}()
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("SetSchema blocked by an open stream")
+	}
+
+	after, done := openStream(t, ts, STREAMS_PREFIX+"/NETCONF/json")
+	defer done()
+
+	e := server.Schema().Lookup("/alarm/alarm")
+	if err := server.Notify(NETCONF_STREAM, e, map[string]interface{}{"severity": "major", "source": "fan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream opened before the reload keeps encoding the notification
+	// of the schema it started with.
+	if event := nextEvent(t, before); !strings.HasSuffix(event, `,"alarm:alarm":{"severity":"major"}}}`) {
+		t.Errorf("stream opened before the reload: got event %s", event)
+	}
+	if event := nextEvent(t, after); !strings.HasSuffix(event, `,"alarm:alarm":{"severity":"major","source":"fan"}}}`) {
+		t.Errorf("stream opened after the reload: got event %s", event)
+	}
+}
+
+func TestMutedNotifications(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{MONITORING_MODULE: monitoringModuleText, "alarm": alarmModuleText}))
+	if err := server.RegStream("alarms", "", "alarm:alarm"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegStream("links", "", "/link:interfaces/link-up"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegStream("bogus", "", "alarm:bad name"); err == nil {
+		t.Errorf("RegStream of an invalid notification: got no error")
+	}
+	if err := server.Mute("bad name"); err == nil {
+		t.Errorf("Mute of an invalid module: got no error")
+	}
+
+	e := server.Schema().Lookup("/alarm/alarm")
+	if err := server.Notify("links", e, nil); err == nil {
+		t.Errorf("Notify on a stream not carrying the notification: got no error")
+	}
+
+	req := httptest.NewRequest("GET", STREAMS_PREFIX+"/alarms/json", nil)
+	l, cancel := server.stream("alarms").listen(req, server.Schema(), APPLICATION_DATA_JSON)
+	defer cancel()
+	streams := func() string {
+		rsp := doRequest(server, "GET", "/restconf/data/ietf-restconf-monitoring:restconf-state/streams/stream?fields=name", "", "")
+		return rsp.Body.String()
+	}
+
+	tests := []struct {
+		mute, unmute []string
+		queued       int
+		streams      string
+	}{
+		{nil, nil, 1, `{"ietf-restconf-monitoring:stream":[{"name":"NETCONF"},{"name":"alarms"},{"name":"links"}]}`},
+		{[]string{"alarm"}, nil, 0, `{"ietf-restconf-monitoring:stream":[{"name":"NETCONF"},{"name":"links"}]}`},
+		{[]string{"alarm:alarm", "link"}, []string{"alarm"}, 0, `{"ietf-restconf-monitoring:stream":[{"name":"NETCONF"}]}`},
+		{nil, []string{"alarm:alarm"}, 1, `{"ietf-restconf-monitoring:stream":[{"name":"NETCONF"},{"name":"alarms"}]}`},
+	}
+	for i, test := range tests {
+		if err := server.Mute(test.mute...); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.Unmute(test.unmute...); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.Notify("alarms", e, map[string]interface{}{"severity": "major"}); err != nil {
+			t.Fatalf("%d: Notify: %s", i, err)
+		}
+		if n := len(l.events); n != test.queued {
+			t.Errorf("%d: got %d queued notifications, want %d", i, n, test.queued)
+		}
+		for len(l.events) > 0 {
+			<-l.events
+		}
+		if got := streams(); got != test.streams {
+			t.Errorf("%d: GET streams: got %s, want %s", i, got, test.streams)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+   Dynamic subscriptions to datastore updates (RFC 8639, RFC 8641), set up
+   with the rpcs of ietf-subscribed-notifications and delivered as server sent
+   events from the uri returned by establish-subscription (RFC 8650).
+
+   {
+     "ietf-restconf:notification" : {
+       "eventTime" : "2024-01-01T00:00:00Z",
+       "ietf-yang-push:push-update" : {
+         "id" : 1,
+         "datastore-contents" : { "example:system" : { ... } }
+       }
+     }
+   }
+
+   The datastore-xpath-filter is an absolute location path of data nodes,
+   with the predicates of an instance-identifier selecting the list entries,
+   a list without them selecting all of its entries:
+
+   /example:system/interface[name='eth0']
+
+   A subscription whose stream is not opened within -subscription-timeout
+   of its establishment is deleted. The periods shorter than
+   -min-subscription-period are refused, as are the subscriptions beyond
+   -max-subscriptions, or -max-user-subscriptions of a user, with a 409
+   resource-denied error.
+*/
+
+var (
+	SUBSCRIPTIONS_MODULE   = "ietf-subscribed-notifications"
+	SUBSCRIPTION_PREFIX    = RESTCONF_PREFIX + "/subscriptions"
+	TEXT_EVENT_STREAM      = "text/event-stream"
+	SUBSCRIPTION_QUEUE_LEN = 16
+
+	SUBSCRIPTION_TIMEOUT    = time.Minute            // time a subscription waits for its stream, 0 for no limit
+	MIN_SUBSCRIPTION_PERIOD = 100 * time.Millisecond // shortest period of a periodic subscription
+
+	// MAX_SUBSCRIPTIONS bounds the subscriptions of all users and
+	// MAX_USER_SUBSCRIPTIONS those of each user, 0 for no limit.
+	MAX_SUBSCRIPTIONS      = 1024
+	MAX_USER_SUBSCRIPTIONS = 16
+
+	ERROR_APP_TAG_NO_SUCH_SUBSCRIPTION = "ietf-subscribed-notifications:no-such-subscription"
+)
+
+// A Subscription is a dynamic subscription to the data of a resource, pushed
+// every period, or whenever it is edited when the subscription is on-change.
+type Subscription struct {
+	ID       uint32
+	Resource *Resource
+	OnChange bool
+
+	request *http.Request      // the establishing request, for access checks
+	schema  *Schema            // the schema of the establishing request
+	updates chan []byte        // notifications waiting for the stream
+	reset   chan time.Duration // new periods of a periodic subscription
+	stop    chan struct{}      // closed when the subscription is deleted
+	cancel  func()             // ends the changes of an on-change subscription
+	dropped int64              // updates dropped since the queue is full, atomic
+
+	receiving bool // its stream is open, guarded by the mu of the Subscriptions
+}
+
+// Subscriptions holds the dynamic subscriptions of a server.
+type Subscriptions struct {
+	mu   sync.Mutex
+	next uint32
+	subs map[uint32]*Subscription
+}
+
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{subs: make(map[uint32]*Subscription)}
+}
+
+// add numbers sub and adds it to the subscriptions, unless its user or
+// the server holds as many as they may.
+func (subs *Subscriptions) add(sub *Subscription) error {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	user := requestUser(sub.request)
+	held := 0
+	for _, s := range subs.subs {
+		if requestUser(s.request) == user {
+			held++
+		}
+	}
+	if MAX_USER_SUBSCRIPTIONS > 0 && held >= MAX_USER_SUBSCRIPTIONS {
+		return NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_RESOURCE_DENIED,
+			"too many subscriptions, at most %d are kept for a user", MAX_USER_SUBSCRIPTIONS)
+	}
+	if MAX_SUBSCRIPTIONS > 0 && len(subs.subs) >= MAX_SUBSCRIPTIONS {
+		return NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_RESOURCE_DENIED,
+			"too many subscriptions, at most %d are kept", MAX_SUBSCRIPTIONS)
+	}
+
+	subs.next++
+	sub.ID = subs.next
+	subs.subs[sub.ID] = sub
+	return nil
+}
+
+// get returns the subscription id established by the user of req.
+func (subs *Subscriptions) get(req *http.Request, id string) (*Subscription, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+
+	subs.mu.Lock()
+	sub, ok := subs.subs[uint32(n)]
+	subs.mu.Unlock()
+
+	if err != nil || !ok || requestUser(sub.request) != requestUser(req) {
+		rerr := NewError(http.StatusNotFound, ERROR_TYPE_APPLICATION,
+			ERROR_TAG_INVALID_VALUE, "subscription %s does not exist", id)
+		rerr.AppTag = ERROR_APP_TAG_NO_SUCH_SUBSCRIPTION
+		return nil, rerr
+	}
+	return sub, nil
+}
+
+// receive marks the stream of sub open. A subscription has a single
+// stream.
+func (subs *Subscriptions) receive(sub *Subscription) error {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	if sub.receiving {
+		return NewError(http.StatusConflict, ERROR_TYPE_APPLICATION, ERROR_TAG_IN_USE,
+			"the stream of subscription %d is already open", sub.ID)
+	}
+	sub.receiving = true
+	return nil
+}
+
+// expire deletes sub if its stream is not open after timeout, 0 for never.
+func (subs *Subscriptions) expire(sub *Subscription, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	time.AfterFunc(timeout, func() {
+		subs.mu.Lock()
+		defer subs.mu.Unlock()
+
+		if !sub.receiving {
+			subs.removeLocked(sub)
+		}
+	})
+}
+
+// remove deletes sub, ending its updates and stream.
+func (subs *Subscriptions) remove(sub *Subscription) {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	subs.removeLocked(sub)
+}
+
+// removeLocked deletes sub, subs.mu held.
+func (subs *Subscriptions) removeLocked(sub *Subscription) {
+	if _, ok := subs.subs[sub.ID]; ok {
+		delete(subs.subs, sub.ID)
+		close(sub.stop)
+		if sub.cancel != nil {
+			sub.cancel()
+		}
+	}
+}
+
+// overlaps reports whether one of the resources a and b is within the other.
+func overlaps(a, b *Resource) bool {
+	n := len(a.Segments)
+	if len(b.Segments) < n {
+		n = len(b.Segments)
+	}
+	for i := 0; i < n; i++ {
+		sa, sb := a.Segments[i], b.Segments[i]
+		if sa.Name != sb.Name || (i == 0 && sa.Module != sb.Module) {
+			return false
+		}
+		if sa.Keys != nil && sb.Keys != nil && strings.Join(sa.Keys, ",") != strings.Join(sb.Keys, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// regSubscriptions registers the rpcs managing dynamic subscriptions.
+func (restconf *RestConf) regSubscriptions() {
+	restconf.RegRpc(SUBSCRIPTIONS_MODULE+":establish-subscription", restconf.establishSubscription)
+	restconf.RegRpc(SUBSCRIPTIONS_MODULE+":modify-subscription", restconf.modifySubscription)
+	restconf.RegRpc(SUBSCRIPTIONS_MODULE+":delete-subscription", restconf.deleteSubscription)
+	// The subscriptions leave the datastore as it is.
+	for _, rpc := range []string{"establish-subscription", "modify-subscription", "delete-subscription"} {
+		restconf.MarkSafe(SUBSCRIPTIONS_MODULE + ":" + rpc)
+	}
+	restconf.register(SUBSCRIPTION_PREFIX, restconf.SubscriptionStream, false)
+}
+
+// subscriptionPeriod returns the period of the periodic container of a
+// subscription rpc input, given in centiseconds, at least
+// MIN_SUBSCRIPTION_PERIOD.
+func subscriptionPeriod(input map[string]interface{}) (time.Duration, error) {
+	periodic, _ := input["periodic"].(map[string]interface{})
+	s, _ := periodic["period"].(string)
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, invalidValue("period must be a positive number of centiseconds")
+	}
+	period := time.Duration(n) * 10 * time.Millisecond
+	if period < MIN_SUBSCRIPTION_PERIOD {
+		return 0, invalidValue("period must be at least %d centiseconds",
+			(MIN_SUBSCRIPTION_PERIOD+10*time.Millisecond-1)/(10*time.Millisecond))
+	}
+	return period, nil
+}
+
+// subscriptionFilter resolves the datastore-xpath-filter filter to the
+// resource it selects.
+func (schema *Schema) subscriptionFilter(filter string) (*Resource, error) {
+	if filter == "" {
+		return nil, invalidValue("datastore-xpath-filter must select a data node")
+	}
+	steps, err := parseInstanceID(filter)
+	if err != nil {
+		return nil, invalidValue("datastore-xpath-filter %q is not a location path of data nodes: %s", filter, err.Error())
+	}
+
+	var segs []PathSegment
+	var r *Resource
+	for _, step := range steps {
+		segs = append(segs, PathSegment{Module: step.module, Name: step.name})
+		if r, err = schema.Resolve(segs); err != nil {
+			return nil, err
+		}
+		if len(step.preds) == 0 {
+			continue
+		}
+		if segs[len(segs)-1].Keys, err = schema.instanceKeys(r.Entry(), step.preds); err != nil {
+			return nil, invalidValue("datastore-xpath-filter %q: %s", filter, err.Error())
+		}
+	}
+	r.Segments = segs
+	return r, nil
+}
+
+// establishSubscription creates a periodic or on-change subscription to the
+// resource selected by the datastore-xpath-filter, such as
+// "/example:system/interface".
+func (restconf *RestConf) establishSubscription(op *Operation) (map[string]interface{}, error) {
+	switch ds := op.Input["datastore"]; ds {
+	case nil, "ietf-datastores:running", "ietf-datastores:operational":
+	default:
+		return nil, invalidValue("datastore %v is not supported", ds)
+	}
+
+	// The subscription holds on to the schema it was established with, the
+	// resource and the updates stay those of that schema after a reload.
+	schema := restconf.schemaOf(op.Request)
+	filter, _ := op.Input["datastore-xpath-filter"].(string)
+	r, err := schema.subscriptionFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if !restconf.permit(op.Request, ACCESS_READ, r.Entry()) {
+		return nil, accessDenied(ACCESS_READ, r.Entry())
+	}
+
+	sub := &Subscription{
+		Resource: r,
+		request:  op.Request,
+		schema:   schema,
+		updates:  make(chan []byte, SUBSCRIPTION_QUEUE_LEN),
+		reset:    make(chan time.Duration),
+		stop:     make(chan struct{}),
+	}
+
+	var period time.Duration
+	if _, ok := op.Input["on-change"]; ok {
+		sub.OnChange = true
+	} else if period, err = subscriptionPeriod(op.Input); err != nil {
+		return nil, err
+	}
+
+	if err := restconf.subscriptions.add(sub); err != nil {
+		return nil, err
+	}
+	restconf.subscriptions.expire(sub, SUBSCRIPTION_TIMEOUT)
+	if sub.OnChange {
+		sub.cancel = restconf.bus.Subscribe(r, func(ev *ChangeEvent) {
+			restconf.pushChanges(sub, ev)
+		})
+	} else {
+		go restconf.runPeriodic(sub, period)
+	}
+
+	id := strconv.FormatUint(uint64(sub.ID), 10)
+	return map[string]interface{}{
+		"id":  id,
+		"uri": SUBSCRIPTION_PREFIX + "/" + id,
+	}, nil
+}
+
+// modifySubscription changes the period of a periodic subscription.
+func (restconf *RestConf) modifySubscription(op *Operation) (map[string]interface{}, error) {
+	id, _ := op.Input["id"].(string)
+	sub, err := restconf.subscriptions.get(op.Request, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.OnChange {
+		return nil, invalidValue("subscription %s is not periodic", id)
+	}
+	period, err := subscriptionPeriod(op.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case sub.reset <- period:
+	case <-sub.stop:
+	}
+	return nil, nil
+}
+
+func (restconf *RestConf) deleteSubscription(op *Operation) (map[string]interface{}, error) {
+	id, _ := op.Input["id"].(string)
+	sub, err := restconf.subscriptions.get(op.Request, id)
+	if err != nil {
+		return nil, err
+	}
+	restconf.subscriptions.remove(sub)
+	return nil, nil
+}
+
+// runPeriodic pushes the data of sub every period until it is deleted.
+func (restconf *RestConf) runPeriodic(sub *Subscription, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sub.stop:
+			return
+		case period := <-sub.reset:
+			ticker.Reset(period)
+		case <-ticker.C:
+			data := restconf.subscribedData(sub)
+			if data == nil {
+				data = []byte("{}")
+			}
+			restconf.push(sub, "push-update", `"datastore-contents":`+string(data))
+		}
+	}
+}
+
+// pushChanges pushes a change update of the changes of ev within the data
+// of sub its subscriber may read, one YANG patch edit for each.
+func (restconf *RestConf) pushChanges(sub *Subscription, ev *ChangeEvent) {
+	schema := sub.schema
+
+	var edits bytes.Buffer
+	n := 0
+	for _, c := range ev.Changes {
+		c, ok := narrow(c, sub.Resource)
+		if !ok {
+			continue
+		}
+		// The change may be one of a newer schema, its node is taken
+		// from the schema of the subscription.
+		e := schema.Lookup(schemaKey(c.Resource.Entry()))
+		if e == nil || !restconf.permit(sub.request, ACCESS_READ, e) {
+			continue
+		}
+
+		if n++; n > 1 {
+			edits.WriteByte(',')
+		}
+		target := make([]string, 0, len(c.Resource.Segments))
+		for _, seg := range c.Resource.Segments {
+			target = append(target, seg.String())
+		}
+		fmt.Fprintf(&edits, `{"edit-id":"edit%d","operation":%q,"target":%q`,
+			n, c.Operation, "/"+strings.Join(target, "/"))
+		if c.After != nil {
+			value := restconf.filterRead(sub.request, e, copyTree(c.After))
+			if c.Resource.Segment().Keys != nil {
+				value = []interface{}{value}
+			}
+			edits.WriteString(`,"value":`)
+			edits.Write(schema.encode(APPLICATION_DATA_JSON, e, value))
+		}
+		edits.WriteString(`}`)
+	}
+	if n == 0 {
+		return
+	}
+
+	restconf.push(sub, "push-change-update", fmt.Sprintf(
+		`"datastore-changes":{"yang-patch":{"patch-id":%q,"edit":[%s]}}`, ev.RequestID, edits.String()))
+}
+
+// subscribedData returns the JSON encoding of the data of sub its subscriber
+// may read, nil if there is none.
+func (restconf *RestConf) subscribedData(sub *Subscription) []byte {
+	r := sub.Resource
+	value, ok := restconf.store.Get(r)
+	if !ok || !restconf.permit(sub.request, ACCESS_READ, r.Entry()) {
+		return nil
+	}
+	value = restconf.filterRead(sub.request, r.Entry(), value)
+	if r.Segment().Keys != nil {
+		value = []interface{}{value}
+	}
+	return sub.schema.encode(APPLICATION_DATA_JSON, r.Entry(), value)
+}
+
+// push queues the ietf-yang-push notification kind with the given members
+// for the stream of sub. It is dropped when the queue is full, which is
+// logged once until the queue takes updates again.
+func (restconf *RestConf) push(sub *Subscription, kind, members string) {
+	msg := fmt.Sprintf(`{"ietf-restconf:notification":{"eventTime":%q,"ietf-yang-push:%s":{"id":%d,%s}}}`,
+		restconf.now().UTC().Format(time.RFC3339Nano), kind, sub.ID, members)
+
+	select {
+	case sub.updates <- []byte(msg):
+		if n := atomic.SwapInt64(&sub.dropped, 0); n > 0 {
+			logRequest(sub.request, "subscription", sub.ID, "queue takes updates again,", n, "dropped")
+		}
+	default:
+		if atomic.AddInt64(&sub.dropped, 1) == 1 {
+			logRequest(sub.request, "subscription", sub.ID, "queue is full, dropping updates!")
+		}
+	}
+}
+
+// SubscriptionStream sends the notifications of a subscription as server
+// sent events, until the subscription is deleted or the client goes away,
+// which deletes it.
+func (restconf *RestConf) SubscriptionStream(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET") {
+		return
+	}
+
+	sub, err := restconf.subscriptions.get(req, strings.TrimPrefix(req.URL.Path, SUBSCRIPTION_PREFIX+"/"))
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	if err := restconf.subscriptions.receive(sub); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	defer restconf.subscriptions.remove(sub)
+
+	draining, done := restconf.trackStream()
+	defer done()
+
+	flusher, _ := rsp.(http.Flusher)
+	rsp.Header().Set("Content-Type", TEXT_EVENT_STREAM)
+	rsp.Header().Set("Cache-Control", "no-cache")
+	rsp.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-draining:
+			endStream(rsp, req)
+			return
+		case <-sub.stop:
+			return
+		case msg := <-sub.updates:
+			if _, err := fmt.Fprintf(rsp, "data: %s\n\n", msg); err != nil {
+				logRequest(req, "write subscription stream failed!", err.Error())
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
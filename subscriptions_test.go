@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subscriptionsModuleText holds the parts of ietf-subscribed-notifications
+// and the ietf-yang-push augmentations the subscription rpcs read.
+var subscriptionsModuleText = `
+module ietf-subscribed-notifications {
+  namespace "urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications";
+  prefix sn;
+
+  rpc establish-subscription {
+    input {
+      leaf datastore { type string; }
+      leaf datastore-xpath-filter { type string; }
+      container periodic {
+        leaf period { type uint32; }
+      }
+      container on-change {
+        presence "on-change updates";
+      }
+    }
+    output {
+      leaf id { type uint32; }
+      leaf uri { type string; }
+    }
+  }
+
+  rpc modify-subscription {
+    input {
+      leaf id { type uint32; }
+      container periodic {
+        leaf period { type uint32; }
+      }
+    }
+  }
+
+  rpc delete-subscription {
+    input {
+      leaf id { type uint32; }
+    }
+  }
+}
+`
+
+// establish establishes a subscription with input and returns its uri.
+func establish(t *testing.T, server http.Handler, input string) string {
+	rsp := doRequest(server, "POST", "/restconf/operations/ietf-subscribed-notifications:establish-subscription",
+		APPLICATION_DATA_JSON, `{"ietf-subscribed-notifications:input":`+input+`}`)
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("establish-subscription: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	var doc struct {
+		Output struct {
+			ID  uint32 `json:"id"`
+			URI string `json:"uri"`
+		} `json:"ietf-subscribed-notifications:output"`
+	}
+	if err := json.Unmarshal(rsp.Body.Bytes(), &doc); err != nil || doc.Output.URI == "" {
+		t.Fatalf("establish-subscription: got body %s: %v", rsp.Body, err)
+	}
+	return doc.Output.URI
+}
+
+// nextEvent returns the data of the next event of the stream, "" at its end.
+func nextEvent(t *testing.T, stream *bufio.Reader) string {
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			return ""
+		}
+		if strings.HasPrefix(line, "data: ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func openStream(t *testing.T, ts *httptest.Server, uri string) (*bufio.Reader, func()) {
+	rsp, err := ts.Client().Get(ts.URL + uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != TEXT_EVENT_STREAM {
+		t.Fatalf("GET %s: got status %d, Content-Type %s", uri, rsp.StatusCode, rsp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(rsp.Body), func() { rsp.Body.Close() }
+}
+
+func TestPeriodicSubscription(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test": testModuleText, "ietf-subscribed-notifications": subscriptionsModuleText}))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`)
+
+	uri := establish(t, server, `{"datastore-xpath-filter":"/test:system/hostname","periodic":{"period":10}}`)
+	stream, done := openStream(t, ts, uri)
+	defer done()
+
+	for i := 0; i < 2; i++ {
+		event := nextEvent(t, stream)
+		if !strings.Contains(event, `"ietf-yang-push:push-update":{"id":1,"datastore-contents":{"test:hostname":"a"}}`) {
+			t.Fatalf("got event %s, want a push-update of the hostname", event)
+		}
+	}
+
+	rsp := doRequest(server, "POST", "/restconf/operations/ietf-subscribed-notifications:modify-subscription",
+		APPLICATION_DATA_JSON, `{"ietf-subscribed-notifications:input":{"id":1,"periodic":{"period":20}}}`)
+	if rsp.Code != http.StatusNoContent {
+		t.Fatalf("modify-subscription: got status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	rsp = doRequest(server, "POST", "/restconf/operations/ietf-subscribed-notifications:delete-subscription",
+		APPLICATION_DATA_JSON, `{"ietf-subscribed-notifications:input":{"id":1}}`)
+	if rsp.Code != http.StatusNoContent {
+		t.Fatalf("delete-subscription: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	// The stream ends with the subscription.
+	for nextEvent(t, stream) != "" {
+	}
+
+	rsp = doRequest(server, "POST", "/restconf/operations/ietf-subscribed-notifications:delete-subscription",
+		APPLICATION_DATA_JSON, `{"ietf-subscribed-notifications:input":{"id":1}}`)
+	if rsp.Code != http.StatusNotFound || !strings.Contains(rsp.Body.String(), ERROR_APP_TAG_NO_SUCH_SUBSCRIPTION) {
+		t.Errorf("delete-subscription of a deleted subscription: got status %d: %s", rsp.Code, rsp.Body)
+	}
+}
+
+func TestOnChangeSubscription(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test": testModuleText, "ietf-subscribed-notifications": subscriptionsModuleText}))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	uri := establish(t, server, `{"datastore-xpath-filter":"/test:system","on-change":{}}`)
+	stream, done := openStream(t, ts, uri)
+	defer done()
+
+	steps := []struct {
+		method, url, body string
+		want              string
+	}{
+		{"PUT", "/restconf/data/test:system", `{"test:system":{"hostname":"a"}}`,
+			`"edit":[{"edit-id":"edit1","operation":"create","target":"/test:system","value":{"test:system":{"hostname":"a"}}}]`},
+		{"POST", "/restconf/data/test:system", `{"test:interface":[{"name":"eth0","unit":0}]}`,
+			`"edit":[{"edit-id":"edit1","operation":"create","target":"/test:system/interface=eth0,0",` +
+				`"value":{"test:interface":[{"name":"eth0","unit":0}]}}]`},
+		{"PATCH", "/restconf/data/test:system", `{"test:system":{"hostname":"b"}}`,
+			`"operation":"replace","target":"/test:system","value":{"test:system":{"hostname":"b","interface":[{"name":"eth0","unit":0}]}}`},
+		{"DELETE", "/restconf/data/test:system", "", `"edit":[{"edit-id":"edit1","operation":"delete","target":"/test:system"}]`},
+	}
+	for _, step := range steps {
+		doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+
+		events := make(chan string, 1)
+		go func() { events <- nextEvent(t, stream) }()
+		select {
+		case event := <-events:
+			if !strings.Contains(event, `"ietf-yang-push:push-change-update":{"id":1,`) || !strings.Contains(event, step.want) {
+				t.Errorf("%s %s: got event %s, want %s", step.method, step.url, event, step.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s %s: no change update", step.method, step.url)
+		}
+	}
+}
+
+func TestSubscriptionErrors(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test": testModuleText, "ietf-subscribed-notifications": subscriptionsModuleText}))
+
+	tests := []struct {
+		input  string
+		status int
+	}{
+		{`{"datastore-xpath-filter":"/test:system"}`, http.StatusBadRequest},
+		{`{"datastore-xpath-filter":"/test:system","periodic":{"period":0}}`, http.StatusBadRequest},
+		{`{"datastore-xpath-filter":"/test:system","periodic":{"period":9}}`, http.StatusBadRequest},
+		{`{"datastore-xpath-filter":"/test:nothing","periodic":{"period":10}}`, http.StatusBadRequest},
+		{`{"datastore":"ietf-datastores:candidate","datastore-xpath-filter":"/test:system","on-change":{}}`, http.StatusBadRequest},
+		{`{"datastore-xpath-filter":"/test:system/interface[name='eth0'][unit='0']","on-change":{}}`, http.StatusOK},
+		{`{"datastore-xpath-filter":"/test:system/interface[name='eth0']","on-change":{}}`, http.StatusBadRequest},
+		{`{"datastore-xpath-filter":"/test:system/interface=eth0,0","on-change":{}}`, http.StatusBadRequest},
+		{`{"datastore-xpath-filter":"/test:system | /test:system/hostname","on-change":{}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rsp := doRequest(server, "POST", "/restconf/operations/ietf-subscribed-notifications:establish-subscription",
+			APPLICATION_DATA_JSON, `{"ietf-subscribed-notifications:input":`+tt.input+`}`)
+		if rsp.Code != tt.status {
+			t.Errorf("establish-subscription %s: got status %d, want %d: %s", tt.input, rsp.Code, tt.status, rsp.Body)
+		}
+	}
+
+	if rsp := doRequest(server, "GET", SUBSCRIPTION_PREFIX+"/7", "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown subscription: got status %d, want %d", rsp.Code, http.StatusNotFound)
+	}
+}
+
+func TestSubscriptionLimits(t *testing.T) {
+	defer func(max, user int) { MAX_SUBSCRIPTIONS, MAX_USER_SUBSCRIPTIONS = max, user }(MAX_SUBSCRIPTIONS, MAX_USER_SUBSCRIPTIONS)
+	MAX_SUBSCRIPTIONS, MAX_USER_SUBSCRIPTIONS = 3, 2
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test": testModuleText, "ietf-subscribed-notifications": subscriptionsModuleText}))
+	server.users = testUsers(t, "alice", "bob")
+
+	for _, step := range []struct {
+		user   string
+		status int
+	}{
+		{"alice", http.StatusOK},
+		{"alice", http.StatusOK},
+		{"alice", http.StatusConflict}, // beyond the subscriptions of a user
+		{"bob", http.StatusOK},
+		{"bob", http.StatusConflict}, // beyond the subscriptions of the server
+	} {
+		req := httptest.NewRequest("POST", "/restconf/operations/ietf-subscribed-notifications:establish-subscription",
+			strings.NewReader(`{"ietf-subscribed-notifications:input":{"datastore-xpath-filter":"/test:system","on-change":{}}}`))
+		req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+		req.SetBasicAuth(step.user, step.user+"-secret")
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != step.status {
+			t.Errorf("%s: got status %d, want %d: %s", step.user, rsp.Code, step.status, rsp.Body)
+		}
+		if step.status == http.StatusConflict && !strings.Contains(rsp.Body.String(), ERROR_TAG_RESOURCE_DENIED) {
+			t.Errorf("%s: got %s, want a %s error", step.user, rsp.Body, ERROR_TAG_RESOURCE_DENIED)
+		}
+	}
+}
+
+func TestSubscriptionTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { SUBSCRIPTION_TIMEOUT = timeout }(SUBSCRIPTION_TIMEOUT)
+	SUBSCRIPTION_TIMEOUT = 50 * time.Millisecond
+	server := NewRestConf(testSchema(t, map[string]string{
+		"test": testModuleText, "ietf-subscribed-notifications": subscriptionsModuleText}))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// A subscription whose stream is not opened is deleted.
+	uri := establish(t, server, `{"datastore-xpath-filter":"/test:system","periodic":{"period":10}}`)
+	time.Sleep(200 * time.Millisecond)
+	if rsp := doRequest(server, "GET", uri, "", ""); rsp.Code != http.StatusNotFound {
+		t.Errorf("GET %s after the timeout: got status %d, want %d", uri, rsp.Code, http.StatusNotFound)
+	}
+
+	// One opened in time is kept, with a single stream.
+	uri = establish(t, server, `{"datastore-xpath-filter":"/test:system","periodic":{"period":10}}`)
+	stream, done := openStream(t, ts, uri)
+	defer done()
+	time.Sleep(200 * time.Millisecond)
+	if event := nextEvent(t, stream); !strings.Contains(event, "push-update") {
+		t.Errorf("got event %s, want a push-update", event)
+	}
+	if rsp := doRequest(server, "GET", uri, "", ""); rsp.Code != http.StatusConflict {
+		t.Errorf("second GET %s: got status %d, want %d", uri, rsp.Code, http.StatusConflict)
+	}
+}
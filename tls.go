@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+/*
+   RESTCONF requires TLS (RFC 8040 section 2.1). With -tls-cert and -tls-key
+   the server only speaks HTTPS on its listen address, and -http adds a
+   plaintext listener helping clients migrate, which in -http-mode
+
+   redirect  redirects every request to the same URL over HTTPS
+   reject    refuses every request with an error naming the HTTPS URL
+   none      serves the requests as the HTTPS listener does
+
+   restconf -tls-cert server.crt -tls-key server.key -addr :443 -http :80
+*/
+
+var (
+	PLAINTEXT_REDIRECT = "redirect"
+	PLAINTEXT_REJECT   = "reject"
+	PLAINTEXT_NONE     = "none"
+)
+
+// httpsURL returns the URL of req on the HTTPS listener bound to tlsAddr,
+// on the host the client sent req to.
+func httpsURL(req *http.Request, tlsAddr string) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(tlsAddr); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	u := url.URL{Scheme: "https", Host: host, Path: req.URL.Path, RawPath: req.URL.RawPath, RawQuery: req.URL.RawQuery}
+	return u.String()
+}
+
+// plaintextHandler returns the handler of the plaintext listener in mode,
+// next being the handler of the HTTPS listener bound to tlsAddr.
+func plaintextHandler(mode, tlsAddr string, next http.Handler) (http.Handler, error) {
+	switch mode {
+	case PLAINTEXT_NONE:
+		return next, nil
+	case PLAINTEXT_REDIRECT:
+		return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			// A 301 may turn the method of the redirected request into
+			// GET, requests other than GET and HEAD are redirected with
+			// 308, which keeps their method and body.
+			status := http.StatusMovedPermanently
+			if req.Method != "GET" && req.Method != "HEAD" {
+				status = http.StatusPermanentRedirect
+			}
+			http.Redirect(rsp, req, httpsURL(req, tlsAddr), status)
+		}), nil
+	case PLAINTEXT_REJECT:
+		return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			writeError(rsp, req, NewError(http.StatusForbidden, ERROR_TYPE_TRANSPORT,
+				ERROR_TAG_ACCESS_DENIED, "RESTCONF requires TLS, use %s", httpsURL(req, tlsAddr)))
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown plaintext mode %q", mode)
+}
+
+// listenPlaintext starts serving the plaintext listener addr in mode, next
+// being the handler of the HTTPS listener bound to tlsAddr.
+func listenPlaintext(addr, mode, tlsAddr string, next http.Handler) error {
+	handler, err := plaintextHandler(mode, tlsAddr, next)
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(handler, false)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if proxyproto {
+		ln = ProxyListener(ln)
+	}
+	go srv.Serve(ln)
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlaintextHandler(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		mode, method, tlsAddr string
+		status                int
+		location              string
+	}{
+		{PLAINTEXT_REDIRECT, "GET", ":443", http.StatusMovedPermanently, "https://example.com/restconf/data/test:system/interface=eth%2F0,0?depth=1"},
+		{PLAINTEXT_REDIRECT, "PUT", ":8443", http.StatusPermanentRedirect, "https://example.com:8443/restconf/data/test:system/interface=eth%2F0,0?depth=1"},
+		{PLAINTEXT_REJECT, "GET", ":443", http.StatusForbidden, ""},
+		{PLAINTEXT_NONE, "GET", ":443", http.StatusNotFound, ""},
+	} {
+		handler, err := plaintextHandler(test.mode, test.tlsAddr, server)
+		if err != nil {
+			t.Fatalf("%s: %v", test.mode, err)
+		}
+		req := httptest.NewRequest(test.method, "http://example.com:8080/restconf/data/test:system/interface=eth%2F0,0?depth=1", nil)
+		rsp := httptest.NewRecorder()
+		handler.ServeHTTP(rsp, req)
+		if rsp.Code != test.status || rsp.Header().Get("Location") != test.location {
+			t.Errorf("%s %s: got status %d, Location %q, want %d, %q", test.mode, test.method,
+				rsp.Code, rsp.Header().Get("Location"), test.status, test.location)
+		}
+	}
+
+	if _, err := plaintextHandler("upgrade", ":443", server); err == nil {
+		t.Errorf("unknown mode: got no error")
+	}
+}
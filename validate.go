@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+// MAX_TYPE_DEPTH bounds the nesting of unions and leafrefs followed when
+// matching a value, leafrefs can refer to each other in a loop.
+var MAX_TYPE_DEPTH = 32
+
+// STRICT_VALIDATION rejects request bodies holding members the schema does
+// not define. When it is false such members are ignored with a warning in the
+// log, values that are invalid for their type are rejected all the same.
+var STRICT_VALIDATION = true
+
+// CHECK_RESPONSES checks the data of responses against the schema before it
+// is sent. It is off by default: a checked response is encoded and decoded
+// again in full before it is streamed.
+var CHECK_RESPONSES = false
+
+// intBits is the size of each integer type.
+var intBits = map[yang.TypeKind]int{
+	yang.Yint8: 8, yang.Yint16: 16, yang.Yint32: 32, yang.Yint64: 64,
+	yang.Yuint8: 8, yang.Yuint16: 16, yang.Yuint32: 32, yang.Yuint64: 64,
+}
+
+// checkResponse checks the data v of the node e, as a response would send
+// it, against the schema, decoding its JSON encoding as the body of an edit
+// would be. req is the request the response answers.
+func (schema *Schema) checkResponse(req *http.Request, e *yang.Entry, v interface{}) error {
+	doc := schema.encode(APPLICATION_DATA_JSON, e, v)
+	_, _, err := schema.decodeJSON(req, bytes.NewReader(doc), nil, func(mod, name string) *yang.Entry { return e })
+	return err
+}
+
+// A jsonType is the JSON type a leaf value was decoded from. Union members
+// only match values encoded as their own type is in JSON, so that "5" is not
+// taken for a uint8 (RFC 7951 section 6.10).
+type jsonType int
+
+const (
+	anyJSON jsonType = iota // not decoded from JSON
+	jsonString
+	jsonNumber
+	jsonBool
+)
+
+// String returns the name of the JSON type t.
+func (t jsonType) String() string {
+	switch t {
+	case jsonString:
+		return "string"
+	case jsonNumber:
+		return "number"
+	case jsonBool:
+		return "boolean"
+	}
+	return "value"
+}
+
+// jsonTypeOf returns the JSON type values of the type kind are encoded as
+// (RFC 7951 section 6). 64-bit integers and decimal64 values are strings.
+func jsonTypeOf(kind yang.TypeKind) jsonType {
+	switch kind {
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yuint8, yang.Yuint16, yang.Yuint32:
+		return jsonNumber
+	case yang.Ybool:
+		return jsonBool
+	}
+	return jsonString
+}
+
+// leafValue checks the value s of the leaf or leaf-list e against the type
+// of e and returns it in its canonical form (RFC 7950 section 9).
+func leafValue(e *yang.Entry, s string) (string, error) {
+	return leafJSONValue(e, s, anyJSON)
+}
+
+// leafJSONValue is leafValue for a value decoded from the JSON type js, the
+// type must match it unless it is anyJSON.
+func leafJSONValue(e *yang.Entry, s string, js jsonType) (string, error) {
+	if e.Type == nil {
+		return s, nil
+	}
+	_, v, err := matchType(e, e.Type, s, js, 0)
+	return v, err
+}
+
+// matchType checks the value s of the leaf e against the type t and returns
+// the type s matched along with its canonical form. Leafrefs match as the
+// leaf they refer to and unions as the first of their member types that s
+// is valid for, and that takes the JSON type js unless it is anyJSON.
+func matchType(e *yang.Entry, t *yang.YangType, s string, js jsonType, depth int) (*yang.YangType, string, error) {
+	if depth > MAX_TYPE_DEPTH {
+		return t, s, nil
+	}
+
+	switch kind := t.Kind; kind {
+	case yang.Yunion, yang.Yleafref:
+	default:
+		if js != anyJSON && jsonTypeOf(kind) != js {
+			return t, "", invalidValue("%s values of leaf %s are not encoded as a JSON %s", kind, e.Name, js)
+		}
+	}
+
+	switch kind := t.Kind; kind {
+	case yang.Yempty:
+		if s != "" {
+			return t, "", invalidValue("leaf %s of type empty cannot have a value", e.Name)
+		}
+	case yang.Ybool:
+		if s != "true" && s != "false" {
+			return t, "", invalidValue("invalid boolean value %q for leaf %s", s, e.Name)
+		}
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yint64:
+		v, err := strconv.ParseInt(s, 10, intBits[kind])
+		if err != nil {
+			return t, "", invalidValue("invalid %s value %q for leaf %s", kind, s, e.Name)
+		}
+		return t, strconv.FormatInt(v, 10), checkRange(e, t, yang.FromInt(v), s)
+	case yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64:
+		v, err := strconv.ParseUint(s, 10, intBits[kind])
+		if err != nil {
+			return t, "", invalidValue("invalid %s value %q for leaf %s", kind, s, e.Name)
+		}
+		return t, strconv.FormatUint(v, 10), checkRange(e, t, yang.FromUint(v), s)
+	case yang.Ydecimal64:
+		n, err := parseDecimal(s, t.FractionDigits)
+		if err != nil {
+			return t, "", invalidValue("invalid decimal64 value %q for leaf %s: %s", s, e.Name, err.Error())
+		}
+		return t, canonicalDecimal(n), checkRange(e, t, n, s)
+	case yang.Ystring:
+		return t, s, checkLength(e, t, uint64(utf8.RuneCountInString(s)), "characters")
+	case yang.Ybinary:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return t, "", invalidValue("invalid base64 value for binary leaf %s", e.Name)
+		}
+		return t, s, checkLength(e, t, uint64(len(b)), "bytes")
+	case yang.Yenum:
+		if t.Enum != nil && !t.Enum.IsDefined(s) {
+			return t, "", invalidValue("%q is not an enum of leaf %s", s, e.Name)
+		}
+	case yang.Ybits:
+		return bitsValue(e, t, s)
+	case yang.Yidentityref:
+		return identityValue(e, t, s)
+	case yang.YinstanceIdentifier:
+		return instanceIDValue(e, t, s)
+	case yang.Yleafref:
+		target := leafrefTarget(e, t.Path)
+		if target == nil || target.Type == nil {
+			return t, s, nil
+		}
+		return matchType(target, target.Type, s, js, depth+1)
+	case yang.Yunion:
+		var names []string
+		for _, member := range t.Type {
+			if mt, v, err := matchType(e, member, s, js, depth+1); err == nil {
+				return mt, v, nil
+			}
+			names = append(names, member.Name)
+		}
+		return t, "", invalidValue("value %q of leaf %s matches none of the union types %s",
+			s, e.Name, strings.Join(names, ", "))
+	}
+	return t, s, nil
+}
+
+// bitsValue checks that every bit named in the space separated list s is
+// defined by the bits type t. The canonical form lists the bits in the order
+// of their positions (RFC 7950 section 9.7.2).
+func bitsValue(e *yang.Entry, t *yang.YangType, s string) (*yang.YangType, string, error) {
+	if t.Bit == nil {
+		return t, s, nil
+	}
+	names := strings.Fields(s)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !t.Bit.IsDefined(name) {
+			return t, "", invalidValue("%q is not a bit of leaf %s", name, e.Name)
+		}
+		if seen[name] {
+			return t, "", invalidValue("bit %q of leaf %s is set more than once", name, e.Name)
+		}
+		seen[name] = true
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return t.Bit.Value(names[i]) < t.Bit.Value(names[j])
+	})
+	return t, strings.Join(names, " "), nil
+}
+
+// identityValue checks that s names an identity derived from the base of
+// the identityref type t. The canonical form is qualified by the name of the
+// module defining the identity (RFC 7951 section 6.8). A name only goes
+// unqualified for an identity of the module of e itself.
+func identityValue(e *yang.Entry, t *yang.YangType, s string) (*yang.YangType, string, error) {
+	if t.IdentityBase == nil {
+		return t, s, nil
+	}
+	mod, name := splitName(s)
+	if mod == "" {
+		mod, _ = e.InstantiatingModule()
+	}
+	for _, id := range t.IdentityBase.Values {
+		if id.Name != name {
+			continue
+		}
+		if idmod := identityModule(id); mod == idmod {
+			return t, idmod + ":" + name, nil
+		}
+	}
+	return t, "", invalidValue("%q is not an identity derived from %s for leaf %s", s, t.IdentityBase.Name, e.Name)
+}
+
+// identityModule returns the name of the module defining the identity id.
+func identityModule(id *yang.Identity) string {
+	mod := yang.RootNode(id)
+	switch {
+	case mod == nil:
+		return ""
+	case mod.BelongsTo != nil:
+		return mod.BelongsTo.Name
+	}
+	return mod.Name
+}
+
+// canonicalLeaf returns the canonical form of the leaf value s, or s itself
+// if it is not a valid value of e.
+func canonicalLeaf(e *yang.Entry, s string) string {
+	if v, err := leafValue(e, s); err == nil {
+		return v
+	}
+	return s
+}
+
+// parseDecimal parses the decimal64 value s with at most digits fraction
+// digits. The value must fit an int64 once scaled by 10^digits, which bounds
+// the range of the type (RFC 7950 section 9.3.4).
+func parseDecimal(s string, digits int) (yang.Number, error) {
+	var n yang.Number
+	if strings.ContainsAny(s, "eExX") || strings.HasPrefix(strings.TrimLeft(s, "+-"), ".") ||
+		strings.HasSuffix(s, ".") {
+		return n, strconv.ErrSyntax
+	}
+	n, err := yang.DecimalValueFromString(s, digits)
+	if err != nil {
+		return n, err
+	}
+	// DecimalValueFromString scales the value to digits, but records the
+	// precision of s.
+	n.FractionDigits = uint8(digits)
+	return n, nil
+}
+
+// canonicalDecimal formats n without leading or trailing zeros, keeping
+// one digit on each side of the decimal point.
+func canonicalDecimal(n yang.Number) string {
+	s := n.String()
+	if !strings.Contains(s, ".") {
+		return s + ".0"
+	}
+	s = strings.TrimRight(s, "0")
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+	if s == "-0.0" {
+		s = "0.0"
+	}
+	return s
+}
+
+// checkRange checks that the number n, given as s, lies in the range of the
+// type t of e. A type without range restriction allows every value.
+func checkRange(e *yang.Entry, t *yang.YangType, n yang.Number, s string) error {
+	if len(t.Range) == 0 {
+		return nil
+	}
+	for _, r := range t.Range {
+		if !n.Less(r.Min) && !r.Max.Less(n) {
+			return nil
+		}
+	}
+	return invalidValue("value %s of leaf %s is out of range %s", s, e.Name, t.Range)
+}
+
+// checkLength checks that the length n, counted in unit, of a value of the
+// leaf e lies in the length of its type t, in any of its parts.
+func checkLength(e *yang.Entry, t *yang.YangType, n uint64, unit string) error {
+	if len(t.Length) == 0 {
+		return nil
+	}
+	l := yang.FromUint(n)
+	for _, r := range t.Length {
+		if !l.Less(r.Min) && !r.Max.Less(l) {
+			return nil
+		}
+	}
+	return invalidValue("value of leaf %s is %d %s long, out of length %s", e.Name, n, unit, t.Length)
+}
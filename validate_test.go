@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+// decodeLeaf decodes the document body holding the leaf name of the
+// test:system container.
+func decodeLeaf(t *testing.T, schema *Schema, ctype, body string) (string, error) {
+	t.Helper()
+	req := httptest.NewRequest("PUT", "/restconf/data/test:system", strings.NewReader(body))
+	req.Header.Set("Content-Type", ctype)
+	v, err := schema.decode(req, nil, schema.Lookup("/test/system"))
+	if err != nil {
+		return "", err
+	}
+	for _, value := range v.(map[string]interface{}) {
+		return value.(string), nil
+	}
+	t.Fatalf("decoded no leaf from %s", body)
+	return "", nil
+}
+
+func TestEmptyLeaf(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+	system := schema.Lookup("/test/system")
+	value := map[string]interface{}{"debug": ""}
+
+	for _, test := range []struct {
+		ctype string
+		doc   string
+		bad   []string
+	}{
+		{
+			APPLICATION_DATA_JSON,
+			`{"test:system":{"debug":[null]}}`,
+			[]string{`{"test:system":{"debug":""}}`, `{"test:system":{"debug":[]}}`, `{"test:system":{"debug":true}}`, `{"test:system":{"debug":null}}`},
+		},
+		{
+			APPLICATION_DATA_XML,
+			`<system xmlns="urn:test"><debug/></system>`,
+			[]string{`<system xmlns="urn:test"><debug>on</debug></system>`, `<system xmlns="urn:test"><debug><on/></debug></system>`},
+		},
+	} {
+		if got := string(schema.encode(test.ctype, system, value)); got != test.doc {
+			t.Errorf("%s: encode got %s, want %s", test.ctype, got, test.doc)
+		}
+		if got, err := decodeLeaf(t, schema, test.ctype, test.doc); err != nil || got != "" {
+			t.Errorf("%s: decode %s: got %q, %v", test.ctype, test.doc, got, err)
+		}
+		for _, doc := range test.bad {
+			if _, err := decodeLeaf(t, schema, test.ctype, doc); err == nil {
+				t.Errorf("%s: decode %s: no error", test.ctype, doc)
+			}
+		}
+	}
+
+	if _, err := decodeLeaf(t, schema, APPLICATION_DATA_XML, `<system xmlns="urn:test"><debug> </debug></system>`); err != nil {
+		t.Errorf("decode empty leaf with white space: %v", err)
+	}
+	if _, err := decodeLeaf(t, schema, APPLICATION_DATA_JSON, `{"test:system":{"hostname":[null]}}`); err == nil {
+		t.Errorf("decode [null] for a string leaf: no error")
+	}
+}
+
+func TestInt64Leaf(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+	system := schema.Lookup("/test/system")
+
+	// 2^53 + 1 is the first integer a float64 cannot represent.
+	value := map[string]interface{}{"counter": "18446744073709551615", "offset": "9007199254740993"}
+	want := `{"test:system":{"counter":"18446744073709551615","offset":"9007199254740993"}}`
+	if got := string(schema.encode(APPLICATION_DATA_JSON, system, value)); got != want {
+		t.Errorf("encode got %s, want %s", got, want)
+	}
+
+	for _, test := range []struct {
+		doc  string
+		want string
+		ok   bool
+	}{
+		{`{"test:system":{"offset":"9007199254740993"}}`, "9007199254740993", true},
+		{`{"test:system":{"offset":9007199254740993}}`, "9007199254740993", true},
+		{`{"test:system":{"offset":"-9223372036854775808"}}`, "-9223372036854775808", true},
+		{`{"test:system":{"counter":"18446744073709551615"}}`, "18446744073709551615", true},
+		{`{"test:system":{"offset":"9007199254740994"}}`, "", false},
+		{`{"test:system":{"offset":"0"}}`, "", false},
+		{`{"test:system":{"counter":"18446744073709551616"}}`, "", false},
+		{`{"test:system":{"counter":"-1"}}`, "", false},
+		{`{"test:system":{"counter":"1.5"}}`, "", false},
+	} {
+		got, err := decodeLeaf(t, schema, APPLICATION_DATA_JSON, test.doc)
+		switch {
+		case test.ok && (err != nil || got != test.want):
+			t.Errorf("decode %s: got %q, %v, want %q", test.doc, got, err, test.want)
+		case !test.ok && err == nil:
+			t.Errorf("decode %s: got %q, want an error", test.doc, got)
+		}
+	}
+
+	if _, err := decodeLeaf(t, schema, APPLICATION_DATA_XML,
+		`<system xmlns="urn:test"><offset>9007199254740994</offset></system>`); err == nil {
+		t.Errorf("decode out of range XML value: no error")
+	}
+}
+
+func TestDecimal64Leaf(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+
+	for _, test := range []struct {
+		leaf  string
+		value string
+		want  string
+		ok    bool
+	}{
+		{"ratio", `"1.5"`, "1.5", true},
+		{"ratio", `1.50`, "1.5", true},
+		{"ratio", `"100"`, "100.0", true},
+		{"ratio", `"-1.50"`, "-1.5", true},
+		{"ratio", `"0.01"`, "0.01", true},
+		{"ratio", `"-0.00"`, "0.0", true},
+		{"ratio", `"0.001"`, "", false},
+		{"ratio", `"100.01"`, "", false},
+		{"ratio", `"-1.51"`, "", false},
+		{"ratio", `"1e2"`, "", false},
+		{"ratio", `".5"`, "", false},
+		{"ratio", `"5."`, "", false},
+		{"ratio", `"abc"`, "", false},
+		{"precise", `"9.223372036854775807"`, "9.223372036854775807", true},
+		{"precise", `"-9.223372036854775808"`, "-9.223372036854775808", true},
+		{"precise", `"9.223372036854775808"`, "", false},
+		{"precise", `"10.0"`, "", false},
+	} {
+		doc := `{"test:system":{"` + test.leaf + `":` + test.value + `}}`
+		got, err := decodeLeaf(t, schema, APPLICATION_DATA_JSON, doc)
+		switch {
+		case test.ok && (err != nil || got != test.want):
+			t.Errorf("decode %s: got %q, %v, want %q", doc, got, err, test.want)
+		case !test.ok && err == nil:
+			t.Errorf("decode %s: got %q, want an error", doc, got)
+		}
+	}
+
+	system := schema.Lookup("/test/system")
+	value := map[string]interface{}{"ratio": "2.50"}
+	if got, want := string(schema.encode(APPLICATION_DATA_JSON, system, value)), `{"test:system":{"ratio":"2.5"}}`; got != want {
+		t.Errorf("encode got %s, want %s", got, want)
+	}
+	if got, want := string(schema.encode(APPLICATION_DATA_XML, system, value)), `<system xmlns="urn:test"><ratio>2.5</ratio></system>`; got != want {
+		t.Errorf("encode got %s, want %s", got, want)
+	}
+}
+
+const rangeModuleText = `module ranges {
+  namespace "urn:ranges";
+  prefix r;
+  typedef small { type int32 { range "1..10|20..30"; } }
+  container limits {
+    leaf level { type int8 { range "min..-100|0|100..max"; } }
+    leaf narrow { type small { range "min..5|25..max"; } }
+    leaf ratio { type decimal64 { fraction-digits 1; range "min..-1.5|1.5..max"; } }
+    leaf code { type string { length "2..3|5|8..max"; } }
+    leaf tag { type string { length "min..1|4"; } }
+    leaf blob { type binary { length "2|4..max"; } }
+  }
+}`
+
+func TestRangeLength(t *testing.T) {
+	schema := testSchema(t, map[string]string{"ranges": rangeModuleText})
+
+	for _, test := range []struct {
+		leaf  string
+		value string
+		ok    bool
+	}{
+		{"level", "-128", true},
+		{"level", "-100", true},
+		{"level", "-99", false},
+		{"level", "0", true},
+		{"level", "1", false},
+		{"level", "127", true},
+		// min and max are the bounds of the typedef narrow restricts.
+		{"narrow", "1", true},
+		{"narrow", "0", false},
+		{"narrow", "6", false},
+		{"narrow", "25", true},
+		{"narrow", "30", true},
+		{"narrow", "31", false},
+		{"ratio", "-1.5", true},
+		{"ratio", "0", false},
+		{"ratio", "1.4", false},
+		{"ratio", "1000.5", true},
+		{"code", "a", false},
+		{"code", "ab", true},
+		{"code", "abcd", false},
+		{"code", "abcde", true},
+		{"code", "abcdefg", false},
+		{"code", "abcdefgh", true},
+		{"code", "ééééé", true},
+		{"tag", "", true},
+		{"tag", "ab", false},
+		{"tag", "abcd", true},
+		{"blob", "AAA=", true},
+		{"blob", "AA==", false},
+		{"blob", "AAAAAA==", true},
+		{"blob", "not base64", false},
+	} {
+		_, err := leafValue(schema.Lookup("/ranges/limits/"+test.leaf), test.value)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s %q: got error %v, want ok %v", test.leaf, test.value, err, test.ok)
+		}
+	}
+}
+
+func TestRangeOutsideBase(t *testing.T) {
+	ms := yang.NewModules()
+	if err := ms.Parse(`module bad {
+  namespace "urn:bad";
+  prefix b;
+  typedef small { type int32 { range "1..10|20..30"; } }
+  leaf x { type small { range "min..15"; } }
+}`, "bad.yang"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := ms.Process(); len(errs) == 0 {
+		t.Error("a range beyond the range of its base type is accepted")
+	}
+}
+
+func TestUnionLeaf(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText, "idext": `module idext {
+  namespace "urn:idext"; prefix e;
+  import test { prefix t; }
+  identity turbo { base t:speed; }
+}`})
+	system := schema.Lookup("/test/system")
+
+	for _, test := range []struct {
+		value string
+		want  string
+		json  string
+	}{
+		{`5`, "5", `5`},
+		// A string is not a uint8 in JSON, "5" is a value of the uint64
+		// leafref, which is encoded as the uint8 it matches first.
+		{`"5"`, "5", `5`},
+		{`"high"`, "high", `"high"`},
+		{`"11"`, "11", `"11"`},
+		{`"fast"`, "test:fast", `"test:fast"`},
+		{`"test:slow"`, "test:slow", `"test:slow"`},
+		{`"idext:turbo"`, "idext:turbo", `"idext:turbo"`},
+		{`true`, "true", `true`},
+		{`"medium"`, "", ""},
+		{`"other:fast"`, "", ""},
+		{`"turbo"`, "", ""},
+		{`"-1"`, "", ""},
+		{`11`, "", ""},
+		{`"true"`, "", ""},
+	} {
+		doc := `{"test:system":{"mode":` + test.value + `}}`
+		got, err := decodeLeaf(t, schema, APPLICATION_DATA_JSON, doc)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("decode %s: got %q, want an error", doc, got)
+			} else if !strings.Contains(err.Error(), "level, identityref, leafref, boolean") {
+				t.Errorf("decode %s: error %q does not list the union types", doc, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("decode %s: got %q, %v, want %q", doc, got, err, test.want)
+			continue
+		}
+
+		want := `{"test:system":{"mode":` + test.json + `}}`
+		if enc := string(schema.encode(APPLICATION_DATA_JSON, system, map[string]interface{}{"mode": got})); enc != want {
+			t.Errorf("encode %q: got %s, want %s", got, enc, want)
+		}
+	}
+
+	for _, test := range []struct {
+		doc, want string
+	}{
+		{`<system xmlns="urn:test"><mode xmlns:x="urn:test">x:slow</mode></system>`, "test:slow"},
+		{`<system xmlns="urn:test" xmlns:x="urn:idext"><mode>x:turbo</mode></system>`, "idext:turbo"},
+		{`<system xmlns="urn:test" xmlns:x="urn:idext"><mode xmlns:x="urn:test">x:slow</mode></system>`, "test:slow"},
+		{`<system xmlns="urn:test" xmlns:x="urn:test"><mode xmlns:x="urn:idext">x:slow</mode></system>`, ""},
+	} {
+		got, err := decodeLeaf(t, schema, APPLICATION_DATA_XML, test.doc)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("decode %s: got %q, want an error", test.doc, got)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("decode %s: got %q, %v, want %q", test.doc, got, err, test.want)
+		}
+	}
+
+	// An identity is encoded with the prefix of its module declared on the
+	// element, and decodes back to itself.
+	for id, want := range map[string]string{
+		"idext:turbo": `<system xmlns="urn:test"><mode xmlns:idext="urn:idext">idext:turbo</mode></system>`,
+		"test:slow":   `<system xmlns="urn:test"><mode xmlns:test="urn:test">test:slow</mode></system>`,
+		"high":        `<system xmlns="urn:test"><mode>high</mode></system>`,
+	} {
+		enc := string(schema.encode(APPLICATION_DATA_XML, system, map[string]interface{}{"mode": id}))
+		if enc != want {
+			t.Errorf("encode %q: got %s, want %s", id, enc, want)
+			continue
+		}
+		if got, err := decodeLeaf(t, schema, APPLICATION_DATA_XML, enc); err != nil || got != id {
+			t.Errorf("decode %s: got %q, %v, want %q", enc, got, err, id)
+		}
+	}
+}
+
+func TestBitsLeaf(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+	system := schema.Lookup("/test/system")
+
+	for _, test := range []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"running up loopback", "up loopback running", true},
+		{" running  up ", "up running", true},
+		{"loopback", "loopback", true},
+		{"", "", true},
+		{"up down", "", false},
+		{"up up", "", false},
+	} {
+		for _, ctype := range []string{APPLICATION_DATA_JSON, APPLICATION_DATA_XML} {
+			doc := `{"test:system":{"flags":"` + test.value + `"}}`
+			if ctype == APPLICATION_DATA_XML {
+				doc = `<system xmlns="urn:test"><flags>` + test.value + `</flags></system>`
+			}
+			got, err := decodeLeaf(t, schema, ctype, doc)
+			switch {
+			case test.ok && (err != nil || got != test.want):
+				t.Errorf("decode %s: got %q, %v, want %q", doc, got, err, test.want)
+			case !test.ok && err == nil:
+				t.Errorf("decode %s: got %q, want an error", doc, got)
+			}
+		}
+	}
+
+	value := map[string]interface{}{"flags": "running up"}
+	if got, want := string(schema.encode(APPLICATION_DATA_JSON, system, value)), `{"test:system":{"flags":"up running"}}`; got != want {
+		t.Errorf("encode got %s, want %s", got, want)
+	}
+	if got, want := string(schema.encode(APPLICATION_DATA_XML, system, value)), `<system xmlns="urn:test"><flags>up running</flags></system>`; got != want {
+		t.Errorf("encode got %s, want %s", got, want)
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	defer func(strict bool) { STRICT_VALIDATION = strict }(STRICT_VALIDATION)
+
+	for _, strict := range []bool{true, false} {
+		STRICT_VALIDATION = strict
+		server := testServer(t)
+
+		for _, test := range []struct {
+			ctype, body string
+			unknown     bool // holds an unknown member, accepted only when lenient
+		}{
+			{APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a","color":"red"}}`, true},
+			{APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a","other:color":"red"}}`, true},
+			{APPLICATION_DATA_XML, `<system xmlns="urn:test"><hostname>a</hostname><color>red</color></system>`, true},
+			{APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a","counter":"many","color":"red"}}`, false},
+		} {
+			rsp := doRequest(server, "PUT", "/restconf/data/test:system", test.ctype, test.body)
+			accepted := rsp.Code == http.StatusCreated || rsp.Code == http.StatusNoContent
+			if accepted != (test.unknown && !strict) {
+				t.Errorf("strict=%v: PUT %s: got status %d: %s", strict, test.body, rsp.Code, rsp.Body)
+			}
+		}
+		if !strict {
+			rsp := doRequest(server, "GET", "/restconf/data/test:system", "", "")
+			if want := `{"test:system":{"hostname":"a"}}`; rsp.Body.String() != want {
+				t.Errorf("strict=%v: GET got %s, want %s", strict, rsp.Body, want)
+			}
+		}
+	}
+}
+
+func TestCheckResponses(t *testing.T) {
+	defer func(check bool) { CHECK_RESPONSES = check }(CHECK_RESPONSES)
+
+	for _, check := range []bool{true, false} {
+		CHECK_RESPONSES = check
+		server := testServer(t)
+
+		// Data the datastore holds against the schema is only sent
+		// when responses are not checked.
+		r, _ := server.Schema().Resolve([]PathSegment{{Module: "test", Name: "system"}})
+		server.store.Edit("PUT", r, map[string]interface{}{"counter": "many"}, nil, nil, nil)
+		status := http.StatusOK
+		if check {
+			status = http.StatusInternalServerError
+		}
+		for _, url := range []string{"/restconf/data/test:system", "/restconf/data"} {
+			if rsp := doRequest(server, "GET", url, "", ""); rsp.Code != status {
+				t.Errorf("check=%v: GET %s: got status %d, want %d: %s", check, url, rsp.Code, status, rsp.Body)
+			}
+		}
+	}
+}
+
+func TestLenientWarning(t *testing.T) {
+	defer func(strict bool) { STRICT_VALIDATION = strict }(STRICT_VALIDATION)
+	STRICT_VALIDATION = false
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// The warning of an ignored member carries the request ID.
+	server := testServer(t)
+	req := httptest.NewRequest("PUT", "/restconf/data/test:system",
+		strings.NewReader(`{"test:system":{"hostname":"a","color":"red"}}`))
+	req.Header.Set("Content-Type", APPLICATION_DATA_JSON)
+	req.Header.Set(REQUEST_ID_HEADER, "abc")
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	if !strings.Contains(buf.String(), `[abc] warning: ignored unknown-element: unknown element "color"`) {
+		t.Errorf("log %q does not carry the warning with the request ID", buf.String())
+	}
+}
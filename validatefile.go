@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   A data file holds top-level data nodes of any of the loaded modules, either
+   directly or within the datastore root:
+
+   { "ietf-restconf:data" : { "example:system" : { ... } } }
+
+	<data xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">
+		<system xmlns="https://example.com/ns/example">...</system>
+	</data>
+*/
+
+// dataFileFormat returns the media type of a data file given with format
+// json or xml, or detected by its extension when format is "".
+func dataFileFormat(file, format string) string {
+	if format != "" {
+		return formatNames[format]
+	}
+	if strings.ToLower(filepath.Ext(file)) == ".xml" {
+		return APPLICATION_DATA_XML
+	}
+	return APPLICATION_DATA_JSON
+}
+
+// ValidateFile checks the data file against the schema, decoding it as the
+// body of an edit would be. It returns every error found.
+func (schema *Schema) ValidateFile(file, format string) error {
+	ctype := dataFileFormat(file, format)
+	if ctype == "" {
+		return malformed("unknown data file format %q", format)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return schema.ValidateData(f, ctype)
+}
+
+// ValidateData checks a data document in the format of the media type
+// format against the schema.
+func (schema *Schema) ValidateData(r io.Reader, format string) error {
+	if format == APPLICATION_DATA_XML {
+		return schema.validateXML(r)
+	}
+	return schema.validateJSON(r)
+}
+
+// topNode returns the top-level data node name of module mod, nil if there is
+// none.
+func (schema *Schema) topNode(mod, name string) *yang.Entry {
+	if m, ok := schema.Modules[mod]; ok {
+		return findDataChild(m, name)
+	}
+	return nil
+}
+
+func (schema *Schema) validateJSON(r io.Reader) error {
+	v, err := readJSON(r)
+	if err != nil {
+		return err
+	}
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return malformed("invalid JSON: the document must be an object")
+	}
+	if data, ok := doc["ietf-restconf:data"]; ok && len(doc) == 1 {
+		if doc, ok = data.(map[string]interface{}); !ok {
+			return invalidValue("ietf-restconf:data must be an object")
+		}
+	}
+
+	var errs ErrorList
+	for _, name := range sortedKeys(doc) {
+		mod, local := splitName(name)
+		e := schema.topNode(mod, local)
+		if e == nil {
+			errs.add(unknownElement("unexpected member %q", name))
+			continue
+		}
+		value, err := schema.fromJSON(nil, e, nil, doc[name])
+		if err == nil && hasRemoval(e, value) {
+			err = invalidValue("null members are not allowed in %s", name)
+		}
+		errs.add(err)
+	}
+	return errs.err()
+}
+
+func (schema *Schema) validateXML(r io.Reader) error {
+	root, err := parseXML(r)
+	if err != nil {
+		return err
+	}
+	nodes := []*xmlNode{root}
+	if root.Name.Space == PUBLIC_XMLNS && root.Name.Local == "data" {
+		nodes = root.Children
+	}
+
+	var errs ErrorList
+	seen := make(map[*yang.Entry]bool)
+	for _, n := range nodes {
+		e := schema.topNode(schema.ModuleByNamespace(n.Name.Space), n.Name.Local)
+		if e == nil {
+			errs.add(unknownElement("unexpected element %q in namespace %q", n.Name.Local, n.Name.Space))
+			continue
+		}
+		if seen[e] && !e.IsList() && !e.IsLeafList() {
+			errs.add(invalidValue("duplicate element %q", e.Name))
+			continue
+		}
+		seen[e] = true
+
+		_, err := schema.fromXML(nil, e, schema.errorPath(nil, e, xmlKeys(e, n)), n)
+		errs.add(err)
+	}
+	return errs.err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateData(t *testing.T) {
+	schema := testSchema(t, map[string]string{"test": testModuleText})
+
+	tests := []struct {
+		format string
+		doc    string
+		errs   int
+	}{
+		{APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a","interface":[{"name":"eth0","unit":0}]}}`, 0},
+		{APPLICATION_DATA_JSON, `{"ietf-restconf:data":{"test:system":{"counter":"1"}}}`, 0},
+		{APPLICATION_DATA_JSON, `{"test:system":{"counter":"x","ratio":"200","flags":"up up"}}`, 3},
+		{APPLICATION_DATA_JSON, `{"test:system":{"hostname":null}}`, 1},
+		{APPLICATION_DATA_JSON, `{"test:system":{},"test:other":{}}`, 1},
+		{APPLICATION_DATA_JSON, `{"test:system":`, 1},
+		{APPLICATION_DATA_XML, `<system xmlns="urn:test"><hostname>a</hostname></system>`, 0},
+		{APPLICATION_DATA_XML, `<data xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">` +
+			`<system xmlns="urn:test"><counter>1</counter></system></data>`, 0},
+		{APPLICATION_DATA_XML, `<data xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">` +
+			`<system xmlns="urn:test"><counter>x</counter><mtu>1</mtu></system>` +
+			`<system xmlns="urn:test"/></data>`, 3},
+	}
+
+	for _, tt := range tests {
+		err := schema.ValidateData(strings.NewReader(tt.doc), tt.format)
+		var errs ErrorList
+		errs.add(err)
+		if len(errs) != tt.errs {
+			t.Errorf("ValidateData(%s): got %d errors, want %d: %v", tt.doc, len(errs), tt.errs, err)
+		}
+	}
+}
+
+func TestDataFileFormat(t *testing.T) {
+	tests := []struct {
+		file, format, want string
+	}{
+		{"config.json", "", APPLICATION_DATA_JSON},
+		{"config.XML", "", APPLICATION_DATA_XML},
+		{"config", "", APPLICATION_DATA_JSON},
+		{"config.json", "xml", APPLICATION_DATA_XML},
+		{"config.xml", "yaml", ""},
+	}
+	for _, tt := range tests {
+		if got := dataFileFormat(tt.file, tt.format); got != tt.want {
+			t.Errorf("dataFileFormat(%s, %s): got %q, want %q", tt.file, tt.format, got, tt.want)
+		}
+	}
+}
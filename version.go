@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+)
+
+// Build information, set at link time with
+//
+//	go build -ldflags "-X main.VERSION=1.2.0 -X main.GIT_COMMIT=$(git rev-parse HEAD) -X main.BUILD_TIME=$(date -u +%FT%TZ)"
+var (
+	VERSION    = "0.1.0"
+	GIT_COMMIT = ""
+	BUILD_TIME = ""
+)
+
+var (
+	DEFAULT_SERVER_NAME = "RESTCONF"
+	VERSION_XMLNS       = "https://github.com/lixiangyun/go-restconf"
+)
+
+/*
+   {
+     "go-restconf:version" : {
+       "product" : "RESTCONF",
+       "version" : "0.1.0",
+       "git-commit" : "...",
+       "build-time" : "..."
+     }
+   }
+*/
+
+type Version struct {
+	XMLName xml.Name `json:"-" xml:"version"`
+	XmlLns  string   `json:"-" xml:"xmlns,attr"`
+
+	Product   string `json:"product" xml:"product"`
+	Version   string `json:"version" xml:"version"`
+	GitCommit string `json:"git-commit,omitempty" xml:"git-commit,omitempty"`
+	BuildTime string `json:"build-time,omitempty" xml:"build-time,omitempty"`
+}
+
+type VersionJson struct {
+	Version Version `json:"go-restconf:version"`
+}
+
+// serverHeader returns the value of the Server header, the product name
+// and version.
+func (restconf *RestConf) serverHeader() string {
+	return restconf.serverName + "/" + VERSION
+}
+
+// Version sends the build information of the server. It is a vendor
+// resource, not part of RESTCONF.
+func (restconf *RestConf) Version(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	version := Version{
+		XmlLns:    VERSION_XMLNS,
+		Product:   restconf.serverName,
+		Version:   VERSION,
+		GitCommit: GIT_COMMIT,
+		BuildTime: BUILD_TIME,
+	}
+
+	var body []byte
+	switch format {
+	case APPLICATION_DATA_XML:
+		{
+			body, err = xml.Marshal(version)
+		}
+	default:
+		{
+			body, err = json.Marshal(VersionJson{Version: version})
+		}
+	}
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(http.StatusOK)
+	rsp.Write(body)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+/*
+   The XML bodies are parsed defensively. A document type declaration is
+   refused, so that neither entity expansion ("billion laughs") nor external
+   entities can be declared, and the only entities are the five predefined
+   ones and character references, which the decoder never resolves outside
+   the document. An XML request body is refused with 413 too-big beyond
+   -max-xml-body bytes, and any XML document holding elements nested deeper
+   than MAX_XML_DEPTH levels is refused as malformed.
+
+   <!DOCTYPE system [ <!ENTITY lol "lol"> ... ]>  ->  400 malformed-message
+*/
+
+var (
+	MAX_XML_BODY  int64 = 16 << 20
+	MAX_XML_DEPTH       = 256
+)
+
+var errXMLTooBig = errors.New("XML body too big")
+
+// xmlLimitReader reads at most n bytes, failing with errXMLTooBig once the
+// body holds more.
+type xmlLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *xmlLimitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errXMLTooBig
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n, errXMLTooBig
+	}
+	return n, err
+}
+
+// limitXMLBody returns the reader of an XML request body r, which fails with
+// errXMLTooBig beyond MAX_XML_BODY bytes, 0 for no limit.
+func limitXMLBody(r io.Reader) io.Reader {
+	if MAX_XML_BODY <= 0 {
+		return r
+	}
+	return &xmlLimitReader{r: r, n: MAX_XML_BODY}
+}
+
+// xmlTooBig returns the error of an XML request body beyond MAX_XML_BODY.
+func xmlTooBig() *RestConfError {
+	return NewError(http.StatusRequestEntityTooLarge, ERROR_TYPE_PROTOCOL, ERROR_TAG_TOO_BIG,
+		"the XML body is larger than %d bytes", MAX_XML_BODY)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXMLEntityAttacks(t *testing.T) {
+	server := testServer(t)
+
+	var laughs strings.Builder
+	laughs.WriteString(`<?xml version="1.0"?><!DOCTYPE system [<!ENTITY lol0 "lol">`)
+	for i := 1; i < 10; i++ {
+		fmt.Fprintf(&laughs, `<!ENTITY lol%d "%s">`, i, strings.Repeat(fmt.Sprintf("&lol%d;", i-1), 10))
+	}
+	laughs.WriteString(`]><system xmlns="urn:test"><hostname>&lol9;</hostname></system>`)
+
+	for _, test := range []struct {
+		name string
+		body string
+	}{
+		{"billion laughs", laughs.String()},
+		{"external entity", `<?xml version="1.0"?><!DOCTYPE system [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>` +
+			`<system xmlns="urn:test"><hostname>&xxe;</hostname></system>`},
+		{"external DTD", `<!DOCTYPE system SYSTEM "http://127.0.0.1:1/evil.dtd"><system xmlns="urn:test"/>`},
+		{"undeclared entity", `<system xmlns="urn:test"><hostname>&xxe;</hostname></system>`},
+		{"deep nesting", `<system xmlns="urn:test"><blob>` + strings.Repeat("<a>", MAX_XML_DEPTH) +
+			strings.Repeat("</a>", MAX_XML_DEPTH) + `</blob></system>`},
+	} {
+		start := time.Now()
+		rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, test.body)
+		if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), ERROR_TAG_MALFORMED_MESSAGE) {
+			t.Errorf("%s: got status %d, want a malformed-message error: %s", test.name, rsp.Code, rsp.Body)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: took %v to refuse", test.name, d)
+		}
+	}
+
+	// The predefined entities and character references are decoded.
+	rsp := doRequest(server, "PUT", "/restconf/data/test:system/hostname", APPLICATION_DATA_XML,
+		`<hostname xmlns="urn:test">a&amp;b&#x21;</hostname>`)
+	if rsp.Code != http.StatusCreated {
+		t.Fatalf("PUT hostname: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system/hostname", "", ""); rsp.Body.String() != `{"test:hostname":"a\u0026b!"}` {
+		t.Errorf("GET hostname: got %s, want a&b!", rsp.Body)
+	}
+}
+
+func TestXMLBodyLimit(t *testing.T) {
+	defer func(limit int64) { MAX_XML_BODY = limit }(MAX_XML_BODY)
+	MAX_XML_BODY = 64
+	server := testServer(t)
+
+	body := `<system xmlns="urn:test"><hostname>` + strings.Repeat("a", 100) + `</hostname></system>`
+	rsp := doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, body)
+	if rsp.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rsp.Body.String(), ERROR_TAG_TOO_BIG) {
+		t.Errorf("got status %d, want a too-big error: %s", rsp.Code, rsp.Body)
+	}
+
+	rsp = doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_XML, `<system xmlns="urn:test"/>`)
+	if rsp.Code != http.StatusCreated {
+		t.Errorf("small body: got status %d: %s", rsp.Code, rsp.Body)
+	}
+}
@@ -0,0 +1,761 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   A restricted XPath 1.0 evaluator for the must and when statements of the
+   schema (RFC 7950 section 6.4). It supports
+
+     - location paths of child, ".", ".." and "*" steps, relative or absolute
+     - literals, numbers and the operators or, and, =, !=, <, <=, >, >=, +,
+       - and |
+     - the functions current, not, true, false, boolean, count, string,
+       number, string-length, concat, contains and starts-with
+
+   Predicates, axes, "//" and other functions are not supported, parsing an
+   expression using them fails with errXPathUnsupported. The prefix of a
+   node name is that of the module defining the expression or of one it
+   imports, names without a prefix match the local name of the schema nodes.
+
+   Expressions are evaluated on the data of the whole datastore, the default
+   values of the missing leafs filled in (RFC 7950 section 6.4.1).
+*/
+
+var errXPathUnsupported = errors.New("unsupported XPath expression")
+
+// An xpathNode is a node of the data tree an expression is evaluated on. A
+// list entry or leaf-list value is a node of its own.
+type xpathNode struct {
+	entry  *yang.Entry
+	value  interface{} // data tree of a container or list entry, value of a leaf
+	parent *xpathNode
+	kids   []*xpathNode // children, nil until first needed
+
+	// in is the data tree holding the node, nil for a default, and index
+	// the index of a list entry or leaf-list value within it, -1 for other
+	// nodes. They locate the node for remove.
+	in    map[string]interface{}
+	index int
+}
+
+// newXPathRoot returns the root node of the data of the datastore, the data
+// tree of the top-level nodes of each module being read with view.
+func (schema *Schema) newXPathRoot(view moduleView) *xpathNode {
+	names := make([]string, 0, len(schema.Modules))
+	for name := range schema.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	root := &xpathNode{kids: []*xpathNode{}, index: -1}
+	for _, name := range names {
+		mod := &xpathNode{entry: schema.Modules[name], value: view(name), index: -1}
+		for _, top := range mod.children() {
+			top.parent = root
+			root.kids = append(root.kids, top)
+		}
+	}
+	return root
+}
+
+// children returns the data node children of n, sorted by name.
+func (n *xpathNode) children() []*xpathNode {
+	if n.kids != nil {
+		return n.kids
+	}
+	n.kids = []*xpathNode{}
+
+	dir, _ := n.value.(map[string]interface{})
+	all := make(map[string]interface{}, len(dir))
+	for name, v := range dir {
+		all[name] = v
+	}
+	if n.entry.IsDir() {
+		addXPathDefaults(n.entry, all)
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		e := findDataChild(n.entry, name)
+		v := all[name]
+		if e == nil || v == nil {
+			continue
+		}
+		in := dir
+		if _, ok := dir[name]; !ok {
+			in = nil
+		}
+		values, ok := v.([]interface{})
+		if !ok || (!e.IsList() && !e.IsLeafList()) {
+			n.kids = append(n.kids, &xpathNode{entry: e, value: v, parent: n, in: in, index: -1})
+			continue
+		}
+		for i, value := range values {
+			n.kids = append(n.kids, &xpathNode{entry: e, value: value, parent: n, in: in, index: i})
+		}
+	}
+	return n.kids
+}
+
+// addXPathDefaults adds to dir, a copy of the data tree of an instance of e,
+// the default values of its missing leafs, and an empty tree for its missing
+// non-presence containers holding defaults, the defaults of which are added
+// by children in turn.
+func addXPathDefaults(e *yang.Entry, dir map[string]interface{}) {
+	for _, child := range e.Dir {
+		if _, ok := dir[child.Name]; ok {
+			continue
+		}
+		switch {
+		case child.IsChoice():
+			if c := activeCase(child, dir); c != nil {
+				addXPathDefaults(c, dir)
+			}
+		case child.IsCase() || isOperation(child) || isNotification(child):
+		case child.IsLeaf():
+			if def := child.DefaultValue(); def != "" {
+				dir[child.Name] = def
+			}
+		case child.IsContainer():
+			if c, _ := child.Node.(*yang.Container); c == nil || c.Presence != nil {
+				continue
+			}
+			defaults := make(map[string]interface{})
+			if addXPathDefaults(child, defaults); len(defaults) > 0 {
+				dir[child.Name] = map[string]interface{}{}
+			}
+		}
+	}
+}
+
+// xpathRemoved stands for a list entry or leaf-list value removed from its
+// data tree, until removeXPathNodes drops it.
+var xpathRemoved = new(struct{})
+
+// removeXPathNodes removes the nodes from the data trees holding them, and
+// from the children of their parents. A default is only removed from its
+// parent.
+func removeXPathNodes(nodes []*xpathNode) {
+	for _, n := range nodes {
+		kids := n.parent.kids[:0]
+		for _, kid := range n.parent.kids {
+			if kid != n {
+				kids = append(kids, kid)
+			}
+		}
+		n.parent.kids = kids
+
+		switch {
+		case n.in == nil:
+		case n.index < 0:
+			delete(n.in, n.entry.Name)
+		default:
+			n.in[n.entry.Name].([]interface{})[n.index] = xpathRemoved
+		}
+	}
+	// The entries are dropped once all are marked, so that the indexes of
+	// the others stay valid.
+	for _, n := range nodes {
+		values, ok := n.in[n.entry.Name].([]interface{})
+		if !ok || n.index < 0 {
+			continue
+		}
+		kept := values[:0]
+		for _, v := range values {
+			if v != xpathRemoved {
+				kept = append(kept, v)
+			}
+		}
+		if len(kept) == 0 {
+			delete(n.in, n.entry.Name)
+		} else {
+			n.in[n.entry.Name] = kept
+		}
+	}
+}
+
+// String returns the string value of n, the value of a leaf and "" for
+// other nodes.
+func (n *xpathNode) String() string {
+	switch v := n.value.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// xpathContext is the context an expression is evaluated in.
+type xpathContext struct {
+	node    *xpathNode
+	current *xpathNode // the node of the must or when statement
+}
+
+// An xpathExpr evaluates to a node set ([]*xpathNode), a string, a float64
+// or a bool.
+type xpathExpr func(ctx *xpathContext) interface{}
+
+// evalXPath evaluates the boolean value of expr at the node n. It returns
+// errXPathUnsupported if expr cannot be evaluated by this evaluator.
+func evalXPath(expr string, n *xpathNode) (bool, error) {
+	x, err := parseXPath(expr, nil)
+	if err != nil {
+		return false, err
+	}
+	return xpathBool(x(&xpathContext{node: n, current: n})), nil
+}
+
+func xpathBool(v interface{}) bool {
+	switch v := v.(type) {
+	case []*xpathNode:
+		return len(v) > 0
+	case string:
+		return v != ""
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case bool:
+		return v
+	}
+	return false
+}
+
+func xpathString(v interface{}) string {
+	switch v := v.(type) {
+	case []*xpathNode:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].String()
+	case string:
+		return v
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func xpathNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(xpathString(v)), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+// xpathCompare compares a and b with the operator op following the rules
+// of XPath 1.0 section 3.4: a node set compares true if one of its nodes
+// does.
+func xpathCompare(op string, a, b interface{}) bool {
+	if nodes, ok := a.([]*xpathNode); ok {
+		if _, ok := b.(bool); ok {
+			return xpathCompare(op, xpathBool(a), b)
+		}
+		for _, n := range nodes {
+			if xpathCompare(op, n.String(), b) {
+				return true
+			}
+		}
+		return false
+	}
+	if nodes, ok := b.([]*xpathNode); ok {
+		if _, ok := a.(bool); ok {
+			return xpathCompare(op, a, xpathBool(b))
+		}
+		for _, n := range nodes {
+			if xpathCompare(op, a, n.String()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, abool := a.(bool)
+		_, bbool := b.(bool)
+		_, anum := a.(float64)
+		_, bnum := b.(float64)
+		switch {
+		case abool || bbool:
+			equal = xpathBool(a) == xpathBool(b)
+		case anum || bnum:
+			equal = xpathNumber(a) == xpathNumber(b)
+		default:
+			equal = xpathString(a) == xpathString(b)
+		}
+		return equal == (op == "=")
+	}
+
+	x, y := xpathNumber(a), xpathNumber(b)
+	switch op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
+
+// An xpathToken is a lexical token of an expression.
+type xpathToken struct {
+	kind byte // one of the xpath token kinds below
+	text string
+}
+
+const (
+	xpathEOF byte = iota
+	xpathName
+	xpathLiteral
+	xpathNumberToken
+	xpathOperator
+)
+
+func isXPathNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		return true
+	case first:
+		return false
+	}
+	return c == '-' || c == '.' || '0' <= c && c <= '9'
+}
+
+// lexXPath splits s into its tokens.
+func lexXPath(s string) ([]xpathToken, error) {
+	var toks []xpathToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return nil, errXPathUnsupported
+			}
+			toks = append(toks, xpathToken{xpathLiteral, s[i+1 : i+1+j]})
+			i += j + 2
+		case '0' <= c && c <= '9' || c == '.' && i+1 < len(s) && '0' <= s[i+1] && s[i+1] <= '9':
+			j := i
+			for j < len(s) && ('0' <= s[j] && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, xpathToken{xpathNumberToken, s[i:j]})
+			i = j
+		case isXPathNameChar(c, true):
+			j := i + 1
+			for j < len(s) && isXPathNameChar(s[j], false) {
+				j++
+			}
+			// A prefixed name, but not an axis.
+			if j+1 < len(s) && s[j] == ':' && isXPathNameChar(s[j+1], true) {
+				j += 2
+				for j < len(s) && isXPathNameChar(s[j], false) {
+					j++
+				}
+			}
+			toks = append(toks, xpathToken{xpathName, s[i:j]})
+			i = j
+		default:
+			op := string(c)
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "!=", "<=", ">=", "..", "//", "::":
+					op = two
+				}
+			}
+			if !strings.Contains(" / .. . * ( ) [ ] , = != < <= > >= + - | ", " "+op+" ") {
+				return nil, errXPathUnsupported
+			}
+			toks = append(toks, xpathToken{xpathOperator, op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+type xpathParser struct {
+	toks []xpathToken
+	pos  int
+	err  error
+
+	namespace func(prefix string) (string, bool)
+}
+
+// parseXPath compiles the expression s, namespace returning the namespace
+// of a prefix of its node names. The prefixes are ignored if it is nil.
+func parseXPath(s string, namespace func(prefix string) (string, bool)) (xpathExpr, error) {
+	toks, err := lexXPath(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &xpathParser{toks: toks, namespace: namespace}
+	x := p.or()
+	if p.peek().kind != xpathEOF {
+		p.fail()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return x, nil
+}
+
+func (p *xpathParser) peek() xpathToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return xpathToken{}
+}
+
+// accept consumes the next token if it is one of the operators or operator
+// names ops, and returns it.
+func (p *xpathParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != xpathOperator && t.kind != xpathName {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// fail records that the expression is not supported and returns an
+// expression of no value, so that parsing can unwind.
+func (p *xpathParser) fail() xpathExpr {
+	if p.err == nil {
+		p.err = errXPathUnsupported
+	}
+	return func(*xpathContext) interface{} { return nil }
+}
+
+func (p *xpathParser) or() xpathExpr {
+	x := p.and()
+	for {
+		if _, ok := p.accept("or"); !ok {
+			return x
+		}
+		l, r := x, p.and()
+		x = func(ctx *xpathContext) interface{} { return xpathBool(l(ctx)) || xpathBool(r(ctx)) }
+	}
+}
+
+func (p *xpathParser) and() xpathExpr {
+	x := p.compare("=", "!=")
+	for {
+		if _, ok := p.accept("and"); !ok {
+			return x
+		}
+		l, r := x, p.compare("=", "!=")
+		x = func(ctx *xpathContext) interface{} { return xpathBool(l(ctx)) && xpathBool(r(ctx)) }
+	}
+}
+
+// compare parses the equality expressions with ops "=" and "!=", the
+// operands of which are relational expressions with the ops "<", "<=", ">"
+// and ">=".
+func (p *xpathParser) compare(ops ...string) xpathExpr {
+	operand := func() xpathExpr {
+		if ops[0] == "=" {
+			return p.compare("<", "<=", ">", ">=")
+		}
+		return p.additive()
+	}
+
+	x := operand()
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return x
+		}
+		l, r := x, operand()
+		x = func(ctx *xpathContext) interface{} { return xpathCompare(op, l(ctx), r(ctx)) }
+	}
+}
+
+func (p *xpathParser) additive() xpathExpr {
+	x := p.unary()
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return x
+		}
+		l, r := x, p.unary()
+		if op == "+" {
+			x = func(ctx *xpathContext) interface{} { return xpathNumber(l(ctx)) + xpathNumber(r(ctx)) }
+		} else {
+			x = func(ctx *xpathContext) interface{} { return xpathNumber(l(ctx)) - xpathNumber(r(ctx)) }
+		}
+	}
+}
+
+func (p *xpathParser) unary() xpathExpr {
+	if _, ok := p.accept("-"); ok {
+		x := p.unary()
+		return func(ctx *xpathContext) interface{} { return -xpathNumber(x(ctx)) }
+	}
+
+	x := p.path()
+	for {
+		if _, ok := p.accept("|"); !ok {
+			return x
+		}
+		l, r := x, p.path()
+		x = func(ctx *xpathContext) interface{} {
+			a, _ := l(ctx).([]*xpathNode)
+			b, _ := r(ctx).([]*xpathNode)
+			return unionNodes(a, b)
+		}
+	}
+}
+
+// path parses a location path, or a primary expression optionally followed
+// by relative steps.
+func (p *xpathParser) path() xpathExpr {
+	t := p.peek()
+	switch {
+	case t.kind == xpathLiteral:
+		p.pos++
+		return func(*xpathContext) interface{} { return t.text }
+	case t.kind == xpathNumberToken:
+		p.pos++
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return p.fail()
+		}
+		return func(*xpathContext) interface{} { return f }
+	case t.kind == xpathOperator && t.text == "(":
+		p.pos++
+		x := p.or()
+		if _, ok := p.accept(")"); !ok {
+			return p.fail()
+		}
+		return p.relative(x)
+	case t.kind == xpathName && p.pos+1 < len(p.toks) && p.toks[p.pos+1].text == "(":
+		return p.relative(p.call())
+	case t.kind == xpathOperator && t.text == "/":
+		p.pos++
+		root := func(ctx *xpathContext) interface{} {
+			n := ctx.node
+			for n.parent != nil {
+				n = n.parent
+			}
+			return []*xpathNode{n}
+		}
+		if next := p.peek(); next.kind == xpathName || next.text == "." || next.text == ".." || next.text == "*" {
+			return p.steps(root)
+		}
+		return root
+	}
+	return p.steps(func(ctx *xpathContext) interface{} { return []*xpathNode{ctx.node} })
+}
+
+// relative parses the steps following the primary expression x, if any.
+func (p *xpathParser) relative(x xpathExpr) xpathExpr {
+	if _, ok := p.accept("/"); !ok {
+		return x
+	}
+	return p.steps(x)
+}
+
+// steps parses one or more location steps applied to the node set from.
+func (p *xpathParser) steps(from xpathExpr) xpathExpr {
+	x := from
+	for {
+		step := p.step()
+		if p.err != nil {
+			return x
+		}
+		prev := x
+		x = func(ctx *xpathContext) interface{} {
+			nodes, _ := prev(ctx).([]*xpathNode)
+			var next []*xpathNode
+			for _, n := range nodes {
+				next = unionNodes(next, step(n))
+			}
+			return next
+		}
+		if _, ok := p.accept("/"); !ok {
+			return x
+		}
+	}
+}
+
+func (p *xpathParser) step() func(n *xpathNode) []*xpathNode {
+	t := p.peek()
+	p.pos++
+	var step func(n *xpathNode) []*xpathNode
+	switch {
+	case t.text == ".":
+		step = func(n *xpathNode) []*xpathNode { return []*xpathNode{n} }
+	case t.text == "..":
+		step = func(n *xpathNode) []*xpathNode {
+			if n.parent == nil {
+				return nil
+			}
+			return []*xpathNode{n.parent}
+		}
+	case t.text == "*":
+		step = func(n *xpathNode) []*xpathNode { return n.children() }
+	case t.kind == xpathName && !(p.pos < len(p.toks) && p.toks[p.pos].text == "("):
+		prefix, name := splitName(t.text)
+		var ns string
+		if prefix != "" && p.namespace != nil {
+			var ok bool
+			if ns, ok = p.namespace(prefix); !ok {
+				p.fail()
+				return nil
+			}
+		}
+		step = func(n *xpathNode) []*xpathNode {
+			var nodes []*xpathNode
+			for _, child := range n.children() {
+				if child.entry.Name == name && (ns == "" || child.entry.Namespace().Name == ns) {
+					nodes = append(nodes, child)
+				}
+			}
+			return nodes
+		}
+	default:
+		p.fail()
+		return nil
+	}
+	// Predicates are not supported.
+	if p.peek().text == "[" {
+		p.fail()
+	}
+	return step
+}
+
+// call parses a function call.
+func (p *xpathParser) call() xpathExpr {
+	name := p.peek().text
+	p.pos += 2
+
+	var args []xpathExpr
+	if _, ok := p.accept(")"); !ok {
+		for {
+			args = append(args, p.or())
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if _, ok := p.accept(")"); !ok {
+				return p.fail()
+			}
+			break
+		}
+	}
+
+	// arg returns the value of argument i, the context node if it is
+	// missing.
+	arg := func(ctx *xpathContext, i int) interface{} {
+		if i < len(args) {
+			return args[i](ctx)
+		}
+		return []*xpathNode{ctx.node}
+	}
+	nargs := func(min, max int) bool {
+		return len(args) >= min && (max < 0 || len(args) <= max)
+	}
+
+	switch {
+	case name == "current" && nargs(0, 0):
+		return func(ctx *xpathContext) interface{} { return []*xpathNode{ctx.current} }
+	case name == "true" && nargs(0, 0):
+		return func(*xpathContext) interface{} { return true }
+	case name == "false" && nargs(0, 0):
+		return func(*xpathContext) interface{} { return false }
+	case name == "not" && nargs(1, 1):
+		return func(ctx *xpathContext) interface{} { return !xpathBool(arg(ctx, 0)) }
+	case name == "boolean" && nargs(1, 1):
+		return func(ctx *xpathContext) interface{} { return xpathBool(arg(ctx, 0)) }
+	case name == "count" && nargs(1, 1):
+		return func(ctx *xpathContext) interface{} {
+			nodes, _ := arg(ctx, 0).([]*xpathNode)
+			return float64(len(nodes))
+		}
+	case name == "string" && nargs(0, 1):
+		return func(ctx *xpathContext) interface{} { return xpathString(arg(ctx, 0)) }
+	case name == "number" && nargs(0, 1):
+		return func(ctx *xpathContext) interface{} { return xpathNumber(arg(ctx, 0)) }
+	case name == "string-length" && nargs(0, 1):
+		return func(ctx *xpathContext) interface{} {
+			return float64(len([]rune(xpathString(arg(ctx, 0)))))
+		}
+	case name == "concat" && nargs(2, -1):
+		return func(ctx *xpathContext) interface{} {
+			var b strings.Builder
+			for i := range args {
+				b.WriteString(xpathString(arg(ctx, i)))
+			}
+			return b.String()
+		}
+	case name == "contains" && nargs(2, 2):
+		return func(ctx *xpathContext) interface{} {
+			return strings.Contains(xpathString(arg(ctx, 0)), xpathString(arg(ctx, 1)))
+		}
+	case name == "starts-with" && nargs(2, 2):
+		return func(ctx *xpathContext) interface{} {
+			return strings.HasPrefix(xpathString(arg(ctx, 0)), xpathString(arg(ctx, 1)))
+		}
+	}
+	return p.fail()
+}
+
+// unionNodes returns the nodes of a and b, each once.
+func unionNodes(a, b []*xpathNode) []*xpathNode {
+	for _, n := range b {
+		found := false
+		for _, m := range a {
+			if m == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, n)
+		}
+	}
+	return a
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var constraintModuleText = `
+module cons {
+  namespace "urn:cons";
+  prefix c;
+
+  container iface {
+    leaf type { type string; }
+    leaf mtu {
+      type uint16;
+      must ". >= 68 and . <= 9000" {
+        error-message "mtu out of bounds";
+      }
+    }
+    leaf vlan {
+      type uint16;
+      when "../type = 'vlan'";
+    }
+    leaf-list addr {
+      type string;
+      must "count(../addr) <= 2";
+    }
+    leaf note {
+      type string;
+      must "../addr[1] = 'a'";
+    }
+    container ppp {
+      when "../c:type = 'ppp'";
+      leaf user {
+        type string;
+        must "string-length(.) > 0 and not(starts-with(., 'root'))";
+      }
+    }
+  }
+}
+`
+
+func TestXPath(t *testing.T) {
+	schema := testSchema(t, map[string]string{"cons": constraintModuleText})
+	root := schema.newXPathRoot(func(mod string) map[string]interface{} {
+		return map[string]interface{}{
+			"iface": map[string]interface{}{
+				"type": "vlan",
+				"mtu":  "1500",
+				"addr": []interface{}{"a", "b"},
+			},
+		}
+	})
+	iface := root.children()[0]
+	mtu := iface.children()[2] // after the two addr values
+	if mtu.entry.Name != "mtu" {
+		t.Fatalf("got node %s, want mtu", mtu.entry.Name)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{". = 1500", true},
+		{". = '1500'", true},
+		{". > 1000 and . < 2000", true},
+		{". != 1500", false},
+		{"../type = 'vlan'", true},
+		{"../c:type = 'ppp' or ../mtu >= 1500", true},
+		{"/iface/type = 'vlan'", true},
+		{"../addr = 'b'", true},
+		{"../addr != 'a'", true},
+		{"count(../addr) = 2", true},
+		{"count(../*) = 4", true},
+		{"../vlan", false},
+		{"not(../vlan)", true},
+		{"boolean(../addr)", true},
+		{"current()/../mtu + 10 = 1510", true},
+		{"-(.) = -1500", true},
+		{"string(../type) = concat('vl', 'an')", true},
+		{"contains(../type, 'la') and starts-with(../type, 'vl')", true},
+		{"string-length(../type) = 4", true},
+		{"number('12') = 12", true},
+		{"count(../addr | ../type) = 3", true},
+		{"(../mtu)/../type = 'vlan'", true},
+		{"true() and not(false())", true},
+	}
+	for _, tt := range tests {
+		got, err := evalXPath(tt.expr, mtu)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %v, %v, want %v", tt.expr, got, err, tt.want)
+		}
+	}
+
+	for _, expr := range []string{
+		"../addr[1]",
+		"//mtu",
+		"ancestor::iface",
+		"@name",
+		"$var",
+		"deref(.)",
+		"../type = 'vlan",
+		"(. = 1",
+		". = ",
+	} {
+		if _, err := parseXPath(expr, nil); err != errXPathUnsupported {
+			t.Errorf("%s: got error %v, want %v", expr, err, errXPathUnsupported)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"cons": constraintModuleText}))
+
+	steps := []struct {
+		method, url, body string
+		status            int
+		want              string
+	}{
+		{"PUT", "/restconf/data/cons:iface", `{"cons:iface":{"type":"eth","mtu":1500}}`, http.StatusCreated, ""},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"mtu":10}}`, http.StatusBadRequest, "mtu out of bounds"},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"mtu":10}}`, http.StatusBadRequest, ERROR_APP_TAG_MUST_VIOLATION},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"mtu":10}}`, http.StatusBadRequest, `"error-path":"/cons:iface/mtu"`},
+		// A node whose when condition is false is removed.
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"vlan":5}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/cons:iface", "", http.StatusOK, `{"cons:iface":{"mtu":1500,"type":"eth"}}`},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"type":"vlan","vlan":5}}`, http.StatusNoContent, ""},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"type":"eth"}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/cons:iface", "", http.StatusOK, `{"cons:iface":{"mtu":1500,"type":"eth"}}`},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"addr":["a","b","c"]}}`, http.StatusBadRequest, ERROR_APP_TAG_MUST_VIOLATION},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"note":"x"}}`, http.StatusNoContent, ""},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"type":"ppp","vlan":null,"ppp":{"user":"root"}}}`, http.StatusBadRequest, ERROR_APP_TAG_MUST_VIOLATION},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"type":"ppp","vlan":null,"ppp":{"user":"joe"}}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/cons:iface", "", http.StatusOK,
+			`{"cons:iface":{"mtu":1500,"note":"x","ppp":{"user":"joe"},"type":"ppp"}}`},
+	}
+	for _, step := range steps {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("%s %s: got status %d, want %d: %s", step.method, step.body, rsp.Code, step.status, rsp.Body)
+		}
+		if step.status != http.StatusOK && !strings.Contains(rsp.Body.String(), step.want) {
+			t.Errorf("%s %s: got %s, want it to contain %s", step.method, step.body, rsp.Body, step.want)
+		}
+		if step.status == http.StatusOK && rsp.Body.String() != step.want {
+			t.Errorf("%s %s: got %s, want %s", step.method, step.body, rsp.Body, step.want)
+		}
+	}
+}
+
+var constraintScopeModuleText = `
+module cons-scope {
+  namespace "urn:cons-scope";
+  prefix s;
+  import cons { prefix k; }
+
+  container tunnel {
+    leaf type { type string; default "gre"; }
+    leaf key {
+      type uint32;
+      when "../type = 'gre' and /k:iface/k:type = 'vlan'";
+    }
+    leaf alias {
+      type string;
+      when "/k:iface/s:type";
+    }
+    leaf peer {
+      type string;
+      must "/k:iface/k:mtu >= 1400";
+    }
+  }
+}
+`
+
+func TestConstraintScope(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"cons": constraintModuleText, "cons-scope": constraintScopeModuleText}))
+
+	// The expressions see the data of other modules and the defaults, their
+	// prefixes name the modules.
+	steps := []struct {
+		method, url, body string
+		status            int
+		want              string
+	}{
+		{"PUT", "/restconf/data/cons:iface", `{"cons:iface":{"type":"vlan","mtu":1500}}`, http.StatusCreated, ""},
+		{"PUT", "/restconf/data/cons-scope:tunnel", `{"cons-scope:tunnel":{"key":5,"alias":"x","peer":"p"}}`, http.StatusCreated, ""},
+		{"GET", "/restconf/data/cons-scope:tunnel", "", http.StatusOK, `{"cons-scope:tunnel":{"key":5,"peer":"p"}}`},
+		{"PATCH", "/restconf/data/cons-scope:tunnel", `{"cons-scope:tunnel":{"type":"ipip"}}`, http.StatusNoContent, ""},
+		{"GET", "/restconf/data/cons-scope:tunnel", "", http.StatusOK, `{"cons-scope:tunnel":{"peer":"p","type":"ipip"}}`},
+		{"PATCH", "/restconf/data/cons:iface", `{"cons:iface":{"mtu":1000}}`, http.StatusNoContent, ""},
+		{"PATCH", "/restconf/data/cons-scope:tunnel", `{"cons-scope:tunnel":{"peer":"q"}}`, http.StatusBadRequest, ERROR_APP_TAG_MUST_VIOLATION},
+	}
+	for _, step := range steps {
+		rsp := doRequest(server, step.method, step.url, APPLICATION_DATA_JSON, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("%s %s: got status %d, want %d: %s", step.method, step.body, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && !strings.Contains(rsp.Body.String(), step.want) {
+			t.Errorf("%s %s: got %s, want %s", step.method, step.body, rsp.Body, step.want)
+		}
+	}
+}
@@ -177,3 +177,17 @@ func TestCoalesce(t *testing.T) {
 		}
 	}
 }
+
+func TestCoalesceDecimal(t *testing.T) {
+	for x, tt := range []struct {
+		in, out string
+	}{
+		{"min..-1.5|1.5..max", "min..-1.5|1.5..max"},
+		{"1.5..2.5|2.5..3.5", "1.5..3.5"},
+		{"1.5..2.5|2.6..3.5", "1.5..2.5|2.6..3.5"},
+	} {
+		if out := mustParseRanges(tt.in); out.String() != tt.out {
+			t.Errorf("#%d: got %v, want %s", x, out, tt.out)
+		}
+	}
+}
@@ -276,6 +276,9 @@ check:
 
 	if t.Range != nil {
 		yr, err := ParseRanges(t.Range.Name)
+		if err == nil {
+			yr, err = yr.resolve(y.Range)
+		}
 		switch {
 		case err != nil:
 			errs = append(errs, fmt.Errorf("%s: bad range: %v", Source(t.Range), err))
@@ -289,6 +292,9 @@ check:
 
 	if t.Length != nil {
 		yr, err := ParseRanges(t.Length.Name)
+		if err == nil {
+			yr, err = yr.resolve(y.Length)
+		}
 		switch {
 		case err != nil:
 			errs = append(errs, fmt.Errorf("%s: bad length: %v", Source(t.Length), err))
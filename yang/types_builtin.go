@@ -793,7 +793,8 @@ func ParseRanges(s string) (YangRange, error) {
 }
 
 // coalesce coalesces r into as few ranges as possible.  For example,
-// 1..5|6..10 would become 1..10.  r is assumed to be sorted.
+// 1..5|6..10 would become 1..10, while 1.5..5.5|6..10 is left alone.  r is
+// assumed to be sorted.
 // r is assumed to be valid (see Validate)
 func coalesce(r YangRange) YangRange {
 	// coalesce the ranges if we have more than 1.
@@ -810,7 +811,12 @@ func coalesce(r YangRange) YangRange {
 		// r1 starts inside of cr[i]
 		// r1.Min cr[i].Max+1
 		// r1 is beyond cr[i]
-		if cr[i].Max.add(1).Less(r1.Min) {
+		// Decimal ranges only join when they touch, there is no next decimal.
+		next := cr[i].Max
+		if !next.IsDecimal() {
+			next = next.add(1)
+		}
+		if next.Less(r1.Min) {
 			// r1 starts after cr[i], this is a new range
 			i++
 			cr[i] = r1
@@ -861,6 +867,30 @@ func (r YangRange) Less(i, j int) bool {
 	}
 }
 
+// resolve returns r with min and max replaced by the lowest and the highest
+// value of base, the range r restricts, as RFC 7950 9.2.4 defines them.  An
+// empty base, or one that is itself unbounded, leaves them unchanged.
+func (r YangRange) resolve(base YangRange) (YangRange, error) {
+	if len(r) == 0 || len(base) == 0 {
+		return r, nil
+	}
+	rr := make(YangRange, len(r))
+	copy(rr, r)
+	first, last := &rr[0], &rr[len(rr)-1]
+	if first.Min.Kind == MinNumber {
+		first.Min = base[0].Min
+	}
+	if last.Max.Kind == MaxNumber {
+		last.Max = base[len(base)-1].Max
+	}
+	for _, b := range []*YRange{first, last} {
+		if b.Max.Less(b.Min) {
+			return nil, fmt.Errorf("%s less than %s", b.Max, b.Min)
+		}
+	}
+	return rr, nil
+}
+
 // Validate sorts r and returns an error if r has either an invalid range or has
 // overlapping ranges.
 func (r YangRange) Validate() error {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+   A GET of /restconf/yang itself returns the bundle of every module of the
+   schema, a tar archive holding the YANG source of each as
+   module@revision.yang. The archive is streamed module by module, gzip
+   compressed if the client accepts it:
+
+   curl --compressed -OJ http://127.0.0.1:8080/restconf/yang
+
+   The bundle is generated, but the same for a schema: the modules are in
+   order and the times of the files those of their revisions. A request with
+   a Range header is served from the bundle built in memory instead, never
+   compressed, with the entity tag of its content so that a download resumed
+   with If-Range after a reload of the modules starts over:
+
+   curl -C - -OJ http://127.0.0.1:8080/restconf/yang
+
+   The Accept-Ranges header of every response tells the client the ranges
+   are served, those of the uncompressed archive.
+*/
+
+var (
+	APPLICATION_TAR  = "application/x-tar"
+	YANG_BUNDLE_NAME = "yang-modules.tar"
+)
+
+// acceptsGzip reports whether the Accept-Encoding of req allows gzip, named
+// or as "*", with a non-zero quality.
+func acceptsGzip(req *http.Request) bool {
+	accept := map[string]bool{}
+	for _, elem := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(elem, ";")
+		q := 1.0
+		for _, p := range params[1:] {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+				q, _ = strconv.ParseFloat(p[2:], 64)
+			}
+		}
+		accept[strings.ToLower(strings.TrimSpace(params[0]))] = q > 0
+	}
+	if ok, named := accept["gzip"]; named {
+		return ok
+	}
+	return accept["*"]
+}
+
+// yangBundle sends the tar archive of the YANG source of every module of the
+// schema, the ranges of it req asks for if any.
+func (restconf *RestConf) yangBundle(rsp http.ResponseWriter, req *http.Request) {
+	schema := restconf.schemaOf(req)
+
+	rsp.Header().Set("Content-Type", APPLICATION_TAR)
+	rsp.Header().Set("Content-Disposition", `attachment; filename="`+YANG_BUNDLE_NAME+`"`)
+	rsp.Header().Set("Accept-Ranges", "bytes")
+	addVary(rsp, "Accept-Encoding")
+	if req.Header.Get("Range") != "" {
+		var body bytes.Buffer
+		if err := writeBundle(&body, schema, nil); err != nil {
+			logRequest(req, "write module bundle failed!", err.Error())
+			writeError(rsp, req, NewError(http.StatusInternalServerError, ERROR_TYPE_APPLICATION,
+				ERROR_TAG_OPERATION_FAILED, "the module bundle cannot be built"))
+			return
+		}
+		rsp.Header().Set("ETag", entityTag(body.Bytes()))
+		http.ServeContent(rsp, req, YANG_BUNDLE_NAME, time.Time{}, bytes.NewReader(body.Bytes()))
+		return
+	}
+	compress := acceptsGzip(req)
+	if compress {
+		rsp.Header().Set("Content-Encoding", "gzip")
+	}
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return
+	}
+
+	var w io.Writer = rsp
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(rsp)
+		w = zw
+	}
+	flusher, _ := rsp.(http.Flusher)
+	err := writeBundle(w, schema, func() {
+		if zw != nil {
+			zw.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if zw != nil && err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		logRequest(req, "write module bundle failed!", err.Error())
+	}
+}
+
+// writeBundle writes the tar archive of the modules of schema to w, calling
+// flush, if not nil, after each module.
+func writeBundle(w io.Writer, schema *Schema, flush func()) error {
+	tw := tar.NewWriter(w)
+
+	// The source of a module is rendered before its header, which holds its
+	// size, the archive is not.
+	var body bytes.Buffer
+	for _, name := range schema.ModuleNames() {
+		mod := schema.modules[name]
+		body.Reset()
+		if err := mod.Source.Write(&body, ""); err != nil {
+			return fmt.Errorf("write module %s: %v", name, err)
+		}
+
+		file, mtime := name, time.Unix(0, 0)
+		if rev := mod.Current(); rev != "" {
+			file += "@" + rev
+			if t, err := time.Parse("2006-01-02", rev); err == nil {
+				mtime = t
+			}
+		}
+		hdr := &tar.Header{Name: file + ".yang", Mode: 0644, Size: int64(body.Len()), ModTime: mtime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(body.Bytes()); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   The errors of a response are defined by the yang-errors yang-data
+   structure of ietf-restconf (RFC 8040 section 8):
+
+   rc:yang-data yang-errors {
+     uses errors;
+   }
+
+   With ietf-restconf loaded the errors are encoded as the data of that
+   structure, like any other data, and otherwise as RestConfErrors.
+*/
+
+var (
+	RESTCONF_MODULE    = "ietf-restconf"
+	YANG_DATA_KEYWORD  = "yang-data"
+	YANG_ERRORS_STRUCT = "yang-errors"
+)
+
+// yangData returns the data node of the yang-data structure name of the
+// module mod, nil if mod does not define it. A structure is the nodes of a
+// single uses of a grouping, as those of ietf-restconf are, other forms are
+// not supported.
+func yangData(mod *yang.Module, name string) *yang.Entry {
+	for _, ext := range mod.Extensions {
+		prefix, keyword := splitName(ext.Keyword)
+		if keyword != YANG_DATA_KEYWORD || ext.Argument != name || importedModule(mod, prefix) != RESTCONF_MODULE {
+			continue
+		}
+		subs := ext.SubStatements()
+		if len(subs) != 1 || subs[0].Keyword != "uses" {
+			return nil
+		}
+		g := yang.FindGrouping(mod, subs[0].Argument, map[string]bool{})
+		if g == nil {
+			return nil
+		}
+		// The structure holds a single container, errors for yang-errors.
+		var top *yang.Entry
+		for _, e := range yang.ToEntry(g).Dir {
+			if top != nil {
+				return nil
+			}
+			top = e
+		}
+		return top
+	}
+	return nil
+}
+
+// importedModule returns the name of the module prefix stands for in mod,
+// "" if it stands for none.
+func importedModule(mod *yang.Module, prefix string) string {
+	if prefix == mod.GetPrefix() {
+		return mod.Name
+	}
+	for _, imp := range mod.Import {
+		if imp.Prefix != nil && imp.Prefix.Name == prefix {
+			return imp.Name
+		}
+	}
+	return ""
+}
+
+// errorsData returns the data of the yang-errors structure holding errs.
+func errorsData(errs ErrorList) map[string]interface{} {
+	entries := make([]interface{}, 0, len(errs))
+	for _, err := range errs {
+		entry := map[string]interface{}{
+			"error-type": err.Type,
+			"error-tag":  err.Tag,
+		}
+		if err.AppTag != "" {
+			entry["error-app-tag"] = err.AppTag
+		}
+		if err.Path != nil {
+			entry["error-path"] = err.Path.String()
+		}
+		if err.Message != "" {
+			entry["error-message"] = err.Message
+		}
+		entries = append(entries, entry)
+	}
+	return map[string]interface{}{"error": entries}
+}
+
+// xmlQualifiedID returns the instance-identifier s, in its JSON form, with
+// every node qualified by the name of its module, and the namespaces of
+// those modules to declare as prefixes of the element holding it. s is
+// returned as is if it is not well-formed.
+func (schema *Schema) xmlQualifiedID(s string) (string, map[string]string) {
+	steps, err := parseInstanceID(s)
+	if err != nil {
+		return s, nil
+	}
+	namespaces := make(map[string]string)
+	declare := func(mod string) {
+		if e, ok := schema.Modules[mod]; ok {
+			namespaces[mod] = e.Namespace().Name
+		}
+	}
+	mod := ""
+	for i := range steps {
+		if steps[i].module == "" {
+			steps[i].module = mod
+		}
+		mod = steps[i].module
+		declare(mod)
+		for j := range steps[i].preds {
+			if pred := &steps[i].preds[j]; pred.module == "" && pred.name != "" && pred.name != "." {
+				pred.module = mod
+			}
+		}
+	}
+	return formatInstanceID(steps), namespaces
+}
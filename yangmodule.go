@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+var (
+	APPLICATION_YANG = "application/yang"
+
+	YANG_MODULE_PREFIX = RESTCONF_PREFIX + "/yang"
+)
+
+// moduleURL returns the path the YANG module mod is downloaded from,
+// "/restconf/yang/module@revision".
+func (schema *Schema) moduleURL(mod string) string {
+	if rev := schema.ModuleRevision(mod); rev != "" {
+		return YANG_MODULE_PREFIX + "/" + mod + "@" + rev
+	}
+	return YANG_MODULE_PREFIX + "/" + mod
+}
+
+// YangModule sends the YANG source of a module of the schema, addressed as
+// /restconf/yang/module or /restconf/yang/module@revision, or the bundle of
+// all of them, addressed as /restconf/yang.
+func (restconf *RestConf) YangModule(rsp http.ResponseWriter, req *http.Request) {
+	if !allowMethods(rsp, req, "GET", "HEAD") {
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(req.URL.Path, YANG_MODULE_PREFIX), "/")
+	if name == "" {
+		restconf.yangBundle(rsp, req)
+		return
+	}
+	var rev string
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, rev = name[:i], name[i+1:]
+	}
+
+	// A revision is looked up in the alternate schemas as well.
+	mod := restconf.moduleRevision(req, name, rev)
+	if mod == nil {
+		writeError(rsp, req, NewError(http.StatusNotFound, ERROR_TYPE_PROTOCOL,
+			ERROR_TAG_INVALID_VALUE, "unknown module %q", strings.TrimPrefix(req.URL.Path, YANG_MODULE_PREFIX+"/")))
+		return
+	}
+
+	var body bytes.Buffer
+	if err := mod.Source.Write(&body, ""); err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	rsp.Header().Set("Content-Type", APPLICATION_YANG)
+	rsp.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return
+	}
+	rsp.Write(body.Bytes())
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestYangModule(t *testing.T) {
+	server := testServer(t)
+
+	for _, test := range []struct {
+		url    string
+		status int
+	}{
+		{"/restconf/yang/test", http.StatusOK},
+		{"/restconf/yang/test@2024-01-01", http.StatusOK},
+		{"/restconf/yang/test@2000-01-01", http.StatusNotFound},
+		{"/restconf/yang/other", http.StatusNotFound},
+	} {
+		rsp := doRequest(server, "GET", test.url, "", "")
+		if rsp.Code != test.status {
+			t.Errorf("GET %s: got status %d, want %d", test.url, rsp.Code, test.status)
+			continue
+		}
+		if test.status == http.StatusOK {
+			if ctype := rsp.Header().Get("Content-Type"); ctype != APPLICATION_YANG {
+				t.Errorf("GET %s: got Content-Type %q", test.url, ctype)
+			}
+			if body := rsp.Body.String(); !strings.HasPrefix(body, `module "test" {`) || !strings.Contains(body, `container "system"`) {
+				t.Errorf("GET %s: got %s", test.url, body)
+			}
+		}
+	}
+
+	rsp := doRequest(server, "HEAD", "/restconf/yang/test", "", "")
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Type") != APPLICATION_YANG || rsp.Body.Len() != 0 {
+		t.Errorf("HEAD: got status %d, Content-Type %q, body %s", rsp.Code, rsp.Header().Get("Content-Type"), rsp.Body)
+	}
+}
+
+func TestDescribedByLink(t *testing.T) {
+	server := testServer(t)
+	doRequest(server, "PUT", "/restconf/data/test:system", APPLICATION_DATA_JSON, `{"test:system":{"hostname":"a"}}`)
+
+	rsp := doRequest(server, "GET", "/restconf/data/test:system/hostname", "", "")
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	want := "http://example.com/restconf/yang/test@2024-01-01"
+	if got := linkTarget(rsp.Header(), "describedby"); got != want {
+		t.Errorf("got describedby %q, want %q", got, want)
+	}
+
+	if rsp := doRequest(server, "GET", want, "", ""); rsp.Code != http.StatusOK {
+		t.Errorf("GET %s: got status %d", want, rsp.Code)
+	}
+}
+
+func TestYangBundle(t *testing.T) {
+	server := testServer(t)
+
+	for _, compress := range []bool{false, true} {
+		req := httptest.NewRequest("GET", "/restconf/yang", nil)
+		if compress {
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("GET: got status %d: %s", rsp.Code, rsp.Body)
+		}
+		if ctype := rsp.Header().Get("Content-Type"); ctype != APPLICATION_TAR {
+			t.Errorf("got Content-Type %q", ctype)
+		}
+		if cd := rsp.Header().Get("Content-Disposition"); cd != `attachment; filename="yang-modules.tar"` {
+			t.Errorf("got Content-Disposition %q", cd)
+		}
+
+		var r io.Reader = rsp.Body
+		if enc := rsp.Header().Get("Content-Encoding"); compress != (enc == "gzip") {
+			t.Fatalf("Accept-Encoding gzip %v: got Content-Encoding %q", compress, enc)
+		}
+		if compress {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatalf("gzip: %s", err)
+			}
+			r = zr
+		}
+		tr := tar.NewReader(r)
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("tar: %s", err)
+			}
+			body, _ := ioutil.ReadAll(tr)
+			if hdr.Name == "test@2024-01-01.yang" && !strings.HasPrefix(string(body), `module "test" {`) {
+				t.Errorf("got %s: %s", hdr.Name, body)
+			}
+			names = append(names, hdr.Name)
+		}
+		if len(names) != 1 || names[0] != "test@2024-01-01.yang" {
+			t.Errorf("got modules %q", names)
+		}
+	}
+
+	for _, test := range []struct {
+		accept string
+		gzip   bool
+	}{
+		{"", false},
+		{"gzip;q=0.5", true},
+		{"gzip;q=0, *", false},
+		{"*", true},
+		{"identity", false},
+	} {
+		req := httptest.NewRequest("GET", "/restconf/yang", nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		if got := acceptsGzip(req); got != test.gzip {
+			t.Errorf("Accept-Encoding %q: got gzip %v, want %v", test.accept, got, test.gzip)
+		}
+	}
+}
+
+func TestYangBundleRange(t *testing.T) {
+	server := testServer(t)
+	get := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/restconf/yang", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rsp := httptest.NewRecorder()
+		server.ServeHTTP(rsp, req)
+		return rsp
+	}
+
+	// Without a Range the archive is streamed, advertising the ranges.
+	full := get()
+	if full.Code != http.StatusOK || full.Header().Get("Accept-Ranges") != "bytes" || full.Header().Get("Content-Length") != "" {
+		t.Fatalf("GET: got status %d, Accept-Ranges %q, Content-Length %q", full.Code,
+			full.Header().Get("Accept-Ranges"), full.Header().Get("Content-Length"))
+	}
+	bundle := full.Body.String()
+
+	rsp := get("Range", "bytes=10-19", "Accept-Encoding", "gzip")
+	if rsp.Code != http.StatusPartialContent || rsp.Body.String() != bundle[10:20] {
+		t.Fatalf("GET bytes=10-19: got status %d, body %q, want %q", rsp.Code, rsp.Body, bundle[10:20])
+	}
+	if enc := rsp.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("GET bytes=10-19: got Content-Encoding %q", enc)
+	}
+	if cr, want := rsp.Header().Get("Content-Range"), "bytes 10-19/"+strconv.Itoa(len(bundle)); cr != want {
+		t.Errorf("GET bytes=10-19: got Content-Range %q, want %q", cr, want)
+	}
+	etag := rsp.Header().Get("ETag")
+
+	// Resuming with the entity tag of the bundle returns the rest, with
+	// another one the whole bundle.
+	if rsp := get("Range", "bytes=20-", "If-Range", etag); rsp.Code != http.StatusPartialContent || rsp.Body.String() != bundle[20:] {
+		t.Errorf("If-Range %s: got status %d", etag, rsp.Code)
+	}
+	if rsp := get("Range", "bytes=20-", "If-Range", `"stale"`); rsp.Code != http.StatusOK || rsp.Body.String() != bundle {
+		t.Errorf("If-Range stale: got status %d", rsp.Code)
+	}
+	if rsp := get("Range", "bytes=100000-"); rsp.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("GET bytes=100000-: got status %d", rsp.Code)
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/lixiangyun/go-restconf/yang"
+)
+
+/*
+   A PATCH with a YANG patch body (RFC 8072) applies the ordered edits it
+   lists below its target resource, the datastore resource included, in a
+   single transaction: either every edit is applied or none is.
+
+   PATCH /restconf/data/example:system
+
+   {
+     "ietf-yang-patch:yang-patch" : {
+       "patch-id" : "add-dns",
+       "edit" : [
+         {
+           "edit-id" : "1",
+           "operation" : "insert",
+           "target" : "/dns=10.0.0.2",
+           "where" : "before",
+           "point" : "/dns=10.0.0.1",
+           "value" : { "example:dns" : [ "10.0.0.2" ] }
+         }
+       ]
+     }
+   }
+
+   The target and point of an edit are paths relative to the target
+   resource. The insert and move operations place an entry of a list or
+   leaf-list ordered-by user as the insert and point query parameters do,
+   last by default, and the point may be an entry an earlier edit of the
+   patch created. The response is 200 with a yang-patch-status holding ok,
+   or the status of the error with the errors of the failing edit in its
+   edit-status.
+*/
+
+var (
+	APPLICATION_YANG_PATCH_XML = "application/yang-patch+xml"
+
+	YANG_PATCH_XMLNS      = "urn:ietf:params:xml:ns:yang:ietf-yang-patch"
+	YANG_PATCH_CAPABILITY = "urn:ietf:params:restconf:capability:yang-patch:1.0"
+
+	PATCH_CREATE  = "create"
+	PATCH_DELETE  = "delete"
+	PATCH_INSERT  = "insert"
+	PATCH_MERGE   = "merge"
+	PATCH_MOVE    = "move"
+	PATCH_REPLACE = "replace"
+	PATCH_REMOVE  = "remove"
+)
+
+// YANG_PATCH_FORMATS lists the media types of the YANG patch bodies.
+var YANG_PATCH_FORMATS = []string{APPLICATION_YANG_PATCH_JSON, APPLICATION_YANG_PATCH_XML}
+
+type YangPatchEditJson struct {
+	EditID    string          `json:"edit-id"`
+	Operation string          `json:"operation"`
+	Target    string          `json:"target"`
+	Point     string          `json:"point,omitempty"`
+	Where     string          `json:"where,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+type YangPatchJson struct {
+	Patch *struct {
+		PatchID string              `json:"patch-id"`
+		Comment string              `json:"comment,omitempty"`
+		Edit    []YangPatchEditJson `json:"edit"`
+	} `json:"ietf-yang-patch:yang-patch"`
+}
+
+// yangEmpty is the value of a leaf of type empty, [null] in JSON.
+type yangEmpty struct{}
+
+func (yangEmpty) MarshalJSON() ([]byte, error) {
+	return []byte("[null]"), nil
+}
+
+type YangPatchErrors struct {
+	Error ErrorList `json:"error" xml:"error"`
+}
+
+type YangPatchEditResult struct {
+	EditID string           `json:"edit-id" xml:"edit-id"`
+	Errors *YangPatchErrors `json:"errors,omitempty" xml:"errors,omitempty"`
+}
+
+type YangPatchEditStatus struct {
+	Edit []YangPatchEditResult `json:"edit" xml:"edit"`
+}
+
+type YangPatchStatus struct {
+	XMLName xml.Name `json:"-" xml:"yang-patch-status"`
+	XmlLns  string   `json:"-" xml:"xmlns,attr"`
+
+	PatchID    string               `json:"patch-id" xml:"patch-id"`
+	Ok         *yangEmpty           `json:"ok,omitempty" xml:"ok,omitempty"`
+	Errors     *YangPatchErrors     `json:"errors,omitempty" xml:"errors,omitempty"`
+	EditStatus *YangPatchEditStatus `json:"edit-status,omitempty" xml:"edit-status,omitempty"`
+}
+
+type YangPatchStatusJson struct {
+	Status *YangPatchStatus `json:"ietf-yang-patch:yang-patch-status"`
+}
+
+// A yangPatchEdit is an edit of a YANG patch as read from the body, its
+// value, if it has one, still to be decoded as the data of its target.
+type yangPatchEdit struct {
+	id, operation, target, point, where string
+
+	value func(at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error)
+}
+
+// isYangPatch reports whether req carries a YANG patch body.
+func isYangPatch(req *http.Request) bool {
+	ctype := mediaType(req.Header.Get("Content-Type"))
+	return ctype == APPLICATION_YANG_PATCH_JSON || ctype == APPLICATION_YANG_PATCH_XML
+}
+
+// patchFormats returns the media types of the PATCH bodies of the resource
+// r, nil for the datastore, which is only patched with YANG patches.
+func patchFormats(r *Resource) []string {
+	if r == nil {
+		return YANG_PATCH_FORMATS
+	}
+	return append(append([]string{}, PATCH_FORMATS...), YANG_PATCH_FORMATS...)
+}
+
+// yangPatch handles a PATCH of the resource r, nil for the datastore, with a
+// YANG patch body.
+func (restconf *RestConf) yangPatch(rsp http.ResponseWriter, req *http.Request, r *Resource) {
+	format, err := restconf.responseFormat(rsp, req, restconf.defaultFormat)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+	if r != nil && r.Entry().IsList() && r.Segment().Keys == nil {
+		writeError(rsp, req, invalidValue("list %s can only be patched by entry", r.Entry().Name))
+		return
+	}
+
+	schema := restconf.schemaOf(req)
+	id, entries, err := schema.readYangPatch(req)
+	if err != nil {
+		writeError(rsp, req, err)
+		return
+	}
+
+	status := &YangPatchStatus{XmlLns: YANG_PATCH_XMLNS, PatchID: id}
+	edits := make([]*patchEdit, 0, len(entries))
+	for _, entry := range entries {
+		edit, err := restconf.patchEdit(req, schema, r, entry)
+		if err != nil {
+			restconf.writePatchStatus(rsp, req, format, status.editFailed(entry.id, err))
+			return
+		}
+		edits = append(edits, edit)
+	}
+
+	failed, err := restconf.store.Patch(edits, schema.constraintCheck, func(changes []*Change) error {
+		return restconf.commitChanges(req, changes)
+	})
+	switch {
+	case failed >= 0:
+		err = errorAt(err, schema.resourcePath(edits[failed].target))
+		status.editFailed(entries[failed].id, err)
+	case err != nil:
+		var errs ErrorList
+		errs.add(err)
+		status.Errors = &YangPatchErrors{Error: errs}
+	default:
+		status.Ok = &yangEmpty{}
+	}
+	restconf.writePatchStatus(rsp, req, format, status)
+}
+
+// editFailed records the error err of the edit id in the status.
+func (status *YangPatchStatus) editFailed(id string, err error) *YangPatchStatus {
+	var errs ErrorList
+	errs.add(err)
+	status.EditStatus = &YangPatchEditStatus{
+		Edit: []YangPatchEditResult{{EditID: id, Errors: &YangPatchErrors{Error: errs}}},
+	}
+	return status
+}
+
+// writePatchStatus sends the yang-patch-status in format, with the status of
+// its errors, 200 if it has none.
+func (restconf *RestConf) writePatchStatus(rsp http.ResponseWriter, req *http.Request, format string, status *YangPatchStatus) {
+	code := http.StatusOK
+	switch {
+	case status.Errors != nil:
+		code = status.Errors.Error.status()
+	case status.EditStatus != nil:
+		code = status.EditStatus.Edit[0].Errors.Error.status()
+	}
+
+	var body []byte
+	var err error
+	if format == APPLICATION_DATA_XML {
+		body, err = xml.Marshal(status)
+	} else {
+		body, err = json.Marshal(YangPatchStatusJson{Status: status})
+	}
+	if err != nil {
+		logRequest(req, "marshal yang-patch-status failed!", err.Error())
+		http.Error(rsp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rsp.Header().Set("Content-Type", format)
+	rsp.WriteHeader(code)
+	rsp.Write(body)
+}
+
+// readYangPatch reads the YANG patch body of req and returns its patch-id
+// and edits.
+func (schema *Schema) readYangPatch(req *http.Request) (string, []*yangPatchEdit, error) {
+	var id string
+	var edits []*yangPatchEdit
+	var err error
+	if mediaType(req.Header.Get("Content-Type")) == APPLICATION_YANG_PATCH_XML {
+		id, edits, err = schema.readYangPatchXML(req)
+	} else {
+		id, edits, err = schema.readYangPatchJSON(req)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if id == "" {
+		return "", nil, missingElement("the YANG patch has no patch-id")
+	}
+	ids := make(map[string]bool, len(edits))
+	for i, edit := range edits {
+		switch {
+		case edit.id == "":
+			return "", nil, missingElement("edit %d of the YANG patch has no edit-id", i+1)
+		case ids[edit.id]:
+			return "", nil, invalidValue("duplicate edit-id %q in the YANG patch", edit.id)
+		}
+		ids[edit.id] = true
+	}
+	return id, edits, nil
+}
+
+func (schema *Schema) readYangPatchJSON(req *http.Request) (string, []*yangPatchEdit, error) {
+	var doc YangPatchJson
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return "", nil, malformed("invalid YANG patch: %s", err.Error())
+	}
+	if doc.Patch == nil {
+		return "", nil, malformed("expected a single ietf-yang-patch:yang-patch member")
+	}
+
+	edits := make([]*yangPatchEdit, 0, len(doc.Patch.Edit))
+	for _, e := range doc.Patch.Edit {
+		edit := &yangPatchEdit{id: e.EditID, operation: e.Operation, target: e.Target, point: e.Point, where: e.Where}
+		if raw := e.Value; len(raw) > 0 {
+			edit.value = func(at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error) {
+				return schema.decodeJSON(req, bytes.NewReader(raw), at, find)
+			}
+		}
+		edits = append(edits, edit)
+	}
+	return doc.Patch.PatchID, edits, nil
+}
+
+func (schema *Schema) readYangPatchXML(req *http.Request) (string, []*yangPatchEdit, error) {
+	root, err := parseXML(limitXMLBody(req.Body))
+	if err != nil {
+		return "", nil, err
+	}
+	if root.Name.Space != YANG_PATCH_XMLNS || root.Name.Local != "yang-patch" {
+		return "", nil, malformed("expected a yang-patch element in namespace %q", YANG_PATCH_XMLNS)
+	}
+
+	var id string
+	var edits []*yangPatchEdit
+	for _, n := range root.Children {
+		switch n.Name.Local {
+		case "patch-id":
+			id = strings.TrimSpace(n.Text)
+		case "comment":
+		case "edit":
+			edit, err := schema.readYangPatchEditXML(req, n)
+			if err != nil {
+				return "", nil, err
+			}
+			edits = append(edits, edit)
+		default:
+			return "", nil, malformed("unknown element %q in yang-patch", n.Name.Local)
+		}
+	}
+	return id, edits, nil
+}
+
+func (schema *Schema) readYangPatchEditXML(req *http.Request, n *xmlNode) (*yangPatchEdit, error) {
+	edit := &yangPatchEdit{}
+	for _, cn := range n.Children {
+		text := strings.TrimSpace(cn.Text)
+		switch cn.Name.Local {
+		case "edit-id":
+			edit.id = text
+		case "operation":
+			edit.operation = text
+		case "target":
+			edit.target = text
+		case "point":
+			edit.point = text
+		case "where":
+			edit.where = text
+		case "value":
+			if len(cn.Children) != 1 {
+				return nil, malformed("the value of an edit must hold a single element, got %d", len(cn.Children))
+			}
+			value := cn.Children[0]
+			edit.value = func(at *ErrorPath, find nodeFinder) (*yang.Entry, interface{}, error) {
+				return schema.decodeXMLNode(req, value, at, find)
+			}
+		default:
+			return nil, malformed("unknown element %q in edit", cn.Name.Local)
+		}
+	}
+	return edit, nil
+}
+
+// patchEdit resolves the edit of a YANG patch of the resource base, nil for
+// the datastore, and checks that the user of req may apply it.
+func (restconf *RestConf) patchEdit(req *http.Request, schema *Schema, base *Resource, edit *yangPatchEdit) (*patchEdit, error) {
+	op := edit.operation
+	if _, ok := patchMethods[op]; !ok {
+		return nil, invalidValue("invalid operation %q of edit %s", op, edit.id)
+	}
+
+	segs, err := ParsePath(edit.target)
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		segs = append(base.Segments[:len(base.Segments):len(base.Segments)], segs...)
+	}
+	if len(segs) == 0 {
+		return nil, invalidValue("edit %s targets the datastore, it must target a data node", edit.id)
+	}
+	target, err := schema.Resolve(segs)
+	if err != nil {
+		return nil, err
+	}
+	e := target.Entry()
+	switch {
+	case isAction(e):
+		return nil, invalidValue("%s is an action, it cannot be edited", e.Name)
+	case e.ReadOnly():
+		return nil, stateWrite(req, e)
+	case e.IsList() && target.Segment().Keys == nil:
+		return nil, invalidValue("list %s can only be edited by entry", e.Name)
+	}
+
+	pe := &patchEdit{operation: op, target: target}
+	switch op {
+	case PATCH_CREATE, PATCH_INSERT, PATCH_MERGE, PATCH_REPLACE:
+		if edit.value == nil {
+			return nil, missingElement("the %s edit %s has no value", op, edit.id)
+		}
+		if pe.value, err = schema.patchValue(target, op, edit); err != nil {
+			return nil, err
+		}
+	default:
+		if edit.value != nil {
+			return nil, invalidValue("the %s edit %s cannot have a value", op, edit.id)
+		}
+	}
+
+	switch op {
+	case PATCH_INSERT, PATCH_MOVE:
+		if pe.ins, err = schema.patchInsertion(target, base, edit); err != nil {
+			return nil, err
+		}
+	default:
+		if edit.where != "" || edit.point != "" {
+			return nil, invalidValue("where and point are only allowed with the %s and %s operations", PATCH_INSERT, PATCH_MOVE)
+		}
+	}
+
+	access := ACCESS_UPDATE
+	switch {
+	case op == PATCH_CREATE || op == PATCH_INSERT:
+		access = ACCESS_CREATE
+	case op == PATCH_DELETE || op == PATCH_REMOVE:
+		access = ACCESS_DELETE
+	case op != PATCH_MOVE && !restconf.store.Exists(target):
+		access = ACCESS_CREATE
+	}
+	if !restconf.permitTree(req, access, e, pe.value) {
+		return nil, accessDenied(access, e)
+	}
+
+	if pe.value != nil {
+		if err := restconf.foreignInstances(schema, target, pe.value); err != nil {
+			return nil, err
+		}
+	}
+	return pe, nil
+}
+
+// patchValue decodes the value of the edit of target, which must hold the
+// node of target, a single entry with its keys for a list entry or
+// leaf-list value.
+func (schema *Schema) patchValue(target *Resource, op string, edit *yangPatchEdit) (interface{}, error) {
+	e := target.Entry()
+	_, value, err := edit.value(schema.resourcePath(target.Parent()), func(mod, name string) *yang.Entry {
+		if name == e.Name && mod == schema.ModuleOf(e) {
+			return e
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if op != PATCH_MERGE && hasRemoval(e, value) {
+		return nil, invalidValue("null members remove data and are only allowed with the %s operation", PATCH_MERGE)
+	}
+
+	keys := target.Segment().Keys
+	if keys == nil {
+		return value, nil
+	}
+	values, _ := value.([]interface{})
+	if len(values) != 1 {
+		return nil, invalidValue("expected a single %s entry, got %d", e.Name, len(values))
+	}
+	if err := matchKeys(e, values[0], keys); err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// patchInsertion returns the position the where and point of the insert or
+// move edit of target place it at. The point is relative to the resource
+// base, like the target.
+func (schema *Schema) patchInsertion(target, base *Resource, edit *yangPatchEdit) (*insertion, error) {
+	e := target.Entry()
+	if !orderedByUser(e) || target.Segment().Keys == nil {
+		return nil, invalidValue("%s is not an entry of a list ordered-by user", e.Name)
+	}
+
+	ins := &insertion{where: edit.where}
+	if ins.where == "" {
+		ins.where = INSERT_LAST
+	}
+	switch ins.where {
+	case INSERT_FIRST, INSERT_LAST:
+		if edit.point != "" {
+			return nil, invalidValue("the point of edit %s is only allowed where it is %s or %s", edit.id, INSERT_BEFORE, INSERT_AFTER)
+		}
+		return ins, nil
+	case INSERT_BEFORE, INSERT_AFTER:
+		if edit.point == "" {
+			return nil, missingElement("edit %s placing %s %s a point has no point", edit.id, e.Name, ins.where)
+		}
+	default:
+		return nil, invalidValue("invalid where %q of edit %s", ins.where, edit.id)
+	}
+
+	var err error
+	ins.point, err = schema.insertPoint(target, base, edit.point, "point")
+	return ins, err
+}
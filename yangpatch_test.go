@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// yangPatch returns the JSON YANG patch patch-id holding the edits.
+func yangPatch(id string, edits ...string) string {
+	return `{"ietf-yang-patch:yang-patch":{"patch-id":"` + id + `","edit":[` + strings.Join(edits, ",") + `]}}`
+}
+
+func TestYangPatchInsert(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"ord": orderedModuleText}))
+
+	steps := []struct {
+		url, body string
+		status    int
+		want      string
+	}{
+		// The points are entries the earlier edits of the patch created.
+		{"/restconf/data/ord:system", yangPatch("p1",
+			`{"edit-id":"1","operation":"insert","target":"/dns=b","value":{"ord:dns":["b"]}}`,
+			`{"edit-id":"2","operation":"insert","target":"/dns=a","where":"before","point":"/dns=b","value":{"ord:dns":["a"]}}`,
+			`{"edit-id":"3","operation":"insert","target":"/dns=c","where":"after","point":"/dns=a","value":{"ord:dns":["c"]}}`,
+			`{"edit-id":"4","operation":"move","target":"/dns=b","where":"first"}`),
+			http.StatusOK, `{"ietf-yang-patch:yang-patch-status":{"patch-id":"p1","ok":[null]}}`},
+		{"/restconf/data", yangPatch("p2",
+			`{"edit-id":"1","operation":"create","target":"/ord:system/route=y","value":{"ord:route":[{"dest":"y"}]}}`,
+			`{"edit-id":"2","operation":"insert","target":"/ord:system/route=x","where":"before","point":"/ord:system/route=y","value":{"ord:route":[{"dest":"x"}]}}`,
+			`{"edit-id":"3","operation":"move","target":"/ord:system/dns=c","where":"after","point":"/ord:system/dns=a"}`),
+			http.StatusOK, ""},
+
+		// A failing edit abandons the whole patch.
+		{"/restconf/data/ord:system", yangPatch("p3",
+			`{"edit-id":"1","operation":"insert","target":"/dns=d","value":{"ord:dns":["d"]}}`,
+			`{"edit-id":"2","operation":"insert","target":"/dns=e","where":"before","point":"/dns=q","value":{"ord:dns":["e"]}}`),
+			http.StatusBadRequest, `"edit-status":{"edit":[{"edit-id":"2","errors"`},
+		// The point removed by an earlier edit no longer exists.
+		{"/restconf/data/ord:system", yangPatch("p4",
+			`{"edit-id":"1","operation":"delete","target":"/dns=a"}`,
+			`{"edit-id":"2","operation":"insert","target":"/dns=e","where":"after","point":"/dns=a","value":{"ord:dns":["e"]}}`),
+			http.StatusBadRequest, `"edit-id":"2"`},
+		{"/restconf/data/ord:system", yangPatch("p5",
+			`{"edit-id":"1","operation":"move","target":"/dns=a","where":"before","point":"/dns=a"}`),
+			http.StatusBadRequest, `"edit-id":"1"`},
+		{"/restconf/data/ord:system", yangPatch("p6",
+			`{"edit-id":"1","operation":"insert","target":"/dns=e","where":"before","value":{"ord:dns":["e"]}}`),
+			http.StatusBadRequest, `"error-tag":"missing-element"`},
+		{"/restconf/data/ord:system", yangPatch("p7",
+			`{"edit-id":"1","operation":"insert","target":"/dns=e","point":"/route=x","where":"after","value":{"ord:dns":["e"]}}`),
+			http.StatusBadRequest, `"error-tag":"invalid-value"`},
+		{"/restconf/data/ord:system", yangPatch("p8",
+			`{"edit-id":"1","operation":"insert","target":"/tag=e","value":{"ord:tag":["e"]}}`),
+			http.StatusBadRequest, `is not an entry of a list ordered-by user`},
+		{"/restconf/data/ord:system", yangPatch("p9",
+			`{"edit-id":"1","operation":"create","target":"/dns=e","where":"first","value":{"ord:dns":["e"]}}`),
+			http.StatusBadRequest, `where and point are only allowed`},
+		{"/restconf/data/ord:system", yangPatch("p10",
+			`{"edit-id":"1","operation":"move","target":"/dns=q","where":"first"}`),
+			http.StatusNotFound, `"error-tag":"data-missing"`},
+		{"/restconf/data/ord:system", yangPatch("p11",
+			`{"edit-id":"1","operation":"insert","target":"/dns=a","where":"last","value":{"ord:dns":["a"]}}`),
+			http.StatusConflict, `"error-tag":"data-exists"`},
+
+		{"/restconf/data/ord:system/dns", "", http.StatusOK, `{"ord:dns":["b","a","c"]}`},
+		{"/restconf/data/ord:system/route", "", http.StatusOK, `{"ord:route":[{"dest":"x"},{"dest":"y"}]}`},
+	}
+	for _, step := range steps {
+		method, ctype := "PATCH", APPLICATION_YANG_PATCH_JSON
+		if step.body == "" {
+			method, ctype = "GET", ""
+		}
+		rsp := doRequest(server, method, step.url, ctype, step.body)
+		if rsp.Code != step.status {
+			t.Fatalf("%s %s %s: got status %d, want %d: %s", method, step.url, step.body, rsp.Code, step.status, rsp.Body)
+		}
+		if step.want != "" && !strings.Contains(rsp.Body.String(), step.want) {
+			t.Errorf("%s %s %s: got %s, want %s", method, step.url, step.body, rsp.Body, step.want)
+		}
+	}
+}
+
+func TestYangPatchOperations(t *testing.T) {
+	server := testServer(t)
+
+	rsp := doRequest(server, "PATCH", "/restconf/data", APPLICATION_YANG_PATCH_JSON, yangPatch("setup",
+		`{"edit-id":"1","operation":"create","target":"/test:system/hostname","value":{"test:hostname":"a"}}`,
+		`{"edit-id":"2","operation":"merge","target":"/test:system","value":{"test:system":{"hostname":"b"}}}`,
+		`{"edit-id":"3","operation":"remove","target":"/test:system/ratio"}`))
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("PATCH: got status %d: %s", rsp.Code, rsp.Body)
+	}
+	if rsp := doRequest(server, "GET", "/restconf/data/test:system/hostname", "", ""); rsp.Body.String() != `{"test:hostname":"b"}` {
+		t.Errorf("GET hostname: got %s", rsp.Body)
+	}
+
+	for _, test := range []struct {
+		edit   string
+		status int
+	}{
+		{`{"edit-id":"1","operation":"create","target":"/test:system/hostname","value":{"test:hostname":"c"}}`, http.StatusConflict},
+		{`{"edit-id":"1","operation":"delete","target":"/test:system/ratio"}`, http.StatusNotFound},
+		{`{"edit-id":"1","operation":"replace","target":"/test:system/hostname"}`, http.StatusBadRequest},
+		{`{"edit-id":"1","operation":"delete","target":"/test:system/hostname","value":{"test:hostname":"c"}}`, http.StatusBadRequest},
+		{`{"edit-id":"1","operation":"replace","target":"/test:system/hostname","value":{"test:ratio":"1.0"}}`, http.StatusBadRequest},
+		{`{"edit-id":"1","operation":"rename","target":"/test:system/hostname"}`, http.StatusBadRequest},
+		{`{"edit-id":"1","operation":"replace","target":"/test:system/uptime","value":{"test:uptime":10}}`, http.StatusMethodNotAllowed},
+		{`{"edit-id":"1","operation":"remove","target":"/"}`, http.StatusBadRequest},
+	} {
+		rsp := doRequest(server, "PATCH", "/restconf/data", APPLICATION_YANG_PATCH_JSON, yangPatch("p", test.edit))
+		if rsp.Code != test.status || !strings.Contains(rsp.Body.String(), `"edit-status"`) {
+			t.Errorf("edit %s: got status %d, want %d with an edit-status: %s", test.edit, rsp.Code, test.status, rsp.Body)
+		}
+	}
+
+	// Malformed patches fail as a whole.
+	for _, body := range []string{
+		`{"ietf-yang-patch:yang-patch":{"edit":[]}}`,
+		yangPatch("p", `{"operation":"remove","target":"/test:system"}`),
+		yangPatch("p", `{"edit-id":"1","operation":"remove","target":"/test:system"}`, `{"edit-id":"1","operation":"remove","target":"/test:system"}`),
+		`{"test:system":{}}`,
+	} {
+		if rsp := doRequest(server, "PATCH", "/restconf/data", APPLICATION_YANG_PATCH_JSON, body); rsp.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d: %s", body, rsp.Code, http.StatusBadRequest, rsp.Body)
+		}
+	}
+
+	// The datastore is only patched with YANG patches.
+	rsp = doRequest(server, "PATCH", "/restconf/data", APPLICATION_DATA_JSON, `{"test:system":{}}`)
+	if rsp.Code != http.StatusUnsupportedMediaType || rsp.Header().Get("Accept-Patch") != "application/yang-patch+json, application/yang-patch+xml" {
+		t.Errorf("plain PATCH of the datastore: got status %d, Accept-Patch %q", rsp.Code, rsp.Header().Get("Accept-Patch"))
+	}
+}
+
+func TestYangPatchXML(t *testing.T) {
+	server := NewRestConf(testSchema(t, map[string]string{"ord": orderedModuleText}))
+
+	body := `<yang-patch xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-patch"><patch-id>x</patch-id>` +
+		`<edit><edit-id>1</edit-id><operation>insert</operation><target>/dns=b</target>` +
+		`<value><dns xmlns="urn:ord">b</dns></value></edit>` +
+		`<edit><edit-id>2</edit-id><operation>insert</operation><target>/dns=a</target><where>before</where><point>/dns=b</point>` +
+		`<value><dns xmlns="urn:ord">a</dns></value></edit></yang-patch>`
+	req := httptest.NewRequest("PATCH", "/restconf/data/ord:system", strings.NewReader(body))
+	req.Header.Set("Content-Type", APPLICATION_YANG_PATCH_XML)
+	req.Header.Set("Accept", APPLICATION_DATA_XML)
+	rsp := httptest.NewRecorder()
+	server.ServeHTTP(rsp, req)
+	want := `<yang-patch-status xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-patch"><patch-id>x</patch-id><ok></ok></yang-patch-status>`
+	if rsp.Code != http.StatusOK || rsp.Body.String() != want {
+		t.Fatalf("got status %d body %s, want %s", rsp.Code, rsp.Body, want)
+	}
+	if rsp := doRequest(server, "GET", "/restconf/data/ord:system/dns", "", ""); rsp.Body.String() != `{"ord:dns":["a","b"]}` {
+		t.Errorf("GET dns: got %s", rsp.Body)
+	}
+}